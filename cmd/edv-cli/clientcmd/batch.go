@@ -0,0 +1,89 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	batchFileFlagName  = "batch-file"
+	batchFileFlagUsage = "JSON file with the batch: an array of operations with an operation (upsert or delete) and " +
+		"either the document to upsert or the ID of the document to delete."
+)
+
+// GetBatchCmd returns the Cobra batch command.
+func GetBatchCmd() *cobra.Command {
+	batchCmd := &cobra.Command{
+		Use:   "batch",
+		Short: "Run a batch of operations in a data vault",
+		Long: "Run a batch of upsert and delete operations from a JSON file in a data vault. The output has the " +
+			"result of each operation: the location of upserted documents, an empty result for deleted documents " +
+			"or an error message. Requires the EDV server to have the Batch extension enabled.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, err := getRequiredFlag(cmd, vaultIDFlagName)
+			if err != nil {
+				return err
+			}
+
+			batchFile, err := getRequiredFlag(cmd, batchFileFlagName)
+			if err != nil {
+				return err
+			}
+
+			var batch models.Batch
+
+			if err = readJSONFile(batchFile, &batch); err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			results, err := params.client.Batch(vaultID, &batch, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to run batch in vault %s: %w", vaultID, err)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, results, batchTable(batch, results))
+		},
+	}
+
+	createCommonFlags(batchCmd)
+
+	batchCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	batchCmd.Flags().StringP(batchFileFlagName, "", "", batchFileFlagUsage)
+
+	return batchCmd
+}
+
+// batchTable returns a table with the operations of a batch and their results.
+func batchTable(batch models.Batch, results []string) *table {
+	t := &table{header: []string{"OPERATION", "DOCUMENT ID", "RESULT"}}
+
+	for i, operation := range batch {
+		docID := operation.DocumentID
+		if operation.Operation == models.UpsertDocumentVaultOperation {
+			docID = operation.EncryptedDocument.ID
+		}
+
+		var result string
+		if i < len(results) {
+			result = results[i]
+		}
+
+		t.rows = append(t.rows, []string{operation.Operation, docID, result})
+	}
+
+	return t
+}
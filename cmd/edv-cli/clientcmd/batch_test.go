@@ -0,0 +1,86 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestBatchCmd(t *testing.T) {
+	edvURL := startEDVServer(t)
+	locationPrefix := strings.TrimPrefix(edvURL, "http://")
+	dir := t.TempDir()
+
+	vaultID := createTestVault(t, edvURL)
+
+	docID1, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	docID2, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	batchFile := writeJSONFile(t, dir, "batch.json", models.Batch{
+		{
+			Operation:         models.UpsertDocumentVaultOperation,
+			EncryptedDocument: models.EncryptedDocument{ID: docID1, JWE: []byte(testJWE1)},
+		},
+		{
+			Operation:         models.UpsertDocumentVaultOperation,
+			EncryptedDocument: models.EncryptedDocument{ID: docID2, JWE: []byte(testJWE1)},
+		},
+		{Operation: models.DeleteDocumentVaultOperation, DocumentID: docID2},
+	})
+
+	t.Run("success", func(t *testing.T) {
+		out, err := runCmd(GetBatchCmd(), "--edv-url", edvURL, "--vault-id", vaultID, "--batch-file", batchFile)
+		require.NoError(t, err)
+
+		var results []string
+
+		require.NoError(t, json.Unmarshal([]byte(out), &results))
+		require.Equal(t, []string{
+			locationPrefix + "/" + vaultID + "/documents/" + docID1,
+			locationPrefix + "/" + vaultID + "/documents/" + docID2,
+			"",
+		}, results)
+	})
+
+	t.Run("success with table output", func(t *testing.T) {
+		out, err := runCmd(GetBatchCmd(), "--edv-url", edvURL, "--vault-id", vaultID, "--batch-file", batchFile,
+			"-o", "table")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 4)
+		require.Equal(t, []string{"OPERATION", "DOCUMENT", "ID", "RESULT"}, strings.Fields(lines[0]))
+		require.Equal(t, []string{"upsert", docID1, locationPrefix + "/" + vaultID + "/documents/" + docID1},
+			strings.Fields(lines[1]))
+		require.Equal(t, []string{"delete", docID2}, strings.Fields(lines[3]))
+	})
+
+	t.Run("invalid batch", func(t *testing.T) {
+		_, err := runCmd(GetBatchCmd(), "--edv-url", edvURL, "--vault-id", vaultID, "--batch-file",
+			writeJSONFile(t, dir, "invalid.json", models.Batch{{Operation: "read"}}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to run batch in vault "+vaultID)
+	})
+
+	t.Run("missing flags", func(t *testing.T) {
+		_, err := runCmd(GetBatchCmd(), "--edv-url", edvURL, "--vault-id", vaultID)
+		require.EqualError(t, err, "batch-file must be set")
+
+		_, err = runCmd(GetBatchCmd(), "--edv-url", edvURL, "--batch-file", batchFile)
+		require.EqualError(t, err, "vault-id must be set")
+	})
+}
@@ -0,0 +1,340 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/client"
+)
+
+const (
+	commonEnvVarUsageText = "Alternatively, this can be set with the following environment variable: "
+
+	edvURLFlagName  = "edv-url"
+	edvURLEnvKey    = "EDV_CLI_URL"
+	edvURLFlagUsage = "URL of the encrypted data vaults endpoint of the EDV server, " +
+		"e.g. https://edv.example.com/encrypted-data-vaults. " + commonEnvVarUsageText + edvURLEnvKey
+
+	tlsCACertsFlagName  = "tls-cacerts"
+	tlsCACertsEnvKey    = "EDV_CLI_TLS_CACERTS"
+	tlsCACertsFlagUsage = "PEM file with CA certificates that the server certificate is verified against, in " +
+		"addition to the system's. Can be repeated. " + commonEnvVarUsageText + tlsCACertsEnvKey + " (comma-separated)"
+
+	tlsCertFileFlagName  = "tls-cert-file"
+	tlsCertFileEnvKey    = "EDV_CLI_TLS_CERT_FILE"
+	tlsCertFileFlagUsage = "PEM file with the client certificate, for servers that require mutual TLS. Requires " +
+		tlsKeyFileFlagName + " to be set. " + commonEnvVarUsageText + tlsCertFileEnvKey
+
+	tlsKeyFileFlagName  = "tls-key-file"
+	tlsKeyFileEnvKey    = "EDV_CLI_TLS_KEY_FILE"
+	tlsKeyFileFlagUsage = "PEM file with the key of the client certificate. " + commonEnvVarUsageText +
+		tlsKeyFileEnvKey
+
+	headerFlagName  = "header"
+	headerEnvKey    = "EDV_CLI_HEADERS"
+	headerFlagUsage = `Header to add to requests, in the "Name: value" format. Can be repeated, ` +
+		`e.g. --header "Authorization: Bearer <token>". ` + commonEnvVarUsageText + headerEnvKey +
+		" (comma-separated)"
+
+	timeoutFlagName  = "timeout"
+	timeoutEnvKey    = "EDV_CLI_TIMEOUT"
+	timeoutFlagUsage = "Time limit for requests, e.g. 30s. No limit if not set. " + commonEnvVarUsageText +
+		timeoutEnvKey
+
+	zcapKeyIDFlagName  = "zcap-key-id"
+	zcapKeyIDEnvKey    = "EDV_CLI_ZCAP_KEY_ID"
+	zcapKeyIDFlagUsage = "DID URL of the key that requests are signed with, for servers with zcap authorization " +
+		"(e.g. did:key:z6Mk...#z6Mk...). Requires " + zcapPrivateKeyFileFlagName + " to be set. " +
+		commonEnvVarUsageText + zcapKeyIDEnvKey
+
+	zcapPrivateKeyFileFlagName  = "zcap-private-key-file"
+	zcapPrivateKeyFileEnvKey    = "EDV_CLI_ZCAP_PRIVATE_KEY_FILE" //nolint: gosec
+	zcapPrivateKeyFileFlagUsage = "PEM file with the Ed25519 private key (PKCS #8) of " + zcapKeyIDFlagName + ". " +
+		commonEnvVarUsageText + zcapPrivateKeyFileEnvKey
+
+	zcapCapabilityFileFlagName  = "zcap-capability-file"
+	zcapCapabilityFileEnvKey    = "EDV_CLI_ZCAP_CAPABILITY_FILE"
+	zcapCapabilityFileFlagUsage = "JSON file with the capability to invoke with requests to the vault, " +
+		"such as the one output by vault create. Requires " + zcapKeyIDFlagName + " to be set. " +
+		commonEnvVarUsageText + zcapCapabilityFileEnvKey
+
+	outputFlagName  = "output"
+	outputEnvKey    = "EDV_CLI_OUTPUT"
+	outputFlagUsage = "Output format. Supported options: " + jsonOutput + ", " + tableOutput + ". Defaults to " +
+		jsonOutput + " if not set. " + commonEnvVarUsageText + outputEnvKey
+
+	vaultIDFlagName  = "vault-id"
+	vaultIDFlagUsage = "ID of the vault."
+
+	jsonOutput  = "json"
+	tableOutput = "table"
+)
+
+// clientParameters are the parameters that all commands share.
+type clientParameters struct {
+	client  *client.Client
+	reqOpts []client.ReqOption
+	output  string
+}
+
+func createCommonFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP(edvURLFlagName, "", "", edvURLFlagUsage)
+	cmd.PersistentFlags().StringArrayP(tlsCACertsFlagName, "", []string{}, tlsCACertsFlagUsage)
+	cmd.PersistentFlags().StringP(tlsCertFileFlagName, "", "", tlsCertFileFlagUsage)
+	cmd.PersistentFlags().StringP(tlsKeyFileFlagName, "", "", tlsKeyFileFlagUsage)
+	cmd.PersistentFlags().StringArrayP(headerFlagName, "", []string{}, headerFlagUsage)
+	cmd.PersistentFlags().StringP(timeoutFlagName, "", "", timeoutFlagUsage)
+	cmd.PersistentFlags().StringP(zcapKeyIDFlagName, "", "", zcapKeyIDFlagUsage)
+	cmd.PersistentFlags().StringP(zcapPrivateKeyFileFlagName, "", "", zcapPrivateKeyFileFlagUsage)
+	cmd.PersistentFlags().StringP(zcapCapabilityFileFlagName, "", "", zcapCapabilityFileFlagUsage)
+	cmd.PersistentFlags().StringP(outputFlagName, "o", "", outputFlagUsage)
+}
+
+// getClientParameters returns the client configured with the common flags of cmd.
+func getClientParameters(cmd *cobra.Command) (*clientParameters, error) {
+	edvURL, err := cmdutils.GetUserSetVarFromString(cmd, edvURLFlagName, edvURLEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := getOutput(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := getTLSConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []client.Option{client.WithTLSConfig(tlsConfig)}
+
+	headers, err := getHeaders(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(headers) > 0 {
+		opts = append(opts, client.WithHeaders(func(req *http.Request) (*http.Header, error) {
+			for name, values := range headers {
+				req.Header[name] = values
+			}
+
+			return &req.Header, nil
+		}))
+	}
+
+	timeout := cmdutils.GetUserSetOptionalVarFromString(cmd, timeoutFlagName, timeoutEnvKey)
+	if timeout != "" {
+		t, errParse := time.ParseDuration(timeout)
+		if errParse != nil {
+			return nil, fmt.Errorf("invalid %s: %w", timeoutFlagName, errParse)
+		}
+
+		opts = append(opts, client.WithTimeout(t))
+	}
+
+	zcapOpts, reqOpts, err := getZCAPOptions(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientParameters{
+		client:  client.New(strings.TrimSuffix(edvURL, "/"), append(opts, zcapOpts...)...),
+		reqOpts: reqOpts,
+		output:  output,
+	}, nil
+}
+
+func getOutput(cmd *cobra.Command) (string, error) {
+	output := cmdutils.GetUserSetOptionalVarFromString(cmd, outputFlagName, outputEnvKey)
+
+	switch output {
+	case "":
+		return jsonOutput, nil
+	case jsonOutput, tableOutput:
+		return output, nil
+	default:
+		return "", fmt.Errorf("unsupported %s: %s", outputFlagName, output)
+	}
+}
+
+func getTLSConfig(cmd *cobra.Command) (*tls.Config, error) {
+	rootCAs, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load system cert pool: %w", err)
+	}
+
+	for _, caCert := range cmdutils.GetUserSetOptionalVarFromArrayString(cmd, tlsCACertsFlagName, tlsCACertsEnvKey) {
+		pemBytes, errRead := ioutil.ReadFile(caCert) //nolint: gosec
+		if errRead != nil {
+			return nil, fmt.Errorf("failed to read CA certificates from %s: %w", caCert, errRead)
+		}
+
+		if !rootCAs.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no CA certificates found in %s", caCert)
+		}
+	}
+
+	config := &tls.Config{RootCAs: rootCAs, MinVersion: tls.VersionTLS12}
+
+	certFile := cmdutils.GetUserSetOptionalVarFromString(cmd, tlsCertFileFlagName, tlsCertFileEnvKey)
+	keyFile := cmdutils.GetUserSetOptionalVarFromString(cmd, tlsKeyFileFlagName, tlsKeyFileEnvKey)
+
+	if certFile == "" && keyFile == "" {
+		return config, nil
+	}
+
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("%s and %s must be set together", tlsCertFileFlagName, tlsKeyFileFlagName)
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+
+	config.Certificates = []tls.Certificate{cert}
+
+	return config, nil
+}
+
+// getHeaders returns the headers set with the header flag.
+func getHeaders(cmd *cobra.Command) (http.Header, error) {
+	headers := http.Header{}
+
+	for _, header := range cmdutils.GetUserSetOptionalVarFromArrayString(cmd, headerFlagName, headerEnvKey) {
+		parts := strings.SplitN(header, ":", 2) //nolint: gomnd
+
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" { //nolint: gomnd
+			return nil, fmt.Errorf(`invalid %s %q: the format is "Name: value"`, headerFlagName, header)
+		}
+
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return headers, nil
+}
+
+// getZCAPOptions returns the options for signing requests with the zcap key and invoking the zcap capability.
+func getZCAPOptions(cmd *cobra.Command) ([]client.Option, []client.ReqOption, error) {
+	keyID := cmdutils.GetUserSetOptionalVarFromString(cmd, zcapKeyIDFlagName, zcapKeyIDEnvKey)
+	privateKeyFile := cmdutils.GetUserSetOptionalVarFromString(cmd, zcapPrivateKeyFileFlagName,
+		zcapPrivateKeyFileEnvKey)
+	capabilityFile := cmdutils.GetUserSetOptionalVarFromString(cmd, zcapCapabilityFileFlagName,
+		zcapCapabilityFileEnvKey)
+
+	if keyID == "" && privateKeyFile == "" {
+		if capabilityFile != "" {
+			return nil, nil, fmt.Errorf("%s requires %s to be set", zcapCapabilityFileFlagName, zcapKeyIDFlagName)
+		}
+
+		return nil, nil, nil
+	}
+
+	if keyID == "" || privateKeyFile == "" {
+		return nil, nil, fmt.Errorf("%s and %s must be set together", zcapKeyIDFlagName, zcapPrivateKeyFileFlagName)
+	}
+
+	privateKey, err := readPrivateKey(privateKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := []client.Option{client.WithCapabilityInvoker(keyID, &ed25519Signer{privateKey: privateKey})}
+
+	if capabilityFile == "" {
+		return opts, nil, nil
+	}
+
+	capabilityBytes, err := ioutil.ReadFile(capabilityFile) //nolint: gosec
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read capability from %s: %w", capabilityFile, err)
+	}
+
+	capability, err := zcapld.ParseCapability(capabilityBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse capability from %s: %w", capabilityFile, err)
+	}
+
+	return opts, []client.ReqOption{client.WithCapability(capability)}, nil
+}
+
+func readPrivateKey(privateKeyFile string) (ed25519.PrivateKey, error) {
+	pemBytes, err := ioutil.ReadFile(privateKeyFile) //nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key from %s: %w", privateKeyFile, err)
+	}
+
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", privateKeyFile)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key from %s: %w", privateKeyFile, err)
+	}
+
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s isn't an Ed25519 key", privateKeyFile)
+	}
+
+	return privateKey, nil
+}
+
+type ed25519Signer struct {
+	privateKey ed25519.PrivateKey
+}
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.privateKey, data), nil
+}
+
+// readJSONFile unmarshals the JSON in the given file into v.
+func readJSONFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path) //nolint: gosec
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// getRequiredFlag returns the value of a command-specific flag that must be set.
+func getRequiredFlag(cmd *cobra.Command, flagName string) (string, error) {
+	value, err := cmd.Flags().GetString(flagName)
+	if err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		return "", errors.New(flagName + " must be set")
+	}
+
+	return value, nil
+}
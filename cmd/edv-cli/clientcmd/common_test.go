@@ -0,0 +1,306 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/restapi"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+const (
+	testJWE1 = `{"protected":"eyJlbmMiOiJDMjBQIn0","recipients":[{"header":{"alg":"A256KW","kid":"https://exam` +
+		`ple.com/kms/z7BgF536GaR"},"encrypted_key":"OR1vdCNvf_B68mfUxFQVT-vyXVrBembuiM40mAAjDC1-Qu5iArDbug"}],` +
+		`"iv":"i8Nins2vTI3PlrYW","ciphertext":"Cb-963UCXblINT8F6MDHzMJN9EAhK3I","tag":"pfZO0JulJcrc3trOZy8rjA"}`
+	testJWE2 = `{"protected":"eyJlbmMiOiJDMjBQIn0","recipients":[{"header":{"alg":"A256KW","kid":"https://exam` +
+		`ple.com/kms/z7BgF536GaR"},"encrypted_key":"OR1vdCNvf_B68mfUxFQVT-vyXVrBembuiM40mAAjDC1-Qu5iArDbug"}],` +
+		`"iv":"i8Nins2vTI3PlrYW","ciphertext":"Lm-NLuqY4JkN4cABuaWFQeBuPmT0Hnk","tag":"pfZO0JulJcrc3trOZy8rjA"}`
+)
+
+func TestCommonFlags(t *testing.T) {
+	t.Run("EDV URL not set", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "read", "--vault-id", "vault1", "--document-id", "doc1")
+		require.EqualError(t, err, "Neither edv-url (command line flag) nor EDV_CLI_URL (environment variable) "+
+			"have been set.")
+	})
+
+	t.Run("EDV URL set with environment variable", func(t *testing.T) {
+		srv := startMockServer(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+
+		require.NoError(t, os.Setenv(edvURLEnvKey, srv.URL))
+		defer func() { require.NoError(t, os.Unsetenv(edvURLEnvKey)) }()
+
+		_, err := runCmd(GetDocumentCmd(), "delete", "--vault-id", "vault1", "--document-id", "doc1")
+		require.NoError(t, err)
+	})
+
+	t.Run("unsupported output", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "read", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--output", "yaml")
+		require.EqualError(t, err, "unsupported output: yaml")
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "read", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--timeout", "soon")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid timeout")
+	})
+
+	t.Run("headers are added to requests", func(t *testing.T) {
+		var authorization, user []string
+
+		srv := startMockServer(t, func(rw http.ResponseWriter, req *http.Request) {
+			authorization = req.Header.Values("Authorization")
+			user = req.Header.Values("X-User")
+		})
+
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--header", "Authorization: Bearer token", "--header", "X-User:user1",
+			"--header", "X-User: user2")
+		require.NoError(t, err)
+		require.Equal(t, []string{"Bearer token"}, authorization)
+		require.Equal(t, []string{"user1", "user2"}, user)
+	})
+
+	t.Run("invalid header", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--header", "Authorization")
+		require.EqualError(t, err, `invalid header "Authorization": the format is "Name: value"`)
+	})
+}
+
+func TestTLSFlags(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	t.Run("server certificate verified with CA certificates", func(t *testing.T) {
+		caCertFile := writeFile(t, dir, "ca.pem", pem.EncodeToMemory(&pem.Block{
+			Type: "CERTIFICATE", Bytes: srv.Certificate().Raw,
+		}))
+
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--tls-cacerts", caCertFile)
+		require.NoError(t, err)
+	})
+
+	t.Run("server certificate not trusted", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "certificate")
+	})
+
+	t.Run("CA certificates file not found", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--tls-cacerts", filepath.Join(dir, "missing.pem"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read CA certificates")
+	})
+
+	t.Run("no CA certificates in file", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--tls-cacerts", writeFile(t, dir, "empty.pem", []byte("empty")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "no CA certificates found")
+	})
+
+	t.Run("client certificate without key", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--tls-cert-file", filepath.Join(dir, "cert.pem"))
+		require.EqualError(t, err, "tls-cert-file and tls-key-file must be set together")
+	})
+
+	t.Run("invalid client certificate", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--tls-cert-file", filepath.Join(dir, "cert.pem"),
+			"--tls-key-file", filepath.Join(dir, "key.pem"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to load client certificate")
+	})
+}
+
+func TestZCAPFlags(t *testing.T) {
+	_, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	privKeyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	privKeyFile := writeFile(t, dir, "key.pem", pem.EncodeToMemory(&pem.Block{
+		Type: "PRIVATE KEY", Bytes: privKeyBytes,
+	}))
+
+	capabilityFile := writeFile(t, dir, "capability.json",
+		[]byte(`{"id":"urn:uuid:capability1","invoker":"did:example:123#key-1"}`))
+
+	t.Run("requests are signed and invoke the capability", func(t *testing.T) {
+		var signature, invocation string
+
+		srv := startMockServer(t, func(rw http.ResponseWriter, req *http.Request) {
+			signature = req.Header.Get("Signature")
+			invocation = req.Header.Get("Capability-Invocation")
+		})
+
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", srv.URL, "--vault-id", "vault1",
+			"--document-id", "doc1", "--zcap-key-id", "did:example:123#key-1",
+			"--zcap-private-key-file", privKeyFile, "--zcap-capability-file", capabilityFile)
+		require.NoError(t, err)
+		require.Contains(t, signature, `keyId="did:example:123#key-1"`)
+		require.Contains(t, signature, "capability-invocation")
+		require.True(t, strings.HasPrefix(invocation, "zcap capability="))
+		require.True(t, strings.HasSuffix(invocation, `action="write"`))
+	})
+
+	t.Run("key ID without private key", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--zcap-key-id", "did:example:123#key-1")
+		require.EqualError(t, err, "zcap-key-id and zcap-private-key-file must be set together")
+	})
+
+	t.Run("capability without key", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--zcap-capability-file", capabilityFile)
+		require.EqualError(t, err, "zcap-capability-file requires zcap-key-id to be set")
+	})
+
+	t.Run("invalid private key", func(t *testing.T) {
+		for name, privKeyFile := range map[string]string{
+			"failed to read private key": filepath.Join(dir, "missing.pem"),
+			"no PEM data found":          writeFile(t, dir, "notpem.pem", []byte("key")),
+			"failed to parse private key": writeFile(t, dir, "invalid.pem", pem.EncodeToMemory(&pem.Block{
+				Type: "PRIVATE KEY", Bytes: []byte("key"),
+			})),
+			"isn't an Ed25519 key": writeFile(t, dir, "ecdsa.pem", ecdsaPrivateKeyPEM(t)),
+		} {
+			_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", "https://localhost", "--vault-id", "vault1",
+				"--document-id", "doc1", "--zcap-key-id", "did:example:123#key-1",
+				"--zcap-private-key-file", privKeyFile)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), name)
+		}
+	})
+
+	t.Run("invalid capability", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", "https://localhost", "--vault-id", "vault1",
+			"--document-id", "doc1", "--zcap-key-id", "did:example:123#key-1", "--zcap-private-key-file",
+			privKeyFile, "--zcap-capability-file", writeFile(t, dir, "invalid.json", []byte("capability")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse capability")
+	})
+}
+
+// ecdsaPrivateKeyPEM returns a PEM block with a PKCS #8 ECDSA private key.
+func ecdsaPrivateKeyPEM(t *testing.T) []byte {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	privKeyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privKeyBytes})
+}
+
+// runCmd runs cmd with the given arguments and returns its output.
+func runCmd(cmd *cobra.Command, args ...string) (string, error) {
+	var out bytes.Buffer
+
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+	cmd.SetErr(ioutil.Discard)
+
+	err := cmd.Execute()
+
+	return out.String(), err
+}
+
+// startEDVServer starts an EDV server with all extensions enabled and returns its URL.
+func startEDVServer(t *testing.T) string {
+	t.Helper()
+
+	memProv := memedvprovider.NewProvider()
+	require.NoError(t, memProv.CreateStore("data_vault_configurations"))
+
+	edvService, err := restapi.New(&operation.Config{
+		Provider: memProv,
+		EnabledExtensions: &operation.EnabledExtensions{
+			ReturnFullDocumentsOnQuery: true,
+			ReadAllDocumentsEndpoint:   true,
+			Batch:                      true,
+		},
+	})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range edvService.GetOperations() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return srv.URL + "/encrypted-data-vaults"
+}
+
+func startMockServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+
+	return path
+}
+
+func writeJSONFile(t *testing.T, dir, name string, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return writeFile(t, dir, name, data)
+}
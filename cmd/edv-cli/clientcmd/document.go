@@ -0,0 +1,216 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	documentIDFlagName  = "document-id"
+	documentIDFlagUsage = "ID of the document."
+
+	documentFileFlagName  = "document-file"
+	documentFileFlagUsage = "JSON file with the encrypted document."
+)
+
+// createDocumentOutput is the output of document create.
+type createDocumentOutput struct {
+	Location string `json:"location"`
+}
+
+// GetDocumentCmd returns the Cobra document command.
+func GetDocumentCmd() *cobra.Command {
+	documentCmd := &cobra.Command{
+		Use:   "document",
+		Short: "Manage encrypted documents",
+		Long:  "Create, read, update and delete encrypted documents in a data vault",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	createCommonFlags(documentCmd)
+
+	documentCmd.AddCommand(createCreateDocumentCmd(), createReadDocumentCmd(), createUpdateDocumentCmd(),
+		createDeleteDocumentCmd())
+
+	return documentCmd
+}
+
+func createCreateDocumentCmd() *cobra.Command {
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create an encrypted document",
+		Long:  "Create an encrypted document in a data vault from a JSON file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, document, err := getVaultIDAndDocument(cmd)
+			if err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			location, err := params.client.CreateDocument(vaultID, document, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to create document in vault %s: %w", vaultID, err)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, createDocumentOutput{Location: location},
+				listTable("LOCATION", []string{location}))
+		},
+	}
+
+	createCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	createCmd.Flags().StringP(documentFileFlagName, "", "", documentFileFlagUsage)
+
+	return createCmd
+}
+
+func createReadDocumentCmd() *cobra.Command {
+	readCmd := &cobra.Command{
+		Use:   "read",
+		Short: "Read an encrypted document",
+		Long:  "Read an encrypted document from a data vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, docID, err := getVaultIDAndDocumentID(cmd)
+			if err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			document, err := params.client.ReadDocument(vaultID, docID, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to read document %s in vault %s: %w", docID, vaultID, err)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, document,
+				documentsTable([]models.EncryptedDocument{*document}))
+		},
+	}
+
+	readCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	readCmd.Flags().StringP(documentIDFlagName, "", "", documentIDFlagUsage)
+
+	return readCmd
+}
+
+func createUpdateDocumentCmd() *cobra.Command {
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update an encrypted document",
+		Long: "Update an encrypted document in a data vault from a JSON file. The document ID is taken from the " +
+			"file if " + documentIDFlagName + " isn't set.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, document, err := getVaultIDAndDocument(cmd)
+			if err != nil {
+				return err
+			}
+
+			docID, err := cmd.Flags().GetString(documentIDFlagName)
+			if err != nil {
+				return err
+			}
+
+			if docID == "" {
+				docID = document.ID
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := params.client.UpdateDocument(vaultID, docID, document, params.reqOpts...); err != nil {
+				return fmt.Errorf("failed to update document %s in vault %s: %w", docID, vaultID, err)
+			}
+
+			return nil
+		},
+	}
+
+	updateCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	updateCmd.Flags().StringP(documentIDFlagName, "", "", documentIDFlagUsage)
+	updateCmd.Flags().StringP(documentFileFlagName, "", "", documentFileFlagUsage)
+
+	return updateCmd
+}
+
+func createDeleteDocumentCmd() *cobra.Command {
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "Delete an encrypted document",
+		Long:  "Delete an encrypted document from a data vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, docID, err := getVaultIDAndDocumentID(cmd)
+			if err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := params.client.DeleteDocument(vaultID, docID, params.reqOpts...); err != nil {
+				return fmt.Errorf("failed to delete document %s in vault %s: %w", docID, vaultID, err)
+			}
+
+			return nil
+		},
+	}
+
+	deleteCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	deleteCmd.Flags().StringP(documentIDFlagName, "", "", documentIDFlagUsage)
+
+	return deleteCmd
+}
+
+func getVaultIDAndDocumentID(cmd *cobra.Command) (string, string, error) {
+	vaultID, err := getRequiredFlag(cmd, vaultIDFlagName)
+	if err != nil {
+		return "", "", err
+	}
+
+	docID, err := getRequiredFlag(cmd, documentIDFlagName)
+	if err != nil {
+		return "", "", err
+	}
+
+	return vaultID, docID, nil
+}
+
+func getVaultIDAndDocument(cmd *cobra.Command) (string, *models.EncryptedDocument, error) {
+	vaultID, err := getRequiredFlag(cmd, vaultIDFlagName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	documentFile, err := getRequiredFlag(cmd, documentFileFlagName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var document models.EncryptedDocument
+
+	if err := readJSONFile(documentFile, &document); err != nil {
+		return "", nil, err
+	}
+
+	return vaultID, &document, nil
+}
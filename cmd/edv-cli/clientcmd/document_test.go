@@ -0,0 +1,139 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestDocumentCmd(t *testing.T) {
+	edvURL := startEDVServer(t)
+	dir := t.TempDir()
+
+	vaultID := createTestVault(t, edvURL)
+
+	docID, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	document := &models.EncryptedDocument{
+		ID: docID,
+		IndexedAttributeCollections: []models.IndexedAttributeCollection{{
+			IndexedAttributes: []models.IndexedAttribute{{Name: "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ"}},
+		}},
+		JWE: []byte(testJWE1),
+	}
+
+	documentFile := writeJSONFile(t, dir, "doc.json", document)
+
+	t.Run("create", func(t *testing.T) {
+		out, err := runCmd(GetDocumentCmd(), "create", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-file", documentFile)
+		require.NoError(t, err)
+
+		var output createDocumentOutput
+
+		require.NoError(t, json.Unmarshal([]byte(out), &output))
+		require.Equal(t, strings.TrimPrefix(edvURL, "http://")+"/"+vaultID+"/documents/"+docID, output.Location)
+	})
+
+	t.Run("create duplicate document", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "create", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-file", documentFile)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, client.ErrDuplicateDocument))
+	})
+
+	t.Run("create with invalid document file", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "create", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-file", writeFile(t, dir, "invalid.json", []byte("document")))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse")
+
+		_, err = runCmd(GetDocumentCmd(), "create", "--edv-url", edvURL, "--vault-id", vaultID)
+		require.EqualError(t, err, "document-file must be set")
+	})
+
+	t.Run("read", func(t *testing.T) {
+		out, err := runCmd(GetDocumentCmd(), "read", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-id", docID)
+		require.NoError(t, err)
+
+		var readDocument models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(out), &readDocument))
+		require.Equal(t, docID, readDocument.ID)
+		require.JSONEq(t, testJWE1, string(readDocument.JWE))
+	})
+
+	t.Run("read with table output", func(t *testing.T) {
+		out, err := runCmd(GetDocumentCmd(), "read", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-id", docID, "--output", "table")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 2)
+		require.Equal(t, []string{"ID", "SEQUENCE", "INDEXED", "ATTRIBUTES"}, strings.Fields(lines[0]))
+		require.Equal(t, []string{docID, "0", "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ"}, strings.Fields(lines[1]))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		document.JWE = []byte(testJWE2)
+
+		_, err := runCmd(GetDocumentCmd(), "update", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-file", writeJSONFile(t, dir, "updated.json", document))
+		require.NoError(t, err)
+
+		out, err := runCmd(GetDocumentCmd(), "read", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-id", docID)
+		require.NoError(t, err)
+		require.Contains(t, out, "Lm-NLuqY4JkN4cABuaWFQeBuPmT0Hnk")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "delete", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-id", docID)
+		require.NoError(t, err)
+
+		_, err = runCmd(GetDocumentCmd(), "read", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--document-id", docID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read document")
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+	})
+
+	t.Run("missing flags", func(t *testing.T) {
+		_, err := runCmd(GetDocumentCmd(), "read", "--edv-url", edvURL, "--document-id", docID)
+		require.EqualError(t, err, "vault-id must be set")
+
+		_, err = runCmd(GetDocumentCmd(), "delete", "--edv-url", edvURL, "--vault-id", vaultID)
+		require.EqualError(t, err, "document-id must be set")
+	})
+}
+
+// createTestVault creates a data vault with the vault create command and returns its ID.
+func createTestVault(t *testing.T, edvURL string) string {
+	t.Helper()
+
+	out, err := runCmd(GetVaultCmd(), "create", "--edv-url", edvURL, "--config-file",
+		writeJSONFile(t, t.TempDir(), "config.json", testDataVaultConfiguration("")))
+	require.NoError(t, err)
+
+	var output createVaultOutput
+
+	require.NoError(t, json.Unmarshal([]byte(out), &output))
+
+	return output.VaultID
+}
@@ -0,0 +1,83 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// table is the table output of a command.
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// writeOutput writes v as indented JSON, or t as a table, depending on the output format.
+func writeOutput(w io.Writer, output string, v interface{}, t *table) error {
+	if output == tableOutput {
+		return writeTable(w, t)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+
+	return err
+}
+
+func writeTable(w io.Writer, t *table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint: gomnd
+
+	fmt.Fprintln(tw, strings.Join(t.header, "\t"))
+
+	for _, row := range t.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// documentsTable returns a table with the IDs, sequence numbers and indexed attribute names of documents.
+func documentsTable(documents []models.EncryptedDocument) *table {
+	t := &table{header: []string{"ID", "SEQUENCE", "INDEXED ATTRIBUTES"}}
+
+	for _, document := range documents {
+		var names []string
+
+		for _, collection := range document.IndexedAttributeCollections {
+			for _, attribute := range collection.IndexedAttributes {
+				names = append(names, attribute.Name)
+			}
+		}
+
+		t.rows = append(t.rows,
+			[]string{document.ID, strconv.FormatUint(document.Sequence, 10), strings.Join(names, ",")})
+	}
+
+	return t
+}
+
+// listTable returns a table with a single column.
+func listTable(column string, values []string) *table {
+	t := &table{header: []string{column}}
+
+	for _, value := range values {
+		t.rows = append(t.rows, []string{value})
+	}
+
+	return t
+}
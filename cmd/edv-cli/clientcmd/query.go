@@ -0,0 +1,90 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	indexNameFlagName  = "index-name"
+	indexNameFlagUsage = "Name of the encrypted index to query."
+
+	indexValueFlagName  = "index-value"
+	indexValueFlagUsage = "Value of the encrypted index to query."
+
+	fullDocumentsFlagName  = "full-documents"
+	fullDocumentsFlagUsage = "Output the full documents that match the query instead of their locations. " +
+		"Requires the EDV server to have the ReturnFullDocumentsOnQuery extension enabled."
+)
+
+// GetQueryCmd returns the Cobra query command.
+func GetQueryCmd() *cobra.Command {
+	queryCmd := &cobra.Command{
+		Use:   "query",
+		Short: "Query a data vault",
+		Long:  "Query a data vault for the documents with an encrypted index with the given name and value",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, err := getRequiredFlag(cmd, vaultIDFlagName)
+			if err != nil {
+				return err
+			}
+
+			name, err := getRequiredFlag(cmd, indexNameFlagName)
+			if err != nil {
+				return err
+			}
+
+			value, err := getRequiredFlag(cmd, indexValueFlagName)
+			if err != nil {
+				return err
+			}
+
+			fullDocuments, err := cmd.Flags().GetBool(fullDocumentsFlagName)
+			if err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			if fullDocuments {
+				documents, errQuery := params.client.QueryVaultForFullDocuments(vaultID, name, value,
+					params.reqOpts...)
+				if errQuery != nil {
+					return fmt.Errorf("failed to query vault %s: %w", vaultID, errQuery)
+				}
+
+				return writeOutput(cmd.OutOrStdout(), params.output, documents, documentsTable(documents))
+			}
+
+			locations, err := params.client.QueryVault(vaultID, name, value, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to query vault %s: %w", vaultID, err)
+			}
+
+			if locations == nil {
+				locations = []string{}
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, locations, listTable("LOCATION", locations))
+		},
+	}
+
+	createCommonFlags(queryCmd)
+
+	queryCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	queryCmd.Flags().StringP(indexNameFlagName, "", "", indexNameFlagUsage)
+	queryCmd.Flags().StringP(indexValueFlagName, "", "", indexValueFlagUsage)
+	queryCmd.Flags().BoolP(fullDocumentsFlagName, "", false, fullDocumentsFlagUsage)
+
+	return queryCmd
+}
@@ -0,0 +1,96 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestQueryCmd(t *testing.T) {
+	var query models.Query
+
+	srv := startMockServer(t, func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal(t, "/encrypted-data-vaults/vault1/query", req.URL.Path)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&query))
+
+		if query.ReturnFullDocuments {
+			require.NoError(t, json.NewEncoder(rw).Encode([]models.EncryptedDocument{{ID: "doc1", Sequence: 2}}))
+
+			return
+		}
+
+		require.NoError(t, json.NewEncoder(rw).Encode([]string{
+			"https://example.com/encrypted-data-vaults/vault1/documents/doc1",
+		}))
+	})
+
+	edvURL := srv.URL + "/encrypted-data-vaults"
+
+	t.Run("locations", func(t *testing.T) {
+		out, err := runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-name", "name1",
+			"--index-value", "value1")
+		require.NoError(t, err)
+		require.Equal(t, models.Query{Name: "name1", Value: "value1"}, query)
+
+		var locations []string
+
+		require.NoError(t, json.Unmarshal([]byte(out), &locations))
+		require.Equal(t, []string{"https://example.com/encrypted-data-vaults/vault1/documents/doc1"}, locations)
+	})
+
+	t.Run("locations with table output", func(t *testing.T) {
+		out, err := runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-name", "name1",
+			"--index-value", "value1", "--output", "table")
+		require.NoError(t, err)
+		require.Equal(t, "LOCATION\nhttps://example.com/encrypted-data-vaults/vault1/documents/doc1\n", out)
+	})
+
+	t.Run("full documents", func(t *testing.T) {
+		out, err := runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-name", "name1",
+			"--index-value", "value1", "--full-documents")
+		require.NoError(t, err)
+		require.True(t, query.ReturnFullDocuments)
+
+		var documents []models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(out), &documents))
+		require.Len(t, documents, 1)
+		require.Equal(t, "doc1", documents[0].ID)
+	})
+
+	t.Run("full documents with table output", func(t *testing.T) {
+		out, err := runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-name", "name1",
+			"--index-value", "value1", "--full-documents", "--output", "table")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 2)
+		require.Equal(t, []string{"doc1", "2"}, strings.Fields(lines[1]))
+	})
+
+	t.Run("query fails", func(t *testing.T) {
+		_, err := runCmd(GetQueryCmd(), "--edv-url", startEDVServer(t), "--vault-id", "vault1",
+			"--index-name", "name1", "--index-value", "value1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to query vault vault1")
+	})
+
+	t.Run("missing flags", func(t *testing.T) {
+		_, err := runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-value", "value1")
+		require.EqualError(t, err, "index-name must be set")
+
+		_, err = runCmd(GetQueryCmd(), "--edv-url", edvURL, "--vault-id", "vault1", "--index-name", "name1")
+		require.EqualError(t, err, "index-value must be set")
+	})
+}
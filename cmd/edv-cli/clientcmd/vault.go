@@ -0,0 +1,177 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	configFileFlagName  = "config-file"
+	configFileFlagUsage = "JSON file with the data vault configuration."
+
+	outputFileFlagName  = "output-file"
+	outputFileFlagUsage = "File to write the documents of the vault to, as a JSON array. " +
+		"The documents are written to standard output if not set."
+)
+
+// createVaultOutput is the output of vault create.
+type createVaultOutput struct {
+	VaultID    string          `json:"vaultId"`
+	Location   string          `json:"location"`
+	Capability json.RawMessage `json:"capability,omitempty"`
+}
+
+// exportVaultOutput is the output of vault export with an output file.
+type exportVaultOutput struct {
+	VaultID    string `json:"vaultId"`
+	OutputFile string `json:"outputFile"`
+	Documents  int    `json:"documents"`
+}
+
+// GetVaultCmd returns the Cobra vault command.
+func GetVaultCmd() *cobra.Command {
+	vaultCmd := &cobra.Command{
+		Use:   "vault",
+		Short: "Manage data vaults",
+		Long:  "Create and export data vaults",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	createCommonFlags(vaultCmd)
+
+	vaultCmd.AddCommand(createCreateVaultCmd(), createExportVaultCmd())
+
+	return vaultCmd
+}
+
+func createCreateVaultCmd() *cobra.Command {
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create a data vault",
+		Long: "Create a data vault with the configuration in a JSON file. The output includes the vault's " +
+			"capability if the EDV server has zcap authorization enabled.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configFile, err := getRequiredFlag(cmd, configFileFlagName)
+			if err != nil {
+				return err
+			}
+
+			var config models.DataVaultConfiguration
+
+			if err = readJSONFile(configFile, &config); err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			location, resp, err := params.client.CreateDataVault(&config, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to create data vault: %w", err)
+			}
+
+			output := createVaultOutput{VaultID: vaultIDFromLocation(location), Location: location}
+
+			if json.Valid(resp) {
+				output.Capability = resp
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, output, &table{
+				header: []string{"VAULT ID", "LOCATION"},
+				rows:   [][]string{{output.VaultID, output.Location}},
+			})
+		},
+	}
+
+	createCmd.Flags().StringP(configFileFlagName, "", "", configFileFlagUsage)
+
+	return createCmd
+}
+
+func createExportVaultCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the documents of a data vault",
+		Long: "Export all the encrypted documents of a data vault. Requires the EDV server to have the " +
+			"ReadAllDocuments extension enabled.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			vaultID, err := getRequiredFlag(cmd, vaultIDFlagName)
+			if err != nil {
+				return err
+			}
+
+			params, err := getClientParameters(cmd)
+			if err != nil {
+				return err
+			}
+
+			documents, err := params.client.ReadAllDocuments(vaultID, params.reqOpts...)
+			if err != nil {
+				return fmt.Errorf("failed to export data vault %s: %w", vaultID, err)
+			}
+
+			if documents == nil {
+				documents = []models.EncryptedDocument{}
+			}
+
+			outputFile, err := cmd.Flags().GetString(outputFileFlagName)
+			if err != nil {
+				return err
+			}
+
+			if outputFile == "" {
+				return writeOutput(cmd.OutOrStdout(), params.output, documents, documentsTable(documents))
+			}
+
+			data, err := json.MarshalIndent(documents, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal documents: %w", err)
+			}
+
+			if err := ioutil.WriteFile(outputFile, data, 0600); err != nil { //nolint: gomnd
+				return fmt.Errorf("failed to write documents to %s: %w", outputFile, err)
+			}
+
+			return writeOutput(cmd.OutOrStdout(), params.output, exportVaultOutput{
+				VaultID: vaultID, OutputFile: outputFile, Documents: len(documents),
+			}, &table{
+				header: []string{"VAULT ID", "OUTPUT FILE", "DOCUMENTS"},
+				rows:   [][]string{{vaultID, outputFile, strconv.Itoa(len(documents))}},
+			})
+		},
+	}
+
+	exportCmd.Flags().StringP(vaultIDFlagName, "", "", vaultIDFlagUsage)
+	exportCmd.Flags().StringP(outputFileFlagName, "", "", outputFileFlagUsage)
+
+	return exportCmd
+}
+
+// vaultIDFromLocation returns the ID of the vault at the given location.
+func vaultIDFromLocation(location string) string {
+	vaultID := location[strings.LastIndex(location, "/")+1:]
+
+	if unescaped, err := url.PathUnescape(vaultID); err == nil {
+		return unescaped
+	}
+
+	return vaultID
+}
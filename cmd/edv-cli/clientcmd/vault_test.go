@@ -0,0 +1,153 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package clientcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestVaultCmd(t *testing.T) {
+	edvURL := startEDVServer(t)
+	dir := t.TempDir()
+
+	configFile := writeJSONFile(t, dir, "config.json", testDataVaultConfiguration("referenceID"))
+
+	var vaultID string
+
+	t.Run("create", func(t *testing.T) {
+		out, err := runCmd(GetVaultCmd(), "create", "--edv-url", edvURL, "--config-file", configFile)
+		require.NoError(t, err)
+
+		var output createVaultOutput
+
+		require.NoError(t, json.Unmarshal([]byte(out), &output))
+		require.NotEmpty(t, output.VaultID)
+		require.Equal(t, strings.TrimPrefix(edvURL, "http://")+"/"+output.VaultID, output.Location)
+		require.Empty(t, output.Capability)
+
+		vaultID = output.VaultID
+	})
+
+	t.Run("create with table output", func(t *testing.T) {
+		configFile := writeJSONFile(t, dir, "config2.json", testDataVaultConfiguration("referenceID2"))
+
+		out, err := runCmd(GetVaultCmd(), "create", "--edv-url", edvURL, "--config-file", configFile,
+			"-o", "table")
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		require.Len(t, lines, 2)
+		require.Equal(t, []string{"VAULT", "ID", "LOCATION"}, strings.Fields(lines[0]))
+		require.Len(t, strings.Fields(lines[1]), 2)
+	})
+
+	t.Run("create duplicate vault", func(t *testing.T) {
+		_, err := runCmd(GetVaultCmd(), "create", "--edv-url", edvURL, "--config-file", configFile)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to create data vault")
+		require.True(t, errors.Is(err, client.ErrDuplicateVault))
+	})
+
+	t.Run("create without config file", func(t *testing.T) {
+		_, err := runCmd(GetVaultCmd(), "create", "--edv-url", edvURL)
+		require.EqualError(t, err, "config-file must be set")
+
+		_, err = runCmd(GetVaultCmd(), "create", "--edv-url", edvURL, "--config-file",
+			filepath.Join(dir, "missing.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read")
+	})
+
+	t.Run("create returns capability", func(t *testing.T) {
+		srv := startMockServer(t, func(rw http.ResponseWriter, req *http.Request) {
+			rw.Header().Set("Location", "https://example.com/encrypted-data-vaults/vault1")
+			rw.WriteHeader(http.StatusCreated)
+			_, err := rw.Write([]byte(`{"id":"urn:uuid:capability1"}`))
+			require.NoError(t, err)
+		})
+
+		out, err := runCmd(GetVaultCmd(), "create", "--edv-url", srv.URL, "--config-file", configFile)
+		require.NoError(t, err)
+
+		var output createVaultOutput
+
+		require.NoError(t, json.Unmarshal([]byte(out), &output))
+		require.Equal(t, "vault1", output.VaultID)
+		require.JSONEq(t, `{"id":"urn:uuid:capability1"}`, string(output.Capability))
+	})
+
+	docID, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	_, err = runCmd(GetDocumentCmd(), "create", "--edv-url", edvURL, "--vault-id", vaultID, "--document-file",
+		writeJSONFile(t, dir, "doc.json", &models.EncryptedDocument{ID: docID, JWE: []byte(testJWE1)}))
+	require.NoError(t, err)
+
+	t.Run("export", func(t *testing.T) {
+		out, err := runCmd(GetVaultCmd(), "export", "--edv-url", edvURL, "--vault-id", vaultID)
+		require.NoError(t, err)
+
+		var documents []models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal([]byte(out), &documents))
+		require.Len(t, documents, 1)
+		require.Equal(t, docID, documents[0].ID)
+	})
+
+	t.Run("export to file", func(t *testing.T) {
+		outputFile := filepath.Join(dir, "export.json")
+
+		out, err := runCmd(GetVaultCmd(), "export", "--edv-url", edvURL, "--vault-id", vaultID,
+			"--output-file", outputFile)
+		require.NoError(t, err)
+
+		var output exportVaultOutput
+
+		require.NoError(t, json.Unmarshal([]byte(out), &output))
+		require.Equal(t, exportVaultOutput{VaultID: vaultID, OutputFile: outputFile, Documents: 1}, output)
+
+		data, err := ioutil.ReadFile(outputFile) //nolint: gosec
+		require.NoError(t, err)
+
+		var documents []models.EncryptedDocument
+
+		require.NoError(t, json.Unmarshal(data, &documents))
+		require.Len(t, documents, 1)
+	})
+
+	t.Run("export vault not found", func(t *testing.T) {
+		_, err := runCmd(GetVaultCmd(), "export", "--edv-url", edvURL, "--vault-id", "unknown")
+		require.Error(t, err)
+		require.True(t, errors.Is(err, client.ErrVaultNotFound))
+	})
+
+	t.Run("export without vault ID", func(t *testing.T) {
+		_, err := runCmd(GetVaultCmd(), "export", "--edv-url", edvURL)
+		require.EqualError(t, err, "vault-id must be set")
+	})
+}
+
+func testDataVaultConfiguration(referenceID string) *models.DataVaultConfiguration {
+	return &models.DataVaultConfiguration{
+		Controller:  "did:example:123",
+		ReferenceID: referenceID,
+		KEK:         models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+		HMAC:        models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright SecureKey Technologies Inc. All Rights Reserved.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+module github.com/trustbloc/edv/cmd/edv-cli
+
+replace github.com/trustbloc/edv => ../..
+
+replace github.com/kilic/bls12-381 => github.com/trustbloc/bls12-381 v0.0.0-20201104214312-31de2a204df8
+
+replace github.com/piprate/json-gold => github.com/trustbloc/json-gold v0.3.1-0.20200414173446-30d742ee949e
+
+require (
+	github.com/gorilla/mux v1.8.0
+	github.com/spf13/cobra v0.0.6
+	github.com/stretchr/testify v1.7.0
+	github.com/trustbloc/edge-core v0.1.5
+	github.com/trustbloc/edv v0.0.0
+)
+
+go 1.15
@@ -0,0 +1,33 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package edv-cli is a command-line client for EDV servers.
+package main
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/cmd/edv-cli/clientcmd"
+)
+
+var logger = log.New("edv-cli")
+
+func main() {
+	rootCmd := &cobra.Command{
+		Use: "edv-cli",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	rootCmd.AddCommand(clientcmd.GetVaultCmd(), clientcmd.GetDocumentCmd(), clientcmd.GetQueryCmd(),
+		clientcmd.GetBatchCmd())
+
+	if err := rootCmd.Execute(); err != nil {
+		logger.Fatalf("Failed to run edv-cli: %s", err)
+	}
+}
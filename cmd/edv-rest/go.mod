@@ -18,9 +18,17 @@ require (
 	github.com/hyperledger/aries-framework-go-ext/component/storage/couchdb v0.0.0-20201119153638-fc5d5e680587
 	github.com/rs/cors v1.7.0
 	github.com/spf13/cobra v0.0.6
-	github.com/stretchr/testify v1.6.1
+	github.com/spf13/pflag v1.0.3
+	github.com/spf13/pflag v1.0.3
+	github.com/stretchr/testify v1.7.0
 	github.com/trustbloc/edge-core v0.1.5
 	github.com/trustbloc/edv v0.0.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
 
 go 1.15
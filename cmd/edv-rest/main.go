@@ -37,6 +37,7 @@ func main() {
 	}
 
 	rootCmd.AddCommand(startcmd.GetStartCmd(&startcmd.HTTPServer{}))
+	rootCmd.AddCommand(startcmd.GetConfigCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		logger.Fatalf("Failed to run edv: %s", err)
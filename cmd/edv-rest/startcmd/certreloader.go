@@ -0,0 +1,109 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const certCheckInterval = 10 * time.Second
+
+// certReloader serves a TLS certificate and key pair from files, and reloads the pair when the files change, so that
+// the certificate can be rotated without restarting the server.
+type certReloader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	now           func() time.Time
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	certPEM   []byte
+	keyPEM    []byte
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: certCheckInterval,
+		now:           time.Now,
+	}
+
+	certPEM, keyPEM, err := r.readFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.cert, r.certPEM, r.keyPEM, r.lastCheck = &cert, certPEM, keyPEM, r.now()
+
+	return r, nil
+}
+
+// GetCertificate returns the current certificate. The files are checked for changes at most once per check interval,
+// during a TLS handshake. If the changed files can't be loaded (e.g. because only one of them has been replaced yet),
+// the previous certificate is served until the next check.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if now := r.now(); now.Sub(r.lastCheck) >= r.checkInterval {
+		r.lastCheck = now
+		r.reload()
+	}
+
+	return r.cert, nil
+}
+
+func (r *certReloader) reload() {
+	certPEM, keyPEM, err := r.readFiles()
+	if err != nil {
+		logger.Warnf("failed to reload TLS certificate, keeping the previous one: %s", err)
+
+		return
+	}
+
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) {
+		return
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		logger.Warnf("failed to reload TLS certificate, keeping the previous one: %s", err)
+
+		return
+	}
+
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+
+	logger.Infof("Reloaded TLS certificate from %s", r.certFile)
+}
+
+func (r *certReloader) readFiles() ([]byte, []byte, error) {
+	certPEM, err := ioutil.ReadFile(r.certFile) // nolint:gosec // the path is configured by the operator
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(r.keyFile) // nolint:gosec // the path is configured by the operator
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeTestKeyPair(t, certFile, keyFile, "edv-1")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	now := time.Now()
+	reloader.now = func() time.Time { return now }
+
+	requireCommonName(t, reloader, "edv-1")
+
+	t.Run("reloads the pair when the files change", func(t *testing.T) {
+		writeTestKeyPair(t, certFile, keyFile, "edv-2")
+
+		// The files aren't checked again until the check interval has passed.
+		requireCommonName(t, reloader, "edv-1")
+
+		now = now.Add(certCheckInterval)
+
+		requireCommonName(t, reloader, "edv-2")
+	})
+
+	t.Run("keeps the previous pair if the files can't be loaded", func(t *testing.T) {
+		otherDir := t.TempDir()
+		writeTestKeyPair(t, filepath.Join(otherDir, "tls.crt"), filepath.Join(otherDir, "tls.key"), "edv-3")
+
+		// Only the certificate has been replaced, so it doesn't match the key.
+		certPEM, err := ioutil.ReadFile(filepath.Join(otherDir, "tls.crt"))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(certFile, certPEM, 0600))
+
+		now = now.Add(certCheckInterval)
+
+		requireCommonName(t, reloader, "edv-2")
+
+		reloader.keyFile = filepath.Join(otherDir, "missing.key")
+		now = now.Add(certCheckInterval)
+
+		requireCommonName(t, reloader, "edv-2")
+	})
+
+	t.Run("failure - invalid pair", func(t *testing.T) {
+		invalidFile := filepath.Join(t.TempDir(), "invalid.pem")
+		require.NoError(t, ioutil.WriteFile(invalidFile, []byte("invalid"), 0600))
+
+		_, err := newCertReloader(invalidFile, invalidFile)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to load TLS certificate")
+	})
+}
+
+func requireCommonName(t *testing.T, reloader *certReloader, commonName string) {
+	t.Helper()
+
+	cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, commonName, leaf.Subject.CommonName)
+}
+
+// writeTestKeyPair writes a self-signed certificate and its key.
+func writeTestKeyPair(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privKey.PublicKey, privKey)
+	require.NoError(t, err)
+
+	keyBytes, err := x509.MarshalECPrivateKey(privKey)
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0600))
+}
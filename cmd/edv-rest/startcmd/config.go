@@ -0,0 +1,355 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package startcmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
+	"gopkg.in/yaml.v3"
+
+	"github.com/trustbloc/edv/pkg/auth/didresolver"
+	"github.com/trustbloc/edv/pkg/auth/oauth2"
+)
+
+const (
+	configFileFlagName  = "config-file"
+	configFileEnvKey    = "EDV_CONFIG_FILE"
+	configFileFlagUsage = "Path to a YAML or JSON file with the configuration of the server. Its keys are the names " +
+		"of the other flags (e.g. host-url), and lists are joined with commas. Flags take precedence over " +
+		"environment variables, which take precedence over the config file. " +
+		commonEnvVarUsageText + configFileEnvKey
+
+	// configFileAnnotation is the annotation of the flags that were set from the config file.
+	configFileAnnotation = "edv-config-file"
+
+	redactedPassword = "xxxxx"
+)
+
+// flagEnvKeys holds the environment variable of each flag of the start command.
+// nolint:gochecknoglobals
+var flagEnvKeys = map[string]string{
+	hostURLFlagName:                       hostURLEnvKey,
+	databaseTypeFlagName:                  databaseTypeEnvKey,
+	databaseURLFlagName:                   databaseURLEnvKey,
+	databasePrefixFlagName:                databasePrefixEnvKey,
+	databaseTimeoutFlagName:               databaseTimeoutEnvKey,
+	databaseRetrievalPageSizeFlagName:     databaseRetrievalPageSizeEnvKey,
+	logLevelFlagName:                      logLevelEnvKey,
+	tlsCertFileFlagName:                   tlsCertFileEnvKey,
+	tlsKeyFileFlagName:                    tlsKeyFileEnvKey,
+	tlsClientCAFileFlagName:               tlsClientCAFileEnvKey,
+	tlsClientAuthFlagName:                 tlsClientAuthEnvKey,
+	tlsClientRulesFileFlagName:            tlsClientRulesFileEnvKey,
+	localKMSSecretsDatabaseTypeFlagName:   localKMSSecretsDatabaseTypeEnvKey,
+	localKMSSecretsDatabaseURLFlagName:    localKMSSecretsDatabaseURLEnvKey,
+	localKMSSecretsDatabasePrefixFlagName: localKMSSecretsDatabasePrefixEnvKey,
+	authEnableFlagName:                    authEnableEnvKey,
+	authTypeFlagName:                      authTypeEnvKey,
+	oauth2JWKSURLFlagName:                 oauth2JWKSURLEnvKey,
+	oauth2JWKSFileFlagName:                oauth2JWKSFileEnvKey,
+	oauth2IssuerFlagName:                  oauth2IssuerEnvKey,
+	oauth2AudienceFlagName:                oauth2AudienceEnvKey,
+	oauth2ControllerClaimFlagName:         oauth2ControllerClaimEnvKey,
+	oauth2ReadScopeFlagName:               oauth2ReadScopeEnvKey,
+	oauth2WriteScopeFlagName:              oauth2WriteScopeEnvKey,
+	controllerProofRequiredFlagName:       controllerProofRequiredEnvKey,
+	extensionsFlagName:                    extensionsEnvKey,
+	corsAllowedOriginsFlagName:            corsAllowedOriginsEnvKey,
+	corsAllowedMethodsFlagName:            corsAllowedMethodsEnvKey,
+	corsAllowedHeadersFlagName:            corsAllowedHeadersEnvKey,
+	corsExposedHeadersFlagName:            corsExposedHeadersEnvKey,
+	corsAllowCredentialsFlagName:          corsAllowCredentialsEnvKey,
+	corsMaxAgeFlagName:                    corsMaxAgeEnvKey,
+	rateLimitRequestsFlagName:             rateLimitRequestsEnvKey,
+	rateLimitBurstFlagName:                rateLimitBurstEnvKey,
+	rateLimitExpensiveRequestsFlagName:    rateLimitExpensiveRequestsEnvKey,
+	rateLimitExpensiveBurstFlagName:       rateLimitExpensiveBurstEnvKey,
+	rateLimitKeysFlagName:                 rateLimitKeysEnvKey,
+	rateLimitTrustedProxiesFlagName:       rateLimitTrustedProxiesEnvKey,
+	didMethodsFlagName:                    didMethodsEnvKey,
+	didCacheTTLFlagName:                   didCacheTTLEnvKey,
+	idempotencyKeyTTLFlagName:             idempotencyKeyTTLEnvKey,
+	metricsURLFlagName:                    metricsURLEnvKey,
+	metricsVaultLabelFlagName:             metricsVaultLabelEnvKey,
+	tracingExporterFlagName:               tracingExporterEnvKey,
+	tracingOTLPURLFlagName:                tracingOTLPURLEnvKey,
+	healthCheckTimeoutFlagName:            healthCheckTimeoutEnvKey,
+	healthCheckDiskPathsFlagName:          healthCheckDiskPathsEnvKey,
+	healthCheckMinFreeDiskSpaceFlagName:   healthCheckMinFreeDiskSpaceEnvKey,
+	shutdownTimeoutFlagName:               shutdownTimeoutEnvKey,
+	auditLogTypeFlagName:                  auditLogTypeEnvKey,
+	auditLogFileFlagName:                  auditLogFileEnvKey,
+	configFileFlagName:                    configFileEnvKey,
+}
+
+// flagDefaults holds the values that flags default to if they aren't set, for the flags that have a fixed default.
+// The flags that aren't listed are disabled or derived from other flags if they aren't set.
+// nolint:gochecknoglobals
+var flagDefaults = map[string]string{
+	databaseTimeoutFlagName:             strconv.Itoa(databaseTimeoutDefault),
+	databaseRetrievalPageSizeFlagName:   strconv.Itoa(databaseRetrievalPageSizeDefault),
+	logLevelFlagName:                    logLevelInfo,
+	authEnableFlagName:                  "false",
+	authTypeFlagName:                    noAuthType,
+	oauth2ControllerClaimFlagName:       oauth2.DefaultControllerClaim,
+	oauth2ReadScopeFlagName:             oauth2.DefaultReadScope,
+	oauth2WriteScopeFlagName:            oauth2.DefaultWriteScope,
+	controllerProofRequiredFlagName:     "false",
+	corsAllowedMethodsFlagName:          strings.Join(defaultCORSAllowedMethods, ","),
+	corsAllowedHeadersFlagName:          strings.Join(defaultCORSAllowedHeaders, ","),
+	corsExposedHeadersFlagName:          strings.Join(defaultCORSExposedHeaders, ","),
+	corsAllowCredentialsFlagName:        "false",
+	rateLimitKeysFlagName:               strings.Join(defaultRateLimitKeys, ","),
+	didMethodsFlagName:                  didresolver.KeyMethod,
+	didCacheTTLFlagName:                 didresolver.DefaultCacheTTL.String(),
+	idempotencyKeyTTLFlagName:           idempotencyKeyTTLDefault.String(),
+	metricsVaultLabelFlagName:           "false",
+	tracingExporterFlagName:             noTracingExporter,
+	tracingOTLPURLFlagName:              tracingOTLPURLDefault,
+	healthCheckTimeoutFlagName:          healthCheckTimeoutDefault.String(),
+	healthCheckMinFreeDiskSpaceFlagName: strconv.Itoa(healthCheckMinFreeDiskSpaceDefault),
+	shutdownTimeoutFlagName:             shutdownTimeoutDefault.String(),
+	auditLogTypeFlagName:                noAuditLog,
+}
+
+// databaseURLPassword matches the password of a database URL, with or without a scheme
+// (e.g. admin:password@couchdb.example.com:5984).
+// nolint:gochecknoglobals
+var databaseURLPassword = regexp.MustCompile(`^((?:[a-zA-Z][a-zA-Z0-9+.-]*://)?[^:@/]*):[^@/]*@`)
+
+// GetConfigCmd returns the Cobra config command.
+func GetConfigCmd() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "EDV configuration",
+		Long:  "Commands for the configuration of the EDV server",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.HelpFunc()(cmd, args)
+		},
+	}
+
+	configCmd.AddCommand(createConfigPrintCmd())
+
+	return configCmd
+}
+
+func createConfigPrintCmd() *cobra.Command {
+	printCmd := &cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration of EDV",
+		Long: "Validates and prints the configuration that the start command would use with the same flags, " +
+			"environment variables and config file, as YAML. Settings that aren't listed use their defaults. " +
+			"The passwords of database URLs are redacted.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := applyConfigFile(cmd)
+			if err != nil {
+				return err
+			}
+
+			_, err = getEDVParameters(cmd, nil)
+			if err != nil {
+				return err
+			}
+
+			return printConfig(cmd.OutOrStdout(), cmd.Flags())
+		},
+	}
+
+	createFlags(printCmd)
+
+	return printCmd
+}
+
+// applyConfigFile sets the flags of cmd that are set in the config file, unless they're set on the command line or
+// by their environment variable.
+func applyConfigFile(cmd *cobra.Command) error {
+	path := cmdutils.GetUserSetOptionalVarFromString(cmd, configFileFlagName, configFileEnvKey)
+	if path == "" {
+		return nil
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if cmd.Flags().Changed(key) {
+			continue
+		}
+
+		if _, isSet := os.LookupEnv(flagEnvKeys[key]); isSet {
+			continue
+		}
+
+		err = cmd.Flags().Set(key, value)
+		if err != nil {
+			return fmt.Errorf("config file %s: failed to set %s: %w", path, key, err)
+		}
+
+		err = cmd.Flags().SetAnnotation(key, configFileAnnotation, []string{path})
+		if err != nil {
+			return fmt.Errorf("config file %s: failed to annotate %s: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// readConfigFile returns the values of the config file by key. JSON is read as YAML, since it's a subset of YAML.
+func readConfigFile(path string) (map[string]string, error) {
+	configBytes, err := ioutil.ReadFile(path) // nolint:gosec // the path is configured by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var config map[string]interface{}
+
+	err = yaml.Unmarshal(configBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string, len(config))
+
+	for key, value := range config {
+		if key == configFileFlagName {
+			return nil, fmt.Errorf("config file %s: %s can't be set in a config file", path, key)
+		}
+
+		if _, known := flagEnvKeys[key]; !known {
+			return nil, fmt.Errorf("config file %s: unknown key %s", path, key)
+		}
+
+		values[key], err = configValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: invalid value of %s: %w", path, key, err)
+		}
+	}
+
+	return values, nil
+}
+
+// configValue returns the flag value of a value of the config file. Lists are joined with commas.
+func configValue(value interface{}) (string, error) {
+	list, isList := value.([]interface{})
+	if !isList {
+		return scalarConfigValue(value)
+	}
+
+	items := make([]string, len(list))
+
+	for i := range list {
+		item, err := scalarConfigValue(list[i])
+		if err != nil {
+			return "", fmt.Errorf("item %d: %w", i, err)
+		}
+
+		items[i] = item
+	}
+
+	return strings.Join(items, ","), nil
+}
+
+func scalarConfigValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", errors.New("value is empty")
+	case string:
+		if v == "" {
+			return "", errors.New("value is empty")
+		}
+
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		return "", fmt.Errorf("must be a string, number, boolean or list of them, not %T", value)
+	}
+}
+
+// printConfig prints all the flags as YAML, with where each value came from as a comment: the command line, an
+// environment variable, the config file or the default.
+func printConfig(w io.Writer, flags *pflag.FlagSet) error {
+	config := &yaml.Node{
+		Kind:        yaml.MappingNode,
+		HeadComment: "Effective configuration of edv-rest start.",
+	}
+
+	var keys []string
+
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if _, isStartFlag := flagEnvKeys[flag.Name]; isStartFlag && flag.Name != configFileFlagName {
+			keys = append(keys, flag.Name)
+		}
+	})
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, source := effectiveValue(flags.Lookup(key))
+
+		if key == databaseURLFlagName || key == localKMSSecretsDatabaseURLFlagName {
+			value = databaseURLPassword.ReplaceAllString(value, "${1}:"+redactedPassword+"@")
+		}
+
+		keyNode, valueNode := &yaml.Node{}, &yaml.Node{LineComment: source}
+		keyNode.SetString(key)
+		valueNode.SetString(value)
+
+		config.Content = append(config.Content, keyNode, valueNode)
+	}
+
+	encoder := yaml.NewEncoder(w)
+
+	err := encoder.Encode(config)
+	if err != nil {
+		return fmt.Errorf("failed to print configuration: %w", err)
+	}
+
+	return encoder.Close()
+}
+
+// effectiveValue returns the value of the flag and where it came from. Flags that aren't set have their default.
+func effectiveValue(flag *pflag.Flag) (string, string) {
+	if flag.Changed {
+		if paths, ok := flag.Annotations[configFileAnnotation]; ok {
+			return flag.Value.String(), "config file " + paths[0]
+		}
+
+		return flag.Value.String(), "flag"
+	}
+
+	envKey := flagEnvKeys[flag.Name]
+
+	if value, isSet := os.LookupEnv(envKey); isSet {
+		return value, "environment variable " + envKey
+	}
+
+	if value, ok := flagDefaults[flag.Name]; ok {
+		return value, "default"
+	}
+
+	return flag.DefValue, "default"
+}
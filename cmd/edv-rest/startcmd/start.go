@@ -8,12 +8,23 @@ package startcmd
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -31,16 +42,34 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/restapi/logspec"
-	"github.com/trustbloc/edge-core/pkg/storage"
 	cmdutils "github.com/trustbloc/edge-core/pkg/utils/cmd"
-
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth/didresolver"
+	"github.com/trustbloc/edv/pkg/auth/mtls"
+	"github.com/trustbloc/edv/pkg/auth/oauth2"
 	"github.com/trustbloc/edv/pkg/auth/zcapld"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvprovider/couchdbedvprovider"
 	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/metrics"
 	"github.com/trustbloc/edv/pkg/restapi"
+	restapiaudit "github.com/trustbloc/edv/pkg/restapi/audit"
+	"github.com/trustbloc/edv/pkg/restapi/capability"
 	"github.com/trustbloc/edv/pkg/restapi/healthcheck"
+	"github.com/trustbloc/edv/pkg/restapi/healthcheck/checks"
+	healthcheckop "github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
+	"github.com/trustbloc/edv/pkg/restapi/idempotency"
 	"github.com/trustbloc/edv/pkg/restapi/operation"
+	"github.com/trustbloc/edv/pkg/restapi/ratelimit"
+	"github.com/trustbloc/edv/pkg/tracing"
 )
 
 const (
@@ -110,16 +139,40 @@ const (
 
 	tlsCertFileFlagName      = "tls-cert-file"
 	tlsCertFileFlagShorthand = ""
-	tlsCertFileFlagUsage     = "TLS certificate file." +
+	tlsCertFileFlagUsage     = "TLS certificate file. The certificate is reloaded when the file changes." +
 		" Alternatively, this can be set with the following environment variable: " + tlsCertFileEnvKey
 	tlsCertFileEnvKey = "EDV_TLS_CERT_FILE"
 
 	tlsKeyFileFlagName      = "tls-key-file"
 	tlsKeyFileFlagShorthand = ""
-	tlsKeyFileFlagUsage     = "TLS key file." +
+	tlsKeyFileFlagUsage     = "TLS key file. The key is reloaded when the file changes." +
 		" Alternatively, this can be set with the following environment variable: " + tlsKeyFileEnvKey
 	tlsKeyFileEnvKey = "EDV_TLS_KEY_FILE"
 
+	tlsClientCAFileFlagName  = "tls-client-ca-file"
+	tlsClientCAFileEnvKey    = "EDV_TLS_CLIENT_CA_FILE"
+	tlsClientCAFileFlagUsage = "PEM file with the CA certificates that client certificates are verified against. " +
+		"Enables mutual TLS. Requires " + tlsCertFileFlagName + " and " + tlsKeyFileFlagName + " to be set. " +
+		commonEnvVarUsageText + tlsClientCAFileEnvKey
+
+	tlsClientAuthFlagName  = "tls-client-auth"
+	tlsClientAuthEnvKey    = "EDV_TLS_CLIENT_AUTH"
+	tlsClientAuthFlagUsage = "Whether clients must present a certificate. Supported options: " +
+		noClientAuth + ", " + optionalClientAuth + " (verify the certificate if one is presented), " +
+		requiredClientAuth + ". Defaults to " + requiredClientAuth + " if " + tlsClientCAFileFlagName + " is set and " +
+		noClientAuth + " otherwise. " + commonEnvVarUsageText + tlsClientAuthEnvKey
+
+	tlsClientRulesFileFlagName  = "tls-client-rules-file"
+	tlsClientRulesFileEnvKey    = "EDV_TLS_CLIENT_RULES_FILE"
+	tlsClientRulesFileFlagUsage = "JSON file with rules that grant clients access to vaults based on the subject " +
+		"or subject alternative names of their certificate. Requests that no rule grants access to are authorized " +
+		"with " + authTypeFlagName + ", or rejected if " + authTypeFlagName + " is " + noAuthType + ". " +
+		"Requires " + tlsClientCAFileFlagName + " to be set. " + commonEnvVarUsageText + tlsClientRulesFileEnvKey
+
+	noClientAuth       = "none"
+	optionalClientAuth = "optional"
+	requiredClientAuth = "required"
+
 	localKMSSecretsDatabaseTypeFlagName  = "localkms-secrets-database-type"
 	localKMSSecretsDatabaseTypeEnvKey    = "EDV_LOCALKMS_SECRETS_DATABASE_TYPE" //nolint: gosec
 	localKMSSecretsDatabaseTypeFlagUsage = "The type of database to use for storing KMS secrets for Keystore. " +
@@ -138,14 +191,251 @@ const (
 		"KMS secrets database. " + commonEnvVarUsageText + localKMSSecretsDatabasePrefixEnvKey
 
 	authEnableFlagName  = "auth-enable"
-	authEnableFlagUsage = "Enable authorization. Possible values [true] [false]. " +
+	authEnableFlagUsage = "Deprecated: use " + authTypeFlagName + " instead. Setting this to true is the same as " +
+		"setting " + authTypeFlagName + " to " + zcapAuthType + ". Possible values [true] [false]. " +
 		"Defaults to false if not set. " + commonEnvVarUsageText + authEnableEnvKey
 	authEnableEnvKey = "EDV_AUTH_ENABLE"
 
-	corsEnableFlagName  = "cors-enable"
-	corsEnableFlagUsage = "Enable cors. Possible values [true] [false]. " +
-		"Defaults to false if not set. " + commonEnvVarUsageText + corsEnableEnvKey
-	corsEnableEnvKey = "EDV_CORS_ENABLE"
+	authTypeFlagName  = "auth-type"
+	authTypeEnvKey    = "EDV_AUTH_TYPE"
+	authTypeFlagUsage = "The type of authorization to use. Supported options: " + noAuthType + ", " + zcapAuthType +
+		" (capability invocations signed with HTTP signatures), " + oauth2AuthType + " (OAuth2/OpenID Connect " +
+		"bearer access tokens in JWT format). Defaults to " + noAuthType + " if not set. " +
+		commonEnvVarUsageText + authTypeEnvKey
+
+	oauth2JWKSURLFlagName  = "oauth2-jwks-url"
+	oauth2JWKSURLEnvKey    = "EDV_OAUTH2_JWKS_URL"
+	oauth2JWKSURLFlagUsage = "URL of the JWK set with the keys that access tokens are signed with, such as the " +
+		"jwks_uri of an OpenID Connect provider. Either this or " + oauth2JWKSFileFlagName + " is required if " +
+		authTypeFlagName + " is " + oauth2AuthType + ". " + commonEnvVarUsageText + oauth2JWKSURLEnvKey
+
+	oauth2JWKSFileFlagName  = "oauth2-jwks-file"
+	oauth2JWKSFileEnvKey    = "EDV_OAUTH2_JWKS_FILE"
+	oauth2JWKSFileFlagUsage = "Path to a file with the JWK set with the keys that access tokens are signed with. " +
+		"Either this or " + oauth2JWKSURLFlagName + " is required if " + authTypeFlagName + " is " + oauth2AuthType +
+		". " + commonEnvVarUsageText + oauth2JWKSFileEnvKey
+
+	oauth2IssuerFlagName  = "oauth2-issuer"
+	oauth2IssuerEnvKey    = "EDV_OAUTH2_ISSUER"
+	oauth2IssuerFlagUsage = "The issuer (iss claim) that access tokens must have. Any issuer is accepted if not set. " +
+		commonEnvVarUsageText + oauth2IssuerEnvKey
+
+	oauth2AudienceFlagName  = "oauth2-audience"
+	oauth2AudienceEnvKey    = "EDV_OAUTH2_AUDIENCE"
+	oauth2AudienceFlagUsage = "The audience (aud claim) that access tokens must have been issued for. " +
+		"Any audience is accepted if not set. " + commonEnvVarUsageText + oauth2AudienceEnvKey
+
+	oauth2ControllerClaimFlagName  = "oauth2-controller-claim"
+	oauth2ControllerClaimEnvKey    = "EDV_OAUTH2_CONTROLLER_CLAIM"
+	oauth2ControllerClaimFlagUsage = "The access token claim that is compared to the controller of a vault to decide " +
+		"whether the token grants access to it. Defaults to " + oauth2.DefaultControllerClaim + " if not set. " +
+		commonEnvVarUsageText + oauth2ControllerClaimEnvKey
+
+	oauth2ReadScopeFlagName  = "oauth2-read-scope"
+	oauth2ReadScopeEnvKey    = "EDV_OAUTH2_READ_SCOPE"
+	oauth2ReadScopeFlagUsage = "The scope that access tokens need to read documents from a vault. Defaults to " +
+		oauth2.DefaultReadScope + " if not set. " + commonEnvVarUsageText + oauth2ReadScopeEnvKey
+
+	oauth2WriteScopeFlagName  = "oauth2-write-scope"
+	oauth2WriteScopeEnvKey    = "EDV_OAUTH2_WRITE_SCOPE"
+	oauth2WriteScopeFlagUsage = "The scope that access tokens need for all other vault operations, including " +
+		"queries. Defaults to " + oauth2.DefaultWriteScope + " if not set. " +
+		commonEnvVarUsageText + oauth2WriteScopeEnvKey
+
+	controllerProofRequiredFlagName  = "controller-proof-required"
+	controllerProofRequiredEnvKey    = "EDV_CONTROLLER_PROOF_REQUIRED"
+	controllerProofRequiredFlagUsage = "Require data vault creation requests to be signed with an HTTP signature " +
+		"by a key belonging to the vault's controller. Possible values [true] [false]. Defaults to false if not set. " +
+		"Requires authorization to be enabled. " + commonEnvVarUsageText + controllerProofRequiredEnvKey
+
+	didMethodsFlagName  = "did-methods"
+	didMethodsEnvKey    = "EDV_DID_METHODS"
+	didMethodsFlagUsage = "Comma-separated list of DID methods that capability invokers and delegators may use. " +
+		"Supported options: " + didresolver.KeyMethod + ", " + didresolver.PeerMethod + ", " + didresolver.WebMethod +
+		". Defaults to " + didresolver.KeyMethod + " if not set. Only used if authorization is enabled. " +
+		commonEnvVarUsageText + didMethodsEnvKey
+
+	didCacheTTLFlagName  = "did-cache-ttl"
+	didCacheTTLEnvKey    = "EDV_DID_CACHE_TTL"
+	didCacheTTLFlagUsage = "How long resolved DID documents are cached for, as a duration (e.g. 30s, 5m). " +
+		"Set to 0 to disable caching. Defaults to 5m if not set. " + commonEnvVarUsageText + didCacheTTLEnvKey
+
+	idempotencyKeyTTLFlagName  = "idempotency-key-ttl"
+	idempotencyKeyTTLEnvKey    = "EDV_IDEMPOTENCY_KEY_TTL"
+	idempotencyKeyTTLFlagUsage = "How long the responses to requests with an Idempotency-Key header are stored for, " +
+		"as a duration (e.g. 1h, 30m). Requests that create data vaults and documents are idempotent by their " +
+		"key for this duration. Set to 0 to disable idempotency keys. Defaults to 24h if not set. " +
+		commonEnvVarUsageText + idempotencyKeyTTLEnvKey
+	idempotencyKeyTTLDefault = 24 * time.Hour
+
+	metricsURLFlagName  = "metrics-url"
+	metricsURLEnvKey    = "EDV_METRICS_URL"
+	metricsURLFlagUsage = "URL to expose Prometheus metrics on at " + metricsEndpoint + ", on a separate listener " +
+		"that doesn't require authorization (e.g. localhost:9090). Metrics are disabled if not set. " +
+		commonEnvVarUsageText + metricsURLEnvKey
+
+	metricsVaultLabelFlagName  = "metrics-vault-label"
+	metricsVaultLabelEnvKey    = "EDV_METRICS_VAULT_LABEL"
+	metricsVaultLabelFlagUsage = "Label the storage metrics with the ID of the vault that was accessed. Every vault " +
+		"adds its own time series, so only enable this on servers with few vaults. Possible values [true] [false]. " +
+		"Defaults to false if not set. " + commonEnvVarUsageText + metricsVaultLabelEnvKey
+
+	metricsEndpoint = "/metrics"
+
+	tracingExporterFlagName  = "tracing-exporter"
+	tracingExporterEnvKey    = "EDV_TRACING_EXPORTER"
+	tracingExporterFlagUsage = "The exporter of OpenTelemetry traces of requests, zcap verification and database " +
+		"calls. Supported options: " + noTracingExporter + ", " + otlpTracingExporter + " (OTLP over HTTP, see " +
+		tracingOTLPURLFlagName + "), " + stdoutTracingExporter + " (for testing). Defaults to " + noTracingExporter +
+		" if not set. " + commonEnvVarUsageText + tracingExporterEnvKey
+
+	tracingOTLPURLFlagName  = "tracing-otlp-url"
+	tracingOTLPURLEnvKey    = "EDV_TRACING_OTLP_URL"
+	tracingOTLPURLFlagUsage = "URL of the OTLP/HTTP collector that traces are exported to if " +
+		tracingExporterFlagName + " is " + otlpTracingExporter + ". Use an http URL for an insecure connection. " +
+		"Defaults to " + tracingOTLPURLDefault + " if not set. " + commonEnvVarUsageText + tracingOTLPURLEnvKey
+	tracingOTLPURLDefault = "http://localhost:4318"
+
+	noTracingExporter     = "none"
+	otlpTracingExporter   = "otlp"
+	stdoutTracingExporter = "stdout"
+
+	// tracingServiceName is the service name of the traces of the server.
+	tracingServiceName = "edv"
+
+	healthCheckTimeoutFlagName  = "healthcheck-timeout"
+	healthCheckTimeoutEnvKey    = "EDV_HEALTHCHECK_TIMEOUT"
+	healthCheckTimeoutFlagUsage = "How long each readiness check of a dependency (e.g. the database) may take " +
+		"before it fails, as a duration (e.g. 5s, 500ms). Defaults to 5s if not set. " +
+		commonEnvVarUsageText + healthCheckTimeoutEnvKey
+	healthCheckTimeoutDefault = 5 * time.Second
+
+	healthCheckDiskPathsFlagName  = "healthcheck-disk-paths"
+	healthCheckDiskPathsEnvKey    = "EDV_HEALTHCHECK_DISK_PATHS"
+	healthCheckDiskPathsFlagUsage = "Comma-separated list of paths (e.g. the data directories of embedded stores) " +
+		"whose file systems must have at least " + healthCheckMinFreeDiskSpaceFlagName + " of free space for the " +
+		"server to be ready. " + commonEnvVarUsageText + healthCheckDiskPathsEnvKey
+
+	healthCheckMinFreeDiskSpaceFlagName  = "healthcheck-min-free-disk-space"
+	healthCheckMinFreeDiskSpaceEnvKey    = "EDV_HEALTHCHECK_MIN_FREE_DISK_SPACE"
+	healthCheckMinFreeDiskSpaceFlagUsage = "Free disk space in megabytes that the file systems of " +
+		healthCheckDiskPathsFlagName + " must have for the server to be ready. Defaults to 100 if not set. " +
+		commonEnvVarUsageText + healthCheckMinFreeDiskSpaceEnvKey
+	healthCheckMinFreeDiskSpaceDefault = 100
+
+	bytesPerMegabyte = 1024 * 1024
+
+	shutdownTimeoutFlagName  = "shutdown-timeout"
+	shutdownTimeoutEnvKey    = "EDV_SHUTDOWN_TIMEOUT"
+	shutdownTimeoutFlagUsage = "How long the server waits for in-flight requests to finish when it receives " +
+		"SIGINT or SIGTERM, before it closes its connections and database clients, as a duration (e.g. 30s, 1m). " +
+		"Defaults to 30s if not set. " + commonEnvVarUsageText + shutdownTimeoutEnvKey
+	shutdownTimeoutDefault = 30 * time.Second
+
+	// jwksFetchTimeout is how long fetching the JWK set from the OAuth 2.0 JWKS URL may take.
+	jwksFetchTimeout = 10 * time.Second
+	// didWebResolveTimeout is how long fetching a did:web DID document may take.
+	didWebResolveTimeout = 10 * time.Second
+	// idempotencyKeySweepInterval is how often expired idempotency keys are deleted.
+	idempotencyKeySweepInterval = time.Hour
+
+	auditLogTypeFlagName  = "audit-log-type"
+	auditLogTypeEnvKey    = "EDV_AUDIT_LOG_TYPE"
+	auditLogTypeFlagUsage = "Where the audit log of the operations on vaults and their documents is stored. " +
+		"Supported options: " + noAuditLog + ", " + fileAuditLog + " (see " + auditLogFileFlagName + "), " +
+		databaseAuditLog + " (the database of " + databaseTypeFlagName + "). Defaults to " + noAuditLog +
+		" if not set. " + commonEnvVarUsageText + auditLogTypeEnvKey
+
+	auditLogFileFlagName  = "audit-log-file"
+	auditLogFileEnvKey    = "EDV_AUDIT_LOG_FILE"
+	auditLogFileFlagUsage = "Path of the file that the audit log is appended to if " + auditLogTypeFlagName +
+		" is " + fileAuditLog + ". " + commonEnvVarUsageText + auditLogFileEnvKey
+
+	noAuditLog       = "none"
+	fileAuditLog     = "file"
+	databaseAuditLog = "database"
+
+	corsAllowedOriginsFlagName  = "cors-allowed-origins"
+	corsAllowedOriginsEnvKey    = "EDV_CORS_ALLOWED_ORIGINS"
+	corsAllowedOriginsFlagUsage = "Comma-separated list of the origins that browsers may make cross-origin requests " +
+		"from, such as https://wallet.example.com. An origin may contain one * as a wildcard " +
+		"(e.g. https://*.example.com), and * alone allows any origin. CORS is disabled if not set. " +
+		commonEnvVarUsageText + corsAllowedOriginsEnvKey
+
+	corsAllowedMethodsFlagName  = "cors-allowed-methods"
+	corsAllowedMethodsEnvKey    = "EDV_CORS_ALLOWED_METHODS"
+	corsAllowedMethodsFlagUsage = "Comma-separated list of the methods of cross-origin requests. " +
+		"Defaults to GET,POST,PUT,DELETE if not set. " + commonEnvVarUsageText + corsAllowedMethodsEnvKey
+
+	corsAllowedHeadersFlagName  = "cors-allowed-headers"
+	corsAllowedHeadersEnvKey    = "EDV_CORS_ALLOWED_HEADERS"
+	corsAllowedHeadersFlagUsage = "Comma-separated list of the headers that cross-origin requests may have. " +
+		"Defaults to Authorization,Capability-Invocation,Content-Type,Digest,Idempotency-Key,Signature if not set. " +
+		commonEnvVarUsageText + corsAllowedHeadersEnvKey
+
+	corsExposedHeadersFlagName  = "cors-exposed-headers"
+	corsExposedHeadersEnvKey    = "EDV_CORS_EXPOSED_HEADERS"
+	corsExposedHeadersFlagUsage = "Comma-separated list of the response headers that browsers expose to " +
+		"cross-origin requests. Defaults to Location,Idempotent-Replayed,Retry-After if not set. " +
+		commonEnvVarUsageText + corsExposedHeadersEnvKey
+
+	corsAllowCredentialsFlagName  = "cors-allow-credentials"
+	corsAllowCredentialsEnvKey    = "EDV_CORS_ALLOW_CREDENTIALS"
+	corsAllowCredentialsFlagUsage = "Whether cross-origin requests may include credentials, such as cookies and " +
+		"client certificates. Can't be used if any origin is allowed. Possible values [true] [false]. " +
+		"Defaults to false if not set. " + commonEnvVarUsageText + corsAllowCredentialsEnvKey
+
+	corsMaxAgeFlagName  = "cors-max-age"
+	corsMaxAgeEnvKey    = "EDV_CORS_MAX_AGE"
+	corsMaxAgeFlagUsage = "How long browsers may cache the result of a preflight request, as a duration in whole " +
+		"seconds (e.g. 10m). Browsers use their own default if not set. " + commonEnvVarUsageText + corsMaxAgeEnvKey
+
+	corsAnyOrigin = "*"
+
+	rateLimitRequestsFlagName  = "rate-limit-requests"
+	rateLimitRequestsEnvKey    = "EDV_RATE_LIMIT_REQUESTS"
+	rateLimitRequestsFlagUsage = "How many requests per second each client IP, invoker and vault may make to routes " +
+		"other than queries, batches and reading all documents. Requests over the limit are rejected with " +
+		"429 Too Many Requests and a Retry-After header. Rate limiting is disabled if not set. " +
+		commonEnvVarUsageText + rateLimitRequestsEnvKey
+
+	rateLimitBurstFlagName  = "rate-limit-burst"
+	rateLimitBurstEnvKey    = "EDV_RATE_LIMIT_BURST"
+	rateLimitBurstFlagUsage = "How many requests each client IP, invoker and vault may make at once after being " +
+		"idle, for the routes limited by " + rateLimitRequestsFlagName + ". Defaults to " + rateLimitRequestsFlagName +
+		" rounded up if not set. " + commonEnvVarUsageText + rateLimitBurstEnvKey
+
+	rateLimitExpensiveRequestsFlagName  = "rate-limit-expensive-requests"
+	rateLimitExpensiveRequestsEnvKey    = "EDV_RATE_LIMIT_EXPENSIVE_REQUESTS"
+	rateLimitExpensiveRequestsFlagUsage = "How many queries, batches and requests to read all documents per second " +
+		"each client IP, invoker and vault may make. These scan the documents of a vault, so they have their own, " +
+		"smaller budget. Defaults to a tenth of " + rateLimitRequestsFlagName + " if not set. " +
+		commonEnvVarUsageText + rateLimitExpensiveRequestsEnvKey
+
+	rateLimitExpensiveBurstFlagName  = "rate-limit-expensive-burst"
+	rateLimitExpensiveBurstEnvKey    = "EDV_RATE_LIMIT_EXPENSIVE_BURST"
+	rateLimitExpensiveBurstFlagUsage = "How many queries, batches and requests to read all documents each client " +
+		"IP, invoker and vault may make at once after being idle. Defaults to " +
+		rateLimitExpensiveRequestsFlagName + " rounded up if not set. " +
+		commonEnvVarUsageText + rateLimitExpensiveBurstEnvKey
+
+	rateLimitKeysFlagName  = "rate-limit-keys"
+	rateLimitKeysEnvKey    = "EDV_RATE_LIMIT_KEYS"
+	rateLimitKeysFlagUsage = "Comma-separated list of what requests are limited by. Supported options: " +
+		ratelimit.ClientIPKey + " (the client IP address), " + ratelimit.InvokerKey + " (who the request was " +
+		"authenticated as), " + ratelimit.VaultKey + " (the vault of the request). Defaults to all of them " +
+		"if not set. " + commonEnvVarUsageText + rateLimitKeysEnvKey
+
+	rateLimitTrustedProxiesFlagName  = "rate-limit-trusted-proxies"
+	rateLimitTrustedProxiesEnvKey    = "EDV_RATE_LIMIT_TRUSTED_PROXIES"
+	rateLimitTrustedProxiesFlagUsage = "Comma-separated list of the IP addresses or CIDR networks (e.g. 10.0.0.0/8) " +
+		"of the reverse proxies in front of the server. The client IP of requests from them is read from their " +
+		"X-Forwarded-For or Forwarded header, so that clients behind the proxies are limited by " +
+		ratelimit.ClientIPKey + " separately. If not set, the forwarding headers are ignored. " +
+		commonEnvVarUsageText + rateLimitTrustedProxiesEnvKey
+
+	// rateLimitExpensiveFraction is the default fraction of rate-limit-requests for the expensive routes.
+	rateLimitExpensiveFraction = 0.1
 
 	// Enables queries to return full documents in queries instead of only the document locations.
 	// Requires "returnFullDocuments" to be set to true in incoming query JSON,
@@ -155,6 +445,13 @@ const (
 	batchExtensionName            = "Batch"
 	readAllDocumentsExtensionName = "ReadAllDocuments"
 
+	noAuthType     = "none"
+	zcapAuthType   = "zcap"
+	oauth2AuthType = "oauth2"
+	// mtlsAuthMethod is the name of authorization by client certificate, as listed by the server configuration
+	// endpoint.
+	mtlsAuthMethod = "mtls"
+
 	extensionsFlagName  = "with-extensions"
 	extensionsFlagUsage = "Enables features that are extensions of the spec. " +
 		"If set, must be a comma-separated list of some or all of the following possible values: " +
@@ -164,8 +461,6 @@ const (
 		"EDV functionality or non-extension-aware clients." + commonEnvVarUsageText + extensionsEnvKey
 	extensionsEnvKey = "EDV_EXTENSIONS"
 
-	dataVaultConfigurationStoreName = "data_vault_configurations"
-
 	sleep = time.Second
 
 	masterKeyURI       = "local-lock://custom/master/key/"
@@ -173,9 +468,6 @@ const (
 	masterKeyDBKeyName = masterKeyStoreName
 
 	masterKeyNumBytes = 32
-
-	createVaultPath = "/encrypted-data-vaults"
-	healthCheckPath = "/healthcheck"
 )
 
 var logger = log.New("edv-rest")
@@ -185,6 +477,17 @@ var errInvalidDatabaseType = fmt.Errorf("database type not set to a valid type."
 
 var errCreateConfigStore = "failed to create data vault configuration store: %w"
 
+// Defaults of the CORS policy and of what requests are rate limited by.
+// nolint:gochecknoglobals
+var (
+	defaultCORSAllowedMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSAllowedHeaders = []string{
+		"Authorization", "Capability-Invocation", "Content-Type", "Digest", idempotency.KeyHeader, "Signature",
+	}
+	defaultCORSExposedHeaders = []string{"Location", idempotency.ReplayedHeader, "Retry-After"}
+	defaultRateLimitKeys      = []string{ratelimit.ClientIPKey, ratelimit.InvokerKey, ratelimit.VaultKey}
+)
+
 // nolint:gochecknoglobals
 var supportedEDVStorageProviders = map[string]func(string, string, uint) (edvprovider.EDVProvider, error){
 	databaseTypeCouchDBOption: func(databaseURL, prefix string, retrievalPageSize uint) (edvprovider.EDVProvider, error) {
@@ -215,10 +518,104 @@ type edvParameters struct {
 	databaseRetrievalPageSize uint
 	logLevel                  string
 	tlsConfig                 *tlsConfig
-	authEnable                bool
-	corsEnable                bool
+	authType                  string
+	oauth2                    *oauth2Parameters
+	controllerProofRequired   bool
+	cors                      *corsParameters
+	rateLimit                 *rateLimitParameters
 	localKMSSecretsStorage    *storageParameters
 	extensionsToEnable        *operation.EnabledExtensions
+	didResolution             *didResolutionParameters
+	idempotencyKeyTTL         time.Duration
+	metrics                   *metricsParameters
+	tracing                   *tracingParameters
+	healthCheck               *healthCheckParameters
+	audit                     *auditParameters
+	shutdownTimeout           time.Duration
+}
+
+type metricsParameters struct {
+	url        string
+	vaultLabel bool
+}
+
+type tracingParameters struct {
+	exporter string
+	otlpURL  string
+}
+
+// corsParameters is the CORS policy of the server. It's nil if CORS is disabled.
+type corsParameters struct {
+	allowedOrigins   []string
+	allowedMethods   []string
+	allowedHeaders   []string
+	exposedHeaders   []string
+	allowCredentials bool
+	maxAge           time.Duration
+}
+
+// rateLimitParameters are the rate limits of the server. It's nil if rate limiting is disabled.
+type rateLimitParameters struct {
+	keys            []string
+	trustedProxies  []*net.IPNet
+	budget          ratelimit.Budget
+	expensiveBudget ratelimit.Budget
+}
+
+type auditParameters struct {
+	logType string
+	file    string
+}
+
+type healthCheckParameters struct {
+	timeout          time.Duration
+	diskPaths        []string
+	minFreeDiskSpace uint64
+}
+
+// dependencies collects the checks of the dependencies that the server needs to be ready, and how to release the
+// dependencies when the server shuts down, as the dependencies are created.
+type dependencies struct {
+	checkOpts []healthcheckop.Option
+	closers   []closer
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+func (d *dependencies) addCheck(name string, checker healthcheckop.Checker) {
+	d.checkOpts = append(d.checkOpts, healthcheckop.WithCheck(name, checker))
+}
+
+func (d *dependencies) addCloser(name string, close func() error) {
+	d.closers = append(d.closers, closer{name: name, close: close})
+}
+
+// close releases the dependencies in the reverse order of their creation. Failures are logged, so that the other
+// dependencies are still released.
+func (d *dependencies) close() {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if err := d.closers[i].close(); err != nil {
+			logger.Warnf("failed to close %s: %s", d.closers[i].name, err)
+		}
+	}
+}
+
+type oauth2Parameters struct {
+	jwksURL         string
+	jwksFile        string
+	issuer          string
+	audience        string
+	controllerClaim string
+	readScope       string
+	writeScope      string
+}
+
+type didResolutionParameters struct {
+	methods  []string
+	cacheTTL time.Duration
 }
 
 type storageParameters struct {
@@ -228,8 +625,11 @@ type storageParameters struct {
 }
 
 type tlsConfig struct {
-	certFile string
-	keyFile  string
+	certFile        string
+	keyFile         string
+	clientCAFile    string
+	clientAuth      tls.ClientAuthType
+	clientRulesFile string
 }
 
 type kmsProvider struct {
@@ -247,23 +647,99 @@ func (k kmsProvider) SecretLock() secretlock.Service {
 
 type authService interface {
 	Create(resourceID, verificationMethod string) ([]byte, error)
-	Handler(resourceID string, req *http.Request, w http.ResponseWriter, next http.HandlerFunc) (http.HandlerFunc, error)
+	VerifyController(req *http.Request, controller string) error
+	ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+		next http.HandlerFunc) (http.HandlerFunc, error)
+	restapi.AuthService
+}
+
+type adminAuthorizer interface {
+	AuthorizeAdmin(req *http.Request) error
 }
 
 type server interface {
-	ListenAndServe(host, certFile, keyFile string, router http.Handler) error
+	ListenAndServe(host, certFile, keyFile string, serverTLSConfig *tls.Config, router http.Handler) error
+	Shutdown(ctx context.Context) error
+}
+
+// HTTPServer represents an actual HTTP server implementation. It can listen on several addresses (e.g. for the REST
+// API and the metrics), which are all shut down by Shutdown.
+type HTTPServer struct {
+	mutex    sync.Mutex
+	servers  []*http.Server
+	shutdown bool
 }
 
-// HTTPServer represents an actual HTTP server implementation.
-type HTTPServer struct{}
+// ListenAndServe starts the server using the standard Go HTTP server implementation. It returns nil once the server
+// has been shut down.
+// serverTLSConfig is only used if certFile and keyFile are set, and may be nil. The certificate and key are reloaded
+// when the files change, so that the certificate can be rotated without restarting the server.
+func (s *HTTPServer) ListenAndServe(host, certFile, keyFile string, serverTLSConfig *tls.Config,
+	router http.Handler) error {
+	srv := &http.Server{Addr: host, Handler: router}
 
-// ListenAndServe starts the server using the standard Go HTTP server implementation.
-func (s *HTTPServer) ListenAndServe(host, certFile, keyFile string, router http.Handler) error {
 	if certFile != "" && keyFile != "" {
-		return http.ListenAndServeTLS(host, certFile, keyFile, router)
+		reloader, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if serverTLSConfig != nil {
+			srv.TLSConfig = serverTLSConfig.Clone()
+		}
+
+		srv.TLSConfig.GetCertificate = reloader.GetCertificate
+	}
+
+	if !s.add(srv) {
+		return nil
+	}
+
+	var err error
+
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Shutdown gracefully shuts down the servers started by ListenAndServe: they stop accepting connections, and
+// Shutdown waits for their in-flight requests to finish until ctx is done.
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.shutdown = true
+	servers := s.servers
+	s.mutex.Unlock()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// add adds a server to be shut down by Shutdown. It returns false if the server has already been shut down.
+func (s *HTTPServer) add(srv *http.Server) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.shutdown {
+		return false
 	}
 
-	return http.ListenAndServe(host, router)
+	s.servers = append(s.servers, srv)
+
+	return true
 }
 
 // GetStartCmd returns the Cobra start command.
@@ -275,307 +751,1058 @@ func GetStartCmd(srv server) *cobra.Command {
 	return startCmd
 }
 
-func createStartCmd(srv server) *cobra.Command { //nolint: funlen,gocyclo
+func createStartCmd(srv server) *cobra.Command {
 	return &cobra.Command{
 		Use:   "start",
 		Short: "Start EDV",
 		Long:  "Start EDV",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			hostURL, err := cmdutils.GetUserSetVarFromString(cmd, hostURLFlagName, hostURLEnvKey, false)
-			if err != nil {
-				return err
-			}
-
-			databaseType, err := cmdutils.GetUserSetVarFromString(cmd, databaseTypeFlagName, databaseTypeEnvKey, false)
-			if err != nil {
-				return err
-			}
-
-			var databaseURL string
-			if databaseType == databaseTypeMemOption {
-				databaseURL = "N/A"
-			} else {
-				var errGetUserSetVar error
-				databaseURL, errGetUserSetVar = cmdutils.GetUserSetVarFromString(cmd, databaseURLFlagName, databaseURLEnvKey, true)
-				if errGetUserSetVar != nil {
-					return errGetUserSetVar
-				}
-			}
-
-			databasePrefix, err := cmdutils.GetUserSetVarFromString(cmd, databasePrefixFlagName, databasePrefixEnvKey, true)
-			if err != nil {
-				return err
-			}
-
-			databaseTimeout, err := getTimeout(cmd)
-			if err != nil {
-				return err
-			}
-
-			databaseRetrievalPageSize, err := getDatabaseRetrievalPageSize(cmd)
-			if err != nil {
-				return err
-			}
-
-			loggingLevel, err := cmdutils.GetUserSetVarFromString(cmd, logLevelFlagName, logLevelEnvKey, true)
-			if err != nil {
-				return err
-			}
-
-			tlsConfig, err := getTLS(cmd)
-			if err != nil {
-				return err
-			}
-
-			authEnable, err := getAuthEnable(cmd)
-			if err != nil {
-				return err
-			}
-
-			corsEnable, err := getCORSEnable(cmd)
-			if err != nil {
-				return err
-			}
-
-			localKMSSecretsStorage, err := getLocalKMSSecretsStorageParameters(cmd, !authEnable)
+			err := applyConfigFile(cmd)
 			if err != nil {
 				return err
 			}
 
-			enabledExtensions, err := getEnabledExtensions(cmd)
+			parameters, err := getEDVParameters(cmd, srv)
 			if err != nil {
 				return err
 			}
 
-			parameters := &edvParameters{
-				srv:                       srv,
-				hostURL:                   hostURL,
-				databaseType:              databaseType,
-				databaseURL:               databaseURL,
-				databasePrefix:            databasePrefix,
-				databaseTimeout:           databaseTimeout,
-				databaseRetrievalPageSize: databaseRetrievalPageSize,
-				logLevel:                  loggingLevel,
-				tlsConfig:                 tlsConfig,
-				authEnable:                authEnable,
-				corsEnable:                corsEnable,
-				localKMSSecretsStorage:    localKMSSecretsStorage,
-				extensionsToEnable:        enabledExtensions,
-			}
 			return startEDV(parameters)
 		},
 	}
 }
 
-func getAuthEnable(cmd *cobra.Command) (bool, error) {
-	authEnableString := cmdutils.GetUserSetOptionalVarFromString(cmd, authEnableFlagName, authEnableEnvKey)
-
-	authEnable := false
-
-	if authEnableString != "" {
-		var err error
-		authEnable, err = strconv.ParseBool(authEnableString)
-
-		if err != nil {
-			return false, err
-		}
+// getEDVParameters returns the parameters of the server, from the flags, environment variables and config file
+// of cmd.
+func getEDVParameters(cmd *cobra.Command, srv server) (*edvParameters, error) { //nolint: funlen,gocyclo
+	hostURL, err := cmdutils.GetUserSetVarFromString(cmd, hostURLFlagName, hostURLEnvKey, false)
+	if err != nil {
+		return nil, err
 	}
 
-	return authEnable, nil
-}
-
-func getCORSEnable(cmd *cobra.Command) (bool, error) {
-	corsEnableString := cmdutils.GetUserSetOptionalVarFromString(cmd, corsEnableFlagName, corsEnableEnvKey)
-
-	corsEnable := false
-
-	if corsEnableString != "" {
-		var err error
-		corsEnable, err = strconv.ParseBool(corsEnableString)
+	databaseType, err := cmdutils.GetUserSetVarFromString(cmd, databaseTypeFlagName, databaseTypeEnvKey, false)
+	if err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return false, err
+	var databaseURL string
+	if databaseType == databaseTypeMemOption {
+		databaseURL = "N/A"
+	} else {
+		var errGetUserSetVar error
+		databaseURL, errGetUserSetVar = cmdutils.GetUserSetVarFromString(cmd, databaseURLFlagName, databaseURLEnvKey,
+			true)
+		if errGetUserSetVar != nil {
+			return nil, errGetUserSetVar
 		}
 	}
 
-	return corsEnable, nil
-}
-
-func getLocalKMSSecretsStorageParameters(cmd *cobra.Command, isOptional bool) (*storageParameters, error) {
-	dbType, err := cmdutils.GetUserSetVarFromString(cmd, localKMSSecretsDatabaseTypeFlagName,
-		localKMSSecretsDatabaseTypeEnvKey, isOptional)
+	databasePrefix, err := cmdutils.GetUserSetVarFromString(cmd, databasePrefixFlagName, databasePrefixEnvKey, true)
 	if err != nil {
 		return nil, err
 	}
 
-	storageParam := &storageParameters{storageType: dbType}
-
-	if dbType != databaseTypeMemOption {
-		dbURL, err := cmdutils.GetUserSetVarFromString(cmd, localKMSSecretsDatabaseURLFlagName,
-			localKMSSecretsDatabaseURLEnvKey, isOptional)
-		if err != nil {
-			return nil, err
-		}
-
-		dbPrefix := cmdutils.GetUserSetOptionalVarFromString(cmd, localKMSSecretsDatabasePrefixFlagName,
-			localKMSSecretsDatabasePrefixEnvKey)
-
-		storageParam.storageURL = dbURL
-		storageParam.storagePrefix = dbPrefix
+	databaseTimeout, err := getTimeout(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	return storageParam, nil
-}
-
-func getEnabledExtensions(cmd *cobra.Command) (*operation.EnabledExtensions, error) {
-	extensionsCSV, err := cmdutils.GetUserSetVarFromString(cmd, extensionsFlagName, extensionsEnvKey, true)
+	databaseRetrievalPageSize, err := getDatabaseRetrievalPageSize(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	extensionsToEnable := strings.Split(extensionsCSV, ",")
-
-	var enabledExtensions operation.EnabledExtensions
-
-	for _, extensionToEnable := range extensionsToEnable {
-		switch {
-		case strings.EqualFold(extensionToEnable, returnFullDocumentOnQueryExtensionName):
-			enabledExtensions.ReturnFullDocumentsOnQuery = true
-		case strings.EqualFold(extensionToEnable, readAllDocumentsExtensionName):
-			enabledExtensions.ReadAllDocumentsEndpoint = true
-		case strings.EqualFold(extensionToEnable, batchExtensionName):
-			enabledExtensions.Batch = true
-		}
+	loggingLevel, err := cmdutils.GetUserSetVarFromString(cmd, logLevelFlagName, logLevelEnvKey, true)
+	if err != nil {
+		return nil, err
 	}
 
-	return &enabledExtensions, nil
-}
-
-func getTimeout(cmd *cobra.Command) (timeout uint64, err error) {
-	databaseTimeout, err := cmdutils.GetUserSetVarFromString(cmd, databaseTimeoutFlagName, databaseTimeoutEnvKey, true)
+	tlsConfig, err := getTLS(cmd)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if databaseTimeout == "" {
-		databaseTimeout = strconv.Itoa(databaseTimeoutDefault)
+	authType, err := getAuthType(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	databaseTimeoutInt, err := strconv.Atoi(databaseTimeout)
+	oauth2Params, err := getOAuth2Parameters(cmd, authType != oauth2AuthType)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse timeout %s: %w", databaseTimeout, err)
+		return nil, err
 	}
 
-	return uint64(databaseTimeoutInt), nil
-}
+	controllerProofRequired, err := getControllerProofRequired(cmd,
+		authType != noAuthType || tlsConfig.clientRulesFile != "")
+	if err != nil {
+		return nil, err
+	}
 
-func getDatabaseRetrievalPageSize(cmd *cobra.Command) (uint, error) {
-	databaseRetrievalPageSize, err := cmdutils.GetUserSetVarFromString(cmd,
-		databaseRetrievalPageSizeFlagName, databaseRetrievalPageSizeEnvKey, true)
+	corsParams, err := getCORSParameters(cmd)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if databaseRetrievalPageSize == "" {
-		databaseRetrievalPageSize = strconv.Itoa(databaseRetrievalPageSizeDefault)
+	rateLimitParams, err := getRateLimitParameters(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	databaseRetrievalPageSizeInt, err := strconv.ParseUint(databaseRetrievalPageSize, 10, 0)
+	localKMSSecretsStorage, err := getLocalKMSSecretsStorageParameters(cmd, authType != zcapAuthType)
 	if err != nil {
-		return 0,
-			fmt.Errorf("failed to parse database retrieval page size %s into a string: %w",
-				databaseRetrievalPageSize, err)
+		return nil, err
 	}
 
-	return uint(databaseRetrievalPageSizeInt), nil
-}
+	enabledExtensions, err := getEnabledExtensions(cmd)
+	if err != nil {
+		return nil, err
+	}
 
-func getTLS(cmd *cobra.Command) (*tlsConfig, error) {
-	tlsCertFile, err := cmdutils.GetUserSetVarFromString(cmd, tlsCertFileFlagName,
-		tlsCertFileEnvKey, true)
+	didResolution, err := getDIDResolutionParameters(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	tlsKeyFile, err := cmdutils.GetUserSetVarFromString(cmd, tlsKeyFileFlagName,
-		tlsKeyFileEnvKey, true)
+	idempotencyKeyTTL, err := getIdempotencyKeyTTL(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	return &tlsConfig{certFile: tlsCertFile, keyFile: tlsKeyFile}, nil
-}
+	metricsParams, err := getMetricsParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
 
-func createFlags(startCmd *cobra.Command) {
-	startCmd.Flags().StringP(hostURLFlagName, hostURLFlagShorthand, "", hostURLFlagUsage)
-	startCmd.Flags().StringP(databaseTypeFlagName, databaseTypeFlagShorthand, "", databaseTypeFlagUsage)
-	startCmd.Flags().StringP(databaseURLFlagName, databaseURLFlagShorthand, "", databaseURLFlagUsage)
-	startCmd.Flags().StringP(databasePrefixFlagName, databasePrefixFlagShorthand, "", databasePrefixFlagUsage)
-	startCmd.Flags().StringP(databaseTimeoutFlagName, databaseTimeoutFlagShorthand, "", databaseTimeoutFlagUsage)
-	startCmd.Flags().StringP(databaseRetrievalPageSizeFlagName,
-		databaseRetrievalPageSizeFlagShorthand, "", databaseRetrievalPageSizeFlagUsage)
-	startCmd.Flags().StringP(logLevelFlagName, logLevelFlagShorthand, "", logLevelPrefixFlagUsage)
-	startCmd.Flags().StringP(tlsCertFileFlagName, tlsCertFileFlagShorthand, "", tlsCertFileFlagUsage)
-	startCmd.Flags().StringP(tlsKeyFileFlagName, tlsKeyFileFlagShorthand, "", tlsKeyFileFlagUsage)
-	startCmd.Flags().StringP(localKMSSecretsDatabaseTypeFlagName, "", "",
-		localKMSSecretsDatabaseTypeFlagUsage)
-	startCmd.Flags().StringP(localKMSSecretsDatabaseURLFlagName, "", "",
-		localKMSSecretsDatabaseURLFlagUsage)
-	startCmd.Flags().StringP(localKMSSecretsDatabasePrefixFlagName, "", "",
-		localKMSSecretsDatabasePrefixFlagUsage)
-	startCmd.Flags().StringP(authEnableFlagName, "", "", authEnableFlagUsage)
-	startCmd.Flags().StringP(extensionsFlagName, "", "", extensionsFlagUsage)
-	startCmd.Flags().StringP(corsEnableFlagName, "", "", corsEnableFlagUsage)
-}
+	tracingParams, err := getTracingParameters(cmd)
+	if err != nil {
+		return nil, err
+	}
 
-func startEDV(parameters *edvParameters) error { //nolint: funlen,gocyclo
-	if parameters.logLevel != "" {
-		setLogLevel(parameters.logLevel)
+	healthCheckParams, err := getHealthCheckParameters(cmd)
+	if err != nil {
+		return nil, err
 	}
 
-	provider, err := createEDVProvider(parameters)
+	auditParams, err := getAuditParameters(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = createConfigStore(provider)
+	shutdownTimeout, err := getShutdownTimeout(cmd)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// create auth service
-	var authSvc authService
+	parameters := &edvParameters{
+		srv:                       srv,
+		hostURL:                   hostURL,
+		databaseType:              databaseType,
+		databaseURL:               databaseURL,
+		databasePrefix:            databasePrefix,
+		databaseTimeout:           databaseTimeout,
+		databaseRetrievalPageSize: databaseRetrievalPageSize,
+		logLevel:                  loggingLevel,
+		tlsConfig:                 tlsConfig,
+		authType:                  authType,
+		oauth2:                    oauth2Params,
+		controllerProofRequired:   controllerProofRequired,
+		cors:                      corsParams,
+		rateLimit:                 rateLimitParams,
+		localKMSSecretsStorage:    localKMSSecretsStorage,
+		extensionsToEnable:        enabledExtensions,
+		didResolution:             didResolution,
+		idempotencyKeyTTL:         idempotencyKeyTTL,
+		metrics:                   metricsParams,
+		tracing:                   tracingParams,
+		healthCheck:               healthCheckParams,
+		audit:                     auditParams,
+		shutdownTimeout:           shutdownTimeout,
+	}
 
-	if parameters.authEnable {
-		keyManager, errCreate := createKeyManager(parameters)
-		if errCreate != nil {
-			return errCreate
-		}
+	return parameters, nil
+}
 
-		// create crypto
-		crypto, errCreate := tinkcrypto.New()
-		if errCreate != nil {
-			return errCreate
-		}
+func getAuthType(cmd *cobra.Command) (string, error) {
+	authType := cmdutils.GetUserSetOptionalVarFromString(cmd, authTypeFlagName, authTypeEnvKey)
+	authEnableString := cmdutils.GetUserSetOptionalVarFromString(cmd, authEnableFlagName, authEnableEnvKey)
 
-		storageProvider, errCreate := createAriesStorageProvider(&storageParameters{
-			storageType: parameters.databaseType,
-			storageURL:  parameters.databaseURL, storagePrefix: parameters.databasePrefix,
-		}, parameters.databaseTimeout)
-		if errCreate != nil {
-			return errCreate
+	if authType != "" && authEnableString != "" {
+		return "", fmt.Errorf("%s and %s can't both be set", authTypeFlagName, authEnableFlagName)
+	}
+
+	switch authType {
+	case "":
+		if authEnableString == "" {
+			return noAuthType, nil
+		}
+
+		authEnable, err := strconv.ParseBool(authEnableString)
+		if err != nil {
+			return "", err
+		}
+
+		if authEnable {
+			return zcapAuthType, nil
+		}
+
+		return noAuthType, nil
+	case noAuthType, zcapAuthType, oauth2AuthType:
+		return authType, nil
+	default:
+		return "", fmt.Errorf("unsupported %s: %s", authTypeFlagName, authType)
+	}
+}
+
+func getOAuth2Parameters(cmd *cobra.Command, isOptional bool) (*oauth2Parameters, error) {
+	params := &oauth2Parameters{
+		jwksURL:  cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2JWKSURLFlagName, oauth2JWKSURLEnvKey),
+		jwksFile: cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2JWKSFileFlagName, oauth2JWKSFileEnvKey),
+		issuer:   cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2IssuerFlagName, oauth2IssuerEnvKey),
+		audience: cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2AudienceFlagName, oauth2AudienceEnvKey),
+		controllerClaim: cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2ControllerClaimFlagName,
+			oauth2ControllerClaimEnvKey),
+		readScope: cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2ReadScopeFlagName, oauth2ReadScopeEnvKey),
+		writeScope: cmdutils.GetUserSetOptionalVarFromString(cmd, oauth2WriteScopeFlagName,
+			oauth2WriteScopeEnvKey),
+	}
+
+	if isOptional {
+		return params, nil
+	}
+
+	if (params.jwksURL == "") == (params.jwksFile == "") {
+		return nil, fmt.Errorf("exactly one of %s and %s must be set if %s is %s", oauth2JWKSURLFlagName,
+			oauth2JWKSFileFlagName, authTypeFlagName, oauth2AuthType)
+	}
+
+	if params.controllerClaim == "" {
+		params.controllerClaim = oauth2.DefaultControllerClaim
+	}
+
+	if params.readScope == "" {
+		params.readScope = oauth2.DefaultReadScope
+	}
+
+	if params.writeScope == "" {
+		params.writeScope = oauth2.DefaultWriteScope
+	}
+
+	return params, nil
+}
+
+func getControllerProofRequired(cmd *cobra.Command, authEnabled bool) (bool, error) {
+	controllerProofRequiredString := cmdutils.GetUserSetOptionalVarFromString(cmd, controllerProofRequiredFlagName,
+		controllerProofRequiredEnvKey)
+
+	if controllerProofRequiredString == "" {
+		return false, nil
+	}
+
+	controllerProofRequired, err := strconv.ParseBool(controllerProofRequiredString)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", controllerProofRequiredFlagName, err)
+	}
+
+	if controllerProofRequired && !authEnabled {
+		return false, fmt.Errorf("%s requires authorization to be enabled with %s or %s",
+			controllerProofRequiredFlagName, authTypeFlagName, tlsClientRulesFileFlagName)
+	}
+
+	return controllerProofRequired, nil
+}
+
+// getCORSParameters returns the CORS policy, or nil if no origins are allowed. The other CORS flags can only be set
+// together with the allowed origins, so that a policy isn't silently ignored.
+func getCORSParameters(cmd *cobra.Command) (*corsParameters, error) { //nolint: funlen,gocyclo
+	allowedOrigins := getCSV(cmd, corsAllowedOriginsFlagName, corsAllowedOriginsEnvKey)
+
+	if len(allowedOrigins) == 0 {
+		for _, name := range []string{
+			corsAllowedMethodsFlagName, corsAllowedHeadersFlagName, corsExposedHeadersFlagName,
+			corsAllowCredentialsFlagName, corsMaxAgeFlagName,
+		} {
+			if cmdutils.GetUserSetOptionalVarFromString(cmd, name, flagEnvKeys[name]) != "" {
+				return nil, fmt.Errorf("%s requires %s to be set", name, corsAllowedOriginsFlagName)
+			}
+		}
+
+		return nil, nil
+	}
+
+	for _, origin := range allowedOrigins {
+		err := validateCORSOrigin(origin)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", corsAllowedOriginsFlagName, origin, err)
+		}
+	}
+
+	parameters := &corsParameters{
+		allowedOrigins: allowedOrigins,
+		allowedMethods: defaultCORSAllowedMethods,
+		allowedHeaders: defaultCORSAllowedHeaders,
+		exposedHeaders: defaultCORSExposedHeaders,
+	}
+
+	if methods := getCSV(cmd, corsAllowedMethodsFlagName, corsAllowedMethodsEnvKey); len(methods) > 0 {
+		for _, method := range methods {
+			if !isCORSMethod(method) {
+				return nil, fmt.Errorf("unsupported %s: %s", corsAllowedMethodsFlagName, method)
+			}
+		}
+
+		parameters.allowedMethods = methods
+	}
+
+	if headers := getCSV(cmd, corsAllowedHeadersFlagName, corsAllowedHeadersEnvKey); len(headers) > 0 {
+		err := validateCORSHeaders(headers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", corsAllowedHeadersFlagName, err)
+		}
+
+		parameters.allowedHeaders = headers
+	}
+
+	if headers := getCSV(cmd, corsExposedHeadersFlagName, corsExposedHeadersEnvKey); len(headers) > 0 {
+		err := validateCORSHeaders(headers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", corsExposedHeadersFlagName, err)
+		}
+
+		parameters.exposedHeaders = headers
+	}
+
+	allowCredentials := cmdutils.GetUserSetOptionalVarFromString(cmd, corsAllowCredentialsFlagName,
+		corsAllowCredentialsEnvKey)
+	if allowCredentials != "" {
+		var err error
+
+		parameters.allowCredentials, err = strconv.ParseBool(allowCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", corsAllowCredentialsFlagName, err)
+		}
+	}
+
+	if parameters.allowCredentials && containsString(allowedOrigins, corsAnyOrigin) {
+		return nil, fmt.Errorf("%s can't be used if %s allows any origin", corsAllowCredentialsFlagName,
+			corsAllowedOriginsFlagName)
+	}
+
+	maxAge := cmdutils.GetUserSetOptionalVarFromString(cmd, corsMaxAgeFlagName, corsMaxAgeEnvKey)
+	if maxAge != "" {
+		var err error
+
+		parameters.maxAge, err = time.ParseDuration(maxAge)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s: %w", corsMaxAgeFlagName, maxAge, err)
+		}
+
+		if parameters.maxAge <= 0 || parameters.maxAge%time.Second != 0 {
+			return nil, fmt.Errorf("%s must be a positive number of whole seconds", corsMaxAgeFlagName)
+		}
+	}
+
+	return parameters, nil
+}
+
+// getRateLimitParameters returns the rate limits, or nil if rate-limit-requests isn't set. The other rate limit flags
+// can only be set together with it.
+func getRateLimitParameters(cmd *cobra.Command) (*rateLimitParameters, error) { //nolint: funlen,gocyclo
+	requests := cmdutils.GetUserSetOptionalVarFromString(cmd, rateLimitRequestsFlagName, rateLimitRequestsEnvKey)
+	if requests == "" {
+		for _, name := range []string{
+			rateLimitBurstFlagName, rateLimitExpensiveRequestsFlagName, rateLimitExpensiveBurstFlagName,
+			rateLimitKeysFlagName, rateLimitTrustedProxiesFlagName,
+		} {
+			if cmdutils.GetUserSetOptionalVarFromString(cmd, name, flagEnvKeys[name]) != "" {
+				return nil, fmt.Errorf("%s requires %s to be set", name, rateLimitRequestsFlagName)
+			}
+		}
+
+		return nil, nil
+	}
+
+	parameters := &rateLimitParameters{
+		keys: defaultRateLimitKeys,
+	}
+
+	var err error
+
+	parameters.budget.RequestsPerSecond, err = parseRate(rateLimitRequestsFlagName, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters.expensiveBudget.RequestsPerSecond = parameters.budget.RequestsPerSecond * rateLimitExpensiveFraction
+
+	expensiveRequests := cmdutils.GetUserSetOptionalVarFromString(cmd, rateLimitExpensiveRequestsFlagName,
+		rateLimitExpensiveRequestsEnvKey)
+	if expensiveRequests != "" {
+		parameters.expensiveBudget.RequestsPerSecond, err = parseRate(rateLimitExpensiveRequestsFlagName,
+			expensiveRequests)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	parameters.budget.Burst, err = getBurst(cmd, rateLimitBurstFlagName, rateLimitBurstEnvKey,
+		parameters.budget.RequestsPerSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters.expensiveBudget.Burst, err = getBurst(cmd, rateLimitExpensiveBurstFlagName,
+		rateLimitExpensiveBurstEnvKey, parameters.expensiveBudget.RequestsPerSecond)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys := getCSV(cmd, rateLimitKeysFlagName, rateLimitKeysEnvKey); len(keys) > 0 {
+		for _, key := range keys {
+			switch key {
+			case ratelimit.ClientIPKey, ratelimit.InvokerKey, ratelimit.VaultKey:
+			default:
+				return nil, fmt.Errorf("unsupported %s: %s", rateLimitKeysFlagName, key)
+			}
+		}
+
+		parameters.keys = keys
+	}
+
+	for _, proxy := range getCSV(cmd, rateLimitTrustedProxiesFlagName, rateLimitTrustedProxiesEnvKey) {
+		network, err := parseNetwork(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s: %w", rateLimitTrustedProxiesFlagName, proxy, err)
 		}
 
-		authSvc, err = zcapld.New(keyManager, crypto, storageProvider)
+		parameters.trustedProxies = append(parameters.trustedProxies, network)
+	}
+
+	return parameters, nil
+}
+
+// parseNetwork parses a CIDR network, or an IP address as the network of just that address.
+func parseNetwork(network string) (*net.IPNet, error) {
+	if !strings.Contains(network, "/") {
+		ip := net.ParseIP(network)
+		if ip == nil {
+			return nil, errors.New("not an IP address or CIDR network")
+		}
+
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(network)
+
+	return ipNet, err
+}
+
+func parseRate(flagName, rate string) (float64, error) {
+	requestsPerSecond, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %s: %w", flagName, rate, err)
+	}
+
+	if requestsPerSecond <= 0 || math.IsInf(requestsPerSecond, 0) {
+		return 0, fmt.Errorf("%s must be a positive number", flagName)
+	}
+
+	return requestsPerSecond, nil
+}
+
+// getBurst returns the burst set by the flag, or the rate rounded up if it isn't set.
+func getBurst(cmd *cobra.Command, flagName, envKey string, requestsPerSecond float64) (int, error) {
+	burst := cmdutils.GetUserSetOptionalVarFromString(cmd, flagName, envKey)
+	if burst == "" {
+		return int(math.Ceil(requestsPerSecond)), nil
+	}
+
+	burstValue, err := strconv.Atoi(burst)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %s: %w", flagName, burst, err)
+	}
+
+	if burstValue <= 0 {
+		return 0, fmt.Errorf("%s must be positive", flagName)
+	}
+
+	return burstValue, nil
+}
+
+// validateCORSOrigin checks that an allowed origin is * or a scheme and host (and optionally a port), with at most
+// one * as a wildcard.
+func validateCORSOrigin(origin string) error {
+	if origin == corsAnyOrigin {
+		return nil
+	}
+
+	if strings.Count(origin, "*") > 1 {
+		return errors.New("must contain at most one *")
+	}
+
+	// The wildcard isn't valid in a URL, so it's replaced by a valid host label to parse the origin.
+	originURL, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil {
+		return err
+	}
+
+	if originURL.Scheme != "http" && originURL.Scheme != "https" {
+		return errors.New("scheme must be http or https")
+	}
+
+	if originURL.Host == "" || originURL.User != nil || originURL.Path != "" || originURL.RawQuery != "" ||
+		originURL.Fragment != "" {
+		return errors.New("must be a scheme and host, such as https://wallet.example.com")
+	}
+
+	return nil
+}
+
+// validateCORSHeaders checks that the headers are header names. The * wildcard isn't supported, so that the headers
+// are listed explicitly.
+func validateCORSHeaders(headers []string) error {
+	for _, header := range headers {
+		if header == "*" {
+			return errors.New("* isn't supported, list the headers instead")
+		}
+
+		if strings.ContainsAny(header, " \t\"(),/:;<=>?@[\\]{}") {
+			return fmt.Errorf("%q isn't a header name", header)
+		}
+	}
+
+	return nil
+}
+
+func isCORSMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// getCSV returns the trimmed, non-empty items of a comma-separated flag.
+func getCSV(cmd *cobra.Command, flagName, envKey string) []string {
+	var items []string
+
+	for _, item := range strings.Split(cmdutils.GetUserSetOptionalVarFromString(cmd, flagName, envKey), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getMetricsParameters(cmd *cobra.Command) (*metricsParameters, error) {
+	metricsURL := cmdutils.GetUserSetOptionalVarFromString(cmd, metricsURLFlagName, metricsURLEnvKey)
+
+	vaultLabelString := cmdutils.GetUserSetOptionalVarFromString(cmd, metricsVaultLabelFlagName,
+		metricsVaultLabelEnvKey)
+
+	if vaultLabelString == "" {
+		return &metricsParameters{url: metricsURL}, nil
+	}
+
+	vaultLabel, err := strconv.ParseBool(vaultLabelString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", metricsVaultLabelFlagName, err)
+	}
+
+	return &metricsParameters{url: metricsURL, vaultLabel: vaultLabel}, nil
+}
+
+func getTracingParameters(cmd *cobra.Command) (*tracingParameters, error) {
+	exporter := cmdutils.GetUserSetOptionalVarFromString(cmd, tracingExporterFlagName, tracingExporterEnvKey)
+
+	switch exporter {
+	case "":
+		exporter = noTracingExporter
+	case noTracingExporter, otlpTracingExporter, stdoutTracingExporter:
+	default:
+		return nil, fmt.Errorf("unsupported %s: %s", tracingExporterFlagName, exporter)
+	}
+
+	otlpURL := cmdutils.GetUserSetOptionalVarFromString(cmd, tracingOTLPURLFlagName, tracingOTLPURLEnvKey)
+	if otlpURL == "" {
+		otlpURL = tracingOTLPURLDefault
+	}
+
+	return &tracingParameters{exporter: exporter, otlpURL: otlpURL}, nil
+}
+
+func getHealthCheckParameters(cmd *cobra.Command) (*healthCheckParameters, error) {
+	parameters := &healthCheckParameters{
+		timeout:          healthCheckTimeoutDefault,
+		minFreeDiskSpace: healthCheckMinFreeDiskSpaceDefault * bytesPerMegabyte,
+	}
+
+	timeout := cmdutils.GetUserSetOptionalVarFromString(cmd, healthCheckTimeoutFlagName, healthCheckTimeoutEnvKey)
+	if timeout != "" {
+		var err error
+
+		parameters.timeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s: %w", healthCheckTimeoutFlagName, timeout, err)
+		}
+
+		if parameters.timeout <= 0 {
+			return nil, fmt.Errorf("%s must be positive", healthCheckTimeoutFlagName)
+		}
+	}
+
+	diskPathsCSV := cmdutils.GetUserSetOptionalVarFromString(cmd, healthCheckDiskPathsFlagName,
+		healthCheckDiskPathsEnvKey)
+	if diskPathsCSV != "" {
+		for _, path := range strings.Split(diskPathsCSV, ",") {
+			parameters.diskPaths = append(parameters.diskPaths, strings.TrimSpace(path))
+		}
+	}
+
+	minFreeDiskSpace := cmdutils.GetUserSetOptionalVarFromString(cmd, healthCheckMinFreeDiskSpaceFlagName,
+		healthCheckMinFreeDiskSpaceEnvKey)
+	if minFreeDiskSpace != "" {
+		megabytes, err := strconv.ParseUint(minFreeDiskSpace, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s: %w", healthCheckMinFreeDiskSpaceFlagName,
+				minFreeDiskSpace, err)
+		}
+
+		parameters.minFreeDiskSpace = megabytes * bytesPerMegabyte
+	}
+
+	return parameters, nil
+}
+
+func getAuditParameters(cmd *cobra.Command) (*auditParameters, error) {
+	logType := cmdutils.GetUserSetOptionalVarFromString(cmd, auditLogTypeFlagName, auditLogTypeEnvKey)
+
+	switch logType {
+	case "":
+		logType = noAuditLog
+	case noAuditLog, fileAuditLog, databaseAuditLog:
+	default:
+		return nil, fmt.Errorf("unsupported %s: %s", auditLogTypeFlagName, logType)
+	}
+
+	file := cmdutils.GetUserSetOptionalVarFromString(cmd, auditLogFileFlagName, auditLogFileEnvKey)
+	if logType == fileAuditLog && file == "" {
+		return nil, fmt.Errorf("%s is required if %s is %s", auditLogFileFlagName, auditLogTypeFlagName,
+			fileAuditLog)
+	}
+
+	return &auditParameters{logType: logType, file: file}, nil
+}
+
+func getLocalKMSSecretsStorageParameters(cmd *cobra.Command, isOptional bool) (*storageParameters, error) {
+	dbType, err := cmdutils.GetUserSetVarFromString(cmd, localKMSSecretsDatabaseTypeFlagName,
+		localKMSSecretsDatabaseTypeEnvKey, isOptional)
+	if err != nil {
+		return nil, err
+	}
+
+	storageParam := &storageParameters{storageType: dbType}
+
+	if dbType != databaseTypeMemOption {
+		dbURL, err := cmdutils.GetUserSetVarFromString(cmd, localKMSSecretsDatabaseURLFlagName,
+			localKMSSecretsDatabaseURLEnvKey, isOptional)
+		if err != nil {
+			return nil, err
+		}
+
+		dbPrefix := cmdutils.GetUserSetOptionalVarFromString(cmd, localKMSSecretsDatabasePrefixFlagName,
+			localKMSSecretsDatabasePrefixEnvKey)
+
+		storageParam.storageURL = dbURL
+		storageParam.storagePrefix = dbPrefix
+	}
+
+	return storageParam, nil
+}
+
+func getEnabledExtensions(cmd *cobra.Command) (*operation.EnabledExtensions, error) {
+	extensionsCSV, err := cmdutils.GetUserSetVarFromString(cmd, extensionsFlagName, extensionsEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	extensionsToEnable := strings.Split(extensionsCSV, ",")
+
+	var enabledExtensions operation.EnabledExtensions
+
+	for _, extensionToEnable := range extensionsToEnable {
+		switch {
+		case strings.EqualFold(extensionToEnable, returnFullDocumentOnQueryExtensionName):
+			enabledExtensions.ReturnFullDocumentsOnQuery = true
+		case strings.EqualFold(extensionToEnable, readAllDocumentsExtensionName):
+			enabledExtensions.ReadAllDocumentsEndpoint = true
+		case strings.EqualFold(extensionToEnable, batchExtensionName):
+			enabledExtensions.Batch = true
+		}
+	}
+
+	return &enabledExtensions, nil
+}
+
+func defaultDIDResolutionParameters() *didResolutionParameters {
+	return &didResolutionParameters{
+		methods:  []string{didresolver.KeyMethod},
+		cacheTTL: didresolver.DefaultCacheTTL,
+	}
+}
+
+func getDIDResolutionParameters(cmd *cobra.Command) (*didResolutionParameters, error) {
+	parameters := defaultDIDResolutionParameters()
+
+	methodsCSV := cmdutils.GetUserSetOptionalVarFromString(cmd, didMethodsFlagName, didMethodsEnvKey)
+	if methodsCSV != "" {
+		parameters.methods = nil
+
+		for _, method := range strings.Split(methodsCSV, ",") {
+			method = strings.TrimSpace(method)
+
+			switch method {
+			case didresolver.KeyMethod, didresolver.PeerMethod, didresolver.WebMethod:
+				parameters.methods = append(parameters.methods, method)
+			default:
+				return nil, fmt.Errorf("unsupported DID method %q in %s", method, didMethodsFlagName)
+			}
+		}
+	}
+
+	cacheTTL := cmdutils.GetUserSetOptionalVarFromString(cmd, didCacheTTLFlagName, didCacheTTLEnvKey)
+	if cacheTTL != "" {
+		var err error
+
+		parameters.cacheTTL, err = time.ParseDuration(cacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s: %w", didCacheTTLFlagName, cacheTTL, err)
+		}
+	}
+
+	return parameters, nil
+}
+
+func getIdempotencyKeyTTL(cmd *cobra.Command) (time.Duration, error) {
+	ttl := cmdutils.GetUserSetOptionalVarFromString(cmd, idempotencyKeyTTLFlagName, idempotencyKeyTTLEnvKey)
+	if ttl == "" {
+		return idempotencyKeyTTLDefault, nil
+	}
+
+	idempotencyKeyTTL, err := time.ParseDuration(ttl)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %s: %w", idempotencyKeyTTLFlagName, ttl, err)
+	}
+
+	if idempotencyKeyTTL < 0 {
+		return 0, fmt.Errorf("%s must not be negative", idempotencyKeyTTLFlagName)
+	}
+
+	return idempotencyKeyTTL, nil
+}
+
+func getShutdownTimeout(cmd *cobra.Command) (time.Duration, error) {
+	timeout := cmdutils.GetUserSetOptionalVarFromString(cmd, shutdownTimeoutFlagName, shutdownTimeoutEnvKey)
+	if timeout == "" {
+		return shutdownTimeoutDefault, nil
+	}
+
+	shutdownTimeout, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %s: %w", shutdownTimeoutFlagName, timeout, err)
+	}
+
+	if shutdownTimeout <= 0 {
+		return 0, fmt.Errorf("%s must be positive", shutdownTimeoutFlagName)
+	}
+
+	return shutdownTimeout, nil
+}
+
+func getTimeout(cmd *cobra.Command) (timeout uint64, err error) {
+	databaseTimeout, err := cmdutils.GetUserSetVarFromString(cmd, databaseTimeoutFlagName, databaseTimeoutEnvKey, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if databaseTimeout == "" {
+		databaseTimeout = strconv.Itoa(databaseTimeoutDefault)
+	}
+
+	databaseTimeoutInt, err := strconv.Atoi(databaseTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse timeout %s: %w", databaseTimeout, err)
+	}
+
+	return uint64(databaseTimeoutInt), nil
+}
+
+func getDatabaseRetrievalPageSize(cmd *cobra.Command) (uint, error) {
+	databaseRetrievalPageSize, err := cmdutils.GetUserSetVarFromString(cmd,
+		databaseRetrievalPageSizeFlagName, databaseRetrievalPageSizeEnvKey, true)
+	if err != nil {
+		return 0, err
+	}
+
+	if databaseRetrievalPageSize == "" {
+		databaseRetrievalPageSize = strconv.Itoa(databaseRetrievalPageSizeDefault)
+	}
+
+	databaseRetrievalPageSizeInt, err := strconv.ParseUint(databaseRetrievalPageSize, 10, 0)
+	if err != nil {
+		return 0,
+			fmt.Errorf("failed to parse database retrieval page size %s into a string: %w",
+				databaseRetrievalPageSize, err)
+	}
+
+	return uint(databaseRetrievalPageSizeInt), nil
+}
+
+func getTLS(cmd *cobra.Command) (*tlsConfig, error) {
+	tlsCertFile, err := cmdutils.GetUserSetVarFromString(cmd, tlsCertFileFlagName,
+		tlsCertFileEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsKeyFile, err := cmdutils.GetUserSetVarFromString(cmd, tlsKeyFileFlagName,
+		tlsKeyFileEnvKey, true)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tlsConfig{certFile: tlsCertFile, keyFile: tlsKeyFile}
+
+	config.clientCAFile = cmdutils.GetUserSetOptionalVarFromString(cmd, tlsClientCAFileFlagName, tlsClientCAFileEnvKey)
+	config.clientRulesFile = cmdutils.GetUserSetOptionalVarFromString(cmd, tlsClientRulesFileFlagName,
+		tlsClientRulesFileEnvKey)
+
+	config.clientAuth, err = getClientAuth(cmd, config.clientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+
+	if config.clientCAFile != "" && (tlsCertFile == "" || tlsKeyFile == "") {
+		return nil, fmt.Errorf("%s requires %s and %s to be set", tlsClientCAFileFlagName, tlsCertFileFlagName,
+			tlsKeyFileFlagName)
+	}
+
+	if config.clientRulesFile != "" && config.clientAuth == tls.NoClientCert {
+		return nil, fmt.Errorf("%s requires client certificates to be verified with %s", tlsClientRulesFileFlagName,
+			tlsClientCAFileFlagName)
+	}
+
+	return config, nil
+}
+
+func getClientAuth(cmd *cobra.Command, clientCAFileSet bool) (tls.ClientAuthType, error) {
+	clientAuth := cmdutils.GetUserSetOptionalVarFromString(cmd, tlsClientAuthFlagName, tlsClientAuthEnvKey)
+
+	if clientAuth == "" {
+		if clientCAFileSet {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+
+		return tls.NoClientCert, nil
+	}
+
+	switch clientAuth {
+	case noClientAuth:
+		return tls.NoClientCert, nil
+	case optionalClientAuth, requiredClientAuth:
+		if !clientCAFileSet {
+			return tls.NoClientCert, fmt.Errorf("%s %s requires %s to be set", tlsClientAuthFlagName, clientAuth,
+				tlsClientCAFileFlagName)
+		}
+
+		if clientAuth == optionalClientAuth {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported %s: %s", tlsClientAuthFlagName, clientAuth)
+	}
+}
+
+// createServerTLSConfig returns the TLS config that verifies client certificates, or nil if client certificates
+// aren't used.
+func createServerTLSConfig(config *tlsConfig) (*tls.Config, error) {
+	if config.clientAuth == tls.NoClientCert {
+		return nil, nil
+	}
+
+	caBytes, err := ioutil.ReadFile(config.clientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caBytes) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", config.clientCAFile)
+	}
+
+	return &tls.Config{ClientCAs: clientCAs, ClientAuth: config.clientAuth, MinVersion: tls.VersionTLS12}, nil
+}
+
+func createFlags(startCmd *cobra.Command) {
+	startCmd.Flags().StringP(hostURLFlagName, hostURLFlagShorthand, "", hostURLFlagUsage)
+	startCmd.Flags().StringP(databaseTypeFlagName, databaseTypeFlagShorthand, "", databaseTypeFlagUsage)
+	startCmd.Flags().StringP(databaseURLFlagName, databaseURLFlagShorthand, "", databaseURLFlagUsage)
+	startCmd.Flags().StringP(databasePrefixFlagName, databasePrefixFlagShorthand, "", databasePrefixFlagUsage)
+	startCmd.Flags().StringP(databaseTimeoutFlagName, databaseTimeoutFlagShorthand, "", databaseTimeoutFlagUsage)
+	startCmd.Flags().StringP(databaseRetrievalPageSizeFlagName,
+		databaseRetrievalPageSizeFlagShorthand, "", databaseRetrievalPageSizeFlagUsage)
+	startCmd.Flags().StringP(logLevelFlagName, logLevelFlagShorthand, "", logLevelPrefixFlagUsage)
+	startCmd.Flags().StringP(tlsCertFileFlagName, tlsCertFileFlagShorthand, "", tlsCertFileFlagUsage)
+	startCmd.Flags().StringP(tlsKeyFileFlagName, tlsKeyFileFlagShorthand, "", tlsKeyFileFlagUsage)
+	startCmd.Flags().StringP(tlsClientCAFileFlagName, "", "", tlsClientCAFileFlagUsage)
+	startCmd.Flags().StringP(tlsClientAuthFlagName, "", "", tlsClientAuthFlagUsage)
+	startCmd.Flags().StringP(tlsClientRulesFileFlagName, "", "", tlsClientRulesFileFlagUsage)
+	startCmd.Flags().StringP(localKMSSecretsDatabaseTypeFlagName, "", "",
+		localKMSSecretsDatabaseTypeFlagUsage)
+	startCmd.Flags().StringP(localKMSSecretsDatabaseURLFlagName, "", "",
+		localKMSSecretsDatabaseURLFlagUsage)
+	startCmd.Flags().StringP(localKMSSecretsDatabasePrefixFlagName, "", "",
+		localKMSSecretsDatabasePrefixFlagUsage)
+	startCmd.Flags().StringP(authEnableFlagName, "", "", authEnableFlagUsage)
+	startCmd.Flags().StringP(authTypeFlagName, "", "", authTypeFlagUsage)
+	startCmd.Flags().StringP(oauth2JWKSURLFlagName, "", "", oauth2JWKSURLFlagUsage)
+	startCmd.Flags().StringP(oauth2JWKSFileFlagName, "", "", oauth2JWKSFileFlagUsage)
+	startCmd.Flags().StringP(oauth2IssuerFlagName, "", "", oauth2IssuerFlagUsage)
+	startCmd.Flags().StringP(oauth2AudienceFlagName, "", "", oauth2AudienceFlagUsage)
+	startCmd.Flags().StringP(oauth2ControllerClaimFlagName, "", "", oauth2ControllerClaimFlagUsage)
+	startCmd.Flags().StringP(oauth2ReadScopeFlagName, "", "", oauth2ReadScopeFlagUsage)
+	startCmd.Flags().StringP(oauth2WriteScopeFlagName, "", "", oauth2WriteScopeFlagUsage)
+	startCmd.Flags().StringP(controllerProofRequiredFlagName, "", "", controllerProofRequiredFlagUsage)
+	startCmd.Flags().StringP(extensionsFlagName, "", "", extensionsFlagUsage)
+	startCmd.Flags().StringP(corsAllowedOriginsFlagName, "", "", corsAllowedOriginsFlagUsage)
+	startCmd.Flags().StringP(corsAllowedMethodsFlagName, "", "", corsAllowedMethodsFlagUsage)
+	startCmd.Flags().StringP(corsAllowedHeadersFlagName, "", "", corsAllowedHeadersFlagUsage)
+	startCmd.Flags().StringP(corsExposedHeadersFlagName, "", "", corsExposedHeadersFlagUsage)
+	startCmd.Flags().StringP(corsAllowCredentialsFlagName, "", "", corsAllowCredentialsFlagUsage)
+	startCmd.Flags().StringP(corsMaxAgeFlagName, "", "", corsMaxAgeFlagUsage)
+	startCmd.Flags().StringP(rateLimitRequestsFlagName, "", "", rateLimitRequestsFlagUsage)
+	startCmd.Flags().StringP(rateLimitBurstFlagName, "", "", rateLimitBurstFlagUsage)
+	startCmd.Flags().StringP(rateLimitExpensiveRequestsFlagName, "", "", rateLimitExpensiveRequestsFlagUsage)
+	startCmd.Flags().StringP(rateLimitExpensiveBurstFlagName, "", "", rateLimitExpensiveBurstFlagUsage)
+	startCmd.Flags().StringP(rateLimitKeysFlagName, "", "", rateLimitKeysFlagUsage)
+	startCmd.Flags().StringP(rateLimitTrustedProxiesFlagName, "", "", rateLimitTrustedProxiesFlagUsage)
+	startCmd.Flags().StringP(didMethodsFlagName, "", "", didMethodsFlagUsage)
+	startCmd.Flags().StringP(didCacheTTLFlagName, "", "", didCacheTTLFlagUsage)
+	startCmd.Flags().StringP(idempotencyKeyTTLFlagName, "", "", idempotencyKeyTTLFlagUsage)
+	startCmd.Flags().StringP(metricsURLFlagName, "", "", metricsURLFlagUsage)
+	startCmd.Flags().StringP(metricsVaultLabelFlagName, "", "", metricsVaultLabelFlagUsage)
+	startCmd.Flags().StringP(tracingExporterFlagName, "", "", tracingExporterFlagUsage)
+	startCmd.Flags().StringP(tracingOTLPURLFlagName, "", "", tracingOTLPURLFlagUsage)
+	startCmd.Flags().StringP(healthCheckTimeoutFlagName, "", "", healthCheckTimeoutFlagUsage)
+	startCmd.Flags().StringP(healthCheckDiskPathsFlagName, "", "", healthCheckDiskPathsFlagUsage)
+	startCmd.Flags().StringP(healthCheckMinFreeDiskSpaceFlagName, "", "", healthCheckMinFreeDiskSpaceFlagUsage)
+	startCmd.Flags().StringP(shutdownTimeoutFlagName, "", "", shutdownTimeoutFlagUsage)
+	startCmd.Flags().StringP(auditLogTypeFlagName, "", "", auditLogTypeFlagUsage)
+	startCmd.Flags().StringP(auditLogFileFlagName, "", "", auditLogFileFlagUsage)
+	startCmd.Flags().StringP(configFileFlagName, "", "", configFileFlagUsage)
+}
+
+func startEDV(parameters *edvParameters) error { //nolint: funlen,gocyclo
+	if parameters.logLevel != "" {
+		setLogLevel(parameters.logLevel)
+	}
+
+	deps := createDependencies(parameters.healthCheck)
+
+	edvMetrics, err := createMetrics(parameters.metrics)
+	if err != nil {
+		return err
+	}
+
+	err = setTracerProvider(parameters.tracing, deps)
+	if err != nil {
+		return err
+	}
+
+	provider, err := createEDVProvider(parameters)
+	if err != nil {
+		return err
+	}
+
+	deps.addCheck("edv-provider", checks.EDVProvider(provider, operation.DataVaultConfigurationStoreName))
+	deps.addCloser("edv-provider", provider.Close)
+
+	if edvMetrics != nil {
+		provider = edvMetrics.InstrumentProvider(provider, parameters.databaseType)
+	}
+
+	err = createConfigStore(provider)
+	if err != nil {
+		return err
+	}
+
+	serverTLSConfig, err := createServerTLSConfig(parameters.tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	authEnable := (parameters.authType != "" && parameters.authType != noAuthType) ||
+		parameters.tlsConfig.clientRulesFile != ""
+
+	operationConfig := &operation.Config{
+		Provider: provider, AuthEnable: authEnable, EnabledExtensions: parameters.extensionsToEnable,
+		AuthMethods: authMethods(parameters),
+	}
+
+	if edvMetrics != nil {
+		operationConfig.Metrics = edvMetrics
+	}
+
+	if parameters.idempotencyKeyTTL > 0 {
+		operationConfig.IdempotencyKeys, err = createIdempotencyKeys(parameters, deps)
+		if err != nil {
+			return err
+		}
+	}
+
+	auditLog, err := createAuditLog(parameters, deps)
+	if err != nil {
+		return err
+	}
+
+	// create auth service
+	var (
+		authSvc      authService
+		authHandlers []operation.Handler
+	)
+
+	if authEnable {
+		authSvc, authHandlers, err = createAuthService(parameters, edvMetrics, deps)
 		if err != nil {
 			return err
 		}
+
+		operationConfig.AuthService = authSvc
+
+		if parameters.controllerProofRequired {
+			operationConfig.ControllerVerifier = authSvc
+		}
 	}
 
-	edvService, err := restapi.New(&operation.Config{
-		Provider: provider, AuthService: authSvc,
-		AuthEnable: parameters.authEnable, EnabledExtensions: parameters.extensionsToEnable,
-	})
+	edvService, err := restapi.New(operationConfig)
 	if err != nil {
 		return err
 	}
@@ -583,29 +1810,487 @@ func startEDV(parameters *edvParameters) error { //nolint: funlen,gocyclo
 	router := mux.NewRouter()
 	router.UseEncodedPath()
 
-	// add health check endpoint
-	healthCheckService := healthcheck.New()
+	var authMiddlewareOpts []restapi.AuthMiddlewareOption
+
+	if admin, ok := authSvc.(adminAuthorizer); ok {
+		authMiddlewareOpts = append(authMiddlewareOpts, restapi.WithAdminAuthorizer(admin.AuthorizeAdmin))
+	}
+
+	authMiddleware := restapi.NewAuthMiddleware(authSvc, authMiddlewareOpts...)
+
+	// Tracing, metrics and the audit log are added before the auth middleware, so that zcap verification is traced
+	// and rejected requests are recorded too.
+	router.Use(tracing.Middleware)
+
+	var rateLimiter *ratelimit.Limiter
+
+	// Clients are limited by IP before their requests are counted, audited and authenticated, and by invoker and
+	// vault after, so that floods are rejected before they cost metrics, audit log writes or zcap verification, and
+	// unauthorized requests don't use up the budget of others.
+	if parameters.rateLimit != nil {
+		rateLimiter = ratelimit.New(parameters.rateLimit.budget,
+			ratelimit.WithExpensiveRoutes(parameters.rateLimit.expensiveBudget, operation.ExpensiveRoutes()...),
+			ratelimit.WithKeys(parameters.rateLimit.keys...),
+			ratelimit.WithTrustedProxies(parameters.rateLimit.trustedProxies...))
+
+		router.Use(rateLimiter.ClientMiddleware)
+	}
+
+	if edvMetrics != nil {
+		router.Use(edvMetrics.Middleware)
+	}
+
+	if auditLog != nil {
+		router.Use(auditLog.Middleware)
+	}
+
+	if authEnable {
+		router.Use(authMiddleware.Middleware)
+	}
 
-	healthCheckHandlers := healthCheckService.GetOperations()
-	for _, handler := range healthCheckHandlers {
-		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	if rateLimiter != nil {
+		router.Use(rateLimiter.Middleware)
 	}
 
-	handlers := edvService.GetOperations()
+	// add health check endpoint
+	healthCheckService := healthcheck.New(deps.checkOpts...)
+
+	var otherHandlers []operation.Handler
 
-	for _, handler := range handlers {
-		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	for _, handler := range healthCheckService.GetOperations() {
+		otherHandlers = append(otherHandlers, handler)
 	}
 
+	otherHandlers = append(otherHandlers, authHandlers...)
+
 	for _, handler := range logspec.New().GetOperations() {
-		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+		otherHandlers = append(otherHandlers, handler)
+	}
+
+	if auditLog != nil {
+		for _, handler := range restapiaudit.New(auditLog).GetOperations() {
+			otherHandlers = append(otherHandlers, handler)
+		}
+	}
+
+	// The configuration endpoint lists all the endpoints of the server, not only the EDV ones.
+	edvService.AddEndpoints(otherHandlers...)
+
+	for _, handler := range edvService.GetOperations() {
+		authMiddleware.HandleFunc(router, handler)
+	}
+
+	for _, handler := range otherHandlers {
+		authMiddleware.HandleFunc(router, handler)
 	}
 
 	logStartupMessage(parameters)
 
-	return parameters.srv.ListenAndServe(parameters.hostURL,
-		parameters.tlsConfig.certFile, parameters.tlsConfig.keyFile, constructHandlers(parameters.corsEnable,
-			authSvc, router))
+	if edvMetrics != nil {
+		go serveMetrics(parameters, edvMetrics)
+	}
+
+	return serve(parameters, serverTLSConfig, constructHandlers(parameters.cors, router), deps)
+}
+
+// serve serves the handler until the server fails, or until the process receives SIGINT or SIGTERM. On a signal,
+// the server stops accepting connections and waits up to the shutdown timeout for in-flight requests (such as batch
+// operations) to finish. The dependencies of the server are then released.
+func serve(parameters *edvParameters, serverTLSConfig *tls.Config, handler http.Handler, deps *dependencies) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- parameters.srv.ListenAndServe(parameters.hostURL, parameters.tlsConfig.certFile,
+			parameters.tlsConfig.keyFile, serverTLSConfig, handler)
+	}()
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			deps.close()
+		}
+
+		return err
+	case sig := <-signals:
+		logger.Infof("Received %s, shutting down EDV REST server", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), parameters.shutdownTimeout)
+	defer cancel()
+
+	err := parameters.srv.Shutdown(ctx)
+
+	// The server stops serving as soon as it starts shutting down.
+	if errServe := <-serveErr; errServe != nil {
+		logger.Warnf("EDV REST server stopped with an error while shutting down: %s", errServe)
+	}
+
+	deps.close()
+
+	if err != nil {
+		return fmt.Errorf("failed to finish in-flight requests within %s: %w", parameters.shutdownTimeout, err)
+	}
+
+	logger.Infof("EDV REST server shut down")
+
+	return nil
+}
+
+// createDependencies returns the dependencies collector with the readiness checks that don't depend on other
+// dependencies of the server, such as the disk space checks.
+func createDependencies(parameters *healthCheckParameters) *dependencies {
+	deps := &dependencies{}
+
+	if parameters == nil {
+		return deps
+	}
+
+	deps.checkOpts = append(deps.checkOpts, healthcheckop.WithCheckTimeout(parameters.timeout))
+
+	for _, path := range parameters.diskPaths {
+		deps.addCheck("disk-space:"+path, checks.DiskSpace(path, parameters.minFreeDiskSpace))
+	}
+
+	return deps
+}
+
+// createMetrics returns the metrics of the server, or nil if metrics are disabled.
+func createMetrics(parameters *metricsParameters) (*metrics.Metrics, error) {
+	if parameters == nil || parameters.url == "" {
+		return nil, nil
+	}
+
+	var opts []metrics.Option
+
+	if parameters.vaultLabel {
+		opts = append(opts, metrics.WithVaultLabel())
+	}
+
+	return metrics.New(opts...)
+}
+
+// serveMetrics serves the metrics on their own listener, so that they're available without authorization.
+func serveMetrics(parameters *edvParameters, edvMetrics *metrics.Metrics) {
+	router := mux.NewRouter()
+	router.Handle(metricsEndpoint, edvMetrics.Handler()).Methods(http.MethodGet)
+
+	err := parameters.srv.ListenAndServe(parameters.metrics.url, "", "", nil, router)
+	if err != nil {
+		logger.Errorf("Metrics server stopped: %s", err)
+	}
+}
+
+// setTracerProvider sets the global tracer provider and propagator that trace the server's requests. Tracing is a
+// no-op if no exporter is configured.
+// The tracer provider is shut down with the other dependencies, which exports the spans that haven't been exported yet.
+func setTracerProvider(parameters *tracingParameters, deps *dependencies) error {
+	if parameters == nil || parameters.exporter == noTracingExporter {
+		return nil
+	}
+
+	var spanProcessor sdktrace.SpanProcessor
+
+	switch parameters.exporter {
+	case otlpTracingExporter:
+		opts, err := otlpOptions(parameters.otlpURL)
+		if err != nil {
+			return err
+		}
+
+		exporter, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+
+		spanProcessor = sdktrace.NewBatchSpanProcessor(exporter)
+	case stdoutTracingExporter:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+
+		// Spans are written as soon as they end, so that they can be read while testing.
+		spanProcessor = sdktrace.NewSimpleSpanProcessor(exporter)
+	default:
+		return fmt.Errorf("unsupported %s: %s", tracingExporterFlagName, parameters.exporter)
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(spanProcessor),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(tracingServiceName))),
+	)
+
+	deps.addCloser("tracer-provider", func() error {
+		return tracerProvider.Shutdown(context.Background())
+	})
+
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{},
+		propagation.Baggage{}))
+
+	return nil
+}
+
+// otlpOptions returns the options of an OTLP/HTTP exporter that exports to the collector at the given URL.
+func otlpOptions(collectorURL string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(collectorURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", tracingOTLPURLFlagName, err)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+
+	switch u.Scheme {
+	case "http":
+		opts = append(opts, otlptracehttp.WithInsecure())
+	case "https":
+	default:
+		return nil, fmt.Errorf("invalid %s %s: scheme must be http or https", tracingOTLPURLFlagName, collectorURL)
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	return opts, nil
+}
+
+func createIdempotencyKeys(parameters *edvParameters, deps *dependencies) (*idempotency.Keys, error) {
+	storageProvider, err := createAriesStorageProvider(&storageParameters{
+		storageType: parameters.databaseType,
+		storageURL:  parameters.databaseURL, storagePrefix: parameters.databasePrefix,
+	}, parameters.databaseTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	deps.addCloser("idempotency-key-storage", storageProvider.Close)
+
+	keys, err := idempotency.New(storageProvider, parameters.idempotencyKeyTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	keys.SweepEvery(idempotencyKeySweepInterval)
+
+	deps.addCloser("idempotency-key-sweep", keys.Close)
+
+	return keys, nil
+}
+
+// createAuditLog returns the audit log of the configured type, or nil if the audit log is disabled.
+func createAuditLog(parameters *edvParameters, deps *dependencies) (*audit.Log, error) {
+	if parameters.audit == nil {
+		return nil, nil
+	}
+
+	switch parameters.audit.logType {
+	case fileAuditLog:
+		sink, err := audit.NewFileSink(parameters.audit.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit log: %w", err)
+		}
+
+		deps.addCloser("audit-log-file", sink.Close)
+
+		return audit.New(sink), nil
+	case databaseAuditLog:
+		storageProvider, err := createAriesStorageProvider(&storageParameters{
+			storageType: parameters.databaseType,
+			storageURL:  parameters.databaseURL, storagePrefix: parameters.databasePrefix,
+		}, parameters.databaseTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		sink, err := audit.NewStorageSink(storageProvider)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create audit log: %w", err)
+		}
+
+		deps.addCheck("audit-log-storage", checks.AriesStorage(storageProvider, audit.StoreName))
+		deps.addCloser("audit-log-storage", storageProvider.Close)
+
+		return audit.New(sink), nil
+	default:
+		return nil, nil
+	}
+}
+
+// authMethods returns the names of the methods requests can be authorized with, as listed by the server
+// configuration endpoint.
+func authMethods(parameters *edvParameters) []string {
+	var methods []string
+
+	if parameters.authType != "" && parameters.authType != noAuthType {
+		methods = append(methods, parameters.authType)
+	}
+
+	if parameters.tlsConfig.clientRulesFile != "" {
+		methods = append(methods, mtlsAuthMethod)
+	}
+
+	return methods
+}
+
+// createAuthService returns the auth service for the configured auth type, along with the REST handlers
+// that the auth service provides (e.g. the capability management endpoints of the zcap service).
+func createAuthService(parameters *edvParameters, edvMetrics *metrics.Metrics,
+	deps *dependencies) (authService, []operation.Handler, error) {
+	storageProvider, err := createAriesStorageProvider(&storageParameters{
+		storageType: parameters.databaseType,
+		storageURL:  parameters.databaseURL, storagePrefix: parameters.databasePrefix,
+	}, parameters.databaseTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deps.addCloser("auth-storage", storageProvider.Close)
+
+	var (
+		authSvc  authService
+		handlers []operation.Handler
+	)
+
+	switch parameters.authType {
+	case zcapAuthType:
+		zcapSvc, errCreate := createZCAPService(parameters, storageProvider, edvMetrics, deps)
+		if errCreate != nil {
+			return nil, nil, errCreate
+		}
+
+		deps.addCheck("zcap-storage", checks.AriesStorage(storageProvider, zcapld.StoreName))
+
+		authSvc = zcapSvc
+
+		for _, handler := range capability.New(zcapSvc).GetOperations() {
+			handlers = append(handlers, handler)
+		}
+	case oauth2AuthType:
+		authSvc, err = createOAuth2Service(parameters.oauth2, storageProvider)
+		if err != nil {
+			return nil, nil, err
+		}
+	case "", noAuthType:
+	default:
+		return nil, nil, fmt.Errorf("unsupported auth type: %s", parameters.authType)
+	}
+
+	if parameters.tlsConfig == nil || parameters.tlsConfig.clientRulesFile == "" {
+		return authSvc, handlers, nil
+	}
+
+	mtlsAuthorizer, err := createMTLSAuthorizer(parameters.tlsConfig.clientRulesFile, authSvc, storageProvider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mtlsAuthorizer, handlers, nil
+}
+
+// createMTLSAuthorizer returns an authorizer that grants access by client certificate and authorizes all other
+// requests with authSvc (if any).
+func createMTLSAuthorizer(rulesFile string, authSvc authService,
+	storageProvider ariesstorage.Provider) (*mtls.Authorizer, error) {
+	rules, err := mtls.LoadRules(rulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []mtls.Option
+
+	if authSvc != nil {
+		opts = append(opts, mtls.WithAuthService(authSvc))
+	}
+
+	return mtls.New(rules, storageProvider, opts...)
+}
+
+func createZCAPService(parameters *edvParameters, storageProvider ariesstorage.Provider,
+	edvMetrics *metrics.Metrics, deps *dependencies) (*zcapld.Service, error) {
+	keyManager, err := createKeyManager(parameters, deps)
+	if err != nil {
+		return nil, err
+	}
+
+	// create crypto
+	crypto, err := tinkcrypto.New()
+	if err != nil {
+		return nil, err
+	}
+
+	keyResolver, err := createKeyResolver(parameters.didResolution, storageProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []zcapld.Option{zcapld.WithKeyResolver(keyResolver)}
+
+	if edvMetrics != nil {
+		opts = append(opts, zcapld.WithAuthorizationObserver(edvMetrics.ObserveZCAPAuthorization))
+	}
+
+	return zcapld.New(keyManager, crypto, storageProvider, opts...)
+}
+
+func createOAuth2Service(parameters *oauth2Parameters,
+	storageProvider ariesstorage.Provider) (*oauth2.Service, error) {
+	var keys oauth2.KeySet
+
+	if parameters.jwksFile != "" {
+		var err error
+
+		keys, err = oauth2.NewFileKeySet(parameters.jwksFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		keys = oauth2.NewRemoteKeySet(parameters.jwksURL, &http.Client{Timeout: jwksFetchTimeout})
+	}
+
+	return oauth2.New(keys, storageProvider,
+		oauth2.WithIssuer(parameters.issuer), oauth2.WithAudience(parameters.audience),
+		oauth2.WithControllerClaim(parameters.controllerClaim),
+		oauth2.WithScopes(parameters.readScope, parameters.writeScope))
+}
+
+func createKeyResolver(parameters *didResolutionParameters,
+	storageProvider ariesstorage.Provider) (*didresolver.Registry, error) {
+	if parameters == nil {
+		parameters = defaultDIDResolutionParameters()
+	}
+
+	opts := []didresolver.Option{didresolver.WithCacheTTL(parameters.cacheTTL)}
+
+	for _, method := range parameters.methods {
+		var resolver didresolver.MethodResolver
+
+		switch method {
+		case didresolver.KeyMethod:
+			resolver = didresolver.NewKeyResolver()
+		case didresolver.WebMethod:
+			resolver = didresolver.NewWebResolver(didresolver.NewWebHTTPClient(didWebResolveTimeout))
+		case didresolver.PeerMethod:
+			var err error
+
+			resolver, err = didresolver.NewPeerResolver(storageProvider)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported DID method: %s", method)
+		}
+
+		opts = append(opts, didresolver.WithMethod(method, resolver))
+	}
+
+	return didresolver.New(opts...), nil
 }
 
 func setLogLevel(userLogLevel string) {
@@ -649,45 +2334,32 @@ func createEDVProvider(parameters *edvParameters) (edvprovider.EDVProvider, erro
 
 // createConfigStore creates the config store and creates indices if supported.
 func createConfigStore(provider edvprovider.EDVProvider) error {
-	err := provider.CreateStore(dataVaultConfigurationStoreName)
+	err := operation.CreateConfigStore(provider)
 	if err != nil {
-		if errors.Is(err, storage.ErrDuplicateStore) {
-			return nil
-		}
-
-		return fmt.Errorf(errCreateConfigStore, err)
-	}
-
-	store, err := provider.OpenStore(dataVaultConfigurationStoreName)
-	if err != nil {
-		return fmt.Errorf(errCreateConfigStore, err)
-	}
-
-	err = store.CreateReferenceIDIndex()
-	if err != nil {
-		if err == edvprovider.ErrIndexingNotSupported { // Allow the EDV to still operate without index support
-			return nil
-		}
-
 		return fmt.Errorf(errCreateConfigStore, err)
 	}
 
 	return nil
 }
 
-func constructHandlers(enableCORS bool, authSvc authService, routerHandler http.Handler) http.Handler {
-	if enableCORS {
-		return cors.New(
-			cors.Options{
-				AllowedMethods: []string{
-					http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions,
-				},
-				AllowedHeaders: []string{"*"},
-			},
-		).Handler(&httpHandler{authSvc: authSvc, routerHandler: routerHandler})
+// constructHandlers wraps the router with the CORS policy, if CORS is enabled. Preflight requests are answered by
+// the CORS handler, and cross-origin requests that the policy doesn't allow are served without CORS headers, so that
+// browsers block their responses.
+func constructHandlers(parameters *corsParameters, routerHandler http.Handler) http.Handler {
+	if parameters == nil {
+		return routerHandler
 	}
 
-	return &httpHandler{authSvc: authSvc, routerHandler: routerHandler}
+	return cors.New(
+		cors.Options{
+			AllowedOrigins:   parameters.allowedOrigins,
+			AllowedMethods:   parameters.allowedMethods,
+			AllowedHeaders:   parameters.allowedHeaders,
+			ExposedHeaders:   parameters.exposedHeaders,
+			AllowCredentials: parameters.allowCredentials,
+			MaxAge:           int(parameters.maxAge / time.Second),
+		},
+	).Handler(routerHandler)
 }
 
 func retry(fn func() error, numRetries uint64) error {
@@ -699,13 +2371,16 @@ func retry(fn func() error, numRetries uint64) error {
 		})
 }
 
-func createKeyManager(parameters *edvParameters) (kms.KeyManager, error) {
+func createKeyManager(parameters *edvParameters, deps *dependencies) (kms.KeyManager, error) {
 	localKMSSecretsStorageProvider, err := createAriesStorageProvider(parameters.localKMSSecretsStorage,
 		parameters.databaseTimeout)
 	if err != nil {
 		return nil, err
 	}
 
+	deps.addCheck("kms-secrets-storage", checks.AriesStorage(localKMSSecretsStorageProvider, masterKeyStoreName))
+	deps.addCloser("kms-secrets-storage", localKMSSecretsStorageProvider.Close)
+
 	localKMS, err := createLocalKMS(localKMSSecretsStorageProvider)
 	if err != nil {
 		return nil, err
@@ -786,49 +2461,14 @@ func createAriesStorageProvider(parameters *storageParameters, databaseTimeout u
 
 func logStartupMessage(parameters *edvParameters) {
 	logger.Infof("Starting EDV REST server with the following parameters:   Host URL: %s, Database type: %s, "+
-		"Database URL: %s, Database prefix: %s, TLS certificate file: %s, TLS key file: %s, Extensions: %+v, "+
-		"Auth enabled?: %t, CORS enabled?: %t, Database timeout: %d, Local KMS secrets storage: %+v, Log level: %s",
+		"Database URL: %s, Database prefix: %s, TLS certificate file: %s, TLS key file: %s, "+
+		"TLS client CA file: %s, TLS client rules file: %s, Extensions: %+v, "+
+		"Auth type: %s, CORS: %+v, Database timeout: %d, Local KMS secrets storage: %+v, Log level: %s, "+
+		"Metrics URL: %s, Tracing exporter: %s, Audit log: %+v, Rate limit: %+v",
 		parameters.hostURL, parameters.databaseType, parameters.databaseURL, parameters.databasePrefix,
-		parameters.tlsConfig.certFile, parameters.tlsConfig.keyFile, parameters.extensionsToEnable,
-		parameters.authEnable, parameters.corsEnable, parameters.databaseTimeout, parameters.localKMSSecretsStorage,
-		parameters.logLevel)
-}
-
-type httpHandler struct {
-	authSvc       authService
-	routerHandler http.Handler
-}
-
-func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// check if authSvc is nil
-	if h.authSvc == nil {
-		h.routerHandler.ServeHTTP(w, r)
-
-		return
-	}
-
-	if r.RequestURI == createVaultPath || r.RequestURI == healthCheckPath {
-		h.routerHandler.ServeHTTP(w, r)
-
-		return
-	}
-
-	s := strings.SplitAfter(r.RequestURI, "/")
-
-	authHandler, err := h.authSvc.Handler(strings.TrimSuffix(s[2], "/"), r, w,
-		func(writer http.ResponseWriter, request *http.Request) {
-			h.routerHandler.ServeHTTP(w, r)
-		})
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-
-		_, errWrite := w.Write([]byte(err.Error()))
-		if errWrite != nil {
-			logger.Errorf(errWrite.Error())
-		}
-
-		return
-	}
-
-	authHandler.ServeHTTP(w, r)
+		parameters.tlsConfig.certFile, parameters.tlsConfig.keyFile, parameters.tlsConfig.clientCAFile,
+		parameters.tlsConfig.clientRulesFile, parameters.extensionsToEnable,
+		parameters.authType, parameters.cors, parameters.databaseTimeout, parameters.localKMSSecretsStorage,
+		parameters.logLevel, parameters.metrics.url, parameters.tracing.exporter, parameters.audit,
+		parameters.rateLimit)
 }
@@ -6,27 +6,63 @@ SPDX-License-Identifier: Apache-2.0
 package startcmd
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth/didresolver"
+	"github.com/trustbloc/edv/pkg/client"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvprovider/couchdbedvprovider"
 	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
 
-type mockServer struct{}
+type mockServer struct {
+	tlsConfig *tls.Config
+}
+
+func (s *mockServer) ListenAndServe(host, certFile, keyFile string, serverTLSConfig *tls.Config,
+	handler http.Handler) error {
+	s.tlsConfig = serverTLSConfig
+
+	return nil
+}
 
-func (s *mockServer) ListenAndServe(host, certFile, keyFile string, handler http.Handler) error {
+func (s *mockServer) Shutdown(context.Context) error {
 	return nil
 }
 
@@ -40,6 +76,10 @@ func (m *mockEDVProvider) CreateStore(string) error {
 	return m.errCreateStore
 }
 
+func (m *mockEDVProvider) Close() error {
+	return nil
+}
+
 func (m *mockEDVProvider) OpenStore(string) (edvprovider.EDVStore, error) {
 	return &mockEDVStore{errCreateReferenceIDIndex: m.errStoreCreateReferenceIDIndex}, m.errOpenStore
 }
@@ -167,7 +207,8 @@ func TestStartCmdValidArgs(t *testing.T) {
 			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
 			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
 			"--" + extensionsFlagName, returnFullDocumentOnQueryExtensionName +
-				"," + readAllDocumentsExtensionName + "," + batchExtensionName, "--" + corsEnableFlagName, "true",
+				"," + readAllDocumentsExtensionName + "," + batchExtensionName,
+			"--" + corsAllowedOriginsFlagName, "https://wallet.example.com",
 		}
 		startCmd.SetArgs(args)
 
@@ -312,7 +353,7 @@ func TestKeyManager(t *testing.T) {
 	t.Run("Error - invalid database type", func(t *testing.T) {
 		parameters := edvParameters{localKMSSecretsStorage: &storageParameters{storageType: "NotARealDatabaseType"}}
 
-		provider, err := createKeyManager(&parameters)
+		provider, err := createKeyManager(&parameters, &dependencies{})
 		require.Nil(t, provider)
 		require.Equal(t, errInvalidDatabaseType, err)
 	})
@@ -323,7 +364,7 @@ func TestKeyManager(t *testing.T) {
 			storageURL:  "%",
 		}, databaseTimeout: 1}
 
-		provider, err := createKeyManager(&parameters)
+		provider, err := createKeyManager(&parameters, &dependencies{})
 		require.Error(t, err)
 		require.Nil(t, provider)
 		require.Contains(t, err.Error(), "failed to connect to couchdb: failed to ping couchDB")
@@ -362,93 +403,197 @@ func TestCreateProvider(t *testing.T) {
 	})
 }
 
-func TestHttpHandler_ServeHTTP(t *testing.T) {
-	t.Run("test svc is nil", func(t *testing.T) {
-		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
-			require.Nil(t, r)
-		}}
-		h := httpHandler{routerHandler: m}
-		h.ServeHTTP(&httptest.ResponseRecorder{}, nil)
-	})
+func TestListenAndServe(t *testing.T) {
+	h := HTTPServer{}
+	err := h.ListenAndServe("localhost:8080", "test.key", "test.cert", nil, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "open test.key: no such file or directory")
+}
 
-	t.Run("test create vault request", func(t *testing.T) {
-		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
-			require.Equal(t, r.RequestURI, createVaultPath)
-		}}
-		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{}}
-		h.ServeHTTP(&httptest.ResponseRecorder{}, &http.Request{RequestURI: createVaultPath})
-	})
+func TestHTTPServer_Shutdown(t *testing.T) {
+	t.Run("success - in-flight request finishes", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
 
-	t.Run("test health check request", func(t *testing.T) {
-		m := &mockHTTPHandler{serveHTTPFun: func(w http.ResponseWriter, r *http.Request) {
-			require.Equal(t, r.RequestURI, healthCheckPath)
-		}}
-		h := httpHandler{routerHandler: m, authSvc: &mockAuthService{}}
-		h.ServeHTTP(&httptest.ResponseRecorder{}, &http.Request{RequestURI: healthCheckPath})
-	})
+		writeTestKeyPair(t, certFile, keyFile, "edv")
 
-	t.Run("test error from auth handler", func(t *testing.T) {
-		h := httpHandler{authSvc: &mockAuthService{
-			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
-				next http.HandlerFunc) (http.HandlerFunc, error) {
-				return nil, fmt.Errorf("failed to create auth handler")
-			},
-		}}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
 
-		responseRecorder := httptest.NewRecorder()
-		h.ServeHTTP(responseRecorder, &http.Request{RequestURI: createVaultPath + "/vaultID"})
+		host := listener.Addr().String()
+		require.NoError(t, listener.Close())
 
-		require.Contains(t, responseRecorder.Body.String(), "failed to create auth handler")
-	})
+		requestStarted, finishRequest := make(chan struct{}), make(chan struct{})
 
-	t.Run("test auth handler success", func(t *testing.T) {
-		h := httpHandler{authSvc: &mockAuthService{
-			handlerFunc: func(resourceID string, req *http.Request, w http.ResponseWriter,
-				next http.HandlerFunc) (http.HandlerFunc, error) {
-				return func(w http.ResponseWriter, r *http.Request) {
-					require.Equal(t, r.RequestURI, createVaultPath+"/vaultID")
-				}, nil
-			},
+		h := &HTTPServer{}
+		serveErr := make(chan error, 1)
+
+		go func() {
+			serveErr <- h.ListenAndServe(host, certFile, keyFile, nil, http.HandlerFunc(
+				func(w http.ResponseWriter, _ *http.Request) {
+					close(requestStarted)
+					<-finishRequest
+					w.WriteHeader(http.StatusNoContent)
+				}))
+		}()
+
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // nolint:gosec // self-signed test certificate
 		}}
 
-		responseRecorder := httptest.NewRecorder()
-		h.ServeHTTP(responseRecorder, &http.Request{RequestURI: createVaultPath + "/vaultID"})
+		responses := make(chan *http.Response, 1)
+
+		go func() {
+			// Retry until the server is listening.
+			for {
+				resp, errGet := client.Get("https://" + host) // nolint:noctx // test request
+				if errGet == nil {
+					responses <- resp
+
+					return
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		<-requestStarted
+
+		shutdownErr := make(chan error, 1)
+
+		go func() {
+			shutdownErr <- h.Shutdown(context.Background())
+		}()
+
+		require.NoError(t, <-serveErr)
+
+		close(finishRequest)
+
+		resp := <-responses
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+		require.NoError(t, <-shutdownErr)
+	})
+
+	t.Run("success - shut down before serving", func(t *testing.T) {
+		h := &HTTPServer{}
+		require.NoError(t, h.Shutdown(context.Background()))
+		require.NoError(t, h.ListenAndServe("127.0.0.1:0", "", "", nil, nil))
 	})
 }
 
-type mockHTTPHandler struct {
-	serveHTTPFun func(w http.ResponseWriter, r *http.Request)
+type blockingServer struct {
+	serving     chan struct{}
+	stop        chan struct{}
+	errShutdown error
 }
 
-func (m *mockHTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if m.serveHTTPFun != nil {
-		m.serveHTTPFun(w, r)
-	}
+func newBlockingServer() *blockingServer {
+	return &blockingServer{serving: make(chan struct{}), stop: make(chan struct{})}
 }
 
-type mockAuthService struct {
-	handlerFunc func(resourceID string, req *http.Request, w http.ResponseWriter,
-		next http.HandlerFunc) (http.HandlerFunc, error)
+func (s *blockingServer) ListenAndServe(string, string, string, *tls.Config, http.Handler) error {
+	close(s.serving)
+	<-s.stop
+
+	return nil
 }
 
-func (m *mockAuthService) Create(resourceID, verificationMethod string) ([]byte, error) {
-	return nil, nil
+func (s *blockingServer) Shutdown(context.Context) error {
+	close(s.stop)
+
+	return s.errShutdown
 }
 
-func (m *mockAuthService) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
-	next http.HandlerFunc) (http.HandlerFunc, error) {
-	if m.handlerFunc != nil {
-		return m.handlerFunc(resourceID, req, w, next)
-	}
+func TestServe(t *testing.T) {
+	t.Run("success - shuts down on SIGTERM", func(t *testing.T) {
+		srv := newBlockingServer()
 
-	return nil, nil
+		closed := false
+		deps := &dependencies{}
+		deps.addCloser("test", func() error {
+			closed = true
+
+			return errors.New("close error")
+		})
+
+		serveErr := make(chan error, 1)
+
+		go func() {
+			serveErr <- serve(&edvParameters{srv: srv, tlsConfig: &tlsConfig{}, shutdownTimeout: time.Second},
+				nil, nil, deps)
+		}()
+
+		<-srv.serving
+
+		sendSIGTERM(t)
+
+		require.NoError(t, <-serveErr)
+		require.True(t, closed)
+	})
+
+	t.Run("failure - in-flight requests don't finish in time", func(t *testing.T) {
+		srv := newBlockingServer()
+		srv.errShutdown = context.DeadlineExceeded
+
+		serveErr := make(chan error, 1)
+
+		go func() {
+			serveErr <- serve(&edvParameters{srv: srv, tlsConfig: &tlsConfig{}, shutdownTimeout: time.Second},
+				nil, nil, &dependencies{})
+		}()
+
+		<-srv.serving
+
+		sendSIGTERM(t)
+
+		err := <-serveErr
+		require.EqualError(t, err, "failed to finish in-flight requests within 1s: context deadline exceeded")
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("failure - server fails", func(t *testing.T) {
+		closed := false
+		deps := &dependencies{}
+		deps.addCloser("test", func() error {
+			closed = true
+
+			return nil
+		})
+
+		err := serve(&edvParameters{srv: &HTTPServer{}, hostURL: "localhost:8080",
+			tlsConfig: &tlsConfig{certFile: "test.key", keyFile: "test.cert"}}, nil, nil, deps)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "open test.key: no such file or directory")
+		require.True(t, closed)
+	})
 }
 
-func TestListenAndServe(t *testing.T) {
-	h := HTTPServer{}
-	err := h.ListenAndServe("localhost:8080", "test.key", "test.cert", nil)
-	require.Error(t, err)
-	require.Contains(t, err.Error(), "open test.key: no such file or directory")
+func sendSIGTERM(t *testing.T) {
+	t.Helper()
+
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(syscall.SIGTERM))
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	for _, test := range []struct {
+		timeout, err string
+	}{
+		{"soon", "failed to parse shutdown-timeout soon"},
+		{"0s", "shutdown-timeout must be positive"},
+	} {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + shutdownTimeoutFlagName, test.timeout,
+		})
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), test.err)
+	}
 }
 
 func TestCreateConfigStore(t *testing.T) {
@@ -515,3 +660,1203 @@ func checkFlagPropertiesCorrect(t *testing.T, cmd *cobra.Command, flagName, flag
 	flagAnnotations := flag.Annotations
 	require.Nil(t, flagAnnotations)
 }
+
+func TestDIDResolutionParameters(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + didMethodsFlagName, "key, peer,web", "--" + didCacheTTLFlagName, "1m",
+		}
+		startCmd.SetArgs(args)
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("failure - unsupported DID method", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + didMethodsFlagName, "key,orb",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, `unsupported DID method "orb" in did-methods`)
+	})
+
+	t.Run("failure - invalid cache TTL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + didCacheTTLFlagName, "forever",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse did-cache-ttl forever")
+	})
+}
+
+func TestIdempotencyKeyTTL(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		for _, ttl := range []string{"1h", "0"} {
+			startCmd := GetStartCmd(&mockServer{})
+
+			args := []string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				"--" + idempotencyKeyTTLFlagName, ttl,
+			}
+			startCmd.SetArgs(args)
+
+			require.NoError(t, startCmd.Execute())
+		}
+	})
+
+	t.Run("failure - invalid TTL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + idempotencyKeyTTLFlagName, "forever",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse idempotency-key-ttl forever")
+	})
+
+	t.Run("failure - negative TTL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + idempotencyKeyTTLFlagName, "-1h",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "idempotency-key-ttl must not be negative")
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 2)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + metricsURLFlagName, "localhost:9090", "--" + metricsVaultLabelFlagName, "true",
+			"--" + authTypeFlagName, zcapAuthType, "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handlers := make(map[string]http.Handler)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case h := <-srv.handlers:
+				handlers[h.host] = h.handler
+			case <-time.After(time.Second):
+				require.FailNow(t, "servers weren't started")
+			}
+		}
+
+		rr := httptest.NewRecorder()
+
+		handlers["localhost:8080"].ServeHTTP(rr,
+			httptest.NewRequest(http.MethodGet, "/.well-known/edv-configuration", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rr = httptest.NewRecorder()
+
+		handlers["localhost:9090"].ServeHTTP(rr, httptest.NewRequest(http.MethodGet, metricsEndpoint, nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(),
+			`edv_http_requests_total{method="GET",route="/.well-known/edv-configuration",status="200"} 1`)
+		require.Contains(t, rr.Body.String(), `edv_store_operations_total{operation="CreateStore",provider="mem",`+
+			`result="success",vault="data_vault_configurations"} 1`)
+	})
+
+	t.Run("failure - invalid vault label", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + metricsURLFlagName, "localhost:9090", "--" + metricsVaultLabelFlagName, "maybe",
+		})
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse metrics-vault-label")
+	})
+}
+
+func TestTracing(t *testing.T) {
+	propagator := otel.GetTextMapPropagator()
+
+	// The default global tracer provider delegates to the first provider that's set, so it can't be restored.
+	t.Cleanup(func() {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	t.Run("success - stdout exporter", func(t *testing.T) {
+		stdout := os.Stdout
+
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+
+		// The stdout exporter writes to the stdout of when it's created.
+		os.Stdout = w
+
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tracingExporterFlagName, stdoutTracingExporter,
+		})
+
+		err = startCmd.Execute()
+
+		os.Stdout = stdout
+
+		require.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/edv-configuration", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+		rr := httptest.NewRecorder()
+
+		(<-srv.handlers).handler.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		require.NoError(t, w.Close())
+
+		output, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		require.Contains(t, string(output), `"Name":"/.well-known/edv-configuration"`)
+		require.Contains(t, string(output), `"TraceID":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	})
+
+	t.Run("success - OTLP exporter", func(t *testing.T) {
+		require.NoError(t, setTracerProvider(&tracingParameters{
+			exporter: otlpTracingExporter, otlpURL: "https://collector.example.com/custom/v1/traces",
+		}, &dependencies{}))
+	})
+
+	t.Run("failure - unsupported exporter", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tracingExporterFlagName, "jaeger",
+		})
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "unsupported tracing-exporter: jaeger")
+	})
+
+	t.Run("failure - invalid OTLP URL", func(t *testing.T) {
+		err := setTracerProvider(&tracingParameters{exporter: otlpTracingExporter, otlpURL: "collector:4318"},
+			&dependencies{})
+		require.EqualError(t, err, "invalid tracing-otlp-url collector:4318: scheme must be http or https")
+
+		err = setTracerProvider(&tracingParameters{exporter: otlpTracingExporter, otlpURL: "%"}, &dependencies{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse tracing-otlp-url")
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authTypeFlagName, zcapAuthType, "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + healthCheckTimeoutFlagName, "1s", "--" + healthCheckDiskPathsFlagName, t.TempDir(),
+			"--" + healthCheckMinFreeDiskSpaceFlagName, "1",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthcheck/ready", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		for _, check := range []string{"edv-provider", "disk-space:", "kms-secrets-storage", "zcap-storage"} {
+			require.Contains(t, rr.Body.String(), `"name":"`+check)
+		}
+
+		rr = httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthcheck/live", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("not ready", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + healthCheckDiskPathsFlagName, filepath.Join(t.TempDir(), "missing"),
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		rr := httptest.NewRecorder()
+
+		(<-srv.handlers).handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthcheck/ready", nil))
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.Contains(t, rr.Body.String(), `"status":"failure"`)
+	})
+
+	t.Run("failure - invalid parameters", func(t *testing.T) {
+		for _, test := range []struct {
+			flag, value, err string
+		}{
+			{healthCheckTimeoutFlagName, "soon", "failed to parse healthcheck-timeout soon"},
+			{healthCheckTimeoutFlagName, "0s", "healthcheck-timeout must be positive"},
+			{healthCheckMinFreeDiskSpaceFlagName, "-1", "failed to parse healthcheck-min-free-disk-space -1"},
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+			startCmd.SetArgs([]string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				"--" + test.flag, test.value,
+			})
+
+			err := startCmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.err)
+		}
+	})
+}
+
+func TestCORS(t *testing.T) {
+	preflight := func(handler http.Handler, origin, method string, headers ...string) http.Header {
+		req := httptest.NewRequest(http.MethodOptions, "/encrypted-data-vaults", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+
+		if len(headers) > 0 {
+			req.Header.Set("Access-Control-Request-Headers", strings.Join(headers, ","))
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Header()
+	}
+
+	t.Run("success - default policy", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + corsAllowedOriginsFlagName, "https://wallet.example.com,https://*.apps.example.com",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		header := preflight(handler, "https://wallet.example.com", http.MethodPost, "Content-Type",
+			"Idempotency-Key")
+		require.Equal(t, "https://wallet.example.com", header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "POST", header.Get("Access-Control-Allow-Methods"))
+		require.Empty(t, header.Get("Access-Control-Allow-Credentials"))
+		require.Empty(t, header.Get("Access-Control-Max-Age"))
+
+		header = preflight(handler, "https://team.apps.example.com", http.MethodGet)
+		require.Equal(t, "https://team.apps.example.com", header.Get("Access-Control-Allow-Origin"))
+
+		// Origins, methods and headers that aren't allowed don't get CORS headers.
+		require.Empty(t, preflight(handler, "https://evil.example.com", http.MethodGet).
+			Get("Access-Control-Allow-Origin"))
+		require.Empty(t, preflight(handler, "https://wallet.example.com", http.MethodPatch).
+			Get("Access-Control-Allow-Origin"))
+		require.Empty(t, preflight(handler, "https://wallet.example.com", http.MethodGet, "X-Custom").
+			Get("Access-Control-Allow-Origin"))
+
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", nil)
+		req.Header.Set("Origin", "https://wallet.example.com")
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, "https://wallet.example.com", rr.Header().Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "Location, Idempotent-Replayed, Retry-After", rr.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("success - custom policy", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + corsAllowedOriginsFlagName, "https://wallet.example.com",
+			"--" + corsAllowedMethodsFlagName, "GET, PATCH",
+			"--" + corsAllowedHeadersFlagName, "X-Custom",
+			"--" + corsExposedHeadersFlagName, "Location",
+			"--" + corsAllowCredentialsFlagName, "true",
+			"--" + corsMaxAgeFlagName, "10m",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		header := preflight(handler, "https://wallet.example.com", http.MethodPatch, "X-Custom")
+		require.Equal(t, "https://wallet.example.com", header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", header.Get("Access-Control-Allow-Credentials"))
+		require.Equal(t, "600", header.Get("Access-Control-Max-Age"))
+
+		require.Empty(t, preflight(handler, "https://wallet.example.com", http.MethodPost).
+			Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("success - clients behind trusted proxies", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitRequestsFlagName, "0.01", "--" + rateLimitBurstFlagName, "1",
+			"--" + rateLimitKeysFlagName, "ip", "--" + rateLimitTrustedProxiesFlagName, "192.0.2.1,10.0.0.0/8",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		forwardedRequest := func(forwardedFor string) int {
+			req := httptest.NewRequest(http.MethodGet, "/.well-known/edv-configuration", nil)
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			return rr.Code
+		}
+
+		// httptest requests come from 192.0.2.1.
+		require.Equal(t, http.StatusOK, forwardedRequest("198.51.100.1"))
+		require.Equal(t, http.StatusOK, forwardedRequest("198.51.100.2, 10.0.0.1"))
+		require.Equal(t, http.StatusTooManyRequests, forwardedRequest("198.51.100.1"))
+	})
+
+	t.Run("success - disabled", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"})
+
+		require.NoError(t, startCmd.Execute())
+
+		header := preflight((<-srv.handlers).handler, "https://wallet.example.com", http.MethodGet)
+		require.Empty(t, header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("failure - invalid policy", func(t *testing.T) {
+		for _, test := range []struct {
+			name string
+			args []string
+			err  string
+		}{
+			{
+				"policy without origins", []string{"--" + corsMaxAgeFlagName, "10m"},
+				"cors-max-age requires cors-allowed-origins to be set",
+			},
+			{
+				"origin with a path", []string{"--" + corsAllowedOriginsFlagName, "https://wallet.example.com/app"},
+				"invalid cors-allowed-origins https://wallet.example.com/app: must be a scheme and host",
+			},
+			{
+				"origin without a scheme", []string{"--" + corsAllowedOriginsFlagName, "wallet.example.com"},
+				"invalid cors-allowed-origins wallet.example.com: scheme must be http or https",
+			},
+			{
+				"origin with two wildcards", []string{"--" + corsAllowedOriginsFlagName, "https://*.*.example.com"},
+				"invalid cors-allowed-origins https://*.*.example.com: must contain at most one *",
+			},
+			{
+				"unsupported method", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsAllowedMethodsFlagName, "CONNECT",
+				},
+				"unsupported cors-allowed-methods: CONNECT",
+			},
+			{
+				"wildcard header", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsAllowedHeadersFlagName, "*",
+				},
+				"invalid cors-allowed-headers: * isn't supported, list the headers instead",
+			},
+			{
+				"invalid header", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsExposedHeadersFlagName, "Location: x",
+				},
+				`invalid cors-exposed-headers: "Location: x" isn't a header name`,
+			},
+			{
+				"credentials for any origin", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsAllowCredentialsFlagName, "true",
+				},
+				"cors-allow-credentials can't be used if cors-allowed-origins allows any origin",
+			},
+			{
+				"invalid credentials", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsAllowCredentialsFlagName, "yes",
+				},
+				"failed to parse cors-allow-credentials",
+			},
+			{
+				"invalid max age", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsMaxAgeFlagName, "1.5s",
+				},
+				"cors-max-age must be a positive number of whole seconds",
+			},
+			{
+				"unparsable max age", []string{
+					"--" + corsAllowedOriginsFlagName, "*", "--" + corsMaxAgeFlagName, "long",
+				},
+				"failed to parse cors-max-age long",
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				startCmd := GetStartCmd(&mockServer{})
+				startCmd.SetArgs(append([]string{
+					"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				}, test.args...))
+
+				err := startCmd.Execute()
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+			})
+		}
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	request := func(handler http.Handler, method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+
+		return rr
+	}
+
+	t.Run("success", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitRequestsFlagName, "0.5", "--" + rateLimitBurstFlagName, "2",
+			"--" + rateLimitKeysFlagName, "ip",
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		// Queries have their own budget, which defaults to a tenth of the rate with a burst of 1.
+		require.Equal(t, http.StatusBadRequest,
+			request(handler, http.MethodPost, "/encrypted-data-vaults/vault1/query").Code)
+
+		rr := request(handler, http.MethodPost, "/encrypted-data-vaults/vault1/query")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "20", rr.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusOK, request(handler, http.MethodGet, "/.well-known/edv-configuration").Code)
+		require.Equal(t, http.StatusOK, request(handler, http.MethodGet, "/.well-known/edv-configuration").Code)
+
+		rr = request(handler, http.MethodGet, "/.well-known/edv-configuration")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "2", rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("success - requests rejected by IP aren't audited", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		auditLogFile := filepath.Join(t.TempDir(), "audit.log")
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + rateLimitRequestsFlagName, "0.01", "--" + rateLimitBurstFlagName, "2",
+			"--" + rateLimitKeysFlagName, "ip",
+			"--" + auditLogTypeFlagName, fileAuditLog, "--" + auditLogFileFlagName, auditLogFile,
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		configBytes, err := json.Marshal(&models.DataVaultConfiguration{
+			Controller: "did:example:123456789",
+			KEK:        models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+			HMAC:       models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults",
+			bytes.NewReader(configBytes)))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		docPath := "/encrypted-data-vaults/" + path.Base(rr.Header().Get("Location")) + "/documents/doc1"
+
+		require.Equal(t, http.StatusNotFound, request(handler, http.MethodGet, docPath).Code)
+		require.Equal(t, http.StatusTooManyRequests, request(handler, http.MethodGet, docPath).Code)
+
+		auditLogBytes, err := ioutil.ReadFile(auditLogFile) //nolint: gosec
+		require.NoError(t, err)
+		require.Len(t, strings.Split(strings.TrimSpace(string(auditLogBytes)), "\n"), 2)
+	})
+
+	t.Run("success - disabled", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, http.StatusOK, request(handler, http.MethodGet, "/.well-known/edv-configuration").Code)
+		}
+	})
+
+	t.Run("failure - invalid rate limits", func(t *testing.T) {
+		for _, test := range []struct {
+			name string
+			args []string
+			err  string
+		}{
+			{
+				"burst without rate", []string{"--" + rateLimitBurstFlagName, "10"},
+				"rate-limit-burst requires rate-limit-requests to be set",
+			},
+			{
+				"unparsable rate", []string{"--" + rateLimitRequestsFlagName, "fast"},
+				"failed to parse rate-limit-requests fast",
+			},
+			{
+				"zero rate", []string{"--" + rateLimitRequestsFlagName, "0"},
+				"rate-limit-requests must be a positive number",
+			},
+			{
+				"negative expensive rate", []string{
+					"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitExpensiveRequestsFlagName, "-1",
+				},
+				"rate-limit-expensive-requests must be a positive number",
+			},
+			{
+				"unparsable burst", []string{
+					"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitExpensiveBurstFlagName, "1.5",
+				},
+				"failed to parse rate-limit-expensive-burst 1.5",
+			},
+			{
+				"zero burst", []string{"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitBurstFlagName, "0"},
+				"rate-limit-burst must be positive",
+			},
+			{
+				"unsupported key", []string{
+					"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitKeysFlagName, "ip,user",
+				},
+				"unsupported rate-limit-keys: user",
+			},
+			{
+				"trusted proxies without rate", []string{"--" + rateLimitTrustedProxiesFlagName, "10.0.0.1"},
+				"rate-limit-trusted-proxies requires rate-limit-requests to be set",
+			},
+			{
+				"invalid trusted proxy", []string{
+					"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitTrustedProxiesFlagName, "10.0.0.0/33",
+				},
+				"invalid rate-limit-trusted-proxies 10.0.0.0/33",
+			},
+			{
+				"trusted proxy isn't an IP address", []string{
+					"--" + rateLimitRequestsFlagName, "10", "--" + rateLimitTrustedProxiesFlagName, "proxy",
+				},
+				"invalid rate-limit-trusted-proxies proxy: not an IP address or CIDR network",
+			},
+		} {
+			t.Run(test.name, func(t *testing.T) {
+				startCmd := GetStartCmd(&mockServer{})
+				startCmd.SetArgs(append([]string{
+					"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+				}, test.args...))
+
+				err := startCmd.Execute()
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+			})
+		}
+	})
+}
+
+func readAuditLog(t *testing.T, handler http.Handler, vaultID string) []*audit.Entry {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/"+vaultID+"/audit", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var entries []*audit.Entry
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &entries))
+
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("success - file", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + auditLogTypeFlagName, fileAuditLog,
+			"--" + auditLogFileFlagName, filepath.Join(t.TempDir(), "audit.log"),
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		handler := (<-srv.handlers).handler
+
+		configBytes, err := json.Marshal(&models.DataVaultConfiguration{
+			Controller:  "did:example:123456789",
+			ReferenceID: "ref1",
+			KEK:         models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+			HMAC:        models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+		})
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults",
+			bytes.NewReader(configBytes)))
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		vaultID := path.Base(rr.Header().Get("Location"))
+
+		// Failed requests are only recorded for vaults that have an audit log.
+		for _, vault := range []string{"unknown", vaultID} {
+			rr = httptest.NewRecorder()
+
+			handler.ServeHTTP(rr,
+				httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/"+vault+"/documents/doc1", nil))
+			require.Equal(t, http.StatusNotFound, rr.Code)
+		}
+
+		entries := readAuditLog(t, handler, "unknown")
+		require.Empty(t, entries)
+
+		entries = readAuditLog(t, handler, vaultID)
+		require.Len(t, entries, 2)
+		require.Equal(t, audit.OutcomeSuccess, entries[0].Outcome)
+		require.Equal(t, "doc1", entries[1].DocumentID)
+		require.Equal(t, audit.OutcomeFailure, entries[1].Outcome)
+		require.NoError(t, audit.Verify(entries))
+
+		// The configuration lists the endpoints of the other services too.
+		rr = httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/.well-known/edv-configuration", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var config models.ServerConfiguration
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/encrypted-data-vaults/{vaultID}/audit", Method: http.MethodGet, Auth: "controller",
+		})
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/healthcheck/ready", Method: http.MethodGet, Auth: "public",
+		})
+	})
+
+	t.Run("success - database", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + auditLogTypeFlagName, databaseAuditLog,
+		})
+
+		require.NoError(t, startCmd.Execute())
+
+		rr := httptest.NewRecorder()
+
+		(<-srv.handlers).handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/healthcheck/ready", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Contains(t, rr.Body.String(), `"name":"audit-log-storage"`)
+	})
+
+	t.Run("disabled by default", func(t *testing.T) {
+		srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs([]string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"})
+
+		require.NoError(t, startCmd.Execute())
+
+		rr := httptest.NewRecorder()
+
+		(<-srv.handlers).handler.ServeHTTP(rr,
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/vault1/audit", nil))
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("failure - invalid parameters", func(t *testing.T) {
+		for _, test := range []struct {
+			args []string
+			err  string
+		}{
+			{[]string{"--" + auditLogTypeFlagName, "syslog"}, "unsupported audit-log-type: syslog"},
+			{
+				[]string{"--" + auditLogTypeFlagName, fileAuditLog},
+				"audit-log-file is required if audit-log-type is file",
+			},
+			{
+				[]string{
+					"--" + auditLogTypeFlagName, fileAuditLog,
+					"--" + auditLogFileFlagName, filepath.Join(t.TempDir(), "missing", "audit.log"),
+				},
+				"failed to create audit log",
+			},
+		} {
+			startCmd := GetStartCmd(&mockServer{})
+			startCmd.SetArgs(append([]string{
+				"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			}, test.args...))
+
+			err := startCmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.err)
+		}
+	})
+}
+
+type hostHandler struct {
+	host    string
+	handler http.Handler
+}
+
+// handlerRecordingServer sends the handlers that it's asked to serve to a channel.
+type handlerRecordingServer struct {
+	handlers chan hostHandler
+}
+
+func (s *handlerRecordingServer) ListenAndServe(host, _, _ string, _ *tls.Config, handler http.Handler) error {
+	s.handlers <- hostHandler{host: host, handler: handler}
+
+	return nil
+}
+
+func (s *handlerRecordingServer) Shutdown(context.Context) error {
+	return nil
+}
+
+func TestControllerProofRequired(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + authEnableFlagName, "true", "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--" + controllerProofRequiredFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("failure - auth not enabled", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + controllerProofRequiredFlagName, "true",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.EqualError(t, err,
+			"controller-proof-required requires authorization to be enabled with auth-type or tls-client-rules-file")
+	})
+
+	t.Run("failure - invalid value", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+
+		args := []string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + controllerProofRequiredFlagName, "maybe",
+		}
+		startCmd.SetArgs(args)
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse controller-proof-required")
+	})
+}
+
+func TestControllerEndpoints(t *testing.T) {
+	srv := &handlerRecordingServer{handlers: make(chan hostHandler, 1)}
+
+	startCmd := GetStartCmd(srv)
+	startCmd.SetArgs([]string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + authTypeFlagName, zcapAuthType, "--" + localKMSSecretsDatabaseTypeFlagName, "mem",
+		"--" + auditLogTypeFlagName, databaseAuditLog,
+	})
+
+	require.NoError(t, startCmd.Execute())
+
+	edvServer := httptest.NewServer((<-srv.handlers).handler)
+	defer edvServer.Close()
+
+	controller, keyID, signer := newTestDIDKey(t)
+
+	edvClient := client.New(edvServer.URL+"/encrypted-data-vaults", client.WithCapabilityInvoker(keyID, signer))
+
+	location, _, err := edvClient.CreateDataVault(&models.DataVaultConfiguration{
+		Controller:  controller,
+		ReferenceID: "ref1",
+		KEK:         models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+		HMAC:        models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+	})
+	if err != nil && strings.Contains(err.Error(), "loading remote context failed") {
+		// Root capabilities are signed with the JSON-LD contexts they reference, which are loaded remotely.
+		t.Skipf("capabilities can't be created without the remote JSON-LD contexts: %s", err)
+	}
+
+	require.NoError(t, err)
+
+	vaultID := path.Base(location)
+
+	capability := edvClient.Capability(vaultID)
+	require.NotNil(t, capability)
+
+	// The capability returned for the vault authorizes reading its documents.
+	_, err = edvClient.ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+	require.True(t, errors.Is(err, client.ErrDocumentNotFound), err)
+
+	t.Run("audit log read by the controller", func(t *testing.T) {
+		entries, err := edvClient.ReadAuditLog(vaultID, client.WithHTTPSignature(keyID, signer))
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.Equal(t, keyID, entries[1].Invoker)
+		require.NoError(t, audit.Verify(entries))
+	})
+
+	t.Run("revocation by another controller is rejected", func(t *testing.T) {
+		_, otherKeyID, otherSigner := newTestDIDKey(t)
+
+		err := edvClient.RevokeCapability(vaultID, capability.ID, client.WithHTTPSignature(otherKeyID, otherSigner))
+		require.True(t, errors.Is(err, client.ErrUnauthorized), err)
+	})
+
+	t.Run("revocation by the controller", func(t *testing.T) {
+		err := edvClient.RevokeCapability(vaultID, capability.ID, client.WithHTTPSignature(keyID, signer))
+		require.NoError(t, err)
+
+		_, err = edvClient.ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.True(t, errors.Is(err, client.ErrUnauthorized), err)
+	})
+}
+
+// newTestDIDKey returns a new did:key, the ID of its key and a signer that signs with that key.
+func newTestDIDKey(t *testing.T) (string, string, client.Signer) {
+	t.Helper()
+
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	didKey, keyID := fingerprint.CreateDIDKey(pubKey)
+
+	return didKey, keyID, ed25519Signer(privKey)
+}
+
+type ed25519Signer ed25519.PrivateKey
+
+func (s ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(ed25519.PrivateKey(s), data), nil
+}
+
+func TestAuthType(t *testing.T) {
+	baseArgs := []string{"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem"}
+
+	t.Run("zcap", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, zcapAuthType,
+			"--"+localKMSSecretsDatabaseTypeFlagName, "mem"))
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("oauth2 with JWK set file", func(t *testing.T) {
+		jwksFile, err := ioutil.TempFile("", "jwks*.json")
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, os.Remove(jwksFile.Name()))
+		}()
+
+		_, err = jwksFile.WriteString(`{"keys":[]}`)
+		require.NoError(t, err)
+		require.NoError(t, jwksFile.Close())
+
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, oauth2AuthType,
+			"--"+oauth2JWKSFileFlagName, jwksFile.Name(), "--"+controllerProofRequiredFlagName, "true"))
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("oauth2 with JWK set URL", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, oauth2AuthType,
+			"--"+oauth2JWKSURLFlagName, "https://issuer.example.com/jwks", "--"+oauth2IssuerFlagName,
+			"https://issuer.example.com", "--"+oauth2AudienceFlagName, "edv", "--"+oauth2ControllerClaimFlagName,
+			"controller", "--"+oauth2ReadScopeFlagName, "vault.read", "--"+oauth2WriteScopeFlagName, "vault.write"))
+
+		require.NoError(t, startCmd.Execute())
+	})
+
+	t.Run("failure - oauth2 JWK set file not found", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, oauth2AuthType,
+			"--"+oauth2JWKSFileFlagName, "missing.json"))
+
+		err := startCmd.Execute()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read JWK set file")
+	})
+
+	t.Run("failure - oauth2 without JWK set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, oauth2AuthType))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err,
+			"exactly one of oauth2-jwks-url and oauth2-jwks-file must be set if auth-type is oauth2")
+	})
+
+	t.Run("failure - oauth2 with both JWK set URL and file", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, oauth2AuthType,
+			"--"+oauth2JWKSURLFlagName, "https://issuer.example.com/jwks", "--"+oauth2JWKSFileFlagName, "jwks.json"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err,
+			"exactly one of oauth2-jwks-url and oauth2-jwks-file must be set if auth-type is oauth2")
+	})
+
+	t.Run("failure - unsupported auth type", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, "basic"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "unsupported auth-type: basic")
+	})
+
+	t.Run("failure - both auth-type and auth-enable set", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs(append(baseArgs, "--"+authTypeFlagName, zcapAuthType, "--"+authEnableFlagName, "true"))
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "auth-type and auth-enable can't both be set")
+	})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caFile, newTestCACert(t), 0600))
+
+	rulesFile := filepath.Join(dir, "rules.json")
+	require.NoError(t, ioutil.WriteFile(rulesFile,
+		[]byte(`{"rules": [{"subject": "indexer", "controllers": ["*"]}, {"subject": "operator", "admin": true}]}`),
+		0600))
+
+	baseArgs := []string{
+		"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+		"--" + tlsCertFileFlagName, "cert.pem", "--" + tlsKeyFileFlagName, "key.pem",
+	}
+
+	execute := func(srv *mockServer, args ...string) error {
+		startCmd := GetStartCmd(srv)
+		startCmd.SetArgs(append(append([]string{}, baseArgs...), args...))
+
+		return startCmd.Execute()
+	}
+
+	t.Run("client certificates required by default", func(t *testing.T) {
+		srv := &mockServer{}
+
+		require.NoError(t, execute(srv, "--"+tlsClientCAFileFlagName, caFile))
+		require.Equal(t, tls.RequireAndVerifyClientCert, srv.tlsConfig.ClientAuth)
+		require.NotNil(t, srv.tlsConfig.ClientCAs)
+	})
+
+	t.Run("optional client certificates with rules and zcap", func(t *testing.T) {
+		srv := &mockServer{}
+
+		require.NoError(t, execute(srv, "--"+tlsClientCAFileFlagName, caFile,
+			"--"+tlsClientAuthFlagName, optionalClientAuth, "--"+tlsClientRulesFileFlagName, rulesFile,
+			"--"+authTypeFlagName, zcapAuthType, "--"+localKMSSecretsDatabaseTypeFlagName, "mem",
+			"--"+controllerProofRequiredFlagName, "true"))
+		require.Equal(t, tls.VerifyClientCertIfGiven, srv.tlsConfig.ClientAuth)
+	})
+
+	t.Run("rules without another auth type", func(t *testing.T) {
+		require.NoError(t, execute(&mockServer{}, "--"+tlsClientCAFileFlagName, caFile,
+			"--"+tlsClientRulesFileFlagName, rulesFile, "--"+controllerProofRequiredFlagName, "true"))
+	})
+
+	t.Run("no client certificates", func(t *testing.T) {
+		srv := &mockServer{}
+
+		require.NoError(t, execute(srv, "--"+tlsClientAuthFlagName, noClientAuth))
+		require.Nil(t, srv.tlsConfig)
+	})
+
+	t.Run("failure - unsupported client auth", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientCAFileFlagName, caFile, "--"+tlsClientAuthFlagName, "maybe")
+		require.EqualError(t, err, "unsupported tls-client-auth: maybe")
+	})
+
+	t.Run("failure - client auth without client CA file", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientAuthFlagName, requiredClientAuth)
+		require.EqualError(t, err, "tls-client-auth required requires tls-client-ca-file to be set")
+	})
+
+	t.Run("failure - client CA file without server certificate", func(t *testing.T) {
+		startCmd := GetStartCmd(&mockServer{})
+		startCmd.SetArgs([]string{
+			"--" + hostURLFlagName, "localhost:8080", "--" + databaseTypeFlagName, "mem",
+			"--" + tlsClientCAFileFlagName, caFile,
+		})
+
+		err := startCmd.Execute()
+		require.EqualError(t, err, "tls-client-ca-file requires tls-cert-file and tls-key-file to be set")
+	})
+
+	t.Run("failure - rules without client certificates", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientRulesFileFlagName, rulesFile)
+		require.EqualError(t, err,
+			"tls-client-rules-file requires client certificates to be verified with tls-client-ca-file")
+	})
+
+	t.Run("failure - invalid rules file", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientCAFileFlagName, caFile,
+			"--"+tlsClientRulesFileFlagName, filepath.Join(dir, "missing.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read client certificate rules file")
+	})
+
+	t.Run("failure - client CA file not found", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientCAFileFlagName, filepath.Join(dir, "missing.pem"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read client CA file")
+	})
+
+	t.Run("failure - client CA file without certificates", func(t *testing.T) {
+		err := execute(&mockServer{}, "--"+tlsClientCAFileFlagName, rulesFile)
+		require.EqualError(t, err, "no certificates found in client CA file "+rulesFile)
+	})
+}
+
+func newTestCACert(t *testing.T) []byte {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privKey.PublicKey, privKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certBytes})
+}
+
+func TestCreateAuthService(t *testing.T) {
+	_, _, err := createAuthService(&edvParameters{databaseType: "mem", authType: "basic"}, nil, &dependencies{})
+	require.EqualError(t, err, "unsupported auth type: basic")
+}
+
+func TestAuthMethods(t *testing.T) {
+	require.Empty(t, authMethods(&edvParameters{authType: noAuthType, tlsConfig: &tlsConfig{}}))
+	require.Equal(t, []string{"zcap"}, authMethods(&edvParameters{authType: zcapAuthType, tlsConfig: &tlsConfig{}}))
+	require.Equal(t, []string{"oauth2", "mtls"}, authMethods(&edvParameters{
+		authType: oauth2AuthType, tlsConfig: &tlsConfig{clientRulesFile: "rules.json"},
+	}))
+	require.Equal(t, []string{"mtls"},
+		authMethods(&edvParameters{tlsConfig: &tlsConfig{clientRulesFile: "rules.json"}}))
+}
+
+func TestCreateKeyResolver(t *testing.T) {
+	t.Run("defaults to did:key", func(t *testing.T) {
+		registry, err := createKeyResolver(nil, ariesmemstorage.NewProvider())
+		require.NoError(t, err)
+		require.Equal(t, []string{didresolver.KeyMethod}, registry.Methods())
+	})
+
+	t.Run("all methods", func(t *testing.T) {
+		registry, err := createKeyResolver(&didResolutionParameters{
+			methods: []string{didresolver.WebMethod, didresolver.PeerMethod, didresolver.KeyMethod},
+		}, ariesmemstorage.NewProvider())
+		require.NoError(t, err)
+		require.Equal(t, []string{didresolver.KeyMethod, didresolver.PeerMethod, didresolver.WebMethod},
+			registry.Methods())
+	})
+
+	t.Run("failure - unsupported method", func(t *testing.T) {
+		_, err := createKeyResolver(&didResolutionParameters{methods: []string{"orb"}}, ariesmemstorage.NewProvider())
+		require.EqualError(t, err, "unsupported DID method: orb")
+	})
+
+	t.Run("failure - peer store can't be opened", func(t *testing.T) {
+		_, err := createKeyResolver(&didResolutionParameters{methods: []string{didresolver.PeerMethod}},
+			&mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open store error")})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to create did:peer resolver")
+	})
+}
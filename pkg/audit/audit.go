@@ -0,0 +1,260 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package audit records the operations on vaults and their documents in a tamper-evident audit log. The entries of
+// each vault form a hash chain: every entry includes the hash of the entry before it, so changing, removing or
+// reordering entries breaks the chain, which Verify detects.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/edge-core/pkg/log"
+)
+
+var logger = log.New("edv-audit")
+
+// Outcomes of audited operations.
+const (
+	// OutcomeSuccess is the outcome of operations that succeeded.
+	OutcomeSuccess = "success"
+	// OutcomeDenied is the outcome of operations that weren't authorized.
+	OutcomeDenied = "denied"
+	// OutcomeFailure is the outcome of operations that failed for any other reason.
+	OutcomeFailure = "failure"
+)
+
+// ErrChainBroken is returned by Verify if the entries don't form an unbroken hash chain.
+var ErrChainBroken = errors.New("audit log hash chain is broken")
+
+// Entry is an entry of the audit log of a vault.
+type Entry struct {
+	// Sequence is the position of the entry in the audit log of its vault, starting at 1.
+	Sequence uint64 `json:"sequence"`
+	// Timestamp is when the operation was handled.
+	Timestamp time.Time `json:"timestamp"`
+	// Invoker is who the request was authenticated as (e.g. the key ID of the HTTP signature of a zcap invocation).
+	// It's empty if the request wasn't authenticated.
+	Invoker string `json:"invoker"`
+	// Action is the HTTP method and path template of the operation,
+	// e.g. "GET /encrypted-data-vaults/{vaultID}/documents/{docID}".
+	Action     string `json:"action"`
+	VaultID    string `json:"vaultID"`
+	DocumentID string `json:"documentID,omitempty"`
+	// Outcome is OutcomeSuccess, OutcomeDenied or OutcomeFailure.
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"statusCode"`
+	// PreviousHash is the hash of the previous entry of the vault, or empty for the first entry.
+	PreviousHash string `json:"previousHash"`
+	// Hash is the hex-encoded SHA-256 hash of the JSON encoding of the entry without its hash.
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the entry.
+func (e *Entry) computeHash() (string, error) {
+	unhashed := *e
+	unhashed.Hash = ""
+
+	entryBytes, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit log entry: %w", err)
+	}
+
+	hash := sha256.Sum256(entryBytes)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Sink stores audit log entries.
+type Sink interface {
+	// Append adds the entry to the end of the audit log of its vault.
+	Append(entry *Entry) error
+	// Last returns the last entry of the audit log of the given vault, or nil if the vault has no entries.
+	Last(vaultID string) (*Entry, error)
+	// Entries returns the audit log of the given vault, in order.
+	Entries(vaultID string) ([]*Entry, error)
+}
+
+// maxCachedVaults is the number of vaults whose last entry is kept in memory. Beyond it, the vaults that no entry
+// is being recorded for are evicted, and their last entry is read from the sink again when needed.
+const maxCachedVaults = 10000
+
+// Log is an audit log that chains the entries of each vault and stores them in a sink.
+// Entries must only be added by one Log per sink, otherwise the chains of the vaults fork.
+type Log struct {
+	sink      Sink
+	now       func() time.Time
+	maxVaults int
+
+	mutex  sync.Mutex
+	vaults map[string]*vaultLog
+}
+
+// vaultLog serializes the entries of a vault, so that entries of different vaults are recorded concurrently.
+type vaultLog struct {
+	mutex sync.Mutex
+	// last is the last entry of the vault, or nil if it hasn't been read from the sink.
+	last *Entry
+	// users is the number of entries that are being recorded for the vault. Guarded by the mutex of the Log.
+	users int
+}
+
+// New returns a new audit log that stores its entries in the given sink.
+func New(sink Sink) *Log {
+	return &Log{sink: sink, now: time.Now, maxVaults: maxCachedVaults, vaults: make(map[string]*vaultLog)}
+}
+
+// Record adds an entry to the audit log of the entry's vault. Its sequence, timestamp and hashes are set by Record.
+func (l *Log) Record(entry *Entry) error {
+	return l.record(entry, false)
+}
+
+// recordIfLogged adds an entry to the audit log of the entry's vault only if the vault already has entries, so that
+// requests to vaults that don't exist can be left out.
+func (l *Log) recordIfLogged(entry *Entry) error {
+	return l.record(entry, true)
+}
+
+func (l *Log) record(entry *Entry, onlyIfLogged bool) error {
+	v := l.acquire(entry.VaultID)
+	defer l.release(entry.VaultID, v)
+
+	if v.last == nil {
+		last, err := l.sink.Last(entry.VaultID)
+		if err != nil {
+			return fmt.Errorf("failed to get last audit log entry of vault %s: %w", entry.VaultID, err)
+		}
+
+		v.last = last
+	}
+
+	if v.last == nil && onlyIfLogged {
+		return nil
+	}
+
+	entry.Sequence = 1
+	entry.PreviousHash = ""
+
+	if v.last != nil {
+		entry.Sequence = v.last.Sequence + 1
+		entry.PreviousHash = v.last.Hash
+	}
+
+	entry.Timestamp = l.now().UTC()
+
+	var err error
+
+	entry.Hash, err = entry.computeHash()
+	if err != nil {
+		return err
+	}
+
+	err = l.sink.Append(entry)
+	if err != nil {
+		return fmt.Errorf("failed to append audit log entry of vault %s: %w", entry.VaultID, err)
+	}
+
+	v.last = entry
+
+	return nil
+}
+
+// acquire returns the locked log of the vault.
+func (l *Log) acquire(vaultID string) *vaultLog {
+	l.mutex.Lock()
+
+	v, found := l.vaults[vaultID]
+	if !found {
+		v = &vaultLog{}
+		l.vaults[vaultID] = v
+	}
+
+	v.users++
+
+	l.mutex.Unlock()
+
+	v.mutex.Lock()
+
+	return v
+}
+
+// release unlocks the log of the vault, and evicts the logs of idle vaults if there are too many.
+func (l *Log) release(vaultID string, v *vaultLog) {
+	v.mutex.Unlock()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	v.users--
+
+	if v.users == 0 && v.last == nil {
+		delete(l.vaults, vaultID)
+	}
+
+	for id, idle := range l.vaults {
+		if len(l.vaults) <= l.maxVaults {
+			break
+		}
+
+		if idle.users == 0 {
+			delete(l.vaults, id)
+		}
+	}
+}
+
+// Entries returns the audit log of the given vault, in order.
+func (l *Log) Entries(vaultID string) ([]*Entry, error) {
+	entries, err := l.sink.Entries(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log entries of vault %s: %w", vaultID, err)
+	}
+
+	return entries, nil
+}
+
+// Verify checks that the given entries are the complete audit log of a vault: that they're numbered from 1 and
+// that every entry's hash is correct and is included in the next entry. It returns an error wrapping
+// ErrChainBroken for the first entry that isn't.
+func Verify(entries []*Entry) error {
+	var previous *Entry
+
+	for _, entry := range entries {
+		expectedSequence, expectedPreviousHash := uint64(1), ""
+
+		if previous != nil {
+			expectedSequence, expectedPreviousHash = previous.Sequence+1, previous.Hash
+		}
+
+		if entry.Sequence != expectedSequence {
+			return fmt.Errorf("%w: expected entry %d but got entry %d", ErrChainBroken, expectedSequence,
+				entry.Sequence)
+		}
+
+		if entry.PreviousHash != expectedPreviousHash {
+			return fmt.Errorf("%w: previous hash of entry %d doesn't match the hash of entry %d", ErrChainBroken,
+				entry.Sequence, expectedSequence-1)
+		}
+
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+
+		if entry.Hash != hash {
+			return fmt.Errorf("%w: hash of entry %d doesn't match its contents", ErrChainBroken, entry.Sequence)
+		}
+
+		previous = entry
+	}
+
+	return nil
+}
@@ -0,0 +1,271 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testVaultID = "Sr7yHjomhn1aeaFnxREfRN"
+	testDocID   = "BJYHHJx4C8J9Fsgz7rZqSp"
+	testInvoker = "did:key:z6MkrqCMy45WhL3UEa1gGTHUtr17AvU4czfP5fH9KNDoYaYN#key1"
+)
+
+func TestLog_Record(t *testing.T) {
+	t.Run("entries of each vault are chained", func(t *testing.T) {
+		l := newTestLog(&memSink{})
+
+		for _, entry := range []*Entry{
+			{VaultID: testVaultID, Action: "POST /encrypted-data-vaults", Outcome: OutcomeSuccess},
+			{VaultID: "other", Action: "POST /encrypted-data-vaults", Outcome: OutcomeSuccess},
+			{VaultID: testVaultID, DocumentID: testDocID, Invoker: testInvoker, Outcome: OutcomeDenied},
+		} {
+			require.NoError(t, l.Record(entry))
+		}
+
+		entries, err := l.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.NoError(t, Verify(entries))
+
+		require.Equal(t, uint64(1), entries[0].Sequence)
+		require.Empty(t, entries[0].PreviousHash)
+		require.Equal(t, uint64(2), entries[1].Sequence)
+		require.Equal(t, entries[0].Hash, entries[1].PreviousHash)
+		require.Equal(t, time.Date(2021, 5, 4, 10, 0, 0, 0, time.UTC), entries[0].Timestamp)
+
+		entries, err = l.Entries("other")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.NoError(t, Verify(entries))
+	})
+
+	t.Run("chains continue from the sink", func(t *testing.T) {
+		sink := &memSink{}
+
+		require.NoError(t, newTestLog(sink).Record(&Entry{VaultID: testVaultID}))
+		require.NoError(t, newTestLog(sink).Record(&Entry{VaultID: testVaultID}))
+
+		entries, err := sink.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.NoError(t, Verify(entries))
+	})
+
+	t.Run("only if the vault has entries", func(t *testing.T) {
+		sink := &memSink{}
+		l := newTestLog(sink)
+
+		require.NoError(t, l.recordIfLogged(&Entry{VaultID: testVaultID, Outcome: OutcomeDenied}))
+		require.Empty(t, sink.entries)
+		require.Empty(t, l.vaults)
+
+		require.NoError(t, l.Record(&Entry{VaultID: testVaultID, Outcome: OutcomeSuccess}))
+		require.NoError(t, l.recordIfLogged(&Entry{VaultID: testVaultID, Outcome: OutcomeDenied}))
+		require.Len(t, sink.entries, 2)
+	})
+
+	t.Run("cached vaults are bounded", func(t *testing.T) {
+		sink := &memSink{}
+		l := newTestLog(sink)
+		l.maxVaults = 2
+
+		for i := 0; i < 2; i++ {
+			for _, vaultID := range []string{"v1", "v2", "v3", "v4"} {
+				require.NoError(t, l.Record(&Entry{VaultID: vaultID}))
+				require.LessOrEqual(t, len(l.vaults), 2)
+			}
+		}
+
+		// The chains of evicted vaults continue from the sink.
+		for _, vaultID := range []string{"v1", "v2", "v3", "v4"} {
+			entries, err := l.Entries(vaultID)
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			require.NoError(t, Verify(entries))
+		}
+	})
+
+	t.Run("concurrently", func(t *testing.T) {
+		sink := &memSink{}
+		l := newTestLog(sink)
+		l.maxVaults = 1
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			vaultID := fmt.Sprintf("v%d", i%3)
+
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				require.NoError(t, l.Record(&Entry{VaultID: vaultID}))
+			}()
+		}
+
+		wg.Wait()
+
+		for i := 0; i < 3; i++ {
+			entries, err := l.Entries(fmt.Sprintf("v%d", i))
+			require.NoError(t, err)
+			require.NoError(t, Verify(entries))
+		}
+	})
+
+	t.Run("failure - last entry", func(t *testing.T) {
+		err := newTestLog(&memSink{errLast: errors.New("db unavailable")}).Record(&Entry{VaultID: testVaultID})
+		require.EqualError(t, err, "failed to get last audit log entry of vault Sr7yHjomhn1aeaFnxREfRN: "+
+			"db unavailable")
+	})
+
+	t.Run("failure - append", func(t *testing.T) {
+		sink := &memSink{errAppend: errors.New("db unavailable")}
+		l := newTestLog(sink)
+
+		err := l.Record(&Entry{VaultID: testVaultID})
+		require.EqualError(t, err, "failed to append audit log entry of vault Sr7yHjomhn1aeaFnxREfRN: "+
+			"db unavailable")
+
+		// The chain continues from the last entry that was stored.
+		sink.errAppend = nil
+
+		require.NoError(t, l.Record(&Entry{VaultID: testVaultID}))
+		require.Equal(t, uint64(1), sink.entries[0].Sequence)
+	})
+
+	t.Run("failure - entries", func(t *testing.T) {
+		_, err := newTestLog(&memSink{errEntries: errors.New("db unavailable")}).Entries(testVaultID)
+		require.EqualError(t, err, "failed to get audit log entries of vault Sr7yHjomhn1aeaFnxREfRN: "+
+			"db unavailable")
+	})
+}
+
+func TestVerify(t *testing.T) {
+	record := func(t *testing.T) []*Entry {
+		t.Helper()
+
+		l := newTestLog(&memSink{})
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, l.Record(&Entry{VaultID: testVaultID, Invoker: testInvoker, Outcome: OutcomeSuccess}))
+		}
+
+		entries, err := l.Entries(testVaultID)
+		require.NoError(t, err)
+
+		return entries
+	}
+
+	t.Run("success", func(t *testing.T) {
+		require.NoError(t, Verify(record(t)))
+		require.NoError(t, Verify(nil))
+	})
+
+	t.Run("entry changed", func(t *testing.T) {
+		entries := record(t)
+		entries[1].Outcome = OutcomeDenied
+
+		err := Verify(entries)
+		require.True(t, errors.Is(err, ErrChainBroken))
+		require.EqualError(t, err, "audit log hash chain is broken: hash of entry 2 doesn't match its contents")
+	})
+
+	t.Run("entry changed and rehashed", func(t *testing.T) {
+		entries := record(t)
+		entries[1].Invoker = "did:example:mallory"
+
+		var err error
+
+		entries[1].Hash, err = entries[1].computeHash()
+		require.NoError(t, err)
+
+		err = Verify(entries)
+		require.True(t, errors.Is(err, ErrChainBroken))
+		require.EqualError(t, err, "audit log hash chain is broken: previous hash of entry 3 doesn't match the "+
+			"hash of entry 2")
+	})
+
+	t.Run("entry removed", func(t *testing.T) {
+		entries := record(t)
+
+		err := Verify(append(entries[:1], entries[2:]...))
+		require.True(t, errors.Is(err, ErrChainBroken))
+		require.EqualError(t, err, "audit log hash chain is broken: expected entry 2 but got entry 3")
+	})
+
+	t.Run("first entry removed", func(t *testing.T) {
+		err := Verify(record(t)[1:])
+		require.True(t, errors.Is(err, ErrChainBroken))
+		require.EqualError(t, err, "audit log hash chain is broken: expected entry 1 but got entry 2")
+	})
+}
+
+func newTestLog(sink Sink) *Log {
+	l := New(sink)
+	l.now = func() time.Time {
+		return time.Date(2021, 5, 4, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	}
+
+	return l
+}
+
+// memSink keeps the entries in memory.
+type memSink struct {
+	mutex      sync.Mutex
+	entries    []*Entry
+	errAppend  error
+	errLast    error
+	errEntries error
+}
+
+func (s *memSink) Append(entry *Entry) error {
+	if s.errAppend != nil {
+		return s.errAppend
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored := *entry
+	s.entries = append(s.entries, &stored)
+
+	return nil
+}
+
+func (s *memSink) Last(vaultID string) (*Entry, error) {
+	entries, err := s.Entries(vaultID)
+	if err != nil || len(entries) == 0 {
+		return nil, s.errLast
+	}
+
+	return entries[len(entries)-1], s.errLast
+}
+
+func (s *memSink) Entries(vaultID string) ([]*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var entries []*Entry
+
+	for _, entry := range s.entries {
+		if entry.VaultID == vaultID {
+			stored := *entry
+			entries = append(entries, &stored)
+		}
+	}
+
+	return entries, s.errEntries
+}
@@ -0,0 +1,139 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const fileMode = 0600
+
+// FileSink appends audit log entries to a file, one JSON object per line. The entries of all vaults are written to
+// the same file, which can be shipped to a log management system.
+type FileSink struct {
+	path  string
+	file  *os.File
+	mutex sync.RWMutex
+	last  map[string]*Entry
+}
+
+// NewFileSink returns a sink that appends entries to the file at the given path, which is created if it doesn't
+// exist. The file is read to find the last entry of each vault, so that their chains continue where they ended.
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, fileMode) //nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+
+	s := &FileSink{path: path, file: file, last: make(map[string]*Entry)}
+
+	err = s.forEach(func(entry *Entry) {
+		s.last[entry.VaultID] = entry
+	})
+	if err != nil {
+		if errClose := file.Close(); errClose != nil {
+			logger.Warnf("failed to close audit log file: %s", errClose)
+		}
+
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Append writes the entry to the end of the file and syncs the file.
+func (s *FileSink) Append(entry *Entry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit log entry: %w", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, err = s.file.Write(append(entryBytes, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to write audit log entry: %w", err)
+	}
+
+	err = s.file.Sync()
+	if err != nil {
+		return fmt.Errorf("failed to sync audit log file: %w", err)
+	}
+
+	s.last[entry.VaultID] = entry
+
+	return nil
+}
+
+// Last returns the last entry of the given vault.
+func (s *FileSink) Last(vaultID string) (*Entry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.last[vaultID], nil
+}
+
+// Entries reads the entries of the given vault from the file.
+func (s *FileSink) Entries(vaultID string) ([]*Entry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var entries []*Entry
+
+	err := s.forEach(func(entry *Entry) {
+		if entry.VaultID == vaultID {
+			entries = append(entries, entry)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Close closes the file.
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// forEach calls f with each entry in the file.
+func (s *FileSink) forEach(f func(entry *Entry)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log file: %w", err)
+	}
+
+	defer func() {
+		if errClose := file.Close(); errClose != nil {
+			logger.Warnf("failed to close audit log file: %s", errClose)
+		}
+	}()
+
+	decoder := json.NewDecoder(file)
+
+	for {
+		var entry Entry
+
+		err = decoder.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read audit log file: %w", err)
+		}
+
+		f(&entry)
+	}
+}
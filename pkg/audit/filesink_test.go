@@ -0,0 +1,92 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	t.Run("entries are appended to the file", func(t *testing.T) {
+		sink, err := NewFileSink(path)
+		require.NoError(t, err)
+
+		l := newTestLog(sink)
+
+		require.NoError(t, l.Record(&Entry{VaultID: testVaultID, Invoker: testInvoker}))
+		require.NoError(t, l.Record(&Entry{VaultID: "other"}))
+		require.NoError(t, sink.Close())
+
+		// The file is reopened, so the chain must continue from the file.
+		sink, err = NewFileSink(path)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, sink.Close()) }()
+
+		require.NoError(t, newTestLog(sink).Record(&Entry{VaultID: testVaultID}))
+
+		entries, err := sink.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		require.NoError(t, Verify(entries))
+		require.Equal(t, testInvoker, entries[0].Invoker)
+
+		last, err := sink.Last(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, entries[1], last)
+
+		fileBytes, err := ioutil.ReadFile(path) //nolint: gosec
+		require.NoError(t, err)
+		require.Len(t, splitLines(fileBytes), 3)
+	})
+
+	t.Run("failure - invalid file", func(t *testing.T) {
+		invalidPath := filepath.Join(t.TempDir(), "audit.log")
+		require.NoError(t, ioutil.WriteFile(invalidPath, []byte("not json"), 0600))
+
+		_, err := NewFileSink(invalidPath)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read audit log file")
+	})
+
+	t.Run("failure - file can't be opened", func(t *testing.T) {
+		_, err := NewFileSink(filepath.Join(t.TempDir(), "missing", "audit.log"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to open audit log file")
+	})
+
+	t.Run("failure - closed file", func(t *testing.T) {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "audit.log"))
+		require.NoError(t, err)
+		require.NoError(t, sink.Close())
+
+		err = sink.Append(&Entry{VaultID: testVaultID})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to write audit log entry")
+	})
+}
+
+func splitLines(b []byte) []string {
+	var lines []string
+
+	start := 0
+
+	for i, c := range b {
+		if c == '\n' {
+			lines = append(lines, string(b[start:i]))
+			start = i + 1
+		}
+	}
+
+	return lines
+}
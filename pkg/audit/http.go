@@ -0,0 +1,138 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+// Path segments of the locations of created vaults and documents.
+const (
+	vaultsPathSegment    = "encrypted-data-vaults"
+	documentsPathSegment = "documents"
+)
+
+// Middleware is a mux middleware that records the requests to routes of a vault in the vault's audit log, once
+// they've been handled. Requests to create a vault are recorded in the log of the new vault. Add it to the router
+// with Use before the auth middleware, so that requests that aren't authorized are recorded too. Requests that
+// didn't succeed are only recorded if the vault already has an audit log, so that requests to vaults that don't
+// exist don't add entries, and denied requests only if their invoker was authenticated. Entries that can't be
+// recorded are logged, since the response has already been sent.
+func (l *Log) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(auth.WithInvokerRecorder(r.Context()))
+		recorder := support.NewStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		entry := &Entry{
+			Invoker:    auth.Invoker(r.Context()),
+			Action:     r.Method + " " + routeTemplate(r),
+			Outcome:    outcome(recorder.StatusCode()),
+			StatusCode: recorder.StatusCode(),
+		}
+
+		vars := mux.Vars(r)
+		entry.VaultID = unescape(vars[operation.VaultIDPathVariable])
+		entry.DocumentID = unescape(vars[operation.DocIDPathVariable])
+
+		// The IDs of created vaults and documents are only known from the location of the response.
+		if location := recorder.Header().Get("Location"); location != "" && entry.DocumentID == "" {
+			vaultID, docID := idsFromLocation(location)
+
+			if entry.VaultID == "" || entry.VaultID == vaultID {
+				entry.VaultID, entry.DocumentID = vaultID, docID
+			}
+		}
+
+		if entry.VaultID == "" {
+			return
+		}
+
+		var err error
+
+		switch {
+		case entry.Outcome == OutcomeSuccess:
+			err = l.Record(entry)
+		case entry.Outcome == OutcomeDenied && entry.Invoker == "":
+			// Anyone can send requests that are denied, so they're only recorded if their invoker was
+			// authenticated. Otherwise, anyone who knows the ID of a vault could grow its log without limit.
+			return
+		default:
+			err = l.recordIfLogged(entry)
+		}
+
+		if err != nil {
+			logger.Errorf("failed to record %s by %q in audit log: %s", entry.Action, entry.Invoker, err)
+		}
+	})
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return r.URL.Path
+}
+
+func outcome(statusCode int) string {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return OutcomeDenied
+	case statusCode >= http.StatusBadRequest:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// idsFromLocation returns the vault ID and document ID (if any) of the location of a created vault or document,
+// e.g. https://edv.example.com/encrypted-data-vaults/{vaultID}/documents/{docID}.
+// The location may not have a scheme (the EDV operations use the host of the request), so it isn't parsed as a URL.
+func idsFromLocation(location string) (string, string) {
+	if end := strings.IndexAny(location, "?#"); end >= 0 {
+		location = location[:end]
+	}
+
+	segments := strings.Split(location, "/")
+
+	for i := range segments {
+		if segments[i] != vaultsPathSegment || i+1 >= len(segments) {
+			continue
+		}
+
+		vaultID, docID := unescape(segments[i+1]), ""
+
+		if i+3 < len(segments) && segments[i+2] == documentsPathSegment {
+			docID = unescape(segments[i+3])
+		}
+
+		return vaultID, docID
+	}
+
+	return "", ""
+}
+
+func unescape(value string) string {
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+
+	return unescaped
+}
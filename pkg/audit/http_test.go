@@ -0,0 +1,151 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+func TestLog_Middleware(t *testing.T) {
+	sink := &memSink{}
+	l := newTestLog(sink)
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+	router.Use(l.Middleware)
+
+	// Stands in for the auth middleware and the EDV operations.
+	authenticated := func(statusCode int, location string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			auth.SetInvoker(r.Context(), testInvoker)
+
+			if location != "" {
+				w.Header().Set("Location", location)
+			}
+
+			w.WriteHeader(statusCode)
+		}
+	}
+
+	router.HandleFunc("/encrypted-data-vaults", authenticated(http.StatusCreated,
+		"https://edv.example.com/encrypted-data-vaults/"+testVaultID)).Methods(http.MethodPost)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/documents", authenticated(http.StatusCreated,
+		"https://edv.example.com/encrypted-data-vaults/"+testVaultID+"/documents/"+testDocID)).
+		Methods(http.MethodPost)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/documents/{docID}", authenticated(http.StatusForbidden, "")).
+		Methods(http.MethodGet)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/query", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}).Methods(http.MethodPost)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/documents/{docID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}).Methods(http.MethodDelete)
+	router.HandleFunc("/healthcheck", authenticated(http.StatusOK, "")).Methods(http.MethodGet)
+
+	for _, request := range []struct{ method, target string }{
+		{http.MethodPost, "/encrypted-data-vaults"},
+		{http.MethodPost, "/encrypted-data-vaults/" + testVaultID + "/documents"},
+		{http.MethodGet, "/encrypted-data-vaults/" + testVaultID + "/documents/" + testDocID},
+		{http.MethodPost, "/encrypted-data-vaults/" + testVaultID + "/query"},
+		{http.MethodGet, "/healthcheck"},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.target, nil))
+	}
+
+	entries, err := l.Entries(testVaultID)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.NoError(t, Verify(entries))
+
+	expected := []Entry{
+		{
+			Invoker: testInvoker, Action: "POST /encrypted-data-vaults", VaultID: testVaultID,
+			Outcome: OutcomeSuccess, StatusCode: http.StatusCreated,
+		},
+		{
+			Invoker: testInvoker, Action: "POST /encrypted-data-vaults/{vaultID}/documents", VaultID: testVaultID,
+			DocumentID: testDocID, Outcome: OutcomeSuccess, StatusCode: http.StatusCreated,
+		},
+		{
+			Invoker: testInvoker, Action: "GET /encrypted-data-vaults/{vaultID}/documents/{docID}",
+			VaultID: testVaultID, DocumentID: testDocID, Outcome: OutcomeDenied, StatusCode: http.StatusForbidden,
+		},
+		{
+			Action: "POST /encrypted-data-vaults/{vaultID}/query", VaultID: testVaultID, Outcome: OutcomeFailure,
+			StatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for i := range expected {
+		require.Equal(t, expected[i].Invoker, entries[i].Invoker)
+		require.Equal(t, expected[i].Action, entries[i].Action)
+		require.Equal(t, expected[i].VaultID, entries[i].VaultID)
+		require.Equal(t, expected[i].DocumentID, entries[i].DocumentID)
+		require.Equal(t, expected[i].Outcome, entries[i].Outcome)
+		require.Equal(t, expected[i].StatusCode, entries[i].StatusCode)
+	}
+
+	t.Run("failed requests to vaults without an audit log aren't recorded", func(t *testing.T) {
+		for _, request := range []struct{ method, target string }{
+			{http.MethodPost, "/encrypted-data-vaults/unknown/query"},
+			{http.MethodGet, "/encrypted-data-vaults/unknown/documents/" + testDocID},
+		} {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.target, nil))
+		}
+
+		entries, err := l.Entries("unknown")
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("denied requests without an invoker aren't recorded", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete,
+			"/encrypted-data-vaults/"+testVaultID+"/documents/"+testDocID, nil))
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		entries, err := l.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Len(t, entries, 4)
+	})
+
+	t.Run("entry can't be recorded", func(t *testing.T) {
+		sink.errAppend = errors.New("db unavailable")
+		defer func() { sink.errAppend = nil }()
+
+		rr := httptest.NewRecorder()
+
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/"+testVaultID+"/query", nil))
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestIDsFromLocation(t *testing.T) {
+	for _, test := range []struct {
+		location, vaultID, docID string
+	}{
+		{"https://edv.example.com/encrypted-data-vaults/v1", "v1", ""},
+		{"localhost:8071/encrypted-data-vaults/v1/documents/d1", "v1", "d1"},
+		{"/prefix/encrypted-data-vaults/v%2F1/documents/d1", "v/1", "d1"},
+		{"https://edv.example.com/encrypted-data-vaults", "", ""},
+		{"https://edv.example.com/other", "", ""},
+		{"https://edv.example.com/encrypted-data-vaults/v1?x=/documents/d1", "v1", ""},
+	} {
+		vaultID, docID := idsFromLocation(test.location)
+		require.Equal(t, test.vaultID, vaultID, test.location)
+		require.Equal(t, test.docID, docID, test.location)
+	}
+}
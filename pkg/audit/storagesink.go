@@ -0,0 +1,110 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+)
+
+// StoreName is the name of the store that StorageSink stores the entries in.
+const StoreName = "audit_log"
+
+// StorageSink stores audit log entries in an Aries storage provider, such as the database of the EDV server.
+// Each entry is stored under the vault ID and its sequence number, and the last entry of each vault under the
+// vault ID, so that the entries of a vault can be read in order without iterating over the store.
+type StorageSink struct {
+	store ariesstorage.Store
+}
+
+// NewStorageSink returns a sink that stores entries in the given storage provider.
+func NewStorageSink(provider ariesstorage.Provider) (*StorageSink, error) {
+	store, err := provider.OpenStore(StoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", StoreName, err)
+	}
+
+	return &StorageSink{store: store}, nil
+}
+
+// Append stores the entry, and then stores it as the last entry of its vault.
+func (s *StorageSink) Append(entry *Entry) error {
+	entryBytes, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit log entry: %w", err)
+	}
+
+	err = s.store.Put(entryKey(entry.VaultID, entry.Sequence), entryBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store audit log entry: %w", err)
+	}
+
+	err = s.store.Put(lastEntryKey(entry.VaultID), entryBytes)
+	if err != nil {
+		return fmt.Errorf("failed to store last audit log entry: %w", err)
+	}
+
+	return nil
+}
+
+// Last returns the last entry of the given vault.
+func (s *StorageSink) Last(vaultID string) (*Entry, error) {
+	entry, err := s.get(lastEntryKey(vaultID))
+	if errors.Is(err, ariesstorage.ErrDataNotFound) {
+		return nil, nil
+	}
+
+	return entry, err
+}
+
+// Entries returns the entries of the given vault, up to its last entry.
+func (s *StorageSink) Entries(vaultID string) ([]*Entry, error) {
+	last, err := s.Last(vaultID)
+	if err != nil || last == nil {
+		return nil, err
+	}
+
+	entries := make([]*Entry, 0, last.Sequence)
+
+	for sequence := uint64(1); sequence < last.Sequence; sequence++ {
+		entry, errGet := s.get(entryKey(vaultID, sequence))
+		if errGet != nil {
+			return nil, fmt.Errorf("failed to get audit log entry %d: %w", sequence, errGet)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return append(entries, last), nil
+}
+
+func (s *StorageSink) get(key string) (*Entry, error) {
+	entryBytes, err := s.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+
+	err = json.Unmarshal(entryBytes, &entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit log entry: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func entryKey(vaultID string, sequence uint64) string {
+	return fmt.Sprintf("%s_%020d", vaultID, sequence)
+}
+
+func lastEntryKey(vaultID string) string {
+	return vaultID + "_last"
+}
@@ -0,0 +1,80 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"errors"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageSink(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		sink, err := NewStorageSink(ariesmemstorage.NewProvider())
+		require.NoError(t, err)
+
+		last, err := sink.Last(testVaultID)
+		require.NoError(t, err)
+		require.Nil(t, last)
+
+		entries, err := sink.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+
+		l := newTestLog(sink)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, l.Record(&Entry{VaultID: testVaultID, Invoker: testInvoker}))
+		}
+
+		require.NoError(t, l.Record(&Entry{VaultID: "other"}))
+
+		entries, err = sink.Entries(testVaultID)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		require.NoError(t, Verify(entries))
+	})
+
+	t.Run("failure - open store", func(t *testing.T) {
+		_, err := NewStorageSink(&mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")})
+		require.EqualError(t, err, "failed to open store audit_log: open error")
+	})
+
+	t.Run("failure - put", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+		provider.Store.ErrPut = errors.New("put error")
+
+		sink, err := NewStorageSink(provider)
+		require.NoError(t, err)
+
+		err = sink.Append(&Entry{VaultID: testVaultID, Sequence: 1})
+		require.EqualError(t, err, "failed to store audit log entry: put error")
+	})
+
+	t.Run("failure - get", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+
+		sink, err := NewStorageSink(provider)
+		require.NoError(t, err)
+
+		require.NoError(t, sink.Append(&Entry{VaultID: testVaultID, Sequence: 2}))
+
+		// Entry 1 is missing.
+		_, err = sink.Entries(testVaultID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get audit log entry 1")
+
+		provider.Store.Store[lastEntryKey(testVaultID)] = []byte("not json")
+
+		_, err = sink.Last(testVaultID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal audit log entry")
+	})
+}
@@ -0,0 +1,44 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+// Requirement describes how requests to an EDV server endpoint must be authorized.
+type Requirement int
+
+const (
+	// Admin endpoints are used to operate the EDV server itself (e.g. changing the log level).
+	// This is the requirement of any endpoint that doesn't declare one.
+	Admin Requirement = iota
+	// Public endpoints don't require any authorization.
+	Public
+	// Vault endpoints require authorization to access the vault identified by the vaultID path variable.
+	Vault
+	// Document endpoints require authorization to access the document identified by the vaultID and docID
+	// path variables.
+	Document
+	// Controller endpoints require proof of being the controller of the vault identified by the vaultID path
+	// variable. Being authorized to access the vault, e.g. with a delegated capability, isn't enough.
+	Controller
+)
+
+// String returns the name of the requirement.
+func (r Requirement) String() string {
+	switch r {
+	case Admin:
+		return "admin"
+	case Public:
+		return "public"
+	case Vault:
+		return "vault"
+	case Document:
+		return "document"
+	case Controller:
+		return "controller"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didresolver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/key"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/peer"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/web"
+)
+
+const (
+	// KeyMethod is the did:key method name.
+	KeyMethod = "key"
+	// PeerMethod is the did:peer method name.
+	PeerMethod = "peer"
+	// WebMethod is the did:web method name.
+	WebMethod = "web"
+
+	// DefaultWebResolveTimeout is how long fetching a did:web DID document may take if no HTTP client is given.
+	DefaultWebResolveTimeout = 10 * time.Second
+
+	maxWebRedirects = 3
+)
+
+// NewKeyResolver returns a resolver for did:key DIDs. did:key DIDs are resolved locally.
+func NewKeyResolver() MethodResolver {
+	return key.New()
+}
+
+// NewPeerResolver returns a resolver for did:peer DIDs. Peer DID documents are looked up in the given storage
+// provider, where they must have been saved (e.g. during a DID exchange) beforehand.
+func NewPeerResolver(storeProvider ariesstorage.Provider) (MethodResolver, error) {
+	vdr, err := peer.New(storeProvider)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create did:peer resolver: %w", err)
+	}
+
+	return vdr, nil
+}
+
+// NewWebResolver returns a resolver for did:web DIDs. DID documents are fetched over HTTPS with the given client.
+// If httpClient is nil, NewWebHTTPClient(DefaultWebResolveTimeout) is used.
+func NewWebResolver(httpClient *http.Client) MethodResolver {
+	if httpClient == nil {
+		httpClient = NewWebHTTPClient(DefaultWebResolveTimeout)
+	}
+
+	return &webResolver{vdr: web.New(), httpClient: httpClient}
+}
+
+// NewWebHTTPClient returns an HTTP client for fetching did:web DID documents. Requests time out after the given
+// timeout, and only up to 3 redirects over HTTPS to the host of the DID are followed, so that resolving a DID
+// can't make the server fetch documents from other hosts.
+func NewWebHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:       timeout,
+		CheckRedirect: checkWebRedirect,
+	}
+}
+
+func checkWebRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxWebRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxWebRedirects)
+	}
+
+	if req.URL.Scheme != "https" {
+		return errors.New("redirect to a URL that isn't HTTPS")
+	}
+
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("redirect to another host %s", req.URL.Host)
+	}
+
+	return nil
+}
+
+type webResolver struct {
+	vdr        *web.VDR
+	httpClient *http.Client
+}
+
+func (w *webResolver) Read(didID string, opts ...vdrapi.ResolveOpts) (*did.Doc, error) {
+	return w.vdr.Read(didID, append([]vdrapi.ResolveOpts{vdrapi.WithHTTPClient(w.httpClient)}, opts...)...)
+}
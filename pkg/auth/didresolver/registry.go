@@ -0,0 +1,208 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didresolver
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+)
+
+// DefaultCacheTTL is how long resolved DID documents are cached for unless configured otherwise.
+const DefaultCacheTTL = 5 * time.Minute
+
+// ErrMethodNotSupported is returned when a key ID references a DID whose method has no registered resolver.
+var ErrMethodNotSupported = errors.New("DID method not supported")
+
+// MethodResolver resolves DIDs of a single DID method into DID documents.
+// The VDRs in github.com/hyperledger/aries-framework-go/pkg/vdr implement this interface.
+type MethodResolver interface {
+	Read(didID string, opts ...vdrapi.ResolveOpts) (*did.Doc, error)
+}
+
+// Option configures the registry.
+type Option func(r *Registry)
+
+// WithMethod registers the resolver to use for DIDs of the given method (e.g. "key", "web").
+func WithMethod(method string, resolver MethodResolver) Option {
+	return func(r *Registry) {
+		r.resolvers[method] = resolver
+	}
+}
+
+// WithCacheTTL sets how long resolved DID documents are cached for. A TTL of zero disables caching.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(r *Registry) {
+		r.cacheTTL = ttl
+	}
+}
+
+type cacheEntry struct {
+	doc     *did.Doc
+	expires time.Time
+}
+
+// Registry resolves verification keys referenced by DID URLs (e.g. did:web:example.com#key-1) using the resolver
+// registered for the DID's method. Registry implements the KeyResolver interface used by
+// github.com/trustbloc/edge-core/pkg/zcapld.
+type Registry struct {
+	resolvers map[string]MethodResolver
+	cacheTTL  time.Duration
+
+	mutex sync.RWMutex
+	cache map[string]cacheEntry
+	now   func() time.Time
+}
+
+// New returns a new registry. Without any WithMethod options, no DID methods are supported.
+func New(opts ...Option) *Registry {
+	r := &Registry{
+		resolvers: make(map[string]MethodResolver),
+		cacheTTL:  DefaultCacheTTL,
+		cache:     make(map[string]cacheEntry),
+		now:       time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r
+}
+
+// Methods returns the DID methods that have a registered resolver, sorted alphabetically.
+func (r *Registry) Methods() []string {
+	methods := make([]string, 0, len(r.resolvers))
+
+	for method := range r.resolvers {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	return methods
+}
+
+// Resolve returns the public key referenced by the given DID URL.
+// The fragment of the DID URL must identify a verification method in the resolved DID document.
+func (r *Registry) Resolve(keyID string) (*verifier.PublicKey, error) {
+	const numParts = 2
+
+	parts := strings.SplitN(keyID, "#", numParts)
+	if len(parts) != numParts || parts[1] == "" {
+		return nil, fmt.Errorf("key ID %s is not a DID URL with a fragment", keyID)
+	}
+
+	doc, err := r.ResolveDID(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	vm := findVerificationMethod(doc, keyID, parts[1])
+	if vm == nil {
+		return nil, fmt.Errorf("DID document %s has no verification method %s", parts[0], keyID)
+	}
+
+	return &verifier.PublicKey{
+		Type:  vm.Type,
+		Value: vm.Value,
+		JWK:   vm.JSONWebKey(),
+	}, nil
+}
+
+// ResolveDID returns the DID document of the given DID, from the cache if possible.
+func (r *Registry) ResolveDID(didID string) (*did.Doc, error) {
+	if doc, found := r.cached(didID); found {
+		return doc, nil
+	}
+
+	parsed, err := did.Parse(didID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DID %s: %w", didID, err)
+	}
+
+	resolver, found := r.resolvers[parsed.Method]
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrMethodNotSupported, parsed.Method)
+	}
+
+	doc, err := resolver.Read(didID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve DID %s: %w", didID, err)
+	}
+
+	r.store(didID, doc)
+
+	return doc, nil
+}
+
+func (r *Registry) cached(didID string) (*did.Doc, bool) {
+	if r.cacheTTL <= 0 {
+		return nil, false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	entry, found := r.cache[didID]
+	if !found || r.now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.doc, true
+}
+
+func (r *Registry) store(didID string, doc *did.Doc) {
+	if r.cacheTTL <= 0 {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := r.now()
+
+	// Drop expired entries so that the cache doesn't grow with DIDs that are no longer in use.
+	for id, entry := range r.cache {
+		if now.After(entry.expires) {
+			delete(r.cache, id)
+		}
+	}
+
+	r.cache[didID] = cacheEntry{doc: doc, expires: now.Add(r.cacheTTL)}
+}
+
+// findVerificationMethod looks for the verification method with the given ID in the document's verification
+// methods, including those embedded in verification relationships. IDs may be absolute or relative to the DID.
+func findVerificationMethod(doc *did.Doc, keyID, fragment string) *did.VerificationMethod {
+	matches := func(id string) bool {
+		return id == keyID || id == "#"+fragment || id == fragment
+	}
+
+	for i := range doc.VerificationMethod {
+		if matches(doc.VerificationMethod[i].ID) {
+			return &doc.VerificationMethod[i]
+		}
+	}
+
+	for _, verifications := range doc.VerificationMethods() {
+		for i := range verifications {
+			if matches(verifications[i].VerificationMethod.ID) {
+				return &verifications[i].VerificationMethod
+			}
+		}
+	}
+
+	return nil
+}
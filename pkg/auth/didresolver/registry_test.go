@@ -0,0 +1,311 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package didresolver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/did"
+	vdrapi "github.com/hyperledger/aries-framework-go/pkg/framework/aries/api/vdr"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/fingerprint"
+	"github.com/hyperledger/aries-framework-go/pkg/vdr/peer"
+	"github.com/stretchr/testify/require"
+)
+
+const ed25519KeyType = "Ed25519VerificationKey2018"
+
+func TestRegistry_Resolve(t *testing.T) {
+	t.Run("did:key", func(t *testing.T) {
+		pubKey := newPublicKey(t)
+		_, keyURL := fingerprint.CreateDIDKey(pubKey)
+
+		registry := New(WithMethod(KeyMethod, NewKeyResolver()))
+
+		key, err := registry.Resolve(keyURL)
+		require.NoError(t, err)
+		require.Equal(t, []byte(pubKey), key.Value)
+		require.Equal(t, ed25519KeyType, key.Type)
+	})
+
+	t.Run("did:web", func(t *testing.T) {
+		pubKey := newPublicKey(t)
+
+		var docID string
+
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/.well-known/doc.json" {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			_, err := w.Write(newDocBytes(t, docID, pubKey))
+			require.NoError(t, err)
+		}))
+		defer server.Close()
+
+		docID = "did:web:" + url.QueryEscape(strings.TrimPrefix(server.URL, "https://"))
+
+		registry := New(WithMethod(WebMethod, NewWebResolver(server.Client())))
+
+		key, err := registry.Resolve(docID + "#key-1")
+		require.NoError(t, err)
+		require.Equal(t, []byte(pubKey), key.Value)
+	})
+
+	t.Run("did:web redirect to another host", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "https://example.com/.well-known/did.json", http.StatusFound)
+		}))
+		defer server.Close()
+
+		docID := "did:web:" + url.QueryEscape(strings.TrimPrefix(server.URL, "https://"))
+
+		client := NewWebHTTPClient(time.Second)
+		client.Transport = server.Client().Transport
+
+		registry := New(WithMethod(WebMethod, NewWebResolver(client)))
+
+		_, err := registry.Resolve(docID + "#key-1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "redirect to another host example.com")
+	})
+
+	t.Run("did:web server not trusted", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.NotFoundHandler())
+		defer server.Close()
+
+		docID := "did:web:" + url.QueryEscape(strings.TrimPrefix(server.URL, "https://"))
+
+		registry := New(WithMethod(WebMethod, NewWebResolver(nil)))
+
+		key, err := registry.Resolve(docID + "#key-1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve DID")
+		require.Nil(t, key)
+	})
+
+	t.Run("did:peer", func(t *testing.T) {
+		pubKey := newPublicKey(t)
+		storeProvider := ariesmemstorage.NewProvider()
+
+		vm := did.NewVerificationMethodFromBytes("#key-1", ed25519KeyType, "", pubKey)
+
+		doc, err := peer.NewDoc([]did.VerificationMethod{*vm}, did.WithAuthentication([]did.Verification{
+			*did.NewReferencedVerification(vm, did.Authentication),
+		}))
+		require.NoError(t, err)
+
+		vdr, err := peer.New(storeProvider)
+		require.NoError(t, err)
+		require.NoError(t, vdr.Store(doc, nil))
+
+		peerResolver, err := NewPeerResolver(storeProvider)
+		require.NoError(t, err)
+
+		registry := New(WithMethod(PeerMethod, peerResolver))
+
+		key, err := registry.Resolve(doc.ID + "#key-1")
+		require.NoError(t, err)
+		require.Equal(t, []byte(pubKey), key.Value)
+	})
+
+	t.Run("method not supported", func(t *testing.T) {
+		registry := New(WithMethod(KeyMethod, NewKeyResolver()))
+
+		key, err := registry.Resolve("did:web:example.com#key-1")
+		require.True(t, errors.Is(err, ErrMethodNotSupported))
+		require.Nil(t, key)
+	})
+
+	t.Run("key ID without fragment", func(t *testing.T) {
+		key, err := New().Resolve("did:web:example.com")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not a DID URL with a fragment")
+		require.Nil(t, key)
+	})
+
+	t.Run("invalid DID", func(t *testing.T) {
+		key, err := New().Resolve("not-a-did#key-1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse DID")
+		require.Nil(t, key)
+	})
+
+	t.Run("verification method not found", func(t *testing.T) {
+		resolver := &mockMethodResolver{doc: newDoc(t, "did:example:123", newPublicKey(t))}
+		registry := New(WithMethod("example", resolver))
+
+		key, err := registry.Resolve("did:example:123#key-2")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "has no verification method")
+		require.Nil(t, key)
+	})
+
+	t.Run("error from method resolver", func(t *testing.T) {
+		registry := New(WithMethod("example", &mockMethodResolver{err: errors.New("resolver error")}))
+
+		key, err := registry.Resolve("did:example:123#key-1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "resolver error")
+		require.Nil(t, key)
+	})
+}
+
+func TestRegistry_Cache(t *testing.T) {
+	const didID = "did:example:123"
+
+	t.Run("resolved documents are cached until they expire", func(t *testing.T) {
+		resolver := &mockMethodResolver{doc: newDoc(t, didID, newPublicKey(t))}
+		registry := New(WithMethod("example", resolver), WithCacheTTL(time.Minute))
+
+		now := time.Now()
+		registry.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			_, err := registry.Resolve(didID + "#key-1")
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 1, resolver.reads)
+
+		now = now.Add(2 * time.Minute)
+
+		_, err := registry.Resolve(didID + "#key-1")
+		require.NoError(t, err)
+		require.Equal(t, 2, resolver.reads)
+	})
+
+	t.Run("expired entries are dropped", func(t *testing.T) {
+		resolver := &mockMethodResolver{doc: newDoc(t, didID, newPublicKey(t))}
+		registry := New(WithMethod("example", resolver), WithCacheTTL(time.Minute))
+
+		now := time.Now()
+		registry.now = func() time.Time { return now }
+
+		_, err := registry.ResolveDID(didID)
+		require.NoError(t, err)
+
+		now = now.Add(2 * time.Minute)
+
+		_, err = registry.ResolveDID("did:example:456")
+		require.NoError(t, err)
+		require.Len(t, registry.cache, 1)
+		require.Contains(t, registry.cache, "did:example:456")
+	})
+
+	t.Run("caching disabled", func(t *testing.T) {
+		resolver := &mockMethodResolver{doc: newDoc(t, didID, newPublicKey(t))}
+		registry := New(WithMethod("example", resolver), WithCacheTTL(0))
+
+		for i := 0; i < 3; i++ {
+			_, err := registry.Resolve(didID + "#key-1")
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, 3, resolver.reads)
+		require.Empty(t, registry.cache)
+	})
+
+	t.Run("failed resolutions are not cached", func(t *testing.T) {
+		resolver := &mockMethodResolver{err: errors.New("resolver error")}
+		registry := New(WithMethod("example", resolver))
+
+		_, err := registry.ResolveDID(didID)
+		require.Error(t, err)
+		require.Empty(t, registry.cache)
+	})
+}
+
+func TestRegistry_Methods(t *testing.T) {
+	registry := New(WithMethod(WebMethod, NewWebResolver(nil)), WithMethod(KeyMethod, NewKeyResolver()))
+
+	require.Equal(t, []string{KeyMethod, WebMethod}, registry.Methods())
+	require.Empty(t, New().Methods())
+}
+
+func TestCheckWebRedirect(t *testing.T) {
+	newRequest := func(target string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, target, nil)
+	}
+
+	via := []*http.Request{newRequest("https://example.com/.well-known/did.json")}
+
+	require.NoError(t, checkWebRedirect(newRequest("https://example.com/user/did.json"), via))
+
+	err := checkWebRedirect(newRequest("http://example.com/user/did.json"), via)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "isn't HTTPS")
+
+	err = checkWebRedirect(newRequest("https://example.org/.well-known/did.json"), via)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "another host")
+
+	err = checkWebRedirect(newRequest("https://example.com/did.json"), append(via, via[0], via[0], via[0]))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "stopped after 3 redirects")
+
+	require.Equal(t, DefaultWebResolveTimeout, NewWebResolver(nil).(*webResolver).httpClient.Timeout)
+}
+
+func newPublicKey(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+
+	pubKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return pubKey
+}
+
+func newDoc(t *testing.T, didID string, pubKey ed25519.PublicKey) *did.Doc {
+	t.Helper()
+
+	doc, err := did.ParseDocument(newDocBytes(t, didID, pubKey))
+	require.NoError(t, err)
+
+	return doc
+}
+
+func newDocBytes(t *testing.T, didID string, pubKey ed25519.PublicKey) []byte {
+	t.Helper()
+
+	vm := did.NewVerificationMethodFromBytes(fmt.Sprintf("%s#key-1", didID), ed25519KeyType, didID, pubKey)
+
+	doc := did.BuildDoc(did.WithVerificationMethod([]did.VerificationMethod{*vm}))
+	doc.ID = didID
+
+	docBytes, err := doc.JSONBytes()
+	require.NoError(t, err)
+
+	return docBytes
+}
+
+type mockMethodResolver struct {
+	doc   *did.Doc
+	err   error
+	reads int
+}
+
+func (m *mockMethodResolver) Read(didID string, _ ...vdrapi.ResolveOpts) (*did.Doc, error) {
+	m.reads++
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return m.doc, nil
+}
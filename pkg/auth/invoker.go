@@ -0,0 +1,59 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+	"sync"
+)
+
+type invokerKey struct{}
+
+// invokerRecorder holds the invoker of a request. It's shared by the contexts derived from the request's context,
+// so that middleware wrapping the auth middleware can see who the request was authenticated as.
+type invokerRecorder struct {
+	mutex   sync.RWMutex
+	invoker string
+}
+
+// WithInvokerRecorder returns a copy of ctx that auth services record the authenticated invoker of the request in
+// with SetInvoker. The invoker can be read with Invoker once the request has been handled.
+// If ctx already has a recorder, ctx is returned, so that all middleware of a request share the recorder.
+func WithInvokerRecorder(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(invokerKey{}).(*invokerRecorder); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, invokerKey{}, &invokerRecorder{})
+}
+
+// SetInvoker records who the request was authenticated as, such as the key ID of the HTTP signature of a zcap
+// invocation, the controller an access token was issued to or the subject of a client certificate. It does nothing
+// if ctx wasn't created by WithInvokerRecorder.
+func SetInvoker(ctx context.Context, invoker string) {
+	recorder, ok := ctx.Value(invokerKey{}).(*invokerRecorder)
+	if !ok {
+		return
+	}
+
+	recorder.mutex.Lock()
+	recorder.invoker = invoker
+	recorder.mutex.Unlock()
+}
+
+// Invoker returns the invoker recorded in ctx, or an empty string if the request wasn't authenticated.
+func Invoker(ctx context.Context) string {
+	recorder, ok := ctx.Value(invokerKey{}).(*invokerRecorder)
+	if !ok {
+		return ""
+	}
+
+	recorder.mutex.RLock()
+	defer recorder.mutex.RUnlock()
+
+	return recorder.invoker
+}
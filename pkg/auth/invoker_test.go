@@ -0,0 +1,42 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testKey struct{}
+
+func TestInvoker(t *testing.T) {
+	t.Run("recorded", func(t *testing.T) {
+		ctx := WithInvokerRecorder(context.Background())
+		require.Empty(t, Invoker(ctx))
+
+		// The invoker is visible through the contexts that the request's context was derived from.
+		SetInvoker(context.WithValue(ctx, testKey{}, "value"), "did:example:alice#key1")
+		require.Equal(t, "did:example:alice#key1", Invoker(ctx))
+	})
+
+	t.Run("shared recorder", func(t *testing.T) {
+		ctx := WithInvokerRecorder(context.Background())
+
+		// A middleware that adds a recorder inside another one shares it.
+		SetInvoker(WithInvokerRecorder(ctx), "did:example:alice#key1")
+		require.Equal(t, "did:example:alice#key1", Invoker(ctx))
+	})
+
+	t.Run("without recorder", func(t *testing.T) {
+		ctx := context.Background()
+
+		SetInvoker(ctx, "did:example:alice#key1")
+		require.Empty(t, Invoker(ctx))
+	})
+}
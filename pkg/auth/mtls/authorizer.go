@@ -0,0 +1,272 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mtls
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+const storeName = "mtls_vault_controller"
+
+var logger = log.New("auth-mtls")
+
+// errNoClientCertificate is returned when the request has no client certificate that was verified during the
+// TLS handshake.
+var errNoClientCertificate = errors.New("no verified client certificate")
+
+// AuthService authorizes requests that aren't authorized by their client certificate.
+// The zcapld and oauth2 services in this repository implement this interface.
+type AuthService interface {
+	Create(resourceID, verificationMethod string) ([]byte, error)
+	Handler(vaultID string, req *http.Request, w http.ResponseWriter, next http.HandlerFunc) (http.HandlerFunc, error)
+	DocumentHandler(vaultID, docID string, req *http.Request, w http.ResponseWriter,
+		next http.HandlerFunc) (http.HandlerFunc, error)
+	ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+		next http.HandlerFunc) (http.HandlerFunc, error)
+	VerifyController(req *http.Request, controller string) error
+}
+
+// Option configures the authorizer.
+type Option func(a *Authorizer)
+
+// WithAuthService sets the auth service that authorizes requests whose client certificate (if any) isn't granted
+// access by the rules. Without one, such requests are rejected.
+func WithAuthService(authService AuthService) Option {
+	return func(a *Authorizer) {
+		a.authService = authService
+	}
+}
+
+// Authorizer authorizes requests by the client certificate verified during the TLS handshake, using rules that map
+// certificate subjects and subject alternative names to vaults and controllers. Authorizer can be used as the
+// EDV's auth service on its own or in front of another auth service.
+type Authorizer struct {
+	rules       []Rule
+	store       ariesstorage.Store
+	authService AuthService
+}
+
+// New returns a new authorizer that grants access according to the given rules. The controllers of the vaults
+// created while the authorizer is in use are saved in storeProv.
+func New(rules []Rule, storeProv ariesstorage.Provider, opts ...Option) (*Authorizer, error) {
+	store, err := storeProv.OpenStore(storeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", storeName, err)
+	}
+
+	a := &Authorizer{rules: rules, store: store}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	return a, nil
+}
+
+// Create saves the controller of a new vault, so that rules can grant access to the vaults of a controller,
+// and returns the payload created by the auth service (if any).
+func (a *Authorizer) Create(resourceID, verificationMethod string) ([]byte, error) {
+	err := a.store.Put(resourceID, []byte(verificationMethod))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store vault controller: %w", err)
+	}
+
+	if a.authService == nil {
+		return nil, nil
+	}
+
+	return a.authService.Create(resourceID, verificationMethod)
+}
+
+// Handler will create auth handler for a route that targets a whole vault.
+func (a *Authorizer) Handler(vaultID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	allowed, err := a.allowsVault(req, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	if allowed {
+		return next, nil
+	}
+
+	if a.authService == nil {
+		return forbidden(req), nil
+	}
+
+	return a.authService.Handler(vaultID, req, w, next)
+}
+
+// DocumentHandler will create auth handler for a route that targets a single document within a vault.
+// Rules grant access to whole vaults, so documents are authorized like their vault.
+func (a *Authorizer) DocumentHandler(vaultID, docID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	allowed, err := a.allowsVault(req, vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	if allowed {
+		return next, nil
+	}
+
+	if a.authService == nil {
+		return forbidden(req), nil
+	}
+
+	return a.authService.DocumentHandler(vaultID, docID, req, w, next)
+}
+
+// ControllerHandler will create auth handler for a route that only the controller of a vault may use. Only rules
+// that allow the vault's controller grant access, not rules that only allow the vault.
+func (a *Authorizer) ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	controller, err := a.controller(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.allowsController(req, controller) {
+		return next, nil
+	}
+
+	if a.authService == nil {
+		return forbidden(req), nil
+	}
+
+	return a.authService.ControllerHandler(vaultID, req, w, next)
+}
+
+// VerifyController verifies that the request's client certificate is allowed to act for the given controller.
+// Otherwise, the request is verified by the auth service.
+func (a *Authorizer) VerifyController(req *http.Request, controller string) error {
+	if a.allowsController(req, controller) {
+		return nil
+	}
+
+	if a.authService == nil {
+		return fmt.Errorf("client certificate isn't allowed to act for controller %s", controller)
+	}
+
+	return a.authService.VerifyController(req, controller)
+}
+
+// AuthorizeAdmin authorizes requests to admin endpoints. Only clients whose certificate matches an admin rule
+// are allowed. AuthorizeAdmin can be used as a restapi.AdminAuthorizer.
+func (a *Authorizer) AuthorizeAdmin(req *http.Request) error {
+	cert := verifiedClientCert(req)
+	if cert == nil {
+		return errNoClientCertificate
+	}
+
+	for i := range a.rules {
+		if a.rules[i].Admin && a.rules[i].matches(cert) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("client certificate %s isn't allowed to use admin endpoints", cert.Subject)
+}
+
+func (a *Authorizer) allowsController(req *http.Request, controller string) bool {
+	cert := verifiedClientCert(req)
+	if cert == nil {
+		return false
+	}
+
+	auth.SetInvoker(req.Context(), cert.Subject.String())
+
+	for i := range a.rules {
+		if a.rules[i].matches(cert) && a.rules[i].allowsController(controller) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *Authorizer) allowsVault(req *http.Request, vaultID string) (bool, error) {
+	cert := verifiedClientCert(req)
+	if cert == nil {
+		return false, nil
+	}
+
+	// The auth service records its own invoker if the certificate isn't granted access.
+	auth.SetInvoker(req.Context(), cert.Subject.String())
+
+	controller, err := a.controller(vaultID)
+	if err != nil {
+		return false, err
+	}
+
+	for i := range a.rules {
+		if a.rules[i].matches(cert) && a.rules[i].allowsVault(vaultID, controller) {
+			logger.Debugf("client certificate %s granted access to vault %s", cert.Subject, vaultID)
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// controller returns the controller of the given vault, or an empty string if the vault was created before the
+// authorizer was in use.
+func (a *Authorizer) controller(vaultID string) (string, error) {
+	controller, err := a.store.Get(vaultID)
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return "", nil
+		}
+
+		return "", fmt.Errorf("failed to get controller of vault %s from db: %w", vaultID, err)
+	}
+
+	return string(controller), nil
+}
+
+// verifiedClientCert returns the client certificate of the request if it was verified against the client CAs
+// during the TLS handshake.
+func verifiedClientCert(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+func forbidden(req *http.Request) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		cert := verifiedClientCert(req)
+		if cert == nil {
+			logger.Infof("unauthorized request: %s", errNoClientCertificate)
+
+			writeError(w, http.StatusUnauthorized, errNoClientCertificate.Error())
+
+			return
+		}
+
+		logger.Infof("unauthorized request: client certificate %s isn't allowed to access the vault", cert.Subject)
+
+		writeError(w, http.StatusForbidden, "client certificate isn't allowed to access the vault")
+	}
+}
+
+func writeError(w http.ResponseWriter, statusCode int, msg string) {
+	if err := support.WriteError(w, statusCode, nil, msg); err != nil {
+		logger.Errorf("failed to write response: %s", err)
+	}
+}
@@ -0,0 +1,408 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mtls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+const (
+	testVaultID    = "vault1"
+	testController = "did:example:alice"
+)
+
+func TestLoadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtls")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	writeRules := func(t *testing.T, rules string) string {
+		t.Helper()
+
+		path := filepath.Join(dir, "rules.json")
+		require.NoError(t, ioutil.WriteFile(path, []byte(rules), 0600))
+
+		return path
+	}
+
+	t.Run("success", func(t *testing.T) {
+		rules, err := LoadRules(writeRules(t, `{"rules": [
+			{"subject": "indexer", "controllers": ["did:example:alice"]},
+			{"san": "admin.example.com", "admin": true}
+		]}`))
+		require.NoError(t, err)
+		require.Equal(t, []Rule{
+			{Subject: "indexer", Controllers: []string{testController}},
+			{SAN: "admin.example.com", Admin: true},
+		}, rules)
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		_, err := LoadRules(filepath.Join(dir, "missing.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read client certificate rules file")
+	})
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		_, err := LoadRules(writeRules(t, "{"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal client certificate rules")
+	})
+
+	t.Run("rule without subject or SAN", func(t *testing.T) {
+		_, err := LoadRules(writeRules(t, `{"rules": [{"vaults": ["*"]}]}`))
+		require.EqualError(t, err, "invalid client certificate rule 0: subject or san must be set")
+	})
+
+	t.Run("rule that grants nothing", func(t *testing.T) {
+		_, err := LoadRules(writeRules(t, `{"rules": [{"subject": "indexer"}]}`))
+		require.EqualError(t, err, "invalid client certificate rule 0: rule doesn't grant access to anything")
+	})
+}
+
+func TestRule_matches(t *testing.T) {
+	cert := newTestCert("indexer")
+
+	require.True(t, (&Rule{Subject: "indexer"}).matches(cert))
+	require.True(t, (&Rule{Subject: "CN=indexer,O=Example Corp"}).matches(cert))
+	require.True(t, (&Rule{SAN: "indexer.example.com"}).matches(cert))
+	require.True(t, (&Rule{SAN: "indexer@example.com"}).matches(cert))
+	require.True(t, (&Rule{SAN: "10.0.0.1"}).matches(cert))
+	require.True(t, (&Rule{SAN: "spiffe://example.com/indexer"}).matches(cert))
+	require.True(t, (&Rule{Subject: "indexer", SAN: "indexer.example.com"}).matches(cert))
+	require.False(t, (&Rule{Subject: "other"}).matches(cert))
+	require.False(t, (&Rule{Subject: "indexer", SAN: "other.example.com"}).matches(cert))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")})
+	require.EqualError(t, err, "failed to open store mtls_vault_controller: open error")
+}
+
+func TestAuthorizer_Create(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+
+		a, err := New(nil, storeProv)
+		require.NoError(t, err)
+
+		payload, err := a.Create(testVaultID, testController)
+		require.NoError(t, err)
+		require.Nil(t, payload)
+
+		controller, err := storeProv.Store.Get(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, testController, string(controller))
+	})
+
+	t.Run("payload from auth service", func(t *testing.T) {
+		a, err := New(nil, mockstorage.NewMockStoreProvider(),
+			WithAuthService(&mockAuthService{payload: []byte("capability")}))
+		require.NoError(t, err)
+
+		payload, err := a.Create(testVaultID, testController)
+		require.NoError(t, err)
+		require.Equal(t, []byte("capability"), payload)
+	})
+
+	t.Run("failed to store controller", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrPut = errors.New("put error")
+
+		a, err := New(nil, storeProv)
+		require.NoError(t, err)
+
+		_, err = a.Create(testVaultID, testController)
+		require.EqualError(t, err, "failed to store vault controller: put error")
+	})
+}
+
+func TestAuthorizer_Handler(t *testing.T) {
+	rules := []Rule{
+		{Subject: "indexer", Controllers: []string{testController}},
+		{SAN: "backup.example.com", Vaults: []string{Wildcard}},
+	}
+
+	newAuthorizer := func(t *testing.T, opts ...Option) *Authorizer {
+		t.Helper()
+
+		a, err := New(rules, mockstorage.NewMockStoreProvider(), opts...)
+		require.NoError(t, err)
+
+		_, err = a.Create(testVaultID, testController)
+		require.NoError(t, err)
+
+		return a
+	}
+
+	serve := func(t *testing.T, a *Authorizer, vaultID string, cert *x509.Certificate) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newRequest(cert)
+		rw := httptest.NewRecorder()
+
+		h, err := a.Handler(vaultID, req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+		require.NoError(t, err)
+
+		h(rw, req)
+
+		return rw
+	}
+
+	t.Run("certificate allowed by controller", func(t *testing.T) {
+		rw := serve(t, newAuthorizer(t), testVaultID, newTestCert("indexer"))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("certificate allowed by vault wildcard", func(t *testing.T) {
+		cert := newTestCert("backup")
+		cert.DNSNames = []string{"backup.example.com"}
+
+		rw := serve(t, newAuthorizer(t), "unknown", cert)
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("certificate not allowed", func(t *testing.T) {
+		rw := serve(t, newAuthorizer(t), "vault2", newTestCert("indexer"))
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Contains(t, rw.Body.String(), "client certificate isn't allowed to access the vault")
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		rw := serve(t, newAuthorizer(t), testVaultID, nil)
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "no verified client certificate")
+	})
+
+	t.Run("falls back to auth service", func(t *testing.T) {
+		rw := serve(t, newAuthorizer(t, WithAuthService(&mockAuthService{})), testVaultID, nil)
+		require.Equal(t, http.StatusTeapot, rw.Code)
+	})
+
+	t.Run("failed to get controller", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrGet = errors.New("get error")
+
+		a, err := New(rules, storeProv)
+		require.NoError(t, err)
+
+		_, err = a.Handler(testVaultID, newRequest(newTestCert("indexer")), httptest.NewRecorder(), nil)
+		require.EqualError(t, err, "failed to get controller of vault vault1 from db: get error")
+	})
+}
+
+func TestAuthorizer_DocumentHandler(t *testing.T) {
+	a, err := New([]Rule{{Subject: "indexer", Vaults: []string{testVaultID}}}, mockstorage.NewMockStoreProvider(),
+		WithAuthService(&mockAuthService{}))
+	require.NoError(t, err)
+
+	serve := func(t *testing.T, cert *x509.Certificate) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newRequest(cert)
+		rw := httptest.NewRecorder()
+
+		h, err := a.DocumentHandler(testVaultID, "doc1", req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+		require.NoError(t, err)
+
+		h(rw, req)
+
+		return rw
+	}
+
+	require.Equal(t, http.StatusOK, serve(t, newTestCert("indexer")).Code)
+	require.Equal(t, http.StatusTeapot, serve(t, newTestCert("other")).Code)
+}
+
+func TestAuthorizer_ControllerHandler(t *testing.T) {
+	rules := []Rule{
+		{Subject: "indexer", Controllers: []string{testController}},
+		{Subject: "backup", Vaults: []string{Wildcard}},
+	}
+
+	a, err := New(rules, mockstorage.NewMockStoreProvider(), WithAuthService(&mockAuthService{}))
+	require.NoError(t, err)
+
+	_, err = a.Create(testVaultID, testController)
+	require.NoError(t, err)
+
+	serve := func(t *testing.T, cert *x509.Certificate) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newRequest(cert)
+		rw := httptest.NewRecorder()
+
+		h, err := a.ControllerHandler(testVaultID, req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+		require.NoError(t, err)
+
+		h(rw, req)
+
+		return rw
+	}
+
+	require.Equal(t, http.StatusOK, serve(t, newTestCert("indexer")).Code)
+
+	// Rules that only allow the vault don't grant access to controller routes.
+	require.Equal(t, http.StatusTeapot, serve(t, newTestCert("backup")).Code)
+
+	t.Run("without auth service", func(t *testing.T) {
+		a, err := New(rules, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+
+		req := newRequest(newTestCert("backup"))
+		rw := httptest.NewRecorder()
+
+		h, err := a.ControllerHandler(testVaultID, req, rw, nil)
+		require.NoError(t, err)
+
+		h(rw, req)
+		require.Equal(t, http.StatusForbidden, rw.Code)
+	})
+
+	t.Run("failed to get controller", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrGet = errors.New("get error")
+
+		a, err := New(rules, storeProv)
+		require.NoError(t, err)
+
+		_, err = a.ControllerHandler(testVaultID, newRequest(newTestCert("indexer")), httptest.NewRecorder(), nil)
+		require.EqualError(t, err, "failed to get controller of vault vault1 from db: get error")
+	})
+}
+
+func TestAuthorizer_VerifyController(t *testing.T) {
+	rules := []Rule{{Subject: "indexer", Controllers: []string{testController}}}
+
+	t.Run("certificate allowed", func(t *testing.T) {
+		a, err := New(rules, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+
+		require.NoError(t, a.VerifyController(newRequest(newTestCert("indexer")), testController))
+	})
+
+	t.Run("records the certificate subject as the invoker", func(t *testing.T) {
+		a, err := New(rules, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+
+		cert := newTestCert("indexer")
+		req := newRequest(cert)
+		req = req.WithContext(auth.WithInvokerRecorder(req.Context()))
+
+		require.NoError(t, a.VerifyController(req, testController))
+		require.Equal(t, cert.Subject.String(), auth.Invoker(req.Context()))
+	})
+
+	t.Run("certificate not allowed", func(t *testing.T) {
+		a, err := New(rules, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+
+		err = a.VerifyController(newRequest(newTestCert("indexer")), "did:example:bob")
+		require.EqualError(t, err, "client certificate isn't allowed to act for controller did:example:bob")
+	})
+
+	t.Run("falls back to auth service", func(t *testing.T) {
+		a, err := New(rules, mockstorage.NewMockStoreProvider(),
+			WithAuthService(&mockAuthService{verifyErr: errors.New("verify error")}))
+		require.NoError(t, err)
+
+		require.EqualError(t, a.VerifyController(newRequest(nil), testController), "verify error")
+	})
+}
+
+func TestAuthorizer_AuthorizeAdmin(t *testing.T) {
+	a, err := New([]Rule{{Subject: "operator", Admin: true}, {Subject: "indexer", Vaults: []string{Wildcard}}},
+		mockstorage.NewMockStoreProvider())
+	require.NoError(t, err)
+
+	require.NoError(t, a.AuthorizeAdmin(newRequest(newTestCert("operator"))))
+
+	err = a.AuthorizeAdmin(newRequest(newTestCert("indexer")))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "isn't allowed to use admin endpoints")
+
+	require.EqualError(t, a.AuthorizeAdmin(newRequest(nil)), "no verified client certificate")
+}
+
+func newTestCert(commonName string) *x509.Certificate {
+	return &x509.Certificate{
+		Subject:        pkix.Name{CommonName: commonName, Organization: []string{"Example Corp"}},
+		DNSNames:       []string{commonName + ".example.com"},
+		EmailAddresses: []string{commonName + "@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/" + commonName}},
+	}
+}
+
+func newRequest(cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/"+testVaultID+"/documents", nil)
+
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	return req
+}
+
+type mockAuthService struct {
+	payload   []byte
+	verifyErr error
+}
+
+func (m *mockAuthService) Create(string, string) ([]byte, error) {
+	return m.payload, nil
+}
+
+func (m *mockAuthService) Handler(string, *http.Request, http.ResponseWriter,
+	http.HandlerFunc) (http.HandlerFunc, error) {
+	return func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	}, nil
+}
+
+func (m *mockAuthService) DocumentHandler(string, string, *http.Request, http.ResponseWriter,
+	http.HandlerFunc) (http.HandlerFunc, error) {
+	return func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	}, nil
+}
+
+func (m *mockAuthService) ControllerHandler(string, *http.Request, http.ResponseWriter,
+	http.HandlerFunc) (http.HandlerFunc, error) {
+	return func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	}, nil
+}
+
+func (m *mockAuthService) VerifyController(*http.Request, string) error {
+	return m.verifyErr
+}
@@ -0,0 +1,123 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// Wildcard matches any vault or controller in a rule.
+const Wildcard = "*"
+
+// Rule grants the clients whose certificates match Subject and SAN access to vaults.
+type Rule struct {
+	// Subject matches the certificate's subject common name or its full distinguished name
+	// (e.g. CN=indexer,O=Example Corp).
+	Subject string `json:"subject,omitempty"`
+	// SAN matches any of the certificate's DNS, email, IP address or URI subject alternative names.
+	SAN string `json:"san,omitempty"`
+	// Controllers lists the controllers whose vaults the client may access. Wildcard matches any controller.
+	Controllers []string `json:"controllers,omitempty"`
+	// Vaults lists the IDs of the vaults that the client may access. Wildcard matches any vault.
+	Vaults []string `json:"vaults,omitempty"`
+	// Admin allows the client to use admin endpoints, such as the log level endpoints.
+	Admin bool `json:"admin,omitempty"`
+}
+
+type rulesFile struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadRules reads rules from a JSON file in the following format:
+// {"rules": [{"subject": "indexer", "controllers": ["did:example:123"]}]}.
+func LoadRules(path string) ([]Rule, error) {
+	rulesBytes, err := ioutil.ReadFile(path) //nolint: gosec // path is set by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate rules file: %w", err)
+	}
+
+	var file rulesFile
+
+	err = json.Unmarshal(rulesBytes, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client certificate rules: %w", err)
+	}
+
+	for i := range file.Rules {
+		err = file.Rules[i].validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate rule %d: %w", i, err)
+		}
+	}
+
+	return file.Rules, nil
+}
+
+func (r *Rule) validate() error {
+	if r.Subject == "" && r.SAN == "" {
+		return errors.New("subject or san must be set")
+	}
+
+	if len(r.Controllers) == 0 && len(r.Vaults) == 0 && !r.Admin {
+		return errors.New("rule doesn't grant access to anything")
+	}
+
+	return nil
+}
+
+func (r *Rule) matches(cert *x509.Certificate) bool {
+	if r.Subject != "" && r.Subject != cert.Subject.CommonName && r.Subject != cert.Subject.String() {
+		return false
+	}
+
+	if r.SAN != "" && !contains(subjectAltNames(cert), r.SAN) {
+		return false
+	}
+
+	return true
+}
+
+func (r *Rule) allowsVault(vaultID, controller string) bool {
+	if contains(r.Vaults, vaultID) || contains(r.Vaults, Wildcard) {
+		return true
+	}
+
+	return r.allowsController(controller)
+}
+
+func (r *Rule) allowsController(controller string) bool {
+	return controller != "" && (contains(r.Controllers, controller) || contains(r.Controllers, Wildcard))
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,244 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/square/go-jose"
+)
+
+const (
+	// DefaultKeySetRefreshInterval is how often a remote JWK set is fetched again to pick up rotated keys.
+	DefaultKeySetRefreshInterval = 15 * time.Minute
+	// DefaultKeySetFetchTimeout is how long fetching a remote JWK set may take if no HTTP client is given.
+	DefaultKeySetFetchTimeout = 10 * time.Second
+
+	// minKeySetRefreshInterval limits how often tokens signed with unknown keys can cause a remote JWK set to be
+	// fetched again.
+	minKeySetRefreshInterval = time.Minute
+)
+
+// ErrKeyNotFound is returned when a JWK set has no key with the requested key ID.
+var ErrKeyNotFound = errors.New("key not found in JWK set")
+
+// KeySet provides the public keys that access tokens are signed with.
+type KeySet interface {
+	// Key returns the key with the given key ID. If keyID is empty, the key set must contain a single key.
+	Key(keyID string) (*jose.JSONWebKey, error)
+}
+
+// NewFileKeySet returns a key set with the keys of the JWK set stored in the given file.
+func NewFileKeySet(path string) (KeySet, error) {
+	jwksBytes, err := ioutil.ReadFile(path) //nolint: gosec // path is set by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWK set file: %w", err)
+	}
+
+	var keys jose.JSONWebKeySet
+
+	err = json.Unmarshal(jwksBytes, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JWK set: %w", err)
+	}
+
+	return &staticKeySet{keys: keys}, nil
+}
+
+type staticKeySet struct {
+	keys jose.JSONWebKeySet
+}
+
+func (s *staticKeySet) Key(keyID string) (*jose.JSONWebKey, error) {
+	return findKey(&s.keys, keyID)
+}
+
+// RemoteKeySet is a key set fetched from a JWKS URL, such as the jwks_uri of an OpenID Connect provider.
+// The key set is fetched again after the refresh interval and, at most once per minute, when a token is
+// signed with a key that isn't in the cached key set. If fetching the key set again fails, the cached keys are used
+// until it succeeds.
+type RemoteKeySet struct {
+	jwksURL         string
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	// fetchMutex serializes the fetches of the key set. It's held while the key set is fetched, so mutex isn't,
+	// and requests don't wait for the JWKS URL while there are cached keys.
+	fetchMutex sync.Mutex
+
+	mutex    sync.Mutex
+	keys     *jose.JSONWebKeySet
+	fetched  time.Time
+	fetching bool
+	// attempted, attempts and fetchErr are the time, number and error of the fetches, successful or not.
+	attempted time.Time
+	attempts  int
+	fetchErr  error
+}
+
+// NewRemoteKeySet returns a key set fetched from the given URL with httpClient.
+// If httpClient is nil, a client that times out after DefaultKeySetFetchTimeout is used.
+func NewRemoteKeySet(jwksURL string, httpClient *http.Client) *RemoteKeySet {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultKeySetFetchTimeout}
+	}
+
+	return &RemoteKeySet{
+		jwksURL:         jwksURL,
+		httpClient:      httpClient,
+		refreshInterval: DefaultKeySetRefreshInterval,
+		now:             time.Now,
+	}
+}
+
+// Key returns the key with the given key ID, fetching the key set if needed.
+func (r *RemoteKeySet) Key(keyID string) (*jose.JSONWebKey, error) {
+	now := r.now()
+
+	r.mutex.Lock()
+	keys, fetched := r.keys, r.fetched
+	r.mutex.Unlock()
+
+	if keys == nil || now.Sub(fetched) > r.refreshInterval {
+		var err error
+
+		keys, fetched, err = r.refresh(now)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := findKey(keys, keyID)
+	if errors.Is(err, ErrKeyNotFound) && now.Sub(fetched) > minKeySetRefreshInterval {
+		// The key may have been rotated in since the key set was fetched.
+		keys, _, err = r.refresh(now)
+		if err != nil {
+			return nil, err
+		}
+
+		return findKey(keys, keyID)
+	}
+
+	return key, err
+}
+
+// refresh fetches the key set and returns the latest keys and when they were fetched. The cached keys are returned
+// without fetching the key set if it's already being fetched or was fetched less than a minute ago, and if fetching
+// it fails.
+func (r *RemoteKeySet) refresh(now time.Time) (*jose.JSONWebKeySet, time.Time, error) {
+	r.mutex.Lock()
+
+	if r.keys != nil && (r.fetching || now.Sub(r.attempted) < minKeySetRefreshInterval) {
+		defer r.mutex.Unlock()
+
+		return r.keys, r.fetched, nil
+	}
+
+	attempts := r.attempts
+
+	r.mutex.Unlock()
+
+	r.fetchMutex.Lock()
+	defer r.fetchMutex.Unlock()
+
+	r.mutex.Lock()
+
+	if r.attempts != attempts {
+		// The key set was fetched while waiting for the fetch mutex.
+		defer r.mutex.Unlock()
+
+		return r.cachedKeys()
+	}
+
+	r.fetching = true
+
+	r.mutex.Unlock()
+
+	keys, err := r.fetch()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.fetching = false
+	r.attempted = now
+	r.attempts++
+	r.fetchErr = err
+
+	if err != nil {
+		if r.keys != nil {
+			logger.Warnf("failed to refresh JWK set, using the cached keys: %s", err)
+		}
+
+		return r.cachedKeys()
+	}
+
+	r.keys, r.fetched = keys, now
+
+	return r.keys, r.fetched, nil
+}
+
+// cachedKeys returns the cached keys, or the error of the last fetch if there are none. mutex must be held.
+func (r *RemoteKeySet) cachedKeys() (*jose.JSONWebKeySet, time.Time, error) {
+	if r.keys == nil {
+		return nil, time.Time{}, r.fetchErr
+	}
+
+	return r.keys, r.fetched, nil
+}
+
+func (r *RemoteKeySet) fetch() (*jose.JSONWebKeySet, error) {
+	resp, err := r.httpClient.Get(r.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWK set from %s: %w", r.jwksURL, err)
+	}
+
+	defer func() {
+		errClose := resp.Body.Close()
+		if errClose != nil {
+			logger.Errorf("failed to close JWK set response body: %s", errClose)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWK set from %s: server returned status code %d", r.jwksURL,
+			resp.StatusCode)
+	}
+
+	var keys jose.JSONWebKeySet
+
+	err = json.NewDecoder(resp.Body).Decode(&keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode JWK set from %s: %w", r.jwksURL, err)
+	}
+
+	return &keys, nil
+}
+
+func findKey(keys *jose.JSONWebKeySet, keyID string) (*jose.JSONWebKey, error) {
+	if keyID == "" {
+		if len(keys.Keys) != 1 {
+			return nil, fmt.Errorf("%w: token has no key ID and the JWK set has %d keys", ErrKeyNotFound,
+				len(keys.Keys))
+		}
+
+		return &keys.Keys[0], nil
+	}
+
+	found := keys.Key(keyID)
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+
+	return &found[0], nil
+}
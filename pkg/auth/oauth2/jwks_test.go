@@ -0,0 +1,283 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFileKeySet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}()
+
+	t.Run("success", func(t *testing.T) {
+		jwksBytes, err := json.Marshal(newTestSigner(t).jwks())
+		require.NoError(t, err)
+
+		path := filepath.Join(dir, "jwks.json")
+		require.NoError(t, ioutil.WriteFile(path, jwksBytes, 0600))
+
+		keys, err := NewFileKeySet(path)
+		require.NoError(t, err)
+
+		key, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+		require.Equal(t, testKeyID, key.KeyID)
+
+		key, err = keys.Key("")
+		require.NoError(t, err)
+		require.Equal(t, testKeyID, key.KeyID)
+
+		_, err = keys.Key("key-2")
+		require.True(t, errors.Is(err, ErrKeyNotFound))
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		_, err := NewFileKeySet(filepath.Join(dir, "missing.json"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read JWK set file")
+	})
+
+	t.Run("invalid JWK set", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.json")
+		require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+
+		_, err := NewFileKeySet(path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal JWK set")
+	})
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	jwks := newTestSigner(t).jwks()
+
+	var fetches int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		fetches++
+
+		require.NoError(t, json.NewEncoder(rw).Encode(jwks))
+	}))
+	defer srv.Close()
+
+	t.Run("key set is cached until the refresh interval", func(t *testing.T) {
+		fetches = 0
+
+		keys := NewRemoteKeySet(srv.URL, srv.Client())
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			key, err := keys.Key(testKeyID)
+			require.NoError(t, err)
+			require.Equal(t, testKeyID, key.KeyID)
+		}
+
+		require.Equal(t, 1, fetches)
+
+		now = now.Add(DefaultKeySetRefreshInterval + time.Second)
+
+		_, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+		require.Equal(t, 2, fetches)
+	})
+
+	t.Run("unknown keys cause a rate-limited refetch", func(t *testing.T) {
+		fetches = 0
+
+		keys := NewRemoteKeySet(srv.URL, srv.Client())
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		_, err := keys.Key("key-2")
+		require.True(t, errors.Is(err, ErrKeyNotFound))
+		require.Equal(t, 1, fetches)
+
+		_, err = keys.Key("key-2")
+		require.True(t, errors.Is(err, ErrKeyNotFound))
+		require.Equal(t, 1, fetches)
+
+		now = now.Add(2 * time.Minute)
+
+		_, err = keys.Key("key-2")
+		require.True(t, errors.Is(err, ErrKeyNotFound))
+		require.Equal(t, 2, fetches)
+	})
+
+	t.Run("cached keys are used if a refresh fails", func(t *testing.T) {
+		fail := false
+
+		flakySrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			if fail {
+				rw.WriteHeader(http.StatusInternalServerError)
+
+				return
+			}
+
+			require.NoError(t, json.NewEncoder(rw).Encode(jwks))
+		}))
+		defer flakySrv.Close()
+
+		keys := NewRemoteKeySet(flakySrv.URL, flakySrv.Client())
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		_, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+
+		fail = true
+		now = now.Add(DefaultKeySetRefreshInterval + time.Second)
+
+		key, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+		require.Equal(t, testKeyID, key.KeyID)
+	})
+
+	t.Run("cached keys are used while the key set is fetched", func(t *testing.T) {
+		block := make(chan struct{})
+		blocked := make(chan struct{}, 1)
+
+		var slowFetches int32
+
+		slowSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			if atomic.AddInt32(&slowFetches, 1) > 1 {
+				blocked <- struct{}{}
+				<-block
+			}
+
+			require.NoError(t, json.NewEncoder(rw).Encode(jwks))
+		}))
+		defer slowSrv.Close()
+
+		keys := NewRemoteKeySet(slowSrv.URL, slowSrv.Client())
+
+		var mutex sync.Mutex
+
+		now := time.Now()
+		keys.now = func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			return now
+		}
+
+		_, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+
+		mutex.Lock()
+		now = now.Add(DefaultKeySetRefreshInterval + time.Second)
+		mutex.Unlock()
+
+		refreshed := make(chan error)
+
+		go func() {
+			_, errKey := keys.Key(testKeyID)
+			refreshed <- errKey
+		}()
+
+		<-blocked
+
+		key, err := keys.Key(testKeyID)
+		require.NoError(t, err)
+		require.Equal(t, testKeyID, key.KeyID)
+
+		close(block)
+		require.NoError(t, <-refreshed)
+		require.Equal(t, int32(2), atomic.LoadInt32(&slowFetches))
+	})
+
+	t.Run("concurrent requests fetch the key set once", func(t *testing.T) {
+		var concurrentFetches int32
+
+		countingSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			atomic.AddInt32(&concurrentFetches, 1)
+
+			require.NoError(t, json.NewEncoder(rw).Encode(jwks))
+		}))
+		defer countingSrv.Close()
+
+		keys := NewRemoteKeySet(countingSrv.URL, countingSrv.Client())
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				_, errKey := keys.Key(testKeyID)
+				require.NoError(t, errKey)
+			}()
+		}
+
+		wg.Wait()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&concurrentFetches))
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		errSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer errSrv.Close()
+
+		_, err := NewRemoteKeySet(errSrv.URL, nil).Key(testKeyID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "server returned status code 500")
+	})
+
+	t.Run("invalid JWK set", func(t *testing.T) {
+		invalidSrv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			_, err := rw.Write([]byte("{"))
+			require.NoError(t, err)
+		}))
+		defer invalidSrv.Close()
+
+		_, err := NewRemoteKeySet(invalidSrv.URL, nil).Key(testKeyID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decode JWK set")
+	})
+
+	t.Run("server unreachable", func(t *testing.T) {
+		_, err := NewRemoteKeySet("http://localhost:0/jwks", nil).Key(testKeyID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to fetch JWK set")
+	})
+}
+
+func TestFindKey(t *testing.T) {
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "key-1"}, {KeyID: "key-2"}}}
+
+	key, err := findKey(&jwks, "key-2")
+	require.NoError(t, err)
+	require.Equal(t, "key-2", key.KeyID)
+
+	_, err = findKey(&jwks, "")
+	require.True(t, errors.Is(err, ErrKeyNotFound))
+	require.Contains(t, err.Error(), "token has no key ID and the JWK set has 2 keys")
+}
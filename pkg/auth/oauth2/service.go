@@ -0,0 +1,285 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/square/go-jose/jwt"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+const (
+	storeName = "oauth2_vault_controller"
+
+	// DefaultControllerClaim is the access token claim whose value is compared to the controller of a vault.
+	DefaultControllerClaim = "sub"
+	// DefaultReadScope is the scope an access token needs to read from a vault.
+	DefaultReadScope = "edv:read"
+	// DefaultWriteScope is the scope an access token needs to write to a vault.
+	DefaultWriteScope = "edv:write"
+
+	bearerScheme = "bearer "
+)
+
+var logger = log.New("auth-oauth2-service")
+
+// Option configures the OAuth2 service.
+type Option func(s *Service)
+
+// WithIssuer sets the issuer that access tokens must have been issued by. Any issuer is accepted by default.
+func WithIssuer(issuer string) Option {
+	return func(s *Service) {
+		s.issuer = issuer
+	}
+}
+
+// WithAudience sets the audience that access tokens must have been issued for. Any audience is accepted by default.
+func WithAudience(audience string) Option {
+	return func(s *Service) {
+		s.audience = audience
+	}
+}
+
+// WithControllerClaim sets the access token claim that holds the vault controller the token was issued to.
+// Defaults to DefaultControllerClaim.
+func WithControllerClaim(claim string) Option {
+	return func(s *Service) {
+		s.controllerClaim = claim
+	}
+}
+
+// WithScopes sets the scopes that access tokens need to read from and write to vaults.
+// Defaults to DefaultReadScope and DefaultWriteScope.
+func WithScopes(readScope, writeScope string) Option {
+	return func(s *Service) {
+		s.readScope = readScope
+		s.writeScope = writeScope
+	}
+}
+
+// Service authorizes requests with OAuth2 bearer access tokens in JWT format, such as the ones issued by
+// OpenID Connect providers. A token grants access to the vaults whose controller matches the token's controller
+// claim, as long as the token has the scope needed by the request.
+type Service struct {
+	keys  KeySet
+	store ariesstorage.Store
+
+	issuer          string
+	audience        string
+	controllerClaim string
+	readScope       string
+	writeScope      string
+	now             func() time.Time
+}
+
+// New returns a new OAuth2 service that verifies access tokens with the given keys. The controllers of the vaults
+// created while the service is in use are saved in storeProv.
+func New(keys KeySet, storeProv ariesstorage.Provider, opts ...Option) (*Service, error) {
+	store, err := storeProv.OpenStore(storeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", storeName, err)
+	}
+
+	svc := &Service{
+		keys:            keys,
+		store:           store,
+		controllerClaim: DefaultControllerClaim,
+		readScope:       DefaultReadScope,
+		writeScope:      DefaultWriteScope,
+		now:             time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	return svc, nil
+}
+
+// Create saves the controller of a new vault. There's no payload to return to the vault's creator,
+// who accesses the vault with access tokens issued to the controller.
+func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error) {
+	err := s.store.Put(resourceID, []byte(verificationMethod))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store vault controller: %w", err)
+	}
+
+	return nil, nil
+}
+
+// Handler will create auth handler for a route that targets a whole vault.
+func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	controller, err := s.store.Get(resourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get controller of vault %s from db: %w", resourceID, err)
+	}
+
+	scope := s.writeScope
+	if req.Method == http.MethodGet {
+		scope = s.readScope
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := s.authorize(r, string(controller), scope)
+		if err != nil {
+			writeAuthError(w, err)
+
+			return
+		}
+
+		next(w, r)
+	}, nil
+}
+
+// DocumentHandler will create auth handler for a route that targets a single document within a vault.
+// Access tokens grant access to whole vaults, so this is the same as Handler.
+func (s *Service) DocumentHandler(vaultID, _ string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return s.Handler(vaultID, req, w, next)
+}
+
+// ControllerHandler will create auth handler for a route that only the controller of a vault may use. Access
+// tokens are only accepted if they were issued to the vault's controller, so this is the same as Handler.
+func (s *Service) ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return s.Handler(vaultID, req, w, next)
+}
+
+// VerifyController verifies that the request has an access token issued to the given controller with the scope
+// needed to write to vaults.
+func (s *Service) VerifyController(req *http.Request, controller string) error {
+	return s.authorize(req, controller, s.writeScope)
+}
+
+// errInsufficientScope is returned when a valid access token doesn't grant access to the requested resource.
+var errInsufficientScope = errors.New("insufficient scope")
+
+func (s *Service) authorize(req *http.Request, controller, scope string) error {
+	claims, err := s.verifyToken(req)
+	if err != nil {
+		return err
+	}
+
+	tokenController, ok := claims[s.controllerClaim].(string)
+	if ok {
+		auth.SetInvoker(req.Context(), tokenController)
+	}
+
+	if !ok || tokenController != controller {
+		return fmt.Errorf("%w: access token wasn't issued to the vault's controller", errInsufficientScope)
+	}
+
+	if !hasScope(claims, scope) {
+		return fmt.Errorf("%w: access token doesn't have scope %s", errInsufficientScope, scope)
+	}
+
+	return nil
+}
+
+// verifyToken verifies the signature and standard claims of the request's bearer token and returns its claims.
+func (s *Service) verifyToken(req *http.Request) (map[string]interface{}, error) {
+	authorization := req.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(authorization), bearerScheme) {
+		return nil, errors.New("missing bearer access token")
+	}
+
+	token, err := jwt.ParseSigned(strings.TrimSpace(authorization[len(bearerScheme):]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse access token: %w", err)
+	}
+
+	if len(token.Headers) != 1 {
+		return nil, errors.New("access token must have exactly one signature")
+	}
+
+	key, err := s.keys.Key(token.Headers[0].KeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access token signing key: %w", err)
+	}
+
+	var (
+		standardClaims jwt.Claims
+		claims         map[string]interface{}
+	)
+
+	// The jwt package is built on gopkg.in/square/go-jose.v2, so it takes the raw public key rather than our JWK.
+	err = token.Claims(key.Key, &standardClaims, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify access token: %w", err)
+	}
+
+	if standardClaims.Expiry == nil {
+		return nil, errors.New("access token has no expiry")
+	}
+
+	expected := jwt.Expected{Issuer: s.issuer, Time: s.now()}
+
+	if s.audience != "" {
+		expected.Audience = jwt.Audience{s.audience}
+	}
+
+	err = standardClaims.Validate(expected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access token: %w", err)
+	}
+
+	return claims, nil
+}
+
+// hasScope checks if the token has the given scope in either the space-separated scope claim (RFC 8693)
+// or the scp array claim used by some providers.
+func hasScope(claims map[string]interface{}, scope string) bool {
+	if scopes, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scopes) {
+			if s == scope {
+				return true
+			}
+		}
+	}
+
+	if scopes, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writeAuthError writes the error as described in RFC 6750: 403 if the token is valid but doesn't grant access,
+// 401 otherwise.
+func writeAuthError(w http.ResponseWriter, err error) {
+	logger.Infof("unauthorized request: %s", err)
+
+	if errors.Is(err, errInsufficientScope) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+		writeError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	writeError(w, http.StatusUnauthorized, err)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	if errWrite := support.WriteError(w, statusCode, err, err.Error()); errWrite != nil {
+		logger.Errorf("failed to write response: %s", errWrite)
+	}
+}
@@ -0,0 +1,347 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package oauth2
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/square/go-jose"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+)
+
+const (
+	testVaultID    = "vault1"
+	testController = "did:example:alice"
+	testIssuer     = "https://issuer.example.com"
+	testAudience   = "https://edv.example.com"
+	testKeyID      = "key-1"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc, err := New(&staticKeySet{}, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+		require.Equal(t, DefaultControllerClaim, svc.controllerClaim)
+		require.Equal(t, DefaultReadScope, svc.readScope)
+		require.Equal(t, DefaultWriteScope, svc.writeScope)
+	})
+
+	t.Run("failed to open store", func(t *testing.T) {
+		_, err := New(&staticKeySet{}, &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")})
+		require.EqualError(t, err, "failed to open store oauth2_vault_controller: open error")
+	})
+}
+
+func TestService_Create(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+
+		svc, err := New(&staticKeySet{}, storeProv)
+		require.NoError(t, err)
+
+		payload, err := svc.Create(testVaultID, testController)
+		require.NoError(t, err)
+		require.Nil(t, payload)
+
+		controller, err := storeProv.Store.Get(testVaultID)
+		require.NoError(t, err)
+		require.Equal(t, testController, string(controller))
+	})
+
+	t.Run("failed to store controller", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrPut = errors.New("put error")
+
+		svc, err := New(&staticKeySet{}, storeProv)
+		require.NoError(t, err)
+
+		_, err = svc.Create(testVaultID, testController)
+		require.EqualError(t, err, "failed to store vault controller: put error")
+	})
+}
+
+func TestService_Handler(t *testing.T) {
+	signer := newTestSigner(t)
+
+	svc, err := New(signer.keySet(), mockstorage.NewMockStoreProvider(),
+		WithIssuer(testIssuer), WithAudience(testAudience))
+	require.NoError(t, err)
+
+	_, err = svc.Create(testVaultID, testController)
+	require.NoError(t, err)
+
+	serve := func(t *testing.T, method, token string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := httptest.NewRequest(method, "/encrypted-data-vaults/"+testVaultID+"/documents", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rw := httptest.NewRecorder()
+
+		h, err := svc.Handler(testVaultID, req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusOK)
+		})
+		require.NoError(t, err)
+
+		h(rw, req)
+
+		return rw
+	}
+
+	t.Run("read with read scope", func(t *testing.T) {
+		rw := serve(t, http.MethodGet, signer.token(t, validClaims(DefaultReadScope)))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("write with write scope in scp claim", func(t *testing.T) {
+		claims := validClaims("")
+		delete(claims, "scope")
+		claims["scp"] = []string{DefaultReadScope, DefaultWriteScope}
+
+		rw := serve(t, http.MethodPost, signer.token(t, claims))
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("write with read scope only", func(t *testing.T) {
+		rw := serve(t, http.MethodPost, signer.token(t, validClaims(DefaultReadScope)))
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Equal(t, `Bearer error="insufficient_scope"`, rw.Header().Get("WWW-Authenticate"))
+		require.Contains(t, rw.Body.String(), "access token doesn't have scope edv:write")
+	})
+
+	t.Run("token issued to another controller", func(t *testing.T) {
+		claims := validClaims(DefaultReadScope)
+		claims["sub"] = "did:example:bob"
+
+		rw := serve(t, http.MethodGet, signer.token(t, claims))
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Contains(t, rw.Body.String(), "access token wasn't issued to the vault's controller")
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		rw := serve(t, http.MethodGet, "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Equal(t, `Bearer error="invalid_token"`, rw.Header().Get("WWW-Authenticate"))
+		require.Contains(t, rw.Body.String(), "missing bearer access token")
+	})
+
+	t.Run("malformed token", func(t *testing.T) {
+		rw := serve(t, http.MethodGet, "not-a-jwt")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to parse access token")
+	})
+
+	t.Run("token signed by an unknown key", func(t *testing.T) {
+		rw := serve(t, http.MethodGet, newTestSigner(t).token(t, validClaims(DefaultReadScope)))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to verify access token")
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		claims := validClaims(DefaultReadScope)
+		claims["exp"] = time.Now().Add(-time.Hour).Unix()
+
+		rw := serve(t, http.MethodGet, signer.token(t, claims))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "token is expired")
+	})
+
+	t.Run("token without expiry", func(t *testing.T) {
+		claims := validClaims(DefaultReadScope)
+		delete(claims, "exp")
+
+		rw := serve(t, http.MethodGet, signer.token(t, claims))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "access token has no expiry")
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		claims := validClaims(DefaultReadScope)
+		claims["iss"] = "https://other.example.com"
+
+		rw := serve(t, http.MethodGet, signer.token(t, claims))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "invalid issuer claim")
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		claims := validClaims(DefaultReadScope)
+		claims["aud"] = "https://other.example.com"
+
+		rw := serve(t, http.MethodGet, signer.token(t, claims))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "invalid audience claim")
+	})
+
+	t.Run("unknown vault", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		_, err := svc.Handler("unknown", req, httptest.NewRecorder(), nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get controller of vault unknown from db")
+	})
+}
+
+func TestService_DocumentHandler(t *testing.T) {
+	signer := newTestSigner(t)
+
+	svc, err := New(signer.keySet(), mockstorage.NewMockStoreProvider())
+	require.NoError(t, err)
+
+	_, err = svc.Create(testVaultID, testController)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signer.token(t, validClaims(DefaultWriteScope)))
+
+	rw := httptest.NewRecorder()
+
+	h, err := svc.DocumentHandler(testVaultID, "doc1", req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusNoContent)
+	})
+	require.NoError(t, err)
+
+	h(rw, req)
+	require.Equal(t, http.StatusNoContent, rw.Code)
+}
+
+func TestService_ControllerHandler(t *testing.T) {
+	signer := newTestSigner(t)
+
+	svc, err := New(signer.keySet(), mockstorage.NewMockStoreProvider())
+	require.NoError(t, err)
+
+	_, err = svc.Create(testVaultID, testController)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+signer.token(t, validClaims(DefaultWriteScope)))
+
+	rw := httptest.NewRecorder()
+
+	h, err := svc.ControllerHandler(testVaultID, req, rw, func(rw http.ResponseWriter, _ *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	})
+	require.NoError(t, err)
+
+	h(rw, req)
+	require.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestService_VerifyController(t *testing.T) {
+	signer := newTestSigner(t)
+
+	svc, err := New(signer.keySet(), mockstorage.NewMockStoreProvider(),
+		WithControllerClaim("controller"), WithScopes("vault.read", "vault.write"))
+	require.NoError(t, err)
+
+	newRequest := func(claims map[string]interface{}) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults", nil)
+		req.Header.Set("Authorization", "Bearer "+signer.token(t, claims))
+
+		return req
+	}
+
+	t.Run("success", func(t *testing.T) {
+		claims := validClaims("vault.write")
+		claims["controller"] = testController
+
+		require.NoError(t, svc.VerifyController(newRequest(claims), testController))
+	})
+
+	t.Run("records the controller as the invoker", func(t *testing.T) {
+		claims := validClaims("vault.write")
+		claims["controller"] = testController
+
+		req := newRequest(claims)
+		req = req.WithContext(auth.WithInvokerRecorder(req.Context()))
+
+		require.NoError(t, svc.VerifyController(req, testController))
+		require.Equal(t, testController, auth.Invoker(req.Context()))
+	})
+
+	t.Run("controller claim missing", func(t *testing.T) {
+		err := svc.VerifyController(newRequest(validClaims("vault.write")), testController)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "access token wasn't issued to the vault's controller")
+	})
+
+	t.Run("write scope missing", func(t *testing.T) {
+		claims := validClaims(DefaultWriteScope)
+		claims["controller"] = testController
+
+		err := svc.VerifyController(newRequest(claims), testController)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "access token doesn't have scope vault.write")
+	})
+}
+
+func validClaims(scope string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   testAudience,
+		"sub":   testController,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": scope,
+	}
+}
+
+type testSigner struct {
+	privKey *ecdsa.PrivateKey
+	signer  jose.Signer
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: privKey},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader(jose.HeaderKey("kid"), testKeyID))
+	require.NoError(t, err)
+
+	return &testSigner{privKey: privKey, signer: signer}
+}
+
+func (s *testSigner) token(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	jws, err := s.signer.Sign(payload)
+	require.NoError(t, err)
+
+	token, err := jws.CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
+
+func (s *testSigner) jwks() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key: &s.privKey.PublicKey, KeyID: testKeyID, Algorithm: string(jose.ES256), Use: "sig",
+	}}}
+}
+
+func (s *testSigner) keySet() KeySet {
+	return &staticKeySet{keys: s.jwks()}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+const (
+	indexStoreName = "zcap_capability_index"
+
+	vaultIndex      = "vault"
+	invokerIndex    = "invoker"
+	parentIndex     = "parent"
+	capabilityIndex = "capability"
+	revocationIndex = "revocation"
+
+	indexKeySeparator = "|"
+)
+
+// ErrCapabilityNotFound is returned when a capability isn't known to the service.
+var ErrCapabilityNotFound = errors.New("capability not found")
+
+// CapabilityQuery selects capabilities. Only capabilities that match all of the fields that are set are selected.
+type CapabilityQuery struct {
+	VaultID string
+	Invoker string
+	Parent  string
+}
+
+// CapabilityInfo is a capability issued by the service together with its status.
+type CapabilityInfo struct {
+	Capability *zcapld.Capability `json:"capability"`
+	VaultID    string             `json:"vaultID"`
+	Revoked    bool               `json:"revoked"`
+	RevokedAt  *time.Time         `json:"revokedAt,omitempty"`
+}
+
+// Revocation is the revocation of a capability of a vault.
+type Revocation struct {
+	CapabilityID string    `json:"capabilityID"`
+	VaultID      string    `json:"vaultID"`
+	RevokedAt    time.Time `json:"revokedAt"`
+}
+
+// Capabilities returns the capabilities issued by Create that match the query. At least one of the query fields
+// must be set.
+func (s *Service) Capabilities(query *CapabilityQuery) ([]*CapabilityInfo, error) {
+	var index, value string
+
+	switch {
+	case query.Parent != "":
+		index, value = parentIndex, query.Parent
+	case query.Invoker != "":
+		index, value = invokerIndex, query.Invoker
+	case query.VaultID != "":
+		index, value = vaultIndex, query.VaultID
+	default:
+		return nil, errors.New("vault ID, invoker or parent must be set")
+	}
+
+	ids, err := s.indexedCapabilityIDs(index, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var capabilities []*CapabilityInfo
+
+	for _, id := range ids {
+		info, err := s.Capability(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if query.matches(info) {
+			capabilities = append(capabilities, info)
+		}
+	}
+
+	return capabilities, nil
+}
+
+// Capability returns the capability with the given ID. ErrCapabilityNotFound is returned if the capability wasn't
+// issued by Create.
+func (s *Service) Capability(id string) (*CapabilityInfo, error) {
+	vaultID, err := s.indexStore.Get(indexKey(capabilityIndex, id))
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCapabilityNotFound, id)
+		}
+
+		return nil, fmt.Errorf("failed to get capability %s from index: %w", id, err)
+	}
+
+	capability, err := s.getCapability(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get capability %s from db: %w", id, err)
+	}
+
+	revokedAt, err := s.revokedAt(string(vaultID), id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CapabilityInfo{
+		Capability: capability, VaultID: string(vaultID), Revoked: revokedAt != nil, RevokedAt: revokedAt,
+	}, nil
+}
+
+// Chain returns the capability with the given ID and all the capabilities it was delegated from,
+// starting with the vault's root capability.
+func (s *Service) Chain(id string) ([]*CapabilityInfo, error) {
+	var chain []*CapabilityInfo
+
+	for id != "" {
+		info, err := s.Capability(id)
+		if err != nil {
+			return nil, err
+		}
+
+		chain = append([]*CapabilityInfo{info}, chain...)
+
+		id = info.Capability.Parent
+	}
+
+	return chain, nil
+}
+
+// Revoke revokes the capability of the vault with the given ID. Invocations of the capability on the vault, or of
+// any capability delegated from it, are rejected from then on. Capabilities delegated by clients aren't known to the
+// service, so they're revoked by ID; only capabilities issued for other vaults can't be revoked. Revoking a
+// capability that was already revoked keeps its revocation time.
+func (s *Service) Revoke(vaultID, id string) (*Revocation, error) {
+	info, err := s.Capability(id)
+	if err != nil && !errors.Is(err, ErrCapabilityNotFound) {
+		return nil, err
+	}
+
+	if info != nil && info.VaultID != vaultID {
+		return nil, fmt.Errorf("%w: %s", ErrCapabilityNotFound, id)
+	}
+
+	revokedAt, err := s.revokedAt(vaultID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if revokedAt != nil {
+		return &Revocation{CapabilityID: id, VaultID: vaultID, RevokedAt: *revokedAt}, nil
+	}
+
+	now := s.now().UTC()
+
+	revokedAtBytes, err := json.Marshal(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal revocation time: %w", err)
+	}
+
+	if err := s.indexStore.Put(indexKey(revocationIndex, vaultID, id), revokedAtBytes); err != nil {
+		return nil, fmt.Errorf("failed to store revocation of capability %s: %w", id, err)
+	}
+
+	return &Revocation{CapabilityID: id, VaultID: vaultID, RevokedAt: now}, nil
+}
+
+// controller returns the controller of the vault, which Create issued the vault's controller capability to.
+func (s *Service) controller(vaultID string) (string, error) {
+	rootCapability, err := s.getCapability(vaultID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get root capability %s from db: %w", vaultID, err)
+	}
+
+	capabilities, err := s.Capabilities(&CapabilityQuery{VaultID: vaultID, Parent: rootCapability.ID})
+	if err != nil {
+		return "", fmt.Errorf("failed to get controller capability of vault %s: %w", vaultID, err)
+	}
+
+	for _, info := range capabilities {
+		if info.Capability.Invoker != "" {
+			return info.Capability.Invoker, nil
+		}
+	}
+
+	return "", fmt.Errorf("controller capability of vault %s not found", vaultID)
+}
+
+// checkNotRevoked returns an error if the capability with the given ID has been revoked for the vault.
+func (s *Service) checkNotRevoked(vaultID, id string) error {
+	revokedAt, err := s.revokedAt(vaultID, id)
+	if err != nil {
+		return err
+	}
+
+	if revokedAt != nil {
+		return fmt.Errorf("capability %s was revoked at %s", id, revokedAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (s *Service) revokedAt(vaultID, id string) (*time.Time, error) {
+	revokedAtBytes, err := s.indexStore.Get(indexKey(revocationIndex, vaultID, id))
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get revocation of capability %s from db: %w", id, err)
+	}
+
+	var revokedAt time.Time
+
+	if err := json.Unmarshal(revokedAtBytes, &revokedAt); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal revocation of capability %s: %w", id, err)
+	}
+
+	return &revokedAt, nil
+}
+
+// index adds the capability to the indexes used to look up capabilities by vault, invoker and parent.
+func (s *Service) index(capability *zcapld.Capability, vaultID string) error {
+	keys := []string{indexKey(vaultIndex, vaultID, capability.ID)}
+
+	if capability.Invoker != "" {
+		keys = append(keys, indexKey(invokerIndex, capability.Invoker, capability.ID))
+	}
+
+	if capability.Parent != "" {
+		keys = append(keys, indexKey(parentIndex, capability.Parent, capability.ID))
+	}
+
+	for _, key := range keys {
+		if err := s.indexStore.Put(key, []byte(capability.ID)); err != nil {
+			return fmt.Errorf("failed to index capability %s: %w", capability.ID, err)
+		}
+	}
+
+	// The capability's own entry is written last, so that capabilities are only known once fully indexed.
+	if err := s.indexStore.Put(indexKey(capabilityIndex, capability.ID), []byte(vaultID)); err != nil {
+		return fmt.Errorf("failed to index capability %s: %w", capability.ID, err)
+	}
+
+	return nil
+}
+
+func (s *Service) indexedCapabilityIDs(index, value string) ([]string, error) {
+	prefix := indexKey(index, value) + indexKeySeparator
+
+	itr := s.indexStore.Iterator(prefix, prefix+ariesstorage.EndKeySuffix)
+	defer itr.Release()
+
+	var ids []string
+
+	for itr.Next() {
+		if !strings.HasPrefix(string(itr.Key()), prefix) {
+			continue
+		}
+
+		ids = append(ids, string(itr.Value()))
+	}
+
+	if err := itr.Error(); err != nil {
+		return nil, fmt.Errorf("failed to query capability index: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (q *CapabilityQuery) matches(info *CapabilityInfo) bool {
+	return (q.VaultID == "" || q.VaultID == info.VaultID) &&
+		(q.Invoker == "" || q.Invoker == info.Capability.Invoker) &&
+		(q.Parent == "" || q.Parent == info.Capability.Parent)
+}
+
+// indexKey builds a key of the index store. The parts are escaped so that one value can't be a prefix of another.
+func indexKey(index string, parts ...string) string {
+	key := index
+
+	for _, part := range parts {
+		key += indexKeySeparator + url.QueryEscape(part)
+	}
+
+	return key
+}
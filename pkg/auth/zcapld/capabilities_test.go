@@ -0,0 +1,300 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	"github.com/square/go-jose/json"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+func TestService_Capabilities(t *testing.T) {
+	svc, root, controllerCapability := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+	_, otherRoot, otherCapability := addIndexedVault(t, svc, "v1|2", "did:example:alice")
+
+	t.Run("by vault", func(t *testing.T) {
+		capabilities, err := svc.Capabilities(&CapabilityQuery{VaultID: "v1"})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{root.ID, controllerCapability.ID}, capabilityIDs(capabilities))
+
+		for _, info := range capabilities {
+			require.Equal(t, "v1", info.VaultID)
+			require.False(t, info.Revoked)
+		}
+	})
+
+	t.Run("by invoker", func(t *testing.T) {
+		capabilities, err := svc.Capabilities(&CapabilityQuery{Invoker: "did:example:alice"})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{controllerCapability.ID, otherCapability.ID}, capabilityIDs(capabilities))
+	})
+
+	t.Run("by invoker and vault", func(t *testing.T) {
+		capabilities, err := svc.Capabilities(&CapabilityQuery{Invoker: "did:example:alice", VaultID: "v1|2"})
+		require.NoError(t, err)
+		require.Equal(t, []string{otherCapability.ID}, capabilityIDs(capabilities))
+	})
+
+	t.Run("by parent", func(t *testing.T) {
+		capabilities, err := svc.Capabilities(&CapabilityQuery{Parent: otherRoot.ID})
+		require.NoError(t, err)
+		require.Equal(t, []string{otherCapability.ID}, capabilityIDs(capabilities))
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		capabilities, err := svc.Capabilities(&CapabilityQuery{Invoker: "did:example:bob"})
+		require.NoError(t, err)
+		require.Empty(t, capabilities)
+	})
+
+	t.Run("empty query", func(t *testing.T) {
+		_, err := svc.Capabilities(&CapabilityQuery{})
+		require.EqualError(t, err, "vault ID, invoker or parent must be set")
+	})
+
+	t.Run("failed to query index", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrItr = errors.New("iterator error")
+
+		svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, storeProv)
+		require.NoError(t, err)
+
+		_, err = svc.Capabilities(&CapabilityQuery{VaultID: "v1"})
+		require.EqualError(t, err, "failed to query capability index: iterator error")
+	})
+}
+
+func TestService_Capability(t *testing.T) {
+	svc, _, controllerCapability := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+
+	t.Run("success", func(t *testing.T) {
+		info, err := svc.Capability(controllerCapability.ID)
+		require.NoError(t, err)
+		require.Equal(t, controllerCapability.ID, info.Capability.ID)
+		require.Equal(t, "did:example:alice", info.Capability.Invoker)
+		require.Equal(t, "v1", info.VaultID)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := svc.Capability("unknown")
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+	})
+
+	t.Run("failed to get index entry", func(t *testing.T) {
+		storeProv := mockstorage.NewMockStoreProvider()
+		storeProv.Store.ErrGet = errors.New("get error")
+
+		svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, storeProv)
+		require.NoError(t, err)
+
+		_, err = svc.Capability("c1")
+		require.EqualError(t, err, "failed to get capability c1 from index: get error")
+	})
+}
+
+func TestService_Chain(t *testing.T) {
+	svc, root, controllerCapability := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+
+	chain, err := svc.Chain(controllerCapability.ID)
+	require.NoError(t, err)
+	require.Equal(t, []string{root.ID, controllerCapability.ID}, capabilityIDs(chain))
+
+	_, err = svc.Chain("unknown")
+	require.True(t, errors.Is(err, ErrCapabilityNotFound))
+}
+
+func TestService_Revoke(t *testing.T) {
+	svc, root, controllerCapability := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+
+	revokedAt := time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return revokedAt }
+
+	rw := serveInvocation(t, svc, controllerCapability, "v1", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	revocation, err := svc.Revoke("v1", controllerCapability.ID)
+	require.NoError(t, err)
+	require.Equal(t, &Revocation{CapabilityID: controllerCapability.ID, VaultID: "v1", RevokedAt: revokedAt},
+		revocation)
+
+	info, err := svc.Capability(controllerCapability.ID)
+	require.NoError(t, err)
+	require.True(t, info.Revoked)
+	require.True(t, revokedAt.Equal(*info.RevokedAt))
+
+	t.Run("revoking again keeps the revocation time", func(t *testing.T) {
+		svc.now = time.Now
+
+		revocation, err := svc.Revoke("v1", controllerCapability.ID)
+		require.NoError(t, err)
+		require.True(t, revokedAt.Equal(revocation.RevokedAt))
+
+		info, err := svc.Capability(controllerCapability.ID)
+		require.NoError(t, err)
+		require.True(t, revokedAt.Equal(*info.RevokedAt))
+	})
+
+	t.Run("chain shows which capability was revoked", func(t *testing.T) {
+		chain, err := svc.Chain(controllerCapability.ID)
+		require.NoError(t, err)
+		require.Len(t, chain, 2)
+		require.False(t, chain[0].Revoked)
+		require.True(t, chain[1].Revoked)
+	})
+
+	t.Run("revoked capability can't be invoked", func(t *testing.T) {
+		rw := serveInvocation(t, svc, controllerCapability, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "was revoked at 2020-12-01T10:00:00Z")
+	})
+
+	t.Run("capabilities delegated from a revoked capability can't be invoked", func(t *testing.T) {
+		delegated := &zcapld.Capability{ID: "delegated", Parent: controllerCapability.ID,
+			InvocationTarget: root.InvocationTarget,
+			Proof:            delegationProof("did:example:alice#key1", root.ID, controllerCapability.ID)}
+
+		rw := serveInvocation(t, svc, delegated, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "capability "+controllerCapability.ID+" was revoked")
+	})
+
+	t.Run("capability issued for another vault", func(t *testing.T) {
+		_, _, otherControllerCapability := addIndexedVault(t, svc, "v2", "did:example:bob")
+
+		_, err := svc.Revoke("v1", otherControllerCapability.ID)
+		require.True(t, errors.Is(err, ErrCapabilityNotFound))
+
+		info, err := svc.Capability(otherControllerCapability.ID)
+		require.NoError(t, err)
+		require.False(t, info.Revoked)
+	})
+}
+
+func TestService_RevokeDelegated(t *testing.T) {
+	svc, root, controllerCapability := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+	_, _, otherControllerCapability := addIndexedVault(t, svc, "v2", "did:example:alice")
+
+	delegated := &zcapld.Capability{ID: "delegated", Parent: controllerCapability.ID,
+		InvocationTarget: root.InvocationTarget,
+		Proof:            delegationProof("did:example:alice#key1", root.ID, controllerCapability.ID)}
+
+	rw := serveInvocation(t, svc, delegated, "v1", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+
+	revocation, err := svc.Revoke("v1", delegated.ID)
+	require.NoError(t, err)
+	require.Equal(t, delegated.ID, revocation.CapabilityID)
+
+	rw = serveInvocation(t, svc, delegated, "v1", "")
+	require.Equal(t, http.StatusUnauthorized, rw.Code)
+	require.Contains(t, rw.Body.String(), "capability delegated was revoked")
+
+	// The revocation only applies to the vault it was made for.
+	delegated.Parent = otherControllerCapability.ID
+	delegated.InvocationTarget.ID = "v2"
+	delegated.Proof = delegationProof("did:example:alice#key1", "root-v2", otherControllerCapability.ID)
+
+	rw = serveInvocation(t, svc, delegated, "v2", "")
+	require.Equal(t, http.StatusOK, rw.Code)
+}
+
+func TestService_ControllerHandler(t *testing.T) {
+	svc, _, _ := newServiceWithIndexedVault(t, "v1", "did:example:alice")
+
+	controller, err := svc.controller("v1")
+	require.NoError(t, err)
+	require.Equal(t, "did:example:alice", controller)
+
+	t.Run("request without http signature", func(t *testing.T) {
+		h, err := svc.ControllerHandler("v1", httptest.NewRequest(http.MethodGet, "/", nil), nil, nil)
+		require.NoError(t, err)
+
+		rw := httptest.NewRecorder()
+
+		h(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("vault not found", func(t *testing.T) {
+		_, err := svc.ControllerHandler("unknown", httptest.NewRequest(http.MethodGet, "/", nil), nil, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get root capability unknown from db")
+	})
+
+	t.Run("vault without controller capability", func(t *testing.T) {
+		root := &zcapld.Capability{ID: "root-v3"}
+
+		rootBytes, err := json.Marshal(root)
+		require.NoError(t, err)
+		require.NoError(t, svc.store.Put("v3", rootBytes))
+
+		_, err = svc.controller("v3")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "controller capability of vault v3 not found")
+	})
+}
+
+func TestIndexKey(t *testing.T) {
+	require.Equal(t, "vault|v1|c1", indexKey(vaultIndex, "v1", "c1"))
+	require.Equal(t, "vault|v1%7C2", indexKey(vaultIndex, "v1|2"))
+}
+
+// newServiceWithIndexedVault returns a service with the root capability of a vault and a capability delegated to
+// its controller, stored and indexed like Create does.
+func newServiceWithIndexedVault(t *testing.T, vaultID,
+	controller string) (*Service, *zcapld.Capability, *zcapld.Capability) {
+	t.Helper()
+
+	svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, mockstorage.NewMockStoreProvider())
+	require.NoError(t, err)
+
+	return addIndexedVault(t, svc, vaultID, controller)
+}
+
+func addIndexedVault(t *testing.T, svc *Service, vaultID,
+	controller string) (*Service, *zcapld.Capability, *zcapld.Capability) {
+	t.Helper()
+
+	root := &zcapld.Capability{ID: "root-" + vaultID,
+		InvocationTarget: zcapld.InvocationTarget{ID: vaultID, Type: VaultInvocationTargetType}}
+	controllerCapability := &zcapld.Capability{ID: "controller-" + vaultID, Parent: root.ID, Invoker: controller,
+		InvocationTarget: root.InvocationTarget}
+
+	for _, capability := range []*zcapld.Capability{root, controllerCapability} {
+		capabilityBytes, err := json.Marshal(capability)
+		require.NoError(t, err)
+
+		require.NoError(t, svc.store.Put(capability.ID, capabilityBytes))
+		require.NoError(t, svc.index(capability, vaultID))
+	}
+
+	rootBytes, err := json.Marshal(root)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.store.Put(vaultID, rootBytes))
+
+	return svc, root, controllerCapability
+}
+
+func capabilityIDs(capabilities []*CapabilityInfo) []string {
+	ids := make([]string, len(capabilities))
+
+	for i, info := range capabilities {
+		ids[i] = info.Capability.ID
+	}
+
+	return ids
+}
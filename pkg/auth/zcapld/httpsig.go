@@ -0,0 +1,281 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	signatureutil "github.com/hyperledger/aries-framework-go/pkg/doc/util/signature"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	httpsig "github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/tracing"
+)
+
+const (
+	// ariesSignatureAlgorithm is the HTTP signature algorithm name returned by zcapld.AriesDIDKeySecrets.
+	ariesSignatureAlgorithm = "https://github.com/hyperledger/aries-framework-go/zcaps"
+
+	keyIDParam   = "keyId"
+	headersParam = "headers"
+
+	ed25519VerificationKey2018 = "Ed25519VerificationKey2018"
+	ed25519VerificationKey2020 = "Ed25519VerificationKey2020"
+	jsonWebKey2020             = "JsonWebKey2020"
+	ed25519Curve               = "Ed25519"
+)
+
+// signatureHashAlgorithm verifies HTTP signatures using keys found by a KeyResolver.
+// It replaces zcapld.AriesDIDKeySignatureHashAlgorithm, which can only resolve did:key URLs.
+type signatureHashAlgorithm struct {
+	keys   zcapld.KeyResolver
+	kms    kms.KeyManager
+	crypto cryptoapi.Crypto
+}
+
+// Algorithm returns this algorithm's name.
+func (a *signatureHashAlgorithm) Algorithm() string {
+	return ariesSignatureAlgorithm
+}
+
+// Create is not supported since the EDV server only verifies HTTP signatures.
+func (a *signatureHashAlgorithm) Create(httpsig.Secret, []byte) ([]byte, error) {
+	return nil, errors.New("creating HTTP signatures is not supported")
+}
+
+// Verify verifies the signature over data with the key referenced by the secret's key ID.
+func (a *signatureHashAlgorithm) Verify(secret httpsig.Secret, data, signature []byte) error {
+	key, err := a.keys.Resolve(secret.KeyID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve key %s: %w", secret.KeyID, err)
+	}
+
+	keyType, err := signingKeyType(key)
+	if err != nil {
+		return fmt.Errorf("key %s can't verify signatures: %w", secret.KeyID, err)
+	}
+
+	kh, err := a.kms.PubKeyBytesToHandle(key.Value, keyType)
+	if err != nil {
+		return fmt.Errorf("failed to convert public key to aries kms handle: %w", err)
+	}
+
+	err = a.crypto.Verify(signature, data, kh)
+	if err != nil {
+		return fmt.Errorf("failed to verify signature: %w", err)
+	}
+
+	return nil
+}
+
+// signingKeyType returns the kms key type of the given verification method's key: Ed25519 for Ed25519 verification
+// keys, and Ed25519 or ECDSA, depending on the curve, for JSON web keys.
+func signingKeyType(key *verifier.PublicKey) (kms.KeyType, error) {
+	switch key.Type {
+	case ed25519VerificationKey2018, ed25519VerificationKey2020:
+		return kms.ED25519, nil
+	case jsonWebKey2020:
+		if key.JWK == nil {
+			return "", errors.New("JsonWebKey2020 verification method has no JWK")
+		}
+
+		if key.JWK.Crv == ed25519Curve {
+			return kms.ED25519, nil
+		}
+
+		ecKey, ok := key.JWK.Key.(*ecdsa.PublicKey)
+		if !ok {
+			return "", fmt.Errorf("unsupported JWK with curve %s", key.JWK.Crv)
+		}
+
+		return signatureutil.MapECCurveToKeyType(ecKey.Curve)
+	default:
+		return "", fmt.Errorf("unsupported verification method type %s", key.Type)
+	}
+}
+
+// httpSigAuthHandler authenticates the request's HTTP signature and verifies the invoked capability before
+// forwarding to next. It follows zcapld.NewHTTPSigAuthHandler, but resolves the keys of both the HTTP signature
+// and the capability proofs with the service's KeyResolver.
+func (s *Service) httpSigAuthHandler(expect *zcapld.InvocationExpectations, verifierOptions []zcapld.VerificationOption,
+	errConsumer func(error), next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, span := tracing.StartSpan(r.Context(), "zcap.VerifyInvocation", tracing.VaultIDKey.String(expect.Target))
+
+		outcome, err := s.verifyInvocation(r, expect, verifierOptions)
+		if err != nil {
+			span.SetAttributes(outcomeKey.String(outcome))
+			tracing.EndSpan(span, err)
+
+			s.observer(outcome)
+			errConsumer(err)
+
+			return
+		}
+
+		tracing.EndSpan(span, nil)
+
+		next(w, r)
+	}
+}
+
+// verifyInvocation verifies the request's HTTP signature and invoked capability. If they can't be verified,
+// it returns the outcome of the invocation along with the error.
+func (s *Service) verifyInvocation(r *http.Request, expect *zcapld.InvocationExpectations,
+	verifierOptions []zcapld.VerificationOption) (string, error) {
+	err := s.newHTTPSignatures().Verify(r)
+	if err != nil {
+		return OutcomeInvalidSignature, fmt.Errorf("failed to verify http signature: %w", err)
+	}
+
+	capability, action, err := parseInvocationHeader(r)
+	if err != nil {
+		return OutcomeInvalidRequest, fmt.Errorf("failed to parse capability-invocation header: %w", err)
+	}
+
+	keyID, err := parseKeyID(r)
+	if err != nil {
+		return OutcomeInvalidRequest, fmt.Errorf("failed to parse keyID: %w", err)
+	}
+
+	// The HTTP signature was verified with this key, so the request is authenticated as its invoker even if the
+	// capability doesn't grant access.
+	auth.SetInvoker(r.Context(), keyID)
+
+	verifier, err := zcapld.NewVerifier(capabilityResolver{svc: s}, s.keyResolver, verifierOptions...)
+	if err != nil {
+		return OutcomeError, fmt.Errorf("failed to init zcap verifier: %w", err)
+	}
+
+	err = verifier.Verify(
+		&zcapld.Proof{
+			Capability:         capability,
+			CapabilityAction:   action,
+			VerificationMethod: keyID,
+		},
+		&zcapld.CapabilityInvocation{
+			ExpectedTarget:         expect.Target,
+			ExpectedAction:         expect.Action,
+			ExpectedRootCapability: expect.RootCapability,
+			VerificationMethod: &zcapld.VerificationMethod{
+				ID:         keyID,
+				Controller: keyController(keyID),
+			},
+		},
+	)
+	if err != nil {
+		return OutcomeDenied, fmt.Errorf("failed to verify zcap: %w", err)
+	}
+
+	return OutcomeAuthorized, nil
+}
+
+func (s *Service) newHTTPSignatures() *httpsig.HTTPSignatures {
+	hs := httpsig.NewHTTPSignatures(&zcapld.AriesDIDKeySecrets{})
+
+	hs.SetDefaultSignatureHeaders([]string{
+		"(key-id)", "(created)", "(expires)", "(request-target)", "host", zcapld.CapabilityInvocationHTTPHeader,
+	})
+
+	hs.SetSignatureHashAlgorithm(&signatureHashAlgorithm{
+		keys:   s.keyResolver,
+		kms:    s.keyManager,
+		crypto: s.crypto,
+	})
+
+	return hs
+}
+
+// VerifyController verifies that the request has a valid HTTP signature created with a key of the given controller.
+// The signature must cover the request target and, if the request has a body, the digest header so that neither
+// the endpoint nor the body of a signed request can be replaced.
+func (s *Service) VerifyController(req *http.Request, controller string) error {
+	signedHeaders, err := parseSignatureParam(req, headersParam)
+	if err != nil {
+		return err
+	}
+
+	required := []string{"(request-target)"}
+
+	if hasBody(req) {
+		required = append(required, "digest")
+	}
+
+	for _, header := range required {
+		if !stringsContain(strings.Fields(strings.ToLower(signedHeaders)), header) {
+			return fmt.Errorf("http signature doesn't cover %s", header)
+		}
+	}
+
+	err = s.newHTTPSignatures().Verify(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify http signature: %w", err)
+	}
+
+	keyID, err := parseKeyID(req)
+	if err != nil {
+		return err
+	}
+
+	if keyID != controller && keyController(keyID) != controller {
+		return fmt.Errorf("key %s doesn't belong to controller %s", keyID, controller)
+	}
+
+	auth.SetInvoker(req.Context(), keyID)
+
+	return nil
+}
+
+// hasBody returns whether the request has a body. Requests whose length is unknown (e.g. chunked requests) are
+// treated as having one.
+func hasBody(req *http.Request) bool {
+	return req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody
+}
+
+// keyController returns the DID of the given key ID. Since the key was resolved from that DID's document,
+// capabilities may name either the key itself or the DID as their invoker.
+func keyController(keyID string) string {
+	return strings.Split(keyID, "#")[0]
+}
+
+// parseKeyID returns the keyId param of the signature header.
+func parseKeyID(r *http.Request) (string, error) {
+	return parseSignatureParam(r, keyIDParam)
+}
+
+// parseSignatureParam returns the value of the given param of the signature header.
+func parseSignatureParam(r *http.Request, name string) (string, error) {
+	const numParts = 2
+
+	for _, param := range strings.Split(strings.Join(r.Header.Values("signature"), ","), ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", numParts)
+
+		if len(kv) == numParts && kv[0] == name {
+			return strings.Trim(kv[1], `"`), nil
+		}
+	}
+
+	return "", fmt.Errorf("%s param not found in signature header", name)
+}
+
+func stringsContain(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,378 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package zcapld
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/verifier"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
+	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	httpsig "github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/square/go-jose/json"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+const (
+	testDID   = "did:web:example.com"
+	testKeyID = testDID + "#key-1"
+)
+
+func TestSignatureHashAlgorithm(t *testing.T) {
+	keys := zcapld.SimpleKeyResolver{testKeyID: testPublicKey()}
+
+	t.Run("algorithm", func(t *testing.T) {
+		require.Equal(t, ariesSignatureAlgorithm, (&signatureHashAlgorithm{}).Algorithm())
+	})
+
+	t.Run("create is not supported", func(t *testing.T) {
+		_, err := (&signatureHashAlgorithm{}).Create(httpsig.Secret{}, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("verify success", func(t *testing.T) {
+		a := &signatureHashAlgorithm{keys: keys, kms: &mockkms.KeyManager{}, crypto: &mockcrypto.Crypto{}}
+
+		require.NoError(t, a.Verify(httpsig.Secret{KeyID: testKeyID}, []byte("data"), []byte("signature")))
+	})
+
+	t.Run("key not resolved", func(t *testing.T) {
+		a := &signatureHashAlgorithm{keys: keys, kms: &mockkms.KeyManager{}, crypto: &mockcrypto.Crypto{}}
+
+		err := a.Verify(httpsig.Secret{KeyID: "did:web:other.com#key-1"}, []byte("data"), []byte("signature"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve key did:web:other.com#key-1")
+	})
+
+	t.Run("unsupported key type", func(t *testing.T) {
+		a := &signatureHashAlgorithm{
+			keys: zcapld.SimpleKeyResolver{testKeyID: &verifier.PublicKey{Type: "X25519KeyAgreementKey2019"}},
+			kms:  &mockkms.KeyManager{}, crypto: &mockcrypto.Crypto{},
+		}
+
+		err := a.Verify(httpsig.Secret{KeyID: testKeyID}, []byte("data"), []byte("signature"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported verification method type X25519KeyAgreementKey2019")
+	})
+
+	t.Run("failed to convert public key", func(t *testing.T) {
+		a := &signatureHashAlgorithm{keys: keys,
+			kms: &mockkms.KeyManager{PubKeyBytesToHandleErr: errors.New("kms error")}, crypto: &mockcrypto.Crypto{}}
+
+		err := a.Verify(httpsig.Secret{KeyID: testKeyID}, []byte("data"), []byte("signature"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "kms error")
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		a := &signatureHashAlgorithm{keys: keys, kms: &mockkms.KeyManager{},
+			crypto: &mockcrypto.Crypto{VerifyErr: errors.New("invalid signature")}}
+
+		err := a.Verify(httpsig.Secret{KeyID: testKeyID}, []byte("data"), []byte("signature"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid signature")
+	})
+}
+
+func TestSigningKeyType(t *testing.T) {
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwk := func(key interface{}, crv string) *jose.JWK {
+		j := &jose.JWK{Crv: crv}
+		j.Key = key
+
+		return j
+	}
+
+	for _, tc := range []struct {
+		name    string
+		key     *verifier.PublicKey
+		keyType kms.KeyType
+		err     string
+	}{
+		{name: "Ed25519VerificationKey2018", key: &verifier.PublicKey{Type: "Ed25519VerificationKey2018"},
+			keyType: kms.ED25519},
+		{name: "Ed25519VerificationKey2020", key: &verifier.PublicKey{Type: "Ed25519VerificationKey2020"},
+			keyType: kms.ED25519},
+		{name: "Ed25519 JWK", key: &verifier.PublicKey{Type: "JsonWebKey2020", JWK: jwk(edKey, "Ed25519")},
+			keyType: kms.ED25519},
+		{name: "P-256 JWK", key: &verifier.PublicKey{Type: "JsonWebKey2020", JWK: jwk(&p256Key.PublicKey, "P-256")},
+			keyType: kms.ECDSAP256TypeIEEEP1363},
+		{name: "P-384 JWK", key: &verifier.PublicKey{Type: "JsonWebKey2020", JWK: jwk(&p384Key.PublicKey, "P-384")},
+			keyType: kms.ECDSAP384TypeIEEEP1363},
+		{name: "X25519 JWK", key: &verifier.PublicKey{Type: "JsonWebKey2020", JWK: jwk([]byte("key"), "X25519")},
+			err: "unsupported JWK with curve X25519"},
+		{name: "JsonWebKey2020 without JWK", key: &verifier.PublicKey{Type: "JsonWebKey2020"},
+			err: "has no JWK"},
+		{name: "no type", key: &verifier.PublicKey{}, err: "unsupported verification method type"},
+	} {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			keyType, err := signingKeyType(tc.key)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tc.keyType, keyType)
+		})
+	}
+}
+
+func TestService_HTTPSigAuthHandler(t *testing.T) {
+	root := &zcapld.Capability{ID: "root", Invoker: testDID,
+		InvocationTarget: zcapld.InvocationTarget{ID: "v1", Type: VaultInvocationTargetType}}
+
+	s := mockstorage.NewMockStoreProvider()
+
+	rootBytes, err := json.Marshal(root)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Store.Put("v1", rootBytes))
+	require.NoError(t, s.Store.Put(root.ID, rootBytes))
+
+	keys := &recordingKeyResolver{keys: zcapld.SimpleKeyResolver{testKeyID: testPublicKey()}}
+
+	svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, s, WithKeyResolver(keys))
+	require.NoError(t, err)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+
+		h, err := svc.Handler("v1", req, rw, func(http.ResponseWriter, *http.Request) {
+			require.FailNow(t, "next must not be called")
+		})
+		require.NoError(t, err)
+
+		h(rw, req)
+
+		return rw
+	}
+
+	t.Run("missing signature", func(t *testing.T) {
+		rw := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to verify http signature")
+	})
+
+	t.Run("signing key not resolved", func(t *testing.T) {
+		rw := serve(signedRequest(t, "did:web:other.com#key-1", invocationHeader(t, root, "read")))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to verify http signature")
+		require.Contains(t, keys.resolved, "did:web:other.com#key-1")
+	})
+
+	t.Run("invalid invocation header", func(t *testing.T) {
+		rw := serve(signedRequest(t, testKeyID, "zcap action=\"read\""))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to parse capability-invocation header")
+	})
+
+	t.Run("invoker is the controller of the signing key", func(t *testing.T) {
+		rw := serve(signedRequest(t, testKeyID, invocationHeader(t, root, "read")))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+
+		// the invoker check passed: the request was only rejected because the test capability has no proof
+		require.NotContains(t, rw.Body.String(), "invoker does not match")
+		require.Contains(t, rw.Body.String(), "failed to verify proof")
+	})
+
+	t.Run("invoker doesn't match the signing key", func(t *testing.T) {
+		other := *root
+		other.Invoker = "did:web:other.com"
+
+		rw := serve(signedRequest(t, testKeyID, invocationHeader(t, &other, "read")))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "invoker does not match")
+	})
+
+	t.Run("unexpected action", func(t *testing.T) {
+		rw := serve(signedRequest(t, testKeyID, invocationHeader(t, root, "write")))
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), `does not match the expected capability action of \"read\"`)
+	})
+}
+
+func TestService_VerifyController(t *testing.T) {
+	keys := zcapld.SimpleKeyResolver{testKeyID: testPublicKey()}
+
+	svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, mockstorage.NewMockStoreProvider(),
+		WithKeyResolver(keys))
+	require.NoError(t, err)
+
+	signedHeaders := []string{"(request-target)", "(created)", "digest"}
+
+	t.Run("signed by a key of the controller", func(t *testing.T) {
+		require.NoError(t, svc.VerifyController(signedPostRequest(t, testKeyID, signedHeaders), testDID))
+	})
+
+	t.Run("signed by the controller's key ID", func(t *testing.T) {
+		require.NoError(t, svc.VerifyController(signedPostRequest(t, testKeyID, signedHeaders), testKeyID))
+	})
+
+	t.Run("signed by another controller's key", func(t *testing.T) {
+		err := svc.VerifyController(signedPostRequest(t, testKeyID, signedHeaders), "did:web:other.com")
+		require.EqualError(t, err, "key "+testKeyID+" doesn't belong to controller did:web:other.com")
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		err := svc.VerifyController(httptest.NewRequest(http.MethodPost, "/", nil), testDID)
+		require.EqualError(t, err, "headers param not found in signature header")
+	})
+
+	t.Run("digest not signed", func(t *testing.T) {
+		req := signedPostRequest(t, testKeyID, []string{"(request-target)", "(created)"})
+
+		require.EqualError(t, svc.VerifyController(req, testDID), "http signature doesn't cover digest")
+	})
+
+	t.Run("request without body doesn't need to cover digest", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/encrypted-data-vaults/vault1/capabilities/zcap1/revoke", nil)
+		signRequest(t, req, testKeyID, []string{"(request-target)", "(created)"})
+
+		require.NoError(t, svc.VerifyController(req, testDID))
+	})
+
+	t.Run("request target not signed", func(t *testing.T) {
+		req := signedPostRequest(t, testKeyID, []string{"(created)", "digest"})
+
+		require.EqualError(t, svc.VerifyController(req, testDID), "http signature doesn't cover (request-target)")
+	})
+
+	t.Run("body was modified", func(t *testing.T) {
+		req := signedPostRequest(t, testKeyID, signedHeaders)
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"controller":"did:web:other.com"}`))
+
+		err := svc.VerifyController(req, testDID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to verify http signature")
+	})
+
+	t.Run("signing key not resolved", func(t *testing.T) {
+		err := svc.VerifyController(signedPostRequest(t, "did:web:other.com#key-1", signedHeaders), "did:web:other.com")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve key did:web:other.com#key-1")
+	})
+}
+
+func TestParseKeyID(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("signature", `keyId="`+testKeyID+`",algorithm="alg",signature="c2ln"`)
+
+		keyID, err := parseKeyID(req)
+		require.NoError(t, err)
+		require.Equal(t, testKeyID, keyID)
+	})
+
+	t.Run("keyId not found", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("signature", `algorithm="alg",signature="c2ln"`)
+
+		_, err := parseKeyID(req)
+		require.Error(t, err)
+	})
+}
+
+func TestKeyController(t *testing.T) {
+	require.Equal(t, testDID, keyController(testKeyID))
+	require.Equal(t, testDID, keyController(testDID))
+}
+
+// signedRequest returns a GET request signed with a dummy signature by the given key.
+func signedRequest(t *testing.T, keyID, invocation string) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Host", req.Host)
+	req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, invocation)
+
+	hs := httpsig.NewHTTPSignatures(httpsig.NewSimpleSecretsStorage(map[string]httpsig.Secret{
+		keyID: {KeyID: keyID, Algorithm: ariesSignatureAlgorithm},
+	}))
+	hs.SetDefaultSignatureHeaders([]string{"(request-target)", "host", zcapld.CapabilityInvocationHTTPHeader})
+	hs.SetSignatureHashAlgorithm(dummySignatureAlgorithm{})
+
+	require.NoError(t, hs.Sign(keyID, req))
+
+	return req
+}
+
+// signedPostRequest returns a POST request with a JSON body, signed with a dummy signature by the given key.
+func signedPostRequest(t *testing.T, keyID string, headers []string) *http.Request {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/data-vaults", strings.NewReader(`{"controller":"`+testDID+`"}`))
+	signRequest(t, req, keyID, headers)
+
+	return req
+}
+
+func signRequest(t *testing.T, req *http.Request, keyID string, headers []string) {
+	t.Helper()
+
+	hs := httpsig.NewHTTPSignatures(httpsig.NewSimpleSecretsStorage(map[string]httpsig.Secret{
+		keyID: {KeyID: keyID, Algorithm: ariesSignatureAlgorithm},
+	}))
+	hs.SetDefaultSignatureHeaders(headers)
+	hs.SetSignatureHashAlgorithm(dummySignatureAlgorithm{})
+
+	require.NoError(t, hs.Sign(keyID, req))
+}
+
+func testPublicKey() *verifier.PublicKey {
+	return &verifier.PublicKey{Type: "Ed25519VerificationKey2018", Value: []byte("key")}
+}
+
+type dummySignatureAlgorithm struct{}
+
+func (dummySignatureAlgorithm) Algorithm() string {
+	return ariesSignatureAlgorithm
+}
+
+func (dummySignatureAlgorithm) Create(httpsig.Secret, []byte) ([]byte, error) {
+	return []byte("signature"), nil
+}
+
+func (dummySignatureAlgorithm) Verify(httpsig.Secret, []byte, []byte) error {
+	return nil
+}
+
+type recordingKeyResolver struct {
+	keys     zcapld.KeyResolver
+	resolved []string
+}
+
+func (r *recordingKeyResolver) Resolve(keyID string) (*verifier.PublicKey, error) {
+	r.resolved = append(r.resolved, keyID)
+
+	return r.keys.Resolve(keyID)
+}
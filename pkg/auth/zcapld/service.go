@@ -7,10 +7,16 @@ SPDX-License-Identifier: Apache-2.0
 package zcapld
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
@@ -24,13 +30,52 @@ import (
 	"github.com/piprate/json-gold/ld"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/zcapld"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/tracing"
 )
 
 const (
-	storeName   = "zcap_capability"
-	edvResource = "urn:edv:vault"
+	// StoreName is the name of the store that the service keeps root capabilities in.
+	StoreName = "zcap_capability"
+
+	// VaultInvocationTargetType is the invocation target type of capabilities that grant access to a whole vault.
+	VaultInvocationTargetType = "urn:edv:vault"
+	// DocumentInvocationTargetType is the invocation target type of capabilities that grant access to a single
+	// document within a vault. The invocation target ID of such capabilities must be built with
+	// DocumentInvocationTarget.
+	DocumentInvocationTargetType = "urn:edv:document"
+
+	capabilityParam = "capability"
+	actionParam     = "action"
+
+	proofPurposeField       = "proofPurpose"
+	capabilityChainField    = "capabilityChain"
+	verificationMethodField = "verificationMethod"
+	delegationProofPurpose  = "capabilityDelegation"
 )
 
+// Outcomes of capability invocations, as passed to the observer set with WithAuthorizationObserver.
+const (
+	// OutcomeAuthorized means that the request was authorized.
+	OutcomeAuthorized = "authorized"
+	// OutcomeInvalidRequest means that the request's HTTP signature or capability-invocation header is missing or
+	// malformed.
+	OutcomeInvalidRequest = "invalid_request"
+	// OutcomeInvalidSignature means that the request's HTTP signature couldn't be verified.
+	OutcomeInvalidSignature = "invalid_signature"
+	// OutcomeDenied means that the invoked capability doesn't grant access to the requested resource and action, or
+	// has been revoked.
+	OutcomeDenied = "denied"
+	// OutcomeError means that the invocation couldn't be verified, because the root capability of the vault couldn't
+	// be read (e.g. the vault doesn't exist) or the verifier couldn't be created.
+	OutcomeError = "error"
+)
+
+// outcomeKey is the span attribute that holds the outcome of a capability invocation that wasn't authorized.
+const outcomeKey = attribute.Key("edv.zcap.outcome")
+
 var logger = log.New("auth-zcap-service")
 
 // Service to provide zcapld functionality
@@ -38,14 +83,43 @@ type Service struct {
 	keyManager      kms.KeyManager
 	crypto          cryptoapi.Crypto
 	store           ariesstorage.Store
+	indexStore      ariesstorage.Store
 	cachedLDContext map[string]*ld.RemoteDocument
+	keyResolver     zcapld.KeyResolver
+	observer        func(outcome string)
+	now             func() time.Time
+}
+
+// Option configures the zcap service.
+type Option func(s *Service)
+
+// WithKeyResolver sets the resolver used to find the keys that sign HTTP requests and capabilities.
+// Defaults to a resolver that only supports did:key URLs.
+func WithKeyResolver(keyResolver zcapld.KeyResolver) Option {
+	return func(s *Service) {
+		s.keyResolver = keyResolver
+	}
+}
+
+// WithAuthorizationObserver sets a function that is called with the outcome of every capability invocation
+// (see the Outcome constants), e.g. to record metrics.
+func WithAuthorizationObserver(observer func(outcome string)) Option {
+	return func(s *Service) {
+		s.observer = observer
+	}
 }
 
 // New return zcap service
-func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, storeProv ariesstorage.Provider) (*Service, error) {
-	store, err := storeProv.OpenStore(storeName)
+func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, storeProv ariesstorage.Provider,
+	opts ...Option) (*Service, error) {
+	store, err := storeProv.OpenStore(StoreName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open store %s: %w", storeName, err)
+		return nil, fmt.Errorf("failed to open store %s: %w", StoreName, err)
+	}
+
+	indexStore, err := storeProv.OpenStore(indexStoreName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", indexStoreName, err)
 	}
 
 	ctx, err := loadJSONLDContext()
@@ -53,12 +127,20 @@ func New(keyManager kms.KeyManager, crypto cryptoapi.Crypto, storeProv ariesstor
 		return nil, fmt.Errorf("failed create json ld document loader: %w", err)
 	}
 
-	return &Service{
-		keyManager: keyManager, crypto: crypto, store: store, cachedLDContext: ctx,
-	}, nil
+	svc := &Service{
+		keyManager: keyManager, crypto: crypto, store: store, indexStore: indexStore, cachedLDContext: ctx,
+		keyResolver: &zcapld.DIDKeyResolver{}, observer: func(string) {}, now: time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(svc)
+	}
+
+	return svc, nil
 }
 
-// Create zcap payload
+// Create zcap payload. The root capability of the vault and the capability delegated to the vault's controller
+// are indexed, so that they can be looked up with Capabilities.
 func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error) {
 	rootCapability, err := s.createRootCapability(resourceID)
 	if err != nil {
@@ -77,7 +159,7 @@ func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error)
 		SuiteType:          ed25519signature2018.SignatureType,
 		VerificationMethod: didKeyURL,
 	}, zcapld.WithParent(rootCapability.ID), zcapld.WithInvoker(verificationMethod),
-		zcapld.WithAllowedActions("read", "write"), zcapld.WithInvocationTarget(resourceID, edvResource),
+		zcapld.WithAllowedActions("read", "write"), zcapld.WithInvocationTarget(resourceID, VaultInvocationTargetType),
 		zcapld.WithCapabilityChain(rootCapability.ID))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new capability: %w", err)
@@ -92,14 +174,68 @@ func (s *Service) Create(resourceID, verificationMethod string) ([]byte, error)
 		return nil, fmt.Errorf("failed to store capability: %w", err)
 	}
 
+	if err := s.index(capability, resourceID); err != nil {
+		return nil, err
+	}
+
 	return capabilityBytes, nil
 }
 
-// Handler will create auth handler
+// DocumentInvocationTarget returns the invocation target ID to use in capabilities
+// that grant access to the given document only.
+func DocumentInvocationTarget(vaultID, docID string) string {
+	return vaultID + "/documents/" + docID
+}
+
+// Handler will create auth handler for a route that targets a whole vault.
+// Capabilities scoped to a single document are rejected by the returned handler.
 func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseWriter,
 	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return s.handler(resourceID, "", req, w, next)
+}
+
+// DocumentHandler will create auth handler for a route that targets a single document within a vault.
+// Both vault capabilities and capabilities scoped to the given document are accepted by the returned handler.
+func (s *Service) DocumentHandler(vaultID, docID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return s.handler(vaultID, docID, req, w, next)
+}
+
+// ControllerHandler will create auth handler for a route that only the controller of a vault may use, such as
+// revoking capabilities. Capabilities aren't accepted by the returned handler, since they may have been delegated:
+// requests must have an HTTP signature made with a key of the controller that the vault was created for, as
+// checked by VerifyController.
+func (s *Service) ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	controller, err := s.controller(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.VerifyController(r, controller); err != nil {
+			s.observer(OutcomeDenied)
+			writeUnauthorized(w, err)
+
+			return
+		}
+
+		s.observer(OutcomeAuthorized)
+		next(w, r)
+	}, nil
+}
+
+func (s *Service) handler(resourceID, docID string, req *http.Request, w http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	_, span := tracing.StartSpan(req.Context(), "zcap.GetRootCapability", tracing.VaultIDKey.String(resourceID))
+
 	rootCapability, err := s.getCapability(resourceID)
+
+	tracing.EndSpan(span, err)
+
 	if err != nil {
+		s.observer(OutcomeError)
+
 		return nil, fmt.Errorf("failed to get root capability %s from db: %w", resourceID, err)
 	}
 
@@ -114,29 +250,172 @@ func (s *Service) Handler(resourceID string, req *http.Request, w http.ResponseW
 		cachingDL.AddDocument(d.ContextURL, d.Document)
 	}
 
-	return zcapld.NewHTTPSigAuthHandler(
-		&zcapld.HTTPSigAuthConfig{
-			CapabilityResolver: capabilityResolver{svc: s},
-			KeyResolver:        &zcapld.DIDKeyResolver{},
-			VerifierOptions: []zcapld.VerificationOption{
-				zcapld.WithSignatureSuites(
-					ed25519signature2018.New(suite.WithVerifier(ed25519signature2018.NewPublicKeyVerifier())),
-				), zcapld.WithLDDocumentLoaders(cachingDL),
-			},
-			Secrets:     &zcapld.AriesDIDKeySecrets{},
-			ErrConsumer: logError{w: w}.Log,
-			KMS:         s.keyManager,
-			Crypto:      s.crypto,
-		},
+	return s.httpSigAuthHandler(
 		&zcapld.InvocationExpectations{
 			Target:         resourceID,
 			RootCapability: rootCapability.ID,
 			Action:         action,
 		},
-		next,
+		[]zcapld.VerificationOption{
+			zcapld.WithSignatureSuites(
+				ed25519signature2018.New(suite.WithVerifier(ed25519signature2018.NewPublicKeyVerifier())),
+			), zcapld.WithLDDocumentLoaders(cachingDL),
+		},
+		logError{w: w}.Log,
+		s.invocationTargetHandler(resourceID, docID, next),
 	), nil
 }
 
+// invocationTargetHandler returns a handler that makes sure the invoked capability (and every capability it was
+// delegated from) is allowed to be used on the requested route and hasn't been revoked before forwarding to next.
+// The zcapld middleware only checks the invocation target of the root capability, which is always the vault.
+func (s *Service) invocationTargetHandler(vaultID, docID string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		capability, _, err := parseInvocationHeader(r)
+		if err != nil {
+			s.observer(OutcomeInvalidRequest)
+			writeUnauthorized(w, fmt.Errorf("failed to parse invoked capability: %w", err))
+
+			return
+		}
+
+		_, span := tracing.StartSpan(r.Context(), "zcap.CheckDelegationChain", tracing.VaultIDKey.String(vaultID))
+
+		err = s.checkDelegationChain(capability, vaultID, docID)
+
+		tracing.EndSpan(span, err)
+
+		if err != nil {
+			s.observer(OutcomeDenied)
+			writeUnauthorized(w, err)
+
+			return
+		}
+
+		s.observer(OutcomeAuthorized)
+		next(w, r)
+	}
+}
+
+// checkDelegationChain walks up the delegation chain of the given capability. Every document-scoped capability
+// in the chain must target the requested document. Document-scoped capabilities can't be used on vault routes.
+// None of the capabilities in the chain may have been revoked, and every capability must have been delegated by
+// its parent (see checkDelegation).
+func (s *Service) checkDelegationChain(capability *zcapld.Capability, vaultID, docID string) error {
+	for {
+		if err := s.checkNotRevoked(vaultID, capability.ID); err != nil {
+			return err
+		}
+
+		if capability.InvocationTarget.Type == DocumentInvocationTargetType {
+			if docID == "" {
+				return fmt.Errorf("capability %s is scoped to document %s and can't be used on a vault route",
+					capability.ID, capability.InvocationTarget.ID)
+			}
+
+			if capability.InvocationTarget.ID != DocumentInvocationTarget(vaultID, docID) {
+				return fmt.Errorf("capability %s is scoped to document %s and can't be used on document %s",
+					capability.ID, capability.InvocationTarget.ID, DocumentInvocationTarget(vaultID, docID))
+			}
+		}
+
+		if capability.Parent == "" {
+			return nil
+		}
+
+		parent, err := s.getCapability(capability.Parent)
+		if err != nil {
+			return fmt.Errorf("failed to get parent capability %s from db: %w", capability.Parent, err)
+		}
+
+		if err := s.checkDelegation(capability, parent); err != nil {
+			return err
+		}
+
+		capability = parent
+	}
+}
+
+// checkDelegation checks that the capability was delegated by its parent. The verifier only checks the signatures
+// of the delegation proofs in the chain, not who made them, so anyone could otherwise sign a capability that names
+// a more powerful capability as its parent. Capabilities delegated from a root capability are only issued by this
+// service, so they must be the ones in the db. Other capabilities must have a delegation proof whose capability
+// chain ends in the parent, made by the parent's invoker or delegator.
+func (s *Service) checkDelegation(capability, parent *zcapld.Capability) error {
+	if parent.Parent == "" {
+		return s.checkIssued(capability)
+	}
+
+	for _, proof := range capability.Proof {
+		if proof[proofPurposeField] != delegationProofPurpose || !chainEndsIn(proof[capabilityChainField], parent.ID) {
+			continue
+		}
+
+		if verificationMethod, ok := proof[verificationMethodField].(string); ok &&
+			isDelegator(parent, verificationMethod) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("capability %s wasn't delegated by the invoker or delegator of its parent %s",
+		capability.ID, parent.ID)
+}
+
+// checkIssued checks that the capability is the one with the same ID in the db.
+func (s *Service) checkIssued(capability *zcapld.Capability) error {
+	stored, err := s.getCapability(capability.ID)
+	if err != nil {
+		return fmt.Errorf("capability %s wasn't issued by this server: %w", capability.ID, err)
+	}
+
+	storedBytes, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal capability %s: %w", stored.ID, err)
+	}
+
+	capabilityBytes, err := json.Marshal(capability)
+	if err != nil {
+		return fmt.Errorf("failed to marshal capability %s: %w", capability.ID, err)
+	}
+
+	if !bytes.Equal(storedBytes, capabilityBytes) {
+		return fmt.Errorf("capability %s wasn't issued by this server", capability.ID)
+	}
+
+	return nil
+}
+
+// isDelegator returns whether the verification method belongs to the invoker or delegator of the capability, or to
+// its controller if it has neither. They're either verification methods or DIDs.
+func isDelegator(capability *zcapld.Capability, verificationMethod string) bool {
+	delegators := []string{capability.Invoker, capability.Delegator}
+	if capability.Invoker == "" && capability.Delegator == "" {
+		delegators = []string{capability.Controller}
+	}
+
+	did := strings.Split(verificationMethod, "#")[0]
+
+	for _, delegator := range delegators {
+		if delegator != "" && (delegator == verificationMethod || delegator == did) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chainEndsIn returns whether the capability chain of a delegation proof ends in the given capability ID.
+func chainEndsIn(chain interface{}, id string) bool {
+	switch c := chain.(type) {
+	case []interface{}:
+		return len(c) > 0 && c[len(c)-1] == id
+	case []string:
+		return len(c) > 0 && c[len(c)-1] == id
+	default:
+		return false
+	}
+}
+
 func (s *Service) createRootCapability(resourceID string) (*zcapld.Capability, error) {
 	// create root capability and store in db
 	signer, err := signature.NewCryptoSigner(s.crypto, s.keyManager, kms.ED25519)
@@ -152,7 +431,7 @@ func (s *Service) createRootCapability(resourceID string) (*zcapld.Capability, e
 		SignatureSuite:     ed25519signature2018.New(suite.WithSigner(signer)),
 		SuiteType:          ed25519signature2018.SignatureType,
 		VerificationMethod: didKeyURL,
-	}, zcapld.WithID(rootID), zcapld.WithInvocationTarget(resourceID, edvResource),
+	}, zcapld.WithID(rootID), zcapld.WithInvocationTarget(resourceID, VaultInvocationTargetType),
 		zcapld.WithAllowedActions("read", "write"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create new root capability: %w", err)
@@ -171,6 +450,10 @@ func (s *Service) createRootCapability(resourceID string) (*zcapld.Capability, e
 		return nil, fmt.Errorf("failed to store root capability: %w", err)
 	}
 
+	if err := s.index(rootCapability, resourceID); err != nil {
+		return nil, err
+	}
+
 	return rootCapability, nil
 }
 
@@ -200,14 +483,80 @@ type logError struct {
 
 // Resolve resolves capabilities.
 func (l logError) Log(err error) {
-	l.w.WriteHeader(http.StatusBadRequest)
+	if errWrite := support.WriteError(l.w, http.StatusBadRequest, err, err.Error()); errWrite != nil {
+		logger.Errorf(errWrite.Error())
+	}
+}
 
-	_, errWrite := l.w.Write([]byte(err.Error()))
-	if errWrite != nil {
+func writeUnauthorized(w http.ResponseWriter, err error) {
+	logger.Infof("unauthorized capability invocation: %s", err)
+
+	if errWrite := support.WriteError(w, http.StatusUnauthorized, err, err.Error()); errWrite != nil {
 		logger.Errorf(errWrite.Error())
 	}
 }
 
+// parseInvocationHeader extracts the capability and action from the capability-invocation header, which is expected
+// to be in the following format: zcap capability="<base64url(gzip(capability))>",action="<action>".
+func parseInvocationHeader(r *http.Request) (*zcapld.Capability, string, error) {
+	const numParts = 2
+
+	value := strings.TrimSpace(strings.Join(r.Header.Values(zcapld.CapabilityInvocationHTTPHeader), ", "))
+
+	if !strings.HasPrefix(strings.ToLower(value), "zcap ") {
+		return nil, "", fmt.Errorf(`"%s" header is missing or has an invalid scheme`,
+			zcapld.CapabilityInvocationHTTPHeader)
+	}
+
+	var (
+		capability *zcapld.Capability
+		action     string
+		err        error
+	)
+
+	for _, param := range strings.Split(value[len("zcap "):], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", numParts)
+		if len(kv) != numParts {
+			continue
+		}
+
+		switch kv[0] {
+		case capabilityParam:
+			capability, err = parseCapability(strings.Trim(kv[1], `"`))
+			if err != nil {
+				return nil, "", err
+			}
+		case actionParam:
+			action = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	if capability == nil {
+		return nil, "", errors.New("capability param not found in invocation header")
+	}
+
+	return capability, action, nil
+}
+
+func parseCapability(value string) (*zcapld.Capability, error) {
+	compressed, err := base64.URLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64URL-decode capability: %w", err)
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to init gzip reader: %w", err)
+	}
+
+	raw, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gunzipped capability: %w", err)
+	}
+
+	return zcapld.ParseCapability(raw)
+}
+
 func loadJSONLDContext() (map[string]*ld.RemoteDocument, error) {
 	contexts := []struct {
 		vocab   string
@@ -7,17 +7,25 @@ SPDX-License-Identifier: Apache-2.0
 package zcapld
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/hyperledger/aries-framework-go/pkg/doc/verifiable"
 	mockcrypto "github.com/hyperledger/aries-framework-go/pkg/mock/crypto"
 	mockkms "github.com/hyperledger/aries-framework-go/pkg/mock/kms"
 	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
 	"github.com/square/go-jose/json"
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/zcapld"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNew(t *testing.T) {
@@ -99,6 +107,306 @@ func TestService_Handler(t *testing.T) {
 	})
 }
 
+func TestService_DocumentHandler(t *testing.T) {
+	t.Run("test root capability not found", func(t *testing.T) {
+		svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, mockstorage.NewMockStoreProvider())
+		require.NoError(t, err)
+
+		h, err := svc.DocumentHandler("r1", "d1", &http.Request{Method: http.MethodGet}, nil, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get root capability r1 from db")
+		require.Nil(t, h)
+	})
+
+	t.Run("test success", func(t *testing.T) {
+		s := mockstorage.NewMockStoreProvider()
+
+		bytes, err := json.Marshal(&zcapld.Capability{})
+		require.NoError(t, err)
+
+		require.NoError(t, s.Store.Put("r1", bytes))
+
+		svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, s)
+		require.NoError(t, err)
+
+		h, err := svc.DocumentHandler("r1", "d1", &http.Request{Method: http.MethodGet}, nil, nil)
+		require.NoError(t, err)
+		require.NotNil(t, h)
+	})
+}
+
+func TestService_InvocationTargetHandler(t *testing.T) {
+	root := &zcapld.Capability{ID: "root",
+		InvocationTarget: zcapld.InvocationTarget{ID: "v1", Type: VaultInvocationTargetType}}
+	vaultCapability := &zcapld.Capability{ID: "vault", Parent: root.ID, Invoker: "did:example:alice",
+		InvocationTarget: zcapld.InvocationTarget{ID: "v1", Type: VaultInvocationTargetType}}
+	docCapability := &zcapld.Capability{ID: "doc", Parent: vaultCapability.ID, Invoker: "did:example:bob#key1",
+		InvocationTarget: zcapld.InvocationTarget{
+			ID: DocumentInvocationTarget("v1", "d1"), Type: DocumentInvocationTargetType,
+		},
+		Proof: delegationProof("did:example:alice#key1", root.ID, vaultCapability.ID)}
+
+	svc := newServiceWithCapabilities(t, root, vaultCapability, docCapability)
+
+	t.Run("vault capability on vault route", func(t *testing.T) {
+		rw := serveInvocation(t, svc, vaultCapability, "v1", "")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("vault capability on document route", func(t *testing.T) {
+		rw := serveInvocation(t, svc, vaultCapability, "v1", "d1")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("document capability on its document route", func(t *testing.T) {
+		rw := serveInvocation(t, svc, docCapability, "v1", "d1")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("document capability delegated further to the same document", func(t *testing.T) {
+		delegated := &zcapld.Capability{ID: "delegated", Parent: docCapability.ID,
+			InvocationTarget: docCapability.InvocationTarget,
+			Proof:            delegationProof("did:example:bob#key1", root.ID, vaultCapability.ID, docCapability.ID)}
+
+		rw := serveInvocation(t, svc, delegated, "v1", "d1")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("document capability on another document route", func(t *testing.T) {
+		rw := serveInvocation(t, svc, docCapability, "v1", "d2")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "is scoped to document v1/documents/d1 and can't be used on "+
+			"document v1/documents/d2")
+	})
+
+	t.Run("document capability on vault route", func(t *testing.T) {
+		rw := serveInvocation(t, svc, docCapability, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "can't be used on a vault route")
+	})
+
+	t.Run("vault capability delegated from a document capability", func(t *testing.T) {
+		escalated := &zcapld.Capability{ID: "escalated", Parent: docCapability.ID,
+			InvocationTarget: vaultCapability.InvocationTarget,
+			Proof:            delegationProof("did:example:bob#key1", root.ID, vaultCapability.ID, docCapability.ID)}
+
+		rw := serveInvocation(t, svc, escalated, "v1", "d2")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "capability doc is scoped to document v1/documents/d1")
+	})
+
+	t.Run("vault capability self-delegated from the controller capability", func(t *testing.T) {
+		forged := &zcapld.Capability{ID: "forged", Parent: vaultCapability.ID, Invoker: "did:example:mallory",
+			InvocationTarget: vaultCapability.InvocationTarget,
+			Proof:            delegationProof("did:example:mallory#key1", root.ID, vaultCapability.ID)}
+
+		rw := serveInvocation(t, svc, forged, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "capability forged wasn't delegated by the invoker or delegator of "+
+			"its parent vault")
+	})
+
+	t.Run("delegation proof with a capability chain that doesn't end in the parent", func(t *testing.T) {
+		forged := &zcapld.Capability{ID: "forged", Parent: vaultCapability.ID,
+			InvocationTarget: vaultCapability.InvocationTarget,
+			Proof:            delegationProof("did:example:alice#key1", root.ID)}
+
+		rw := serveInvocation(t, svc, forged, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "wasn't delegated by the invoker or delegator of its parent vault")
+	})
+
+	t.Run("capability delegated from the root capability that wasn't issued by the server", func(t *testing.T) {
+		forged := &zcapld.Capability{ID: "forged", Parent: root.ID, Invoker: "did:example:mallory",
+			InvocationTarget: root.InvocationTarget,
+			Proof:            delegationProof("did:example:mallory#key1", root.ID)}
+
+		rw := serveInvocation(t, svc, forged, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "capability forged wasn't issued by this server")
+
+		// Reusing the ID of an issued capability doesn't help.
+		forged.ID = vaultCapability.ID
+
+		rw = serveInvocation(t, svc, forged, "v1", "")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "capability vault wasn't issued by this server")
+	})
+
+	t.Run("parent capability not found", func(t *testing.T) {
+		orphan := &zcapld.Capability{ID: "orphan", Parent: "unknown",
+			InvocationTarget: vaultCapability.InvocationTarget}
+
+		rw := serveInvocation(t, svc, orphan, "v1", "d1")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to get parent capability unknown from db")
+	})
+
+	t.Run("missing invocation header", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+
+		svc.invocationTargetHandler("v1", "d1", func(http.ResponseWriter, *http.Request) {
+			require.FailNow(t, "next must not be called")
+		})(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to parse invoked capability")
+	})
+
+	t.Run("invalid capability encoding", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, `zcap capability="%%%",action="read"`)
+
+		svc.invocationTargetHandler("v1", "d1", nil)(rw, req)
+
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to base64URL-decode capability")
+	})
+}
+
+func TestService_AuthorizationObserver(t *testing.T) {
+	root := &zcapld.Capability{ID: "root",
+		InvocationTarget: zcapld.InvocationTarget{ID: "v1", Type: VaultInvocationTargetType}}
+	docCapability := &zcapld.Capability{ID: "doc", Parent: root.ID,
+		InvocationTarget: zcapld.InvocationTarget{
+			ID: DocumentInvocationTarget("v1", "d1"), Type: DocumentInvocationTargetType,
+		}}
+
+	var outcomes []string
+
+	svc := newServiceWithCapabilities(t, root, docCapability)
+	WithAuthorizationObserver(func(outcome string) {
+		outcomes = append(outcomes, outcome)
+	})(svc)
+
+	serveInvocation(t, svc, docCapability, "v1", "d1")
+	serveInvocation(t, svc, docCapability, "v1", "d2")
+	svc.invocationTargetHandler("v1", "d1", nil)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	_, err := svc.Handler("unknown", &http.Request{Method: http.MethodGet}, nil, nil)
+	require.Error(t, err)
+
+	rw := httptest.NewRecorder()
+
+	h, err := svc.Handler("root", &http.Request{Method: http.MethodGet}, rw, nil)
+	require.NoError(t, err)
+
+	h(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, []string{
+		OutcomeAuthorized, OutcomeDenied, OutcomeInvalidRequest, OutcomeError, OutcomeInvalidSignature,
+	}, outcomes)
+}
+
+func TestService_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	root := &zcapld.Capability{ID: "root",
+		InvocationTarget: zcapld.InvocationTarget{ID: "v1", Type: VaultInvocationTargetType}}
+	docCapability := &zcapld.Capability{ID: "doc", Parent: root.ID,
+		InvocationTarget: zcapld.InvocationTarget{
+			ID: DocumentInvocationTarget("v1", "d1"), Type: DocumentInvocationTargetType,
+		}}
+
+	svc := newServiceWithCapabilities(t, root, docCapability)
+
+	serveInvocation(t, svc, docCapability, "v1", "d2")
+
+	rw := httptest.NewRecorder()
+
+	h, err := svc.Handler("root", &http.Request{Method: http.MethodGet}, rw, nil)
+	require.NoError(t, err)
+
+	h(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+
+	require.Equal(t, "zcap.CheckDelegationChain", spans[0].Name())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+
+	require.Equal(t, "zcap.GetRootCapability", spans[1].Name())
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	require.Equal(t, "zcap.VerifyInvocation", spans[2].Name())
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+	require.Contains(t, spans[2].Attributes(), outcomeKey.String(OutcomeInvalidSignature))
+}
+
+func newServiceWithCapabilities(t *testing.T, capabilities ...*zcapld.Capability) *Service {
+	t.Helper()
+
+	s := mockstorage.NewMockStoreProvider()
+
+	for _, capability := range capabilities {
+		capabilityBytes, err := json.Marshal(capability)
+		require.NoError(t, err)
+
+		require.NoError(t, s.Store.Put(capability.ID, capabilityBytes))
+	}
+
+	svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, s)
+	require.NoError(t, err)
+
+	return svc
+}
+
+func serveInvocation(t *testing.T, svc *Service, capability *zcapld.Capability,
+	vaultID, docID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, invocationHeader(t, capability, "read"))
+
+	rw := httptest.NewRecorder()
+
+	svc.invocationTargetHandler(vaultID, docID, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})(rw, req)
+
+	return rw
+}
+
+// delegationProof returns a capability delegation proof made with the verification method. Its signature is checked
+// by the verifier, not by the handler, so it has none.
+func delegationProof(verificationMethod string, chain ...string) []verifiable.Proof {
+	capabilityChain := make([]interface{}, len(chain))
+	for i, id := range chain {
+		capabilityChain[i] = id
+	}
+
+	return []verifiable.Proof{{
+		"type":               "Ed25519Signature2018",
+		"proofPurpose":       "capabilityDelegation",
+		"verificationMethod": verificationMethod,
+		"capabilityChain":    capabilityChain,
+	}}
+}
+
+func invocationHeader(t *testing.T, capability *zcapld.Capability, action string) string {
+	t.Helper()
+
+	capabilityBytes, err := json.Marshal(capability)
+	require.NoError(t, err)
+
+	compressed := bytes.NewBuffer(nil)
+
+	w := gzip.NewWriter(compressed)
+
+	_, err = w.Write(capabilityBytes)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return fmt.Sprintf(`zcap capability="%s",action="%s"`,
+		base64.URLEncoding.EncodeToString(compressed.Bytes()), action)
+}
+
 func TestCapabilityResolver_Resolve(t *testing.T) {
 	t.Run("test not found", func(t *testing.T) {
 		svc, err := New(&mockkms.KeyManager{}, &mockcrypto.Crypto{}, mockstorage.NewMockStoreProvider())
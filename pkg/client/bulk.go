@@ -0,0 +1,288 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	defaultConcurrency = 10
+	defaultBatchSize   = 100
+)
+
+// BulkResult is the result of a bulk operation for one document.
+type BulkResult struct {
+	DocumentID string
+	// Location is the location of the written document. It's only set by UpsertDocuments.
+	Location string
+	// Document is the document that was read. It's only set by ReadDocuments.
+	Document *models.EncryptedDocument
+	// Err is the error of the operation for the document, if it failed.
+	Err error
+}
+
+// WithConcurrency option sets the maximum number of requests that bulk operations send at the same time.
+// Defaults to 10.
+func WithConcurrency(concurrency int) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.concurrency = concurrency
+	}
+}
+
+// WithBatchSize option sets the maximum number of documents in the batches that bulk operations send to EDV servers
+// that support the Batch extension. Defaults to 100.
+func WithBatchSize(batchSize int) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.batchSize = batchSize
+	}
+}
+
+// UpsertDocuments creates the documents in the given vault, or replaces them if they already exist. If the EDV
+// server supports the Batch extension, the documents are upserted in batches. Otherwise, each document is created
+// with a CreateDocument request, and updated with an UpdateDocument request if it already exists; at most
+// WithConcurrency documents are written at the same time. There's a result for every document, in the same order.
+// An error is returned if any document failed. Idempotency keys set with WithIdempotencyKey are ignored.
+func (c *Client) UpsertDocuments(vaultID string, documents []models.EncryptedDocument,
+	opts ...ReqOption) ([]BulkResult, error) {
+	return c.UpsertDocumentsWithContext(context.Background(), vaultID, documents, opts...)
+}
+
+// UpsertDocumentsWithContext is like UpsertDocuments, but sends the requests with the given context.
+func (c *Client) UpsertDocumentsWithContext(ctx context.Context, vaultID string, documents []models.EncryptedDocument,
+	opts ...ReqOption) ([]BulkResult, error) {
+	results := make([]BulkResult, len(documents))
+	batch := make(models.Batch, len(documents))
+
+	for i := range documents {
+		results[i].DocumentID = documents[i].ID
+		batch[i] = models.VaultOperation{
+			Operation: models.UpsertDocumentVaultOperation, EncryptedDocument: documents[i],
+		}
+	}
+
+	c.bulk(ctx, vaultID, batch, results, opts, func(i int, opts []ReqOption) {
+		results[i].Location, results[i].Err = c.upsertDocument(ctx, vaultID, &documents[i], opts)
+	})
+
+	return results, bulkError("upsert", results)
+}
+
+// upsertDocument creates the document, or updates it if it already exists, and returns its location.
+func (c *Client) upsertDocument(ctx context.Context, vaultID string, document *models.EncryptedDocument,
+	opts []ReqOption) (string, error) {
+	location, err := c.CreateDocumentWithContext(ctx, vaultID, document, opts...)
+	if !errors.Is(err, ErrDuplicateDocument) {
+		return location, err
+	}
+
+	err = c.UpdateDocumentWithContext(ctx, vaultID, document.ID, document, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return c.edvServerURL + fmt.Sprintf("/%s/documents/%s", url.PathEscape(vaultID), url.PathEscape(document.ID)), nil
+}
+
+// ReadDocuments reads the documents with the given IDs from the given vault with concurrent ReadDocument requests.
+// There's a result for every ID, in the same order. An error is returned if any document failed to be read.
+func (c *Client) ReadDocuments(vaultID string, docIDs []string, opts ...ReqOption) ([]BulkResult, error) {
+	return c.ReadDocumentsWithContext(context.Background(), vaultID, docIDs, opts...)
+}
+
+// ReadDocumentsWithContext is like ReadDocuments, but sends the requests with the given context.
+func (c *Client) ReadDocumentsWithContext(ctx context.Context, vaultID string, docIDs []string,
+	opts ...ReqOption) ([]BulkResult, error) {
+	results := newBulkResults(docIDs)
+	reqOpt, opts := bulkOptions(opts)
+
+	started := forEach(ctx, len(docIDs), reqOpt.concurrency, func(i int) {
+		results[i].Document, results[i].Err = c.ReadDocumentWithContext(ctx, vaultID, docIDs[i], opts...)
+	})
+
+	skipped(ctx, results, started)
+
+	return results, bulkError("read", results)
+}
+
+// DeleteDocuments deletes the documents with the given IDs from the given vault. If the EDV server supports the
+// Batch extension, the documents are deleted in batches. Otherwise, they're deleted with concurrent DeleteDocument
+// requests. There's a result for every ID, in the same order. An error is returned if any document failed.
+func (c *Client) DeleteDocuments(vaultID string, docIDs []string, opts ...ReqOption) ([]BulkResult, error) {
+	return c.DeleteDocumentsWithContext(context.Background(), vaultID, docIDs, opts...)
+}
+
+// DeleteDocumentsWithContext is like DeleteDocuments, but sends the requests with the given context.
+func (c *Client) DeleteDocumentsWithContext(ctx context.Context, vaultID string, docIDs []string,
+	opts ...ReqOption) ([]BulkResult, error) {
+	results := newBulkResults(docIDs)
+
+	batch := make(models.Batch, len(docIDs))
+
+	for i, docID := range docIDs {
+		batch[i] = models.VaultOperation{Operation: models.DeleteDocumentVaultOperation, DocumentID: docID}
+	}
+
+	c.bulk(ctx, vaultID, batch, results, opts, func(i int, opts []ReqOption) {
+		results[i].Err = c.DeleteDocumentWithContext(ctx, vaultID, docIDs[i], opts...)
+	})
+
+	return results, bulkError("delete", results)
+}
+
+// bulk performs the operations in batches if the EDV server supports the Batch extension, or with concurrent calls
+// to single otherwise.
+func (c *Client) bulk(ctx context.Context, vaultID string, batch models.Batch, results []BulkResult,
+	opts []ReqOption, single func(i int, opts []ReqOption)) {
+	reqOpt, opts := bulkOptions(opts)
+
+	if !c.supportsExtension(ctx, models.BatchExtension, opts) {
+		started := forEach(ctx, len(batch), reqOpt.concurrency, func(i int) {
+			single(i, opts)
+		})
+
+		skipped(ctx, results, started)
+
+		return
+	}
+
+	numBatches := (len(batch) + reqOpt.batchSize - 1) / reqOpt.batchSize
+
+	started := forEach(ctx, numBatches, reqOpt.concurrency, func(n int) {
+		start := n * reqOpt.batchSize
+
+		end := start + reqOpt.batchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+
+		chunk := batch[start:end]
+
+		responses, err := c.BatchWithContext(ctx, vaultID, &chunk, opts...)
+		if err == nil && len(responses) != len(chunk) {
+			err = fmt.Errorf("expected %d batch responses, got %d", len(chunk), len(responses))
+		}
+
+		for i := range chunk {
+			if err != nil {
+				results[start+i].Err = err
+
+				continue
+			}
+
+			if chunk[i].Operation == models.UpsertDocumentVaultOperation {
+				results[start+i].Location = responses[i]
+			}
+		}
+	})
+
+	skipped(ctx, results, started*reqOpt.batchSize)
+}
+
+// bulkOptions returns the request options of a bulk operation with defaults set, and the options to send its
+// requests with.
+func bulkOptions(opts []ReqOption) (*ReqOpts, []ReqOption) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	if reqOpt.concurrency <= 0 {
+		reqOpt.concurrency = defaultConcurrency
+	}
+
+	if reqOpt.batchSize <= 0 {
+		reqOpt.batchSize = defaultBatchSize
+	}
+
+	// Every request must have its own idempotency key.
+	return reqOpt, append(opts[:len(opts):len(opts)], WithIdempotencyKey(""))
+}
+
+// forEach calls f for 0 to n-1, with at most concurrency calls at the same time. If the context is done, the
+// remaining calls are skipped. It returns the number of calls that were made.
+func forEach(ctx context.Context, n, concurrency int, f func(i int)) int {
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	semaphore := make(chan struct{}, concurrency)
+
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			return i
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return i
+		}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+
+			f(i)
+		}(i)
+	}
+
+	return n
+}
+
+// skipped sets the error of the results from start on to the error of the context.
+func skipped(ctx context.Context, results []BulkResult, start int) {
+	for i := start; i < len(results); i++ {
+		results[i].Err = ctx.Err()
+	}
+}
+
+func newBulkResults(docIDs []string) []BulkResult {
+	results := make([]BulkResult, len(docIDs))
+
+	for i, docID := range docIDs {
+		results[i].DocumentID = docID
+	}
+
+	return results
+}
+
+// bulkError returns an error that wraps the first error in the results, if any.
+func bulkError(operation string, results []BulkResult) error {
+	var (
+		failed   int
+		firstErr *BulkResult
+	)
+
+	for i := range results {
+		if results[i].Err != nil {
+			failed++
+
+			if firstErr == nil {
+				firstErr = &results[i]
+			}
+		}
+	}
+
+	if firstErr == nil {
+		return nil
+	}
+
+	return fmt.Errorf("failed to %s %d of %d documents, first failure for document %s: %w", operation, failed,
+		len(results), firstErr.DocumentID, firstErr.Err)
+}
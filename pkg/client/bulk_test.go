@@ -0,0 +1,274 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+func TestClient_GetExtensions(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv, _ := startCountingEDVServer(t, &operation.EnabledExtensions{Batch: true, ReadAllDocumentsEndpoint: true})
+
+		extensions, err := New(srv.URL + "/encrypted-data-vaults").GetExtensions()
+		require.NoError(t, err)
+		require.Equal(t, []string{models.ReadAllDocumentsExtension, models.BatchExtension}, extensions)
+
+		extensions, err = New(srv.URL + "/encrypted-data-vaults/").GetExtensions()
+		require.NoError(t, err)
+		require.Len(t, extensions, 2)
+
+		config, err := New(srv.URL + "/encrypted-data-vaults").GetConfiguration()
+		require.NoError(t, err)
+		require.Equal(t, extensions, config.Extensions)
+		require.NotEmpty(t, config.Endpoints)
+	})
+
+	t.Run("server without configuration endpoint", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		defer srv.Close()
+
+		c := New(srv.URL + "/encrypted-data-vaults")
+
+		_, err := c.GetExtensions()
+		require.True(t, errors.Is(err, ErrNotFound))
+		require.False(t, c.supportsExtension(context.Background(), models.BatchExtension, nil))
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+			_, _ = rw.Write([]byte("extensions")) //nolint: errcheck
+		}))
+		defer srv.Close()
+
+		_, err := New(srv.URL + "/encrypted-data-vaults").GetExtensions()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal server configuration")
+	})
+
+	t.Run("server unreachable", func(t *testing.T) {
+		c := New("http://" + randomURL() + "/encrypted-data-vaults")
+
+		_, err := c.GetExtensions()
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failure while sending request to get server configuration")
+		require.False(t, c.supportsExtension(context.Background(), models.BatchExtension, nil))
+	})
+}
+
+func TestClient_Bulk(t *testing.T) {
+	for name, extensions := range map[string]*operation.EnabledExtensions{
+		"with batch extension":    {Batch: true},
+		"without batch extension": {},
+	} {
+		extensions := extensions
+
+		t.Run(name, func(t *testing.T) {
+			srv, counter := startCountingEDVServer(t, extensions)
+			c := New(srv.URL + "/encrypted-data-vaults")
+			vaultID := createBulkTestVault(t, c)
+
+			documents := make([]models.EncryptedDocument, 25)
+			docIDs := make([]string, len(documents))
+
+			for i := range documents {
+				docID, err := edvutils.GenerateEDVCompatibleID()
+				require.NoError(t, err)
+
+				documents[i] = models.EncryptedDocument{ID: docID, JWE: []byte(testJWE)}
+				docIDs[i] = docID
+			}
+
+			results, err := c.UpsertDocuments(vaultID, documents, WithBatchSize(10), WithConcurrency(3))
+			require.NoError(t, err)
+			require.Len(t, results, len(documents))
+
+			for i, result := range results {
+				require.Equal(t, docIDs[i], result.DocumentID)
+				require.True(t, strings.HasSuffix(result.Location, "/documents/"+docIDs[i]))
+			}
+
+			results, err = c.ReadDocuments(vaultID, docIDs)
+			require.NoError(t, err)
+
+			for i, result := range results {
+				require.Equal(t, docIDs[i], result.Document.ID)
+			}
+
+			// Existing documents are replaced, whether or not the server has the batch extension.
+			documents[0].Sequence = 1
+
+			results, err = c.UpsertDocuments(vaultID, documents[:5])
+			require.NoError(t, err)
+			require.True(t, strings.HasSuffix(results[0].Location, "/"+vaultID+"/documents/"+docIDs[0]))
+
+			document, err := c.ReadDocument(vaultID, docIDs[0])
+			require.NoError(t, err)
+			require.Equal(t, uint64(1), document.Sequence)
+
+			_, err = c.DeleteDocuments(vaultID, docIDs, WithBatchSize(10))
+			require.NoError(t, err)
+
+			if extensions.Batch {
+				require.Equal(t, 7, counter.count(http.MethodPost, "/batch"))
+				require.Equal(t, 0, counter.count(http.MethodPost, "/documents"))
+				require.Equal(t, 0, counter.count(http.MethodPost, "/documents/"))
+				require.Equal(t, 0, counter.count(http.MethodDelete, "/documents/"))
+			} else {
+				require.Equal(t, 0, counter.count(http.MethodPost, "/batch"))
+				require.Equal(t, len(documents)+5, counter.count(http.MethodPost, "/documents"))
+				require.Equal(t, 5, counter.count(http.MethodPost, "/documents/"))
+				require.Equal(t, len(documents), counter.count(http.MethodDelete, "/documents/"))
+			}
+
+			// The extensions are only read once.
+			require.Equal(t, 1, counter.count(http.MethodGet, "/.well-known/edv-configuration"))
+
+			results, err = c.ReadDocuments(vaultID, docIDs[:2])
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "failed to read 2 of 2 documents, first failure for document "+docIDs[0])
+			require.True(t, errors.Is(err, ErrDocumentNotFound))
+			require.True(t, errors.Is(results[1].Err, ErrDocumentNotFound))
+		})
+	}
+}
+
+func TestClient_Bulk_Errors(t *testing.T) {
+	t.Run("batch failure", func(t *testing.T) {
+		srv, _ := startCountingEDVServer(t, &operation.EnabledExtensions{Batch: true})
+		c := New(srv.URL + "/encrypted-data-vaults")
+		vaultID := createBulkTestVault(t, c)
+
+		results, err := c.DeleteDocuments(vaultID, []string{testDocumentID, testDocumentID2}, WithBatchSize(1))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to delete 2 of 2 documents")
+		require.Error(t, results[0].Err)
+		require.Error(t, results[1].Err)
+	})
+
+	t.Run("unexpected number of batch responses", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/.well-known/edv-configuration" {
+				_, _ = rw.Write([]byte(`{"extensions":["Batch"]}`)) //nolint: errcheck
+
+				return
+			}
+
+			_, _ = rw.Write([]byte(`[]`)) //nolint: errcheck
+		}))
+		defer srv.Close()
+
+		results, err := New(srv.URL+"/encrypted-data-vaults").DeleteDocuments("vault", []string{testDocumentID})
+		require.Error(t, err)
+		require.EqualError(t, results[0].Err, "expected 1 batch responses, got 0")
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		srv, counter := startCountingEDVServer(t, &operation.EnabledExtensions{})
+		c := New(srv.URL + "/encrypted-data-vaults")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := c.ReadDocumentsWithContext(ctx, "vault", []string{testDocumentID, testDocumentID2})
+		require.Error(t, err)
+		require.True(t, errors.Is(results[0].Err, context.Canceled))
+		require.True(t, errors.Is(results[1].Err, context.Canceled))
+
+		results, err = c.UpsertDocumentsWithContext(ctx, "vault", []models.EncryptedDocument{{ID: testDocumentID}})
+		require.Error(t, err)
+		require.True(t, errors.Is(results[0].Err, context.Canceled))
+		require.Equal(t, 0, counter.count(http.MethodPost, "/documents"))
+	})
+}
+
+type requestCounter struct {
+	mutex  sync.Mutex
+	counts map[string]int
+}
+
+// count returns the number of requests with the given method to paths that end with (or, for suffixes that end
+// with a slash, contain) suffix.
+func (c *requestCounter) count(method, suffix string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var n int
+
+	for request, count := range c.counts {
+		path := strings.TrimPrefix(request, method+" ")
+		if path == request {
+			continue
+		}
+
+		if strings.HasSuffix(path, suffix) || (strings.HasSuffix(suffix, "/") && strings.Contains(path, suffix)) {
+			n += count
+		}
+	}
+
+	return n
+}
+
+// startCountingEDVServer starts an EDV server that counts the requests it receives.
+func startCountingEDVServer(t *testing.T, enabledExtensions *operation.EnabledExtensions) (*httptest.Server,
+	*requestCounter) {
+	t.Helper()
+
+	memProv := memedvprovider.NewProvider()
+	require.NoError(t, memProv.CreateStore(dataVaultConfigurationStoreName))
+
+	edvService, err := restapi.New(&operation.Config{Provider: memProv, EnabledExtensions: enabledExtensions})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range edvService.GetOperations() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	counter := &requestCounter{counts: make(map[string]int)}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		counter.mutex.Lock()
+		counter.counts[fmt.Sprintf("%s %s", req.Method, req.URL.Path)]++
+		counter.mutex.Unlock()
+
+		router.ServeHTTP(rw, req)
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv, counter
+}
+
+func createBulkTestVault(t *testing.T, c *Client) string {
+	t.Helper()
+
+	config := getTestValidDataVaultConfiguration()
+
+	location, _, err := c.CreateDataVault(&config)
+	require.NoError(t, err)
+
+	return getVaultIDFromURL(location)
+}
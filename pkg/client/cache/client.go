@@ -0,0 +1,386 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package cache provides an EDV client that keeps a local copy of the documents it reads and writes, so that
+// applications keep working while the EDV server is unreachable. Documents are read from the cache when the server
+// can't be reached, and writes are queued until it can. Queued writes are sent when the server is reachable again,
+// and conflicting changes made on the server in the meantime are detected by document sequence.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	documentKeyPrefix = "document/"
+	writeKeyPrefix    = "write/"
+)
+
+var logger = log.New("edv-client-cache")
+
+// EDVClient sends documents to an EDV server. *client.Client implements this interface.
+type EDVClient interface {
+	CreateDocumentWithContext(ctx context.Context, vaultID string, document *models.EncryptedDocument,
+		opts ...client.ReqOption) (string, error)
+	ReadDocumentWithContext(ctx context.Context, vaultID, docID string,
+		opts ...client.ReqOption) (*models.EncryptedDocument, error)
+	UpdateDocumentWithContext(ctx context.Context, vaultID, docID string, document *models.EncryptedDocument,
+		opts ...client.ReqOption) error
+	DeleteDocumentWithContext(ctx context.Context, vaultID, docID string, opts ...client.ReqOption) error
+}
+
+// Conflict is a queued write of a document that was also changed on the server since the write's base version.
+type Conflict struct {
+	VaultID    string
+	DocumentID string
+	// Local is the document that was written while offline, or nil if it was deleted.
+	Local *models.EncryptedDocument
+	// Remote is the document on the server, or nil if it was deleted.
+	Remote *models.EncryptedDocument
+}
+
+// ConflictHandler resolves conflicts. It returns the document to write to the server, e.g. a merge of the local and
+// remote documents, or nil to keep the remote document and discard the local write. An error stops the sync and
+// leaves the write queued.
+type ConflictHandler func(conflict *Conflict) (*models.EncryptedDocument, error)
+
+// Option configures the client.
+type Option func(c *Client)
+
+// WithStore sets the store of cached documents and queued writes. Defaults to a MemStore. Use a FileStore to keep
+// queued writes across restarts.
+func WithStore(store Store) Option {
+	return func(c *Client) {
+		c.store = store
+	}
+}
+
+// WithConflictHandler sets the handler of conflicts. By default, conflicts are resolved by keeping the remote
+// document, and the discarded local write is logged.
+func WithConflictHandler(handler ConflictHandler) Option {
+	return func(c *Client) {
+		c.conflictHandler = handler
+	}
+}
+
+// WithMaxAge sets how long cached documents are read from the cache without revalidating them with the server.
+// By default, documents are always read from the server when it's reachable.
+func WithMaxAge(maxAge time.Duration) Option {
+	return func(c *Client) {
+		c.maxAge = maxAge
+	}
+}
+
+// Client caches the documents that it reads and writes with an EDV client.
+type Client struct {
+	edvClient       EDVClient
+	store           Store
+	conflictHandler ConflictHandler
+	maxAge          time.Duration
+	now             func() time.Time
+
+	// writeMutex serializes writes and syncs, so that queued writes are sent in order.
+	writeMutex sync.Mutex
+}
+
+// cachedDocument is a document in the cache.
+type cachedDocument struct {
+	// Document is the latest version of the document, or nil if it was deleted while offline.
+	Document *models.EncryptedDocument `json:"document,omitempty"`
+	// RemoteSequence is the sequence of the document on the server when it was last read or written, if it's known.
+	RemoteSequence *uint64 `json:"remoteSequence,omitempty"`
+	// Pending is true if the document has a queued write.
+	Pending  bool      `json:"pending,omitempty"`
+	CachedAt time.Time `json:"cachedAt"`
+}
+
+// New returns a new caching client that reads and writes documents with edvClient.
+func New(edvClient EDVClient, opts ...Option) *Client {
+	c := &Client{edvClient: edvClient, store: NewMemStore(), now: time.Now}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// CreateDocument creates the document in the given vault. If the EDV server can't be reached, the write is queued
+// and an empty location is returned.
+func (c *Client) CreateDocument(vaultID string, document *models.EncryptedDocument,
+	opts ...client.ReqOption) (string, error) {
+	return c.CreateDocumentWithContext(context.Background(), vaultID, document, opts...)
+}
+
+// CreateDocumentWithContext is like CreateDocument, but sends requests with the given context.
+func (c *Client) CreateDocumentWithContext(ctx context.Context, vaultID string, document *models.EncryptedDocument,
+	opts ...client.ReqOption) (string, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	pending, err := c.hasPendingWrites(ctx, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if pending {
+		return "", c.queue(vaultID, document.ID, OperationCreate, document)
+	}
+
+	location, err := c.edvClient.CreateDocumentWithContext(ctx, vaultID, document, opts...)
+	if err != nil {
+		if isOffline(ctx, err) {
+			logger.Debugf("Queuing creation of document %s in vault %s: %s", document.ID, vaultID, err)
+
+			return "", c.queue(vaultID, document.ID, OperationCreate, document)
+		}
+
+		return "", err
+	}
+
+	return location, c.putRemoteDocument(vaultID, document)
+}
+
+// ReadDocument reads the document from the EDV server and caches it. The cached document is returned if the server
+// can't be reached, if it has a queued write, or if it was cached within the max age set with WithMaxAge.
+func (c *Client) ReadDocument(vaultID, docID string, opts ...client.ReqOption) (*models.EncryptedDocument, error) {
+	return c.ReadDocumentWithContext(context.Background(), vaultID, docID, opts...)
+}
+
+// ReadDocumentWithContext is like ReadDocument, but sends requests with the given context.
+func (c *Client) ReadDocumentWithContext(ctx context.Context, vaultID, docID string,
+	opts ...client.ReqOption) (*models.EncryptedDocument, error) {
+	cached, err := c.getCachedDocument(vaultID, docID)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && (cached.Pending || c.now().Sub(cached.CachedAt) < c.maxAge) {
+		return cached.document(vaultID, docID)
+	}
+
+	document, err := c.edvClient.ReadDocumentWithContext(ctx, vaultID, docID, opts...)
+	if err != nil {
+		switch {
+		case errors.Is(err, client.ErrDocumentNotFound):
+			if errDelete := c.store.Delete(documentKey(vaultID, docID)); errDelete != nil {
+				logger.Warnf("Failed to delete document %s in vault %s from the cache: %s", docID, vaultID, errDelete)
+			}
+		case cached != nil && isOffline(ctx, err):
+			logger.Debugf("Reading document %s in vault %s from the cache: %s", docID, vaultID, err)
+
+			return cached.document(vaultID, docID)
+		}
+
+		return nil, err
+	}
+
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	// The document may have been written while it was read, which is more recent than the read document.
+	if cached, err = c.getCachedDocument(vaultID, docID); err == nil && cached != nil && cached.Pending {
+		return cached.document(vaultID, docID)
+	}
+
+	if err := c.putRemoteDocument(vaultID, document); err != nil {
+		logger.Warnf("Failed to cache document %s in vault %s: %s", docID, vaultID, err)
+	}
+
+	// The server is reachable, so any writes that were queued while it wasn't can be sent now.
+	if _, err := c.hasPendingWrites(ctx, opts); err != nil {
+		logger.Warnf("Failed to send queued writes: %s", err)
+	}
+
+	return document, nil
+}
+
+// UpdateDocument updates the document in the given vault. If the EDV server can't be reached, the write is queued.
+// The document is written with the sequence after the one of the version it replaces, if the client knows it and
+// the document doesn't have a later sequence already. The caller's document isn't modified.
+func (c *Client) UpdateDocument(vaultID, docID string, document *models.EncryptedDocument,
+	opts ...client.ReqOption) error {
+	return c.UpdateDocumentWithContext(context.Background(), vaultID, docID, document, opts...)
+}
+
+// UpdateDocumentWithContext is like UpdateDocument, but sends requests with the given context.
+func (c *Client) UpdateDocumentWithContext(ctx context.Context, vaultID, docID string,
+	document *models.EncryptedDocument, opts ...client.ReqOption) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	pending, err := c.hasPendingWrites(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	cached, err := c.getCachedDocument(vaultID, docID)
+	if err != nil {
+		return err
+	}
+
+	if cached != nil && cached.RemoteSequence != nil {
+		document = advance(document, *cached.RemoteSequence)
+	}
+
+	if pending {
+		return c.queue(vaultID, docID, OperationUpdate, document)
+	}
+
+	err = c.edvClient.UpdateDocumentWithContext(ctx, vaultID, docID, document, opts...)
+	if err != nil {
+		if isOffline(ctx, err) {
+			logger.Debugf("Queuing update of document %s in vault %s: %s", docID, vaultID, err)
+
+			return c.queue(vaultID, docID, OperationUpdate, document)
+		}
+
+		return err
+	}
+
+	return c.putRemoteDocument(vaultID, document)
+}
+
+// DeleteDocument deletes the document in the given vault. If the EDV server can't be reached, the write is queued.
+func (c *Client) DeleteDocument(vaultID, docID string, opts ...client.ReqOption) error {
+	return c.DeleteDocumentWithContext(context.Background(), vaultID, docID, opts...)
+}
+
+// DeleteDocumentWithContext is like DeleteDocument, but sends requests with the given context.
+func (c *Client) DeleteDocumentWithContext(ctx context.Context, vaultID, docID string,
+	opts ...client.ReqOption) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	pending, err := c.hasPendingWrites(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if pending {
+		return c.queue(vaultID, docID, OperationDelete, nil)
+	}
+
+	err = c.edvClient.DeleteDocumentWithContext(ctx, vaultID, docID, opts...)
+	if err != nil {
+		if isOffline(ctx, err) {
+			logger.Debugf("Queuing deletion of document %s in vault %s: %s", docID, vaultID, err)
+
+			return c.queue(vaultID, docID, OperationDelete, nil)
+		}
+
+		return err
+	}
+
+	return c.store.Delete(documentKey(vaultID, docID))
+}
+
+// hasPendingWrites sends the queued writes, if any, and returns whether writes are still queued because the EDV
+// server can't be reached. New writes are queued behind them, so that writes reach the server in order. If a queued
+// write fails otherwise (e.g. it's rejected by the server or the conflict handler), the error is returned and the
+// write stays queued until it's sent with Sync or discarded with Discard.
+func (c *Client) hasPendingWrites(ctx context.Context, opts []client.ReqOption) (bool, error) {
+	keys, err := c.store.Keys(writeKeyPrefix)
+	if err != nil {
+		return false, fmt.Errorf("failed to get queued writes: %w", err)
+	}
+
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	if err := c.sync(ctx, opts); err != nil {
+		if isOffline(ctx, err) {
+			logger.Debugf("Failed to send queued writes: %s", err)
+
+			return true, nil
+		}
+
+		return true, err
+	}
+
+	return false, nil
+}
+
+func (c *Client) getCachedDocument(vaultID, docID string) (*cachedDocument, error) {
+	value, err := c.store.Get(documentKey(vaultID, docID))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get document %s in vault %s from the cache: %w", docID, vaultID, err)
+	}
+
+	var cached cachedDocument
+
+	if err := json.Unmarshal(value, &cached); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cached document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	return &cached, nil
+}
+
+func (c *Client) putCachedDocument(vaultID, docID string, cached *cachedDocument) error {
+	cached.CachedAt = c.now()
+
+	value, err := json.Marshal(cached)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	return c.store.Put(documentKey(vaultID, docID), value)
+}
+
+// putRemoteDocument caches a document that was read from or written to the server.
+func (c *Client) putRemoteDocument(vaultID string, document *models.EncryptedDocument) error {
+	sequence := document.Sequence
+
+	return c.putCachedDocument(vaultID, document.ID, &cachedDocument{Document: document, RemoteSequence: &sequence})
+}
+
+// document returns the cached document, or an error that matches client.ErrDocumentNotFound if it was deleted.
+func (d *cachedDocument) document(vaultID, docID string) (*models.EncryptedDocument, error) {
+	if d.Document == nil {
+		return nil, fmt.Errorf("document %s in vault %s was deleted: %w", docID, vaultID, client.ErrDocumentNotFound)
+	}
+
+	return d.Document, nil
+}
+
+// isOffline returns true if err means that the EDV server couldn't be reached: the request failed to be sent
+// (other than by the caller canceling it), or a gateway in front of the server returned an error.
+func isOffline(ctx context.Context, err error) bool {
+	if ctx.Err() == context.Canceled {
+		return false
+	}
+
+	var edvErr *client.Error
+	if errors.As(err, &edvErr) {
+		return edvErr.StatusCode == http.StatusBadGateway || edvErr.StatusCode == http.StatusServiceUnavailable ||
+			edvErr.StatusCode == http.StatusGatewayTimeout
+	}
+
+	var urlErr *url.Error
+
+	return errors.As(err, &urlErr)
+}
+
+func documentKey(vaultID, docID string) string {
+	return documentKeyPrefix + vaultID + "/" + docID
+}
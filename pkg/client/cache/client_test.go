@@ -0,0 +1,609 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvtest"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testJWE = `{"protected":"eyJlbmMiOiJDMjBQIn0","recipients":[{"header":{"alg":"A256KW","kid":"https://exam` +
+		`ple.com/kms/z7BgF536GaR"},"encrypted_key":"OR1vdCNvf_B68mfUxFQVT-vyXVrBembuiM40mAAjDC1-Qu5iArDbug"}],` +
+		`"iv":"i8Nins2vTI3PlrYW","ciphertext":"Cb-963UCXblINT8F6MDHzMJN9EAhK3I","tag":"pfZO0JulJcrc3trOZy8rjA"}`
+
+	// offlineRequests is the number of requests that fail while the test server is "offline".
+	offlineRequests = 1000
+)
+
+func TestClient_Online(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	c := New(srv.Client())
+
+	document := newDocument(t, 0)
+
+	location, err := c.CreateDocument(vaultID, document)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(location, "/documents/"+document.ID))
+
+	t.Run("read revalidates with the server", func(t *testing.T) {
+		require.NoError(t, srv.Client().UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 1)))
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), readDocument.Sequence)
+	})
+
+	t.Run("read within max age", func(t *testing.T) {
+		c := New(srv.Client(), WithMaxAge(time.Hour))
+
+		_, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, srv.Client().UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 2)))
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), readDocument.Sequence)
+
+		c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+		readDocument, err = c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), readDocument.Sequence)
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		require.NoError(t, c.UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 3)))
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), remote.Sequence)
+
+		require.NoError(t, c.DeleteDocument(vaultID, document.ID))
+
+		_, err = c.ReadDocument(vaultID, document.ID)
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+	})
+
+	t.Run("errors are returned", func(t *testing.T) {
+		_, err := c.CreateDocument("vault", newDocument(t, 0))
+		require.True(t, errors.Is(err, client.ErrVaultNotFound))
+
+		err = c.UpdateDocument("vault", document.ID, document)
+		require.True(t, errors.Is(err, client.ErrVaultNotFound))
+
+		err = c.DeleteDocument("vault", document.ID)
+		require.True(t, errors.Is(err, client.ErrVaultNotFound))
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+	})
+}
+
+func TestClient_Offline(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	c := New(srv.Client())
+
+	document := newDocument(t, 0)
+
+	_, err := c.CreateDocument(vaultID, document)
+	require.NoError(t, err)
+
+	srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+	t.Run("read from the cache", func(t *testing.T) {
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, document.ID, readDocument.ID)
+
+		_, err = c.ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "503")
+	})
+
+	newDoc := newDocument(t, 0)
+
+	t.Run("writes are queued", func(t *testing.T) {
+		location, err := c.CreateDocument(vaultID, newDoc)
+		require.NoError(t, err)
+		require.Empty(t, location)
+
+		require.NoError(t, c.UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 1)))
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), readDocument.Sequence)
+
+		readDocument, err = c.ReadDocument(vaultID, newDoc.ID)
+		require.NoError(t, err)
+		require.Equal(t, newDoc.ID, readDocument.ID)
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Len(t, writes, 2)
+		require.Equal(t, OperationCreate, writes[0].Operation)
+		require.Nil(t, writes[0].BaseSequence)
+		require.Equal(t, OperationUpdate, writes[1].Operation)
+		require.Equal(t, uint64(0), *writes[1].BaseSequence)
+	})
+
+	t.Run("sync fails while offline", func(t *testing.T) {
+		err := c.Sync(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to send queued create of document "+newDoc.ID)
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Len(t, writes, 2)
+	})
+
+	t.Run("writes are sent on reconnect", func(t *testing.T) {
+		srv.FailNextRequests(0, 0)
+
+		require.NoError(t, c.DeleteDocument(vaultID, newDoc.ID))
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), remote.Sequence)
+
+		_, err = srv.Document(vaultID, newDoc.ID)
+		require.Error(t, err)
+	})
+
+	t.Run("writes are sent by a read from the server", func(t *testing.T) {
+		_, err := c.CreateDocument(vaultID, newDoc)
+		require.NoError(t, err)
+
+		srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+		require.NoError(t, c.UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 2)))
+
+		srv.FailNextRequests(0, 0)
+
+		_, err = c.ReadDocument(vaultID, newDoc.ID)
+		require.NoError(t, err)
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), remote.Sequence)
+	})
+}
+
+func TestClient_RejectedQueuedWrite(t *testing.T) {
+	t.Run("rejected by the server", func(t *testing.T) {
+		srv := edvtest.NewServer(t)
+		vaultID := createVault(t, srv)
+		c := New(srv.Client())
+
+		srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+		queued := newDocument(t, 0)
+
+		_, err := c.CreateDocument(vaultID, queued)
+		require.NoError(t, err)
+
+		srv.FailNextRequests(1, http.StatusForbidden)
+
+		document := newDocument(t, 0)
+
+		_, err = c.CreateDocument(vaultID, document)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to send queued create of document "+queued.ID)
+		require.Contains(t, err.Error(), "403")
+
+		_, err = srv.Document(vaultID, document.ID)
+		require.Error(t, err)
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Len(t, writes, 1)
+		require.Equal(t, queued.ID, writes[0].DocumentID)
+
+		_, err = c.CreateDocument(vaultID, document)
+		require.NoError(t, err)
+
+		writes, err = c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+
+		_, err = srv.Document(vaultID, queued.ID)
+		require.NoError(t, err)
+
+		_, err = srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+	})
+
+	t.Run("rejected by the conflict handler", func(t *testing.T) {
+		srv, vaultID, c, document := setUpConflict(t, WithConflictHandler(
+			func(c *Conflict) (*models.EncryptedDocument, error) {
+				return nil, errors.New("resolve error")
+			}))
+
+		other := newDocument(t, 0)
+
+		_, err := c.CreateDocument(vaultID, other)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve conflict: resolve error")
+
+		err = c.DeleteDocument(vaultID, other.ID)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve conflict: resolve error")
+
+		_, err = srv.Document(vaultID, other.ID)
+		require.Error(t, err)
+
+		require.NoError(t, c.Discard(vaultID, document.ID))
+
+		_, err = c.CreateDocument(vaultID, other)
+		require.NoError(t, err)
+
+		_, err = srv.Document(vaultID, other.ID)
+		require.NoError(t, err)
+	})
+}
+
+func TestClient_QueuedWritesAreMerged(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	c := New(srv.Client())
+
+	document := newDocument(t, 0)
+
+	_, err := c.CreateDocument(vaultID, document)
+	require.NoError(t, err)
+
+	srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+	t.Run("create and delete", func(t *testing.T) {
+		newDoc := newDocument(t, 0)
+
+		_, err := c.CreateDocument(vaultID, newDoc)
+		require.NoError(t, err)
+
+		_, err = c.CreateDocument(vaultID, newDoc)
+		require.True(t, errors.Is(err, client.ErrDuplicateDocument))
+
+		require.NoError(t, c.UpdateDocument(vaultID, newDoc.ID, newDocumentWithID(newDoc.ID, 1)))
+		require.NoError(t, c.DeleteDocument(vaultID, newDoc.ID))
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+	})
+
+	t.Run("delete and create", func(t *testing.T) {
+		require.NoError(t, c.DeleteDocument(vaultID, document.ID))
+
+		_, err := c.ReadDocument(vaultID, document.ID)
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+
+		err = c.UpdateDocument(vaultID, document.ID, document)
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+
+		require.NoError(t, c.DeleteDocument(vaultID, document.ID))
+
+		_, err = c.CreateDocument(vaultID, newDocumentWithID(document.ID, 1))
+		require.NoError(t, err)
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Len(t, writes, 1)
+		require.Equal(t, OperationUpdate, writes[0].Operation)
+		require.Equal(t, uint64(1), writes[0].Document.Sequence)
+		require.Equal(t, uint64(0), *writes[0].BaseSequence)
+	})
+
+	t.Run("discard", func(t *testing.T) {
+		require.NoError(t, c.Discard(vaultID, document.ID))
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Empty(t, writes)
+
+		srv.FailNextRequests(0, 0)
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(0), readDocument.Sequence)
+	})
+}
+
+func TestClient_Conflicts(t *testing.T) {
+	t.Run("remote is kept by default", func(t *testing.T) {
+		srv, vaultID, c, document := setUpConflict(t)
+
+		require.NoError(t, c.Sync(context.Background()))
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), readDocument.Sequence)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(5), remote.Sequence)
+	})
+
+	t.Run("conflict handler resolves the conflict", func(t *testing.T) {
+		var conflict *Conflict
+
+		srv, vaultID, c, document := setUpConflict(t, WithConflictHandler(
+			func(c *Conflict) (*models.EncryptedDocument, error) {
+				conflict = c
+
+				return newDocumentWithID(c.DocumentID, c.Remote.Sequence+1), nil
+			}))
+
+		require.NoError(t, c.Sync(context.Background()))
+
+		require.NotNil(t, conflict)
+		require.Equal(t, vaultID, conflict.VaultID)
+		require.Equal(t, uint64(1), conflict.Local.Sequence)
+		require.Equal(t, uint64(5), conflict.Remote.Sequence)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(6), remote.Sequence)
+	})
+
+	t.Run("conflict handler error", func(t *testing.T) {
+		_, vaultID, c, document := setUpConflict(t, WithConflictHandler(
+			func(c *Conflict) (*models.EncryptedDocument, error) {
+				return nil, errors.New("resolve error")
+			}))
+
+		err := c.Sync(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to resolve conflict: resolve error")
+
+		writes, err := c.PendingWrites()
+		require.NoError(t, err)
+		require.Len(t, writes, 1)
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), readDocument.Sequence)
+	})
+
+	t.Run("document deleted on the server", func(t *testing.T) {
+		var conflict *Conflict
+
+		srv, vaultID, c, document := setUpConflict(t, WithConflictHandler(
+			func(c *Conflict) (*models.EncryptedDocument, error) {
+				conflict = c
+
+				return c.Local, nil
+			}))
+
+		require.NoError(t, srv.Client().DeleteDocument(vaultID, document.ID))
+		require.NoError(t, c.Sync(context.Background()))
+
+		require.NotNil(t, conflict)
+		require.Nil(t, conflict.Remote)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), remote.Sequence)
+	})
+
+	t.Run("document created on the server", func(t *testing.T) {
+		srv := edvtest.NewServer(t)
+		vaultID := createVault(t, srv)
+		c := New(srv.Client())
+
+		document := newDocument(t, 0)
+
+		srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+		_, err := c.CreateDocument(vaultID, document)
+		require.NoError(t, err)
+
+		srv.FailNextRequests(0, 0)
+
+		_, err = srv.Client().CreateDocument(vaultID, newDocumentWithID(document.ID, 7))
+		require.NoError(t, err)
+
+		require.NoError(t, c.Sync(context.Background()))
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(7), readDocument.Sequence)
+	})
+
+	t.Run("deletion of a document changed on the server", func(t *testing.T) {
+		srv, vaultID, c, document := setUpConflict(t)
+
+		// Replace the queued update with a deletion.
+		srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+		require.NoError(t, c.DeleteDocument(vaultID, document.ID))
+		srv.FailNextRequests(0, 0)
+
+		require.NoError(t, c.Sync(context.Background()))
+
+		_, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+	})
+}
+
+func TestClient_LostUpdate(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+
+	var conflicts []*Conflict
+
+	handler := func(conflict *Conflict) (*models.EncryptedDocument, error) {
+		conflicts = append(conflicts, conflict)
+
+		return nil, nil
+	}
+
+	first, second := New(srv.Client(), WithConflictHandler(handler)), New(srv.Client(), WithConflictHandler(handler))
+
+	document := newDocument(t, 0)
+
+	_, err := first.CreateDocument(vaultID, document)
+	require.NoError(t, err)
+
+	// Both clients read the document and update it while offline, keeping the sequence they read.
+	for _, c := range []*Client{first, second} {
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+
+		srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+		require.NoError(t, c.UpdateDocument(vaultID, document.ID, readDocument))
+
+		srv.FailNextRequests(0, 0)
+	}
+
+	require.NoError(t, first.Sync(context.Background()))
+	require.Empty(t, conflicts)
+
+	remote, err := srv.Document(vaultID, document.ID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), remote.Sequence)
+	require.Equal(t, uint64(0), document.Sequence)
+
+	// The update of the second client was based on the version that the first client replaced.
+	require.NoError(t, second.Sync(context.Background()))
+	require.Len(t, conflicts, 1)
+	require.Equal(t, uint64(1), conflicts[0].Local.Sequence)
+	require.Equal(t, uint64(1), conflicts[0].Remote.Sequence)
+
+	writes, err := second.PendingWrites()
+	require.NoError(t, err)
+	require.Empty(t, writes)
+
+	t.Run("online updates advance the sequence", func(t *testing.T) {
+		readDocument, err := second.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+
+		require.NoError(t, second.UpdateDocument(vaultID, document.ID, readDocument))
+		require.Equal(t, uint64(1), readDocument.Sequence)
+
+		remote, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(2), remote.Sequence)
+	})
+}
+
+func TestClient_FileStore(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	document := newDocument(t, 0)
+
+	srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+	_, err = New(srv.Client(), WithStore(store)).CreateDocument(vaultID, document)
+	require.NoError(t, err)
+
+	srv.FailNextRequests(0, 0)
+
+	// The queued write survives a restart.
+	store, err = NewFileStore(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, New(srv.Client(), WithStore(store)).Sync(context.Background()))
+
+	_, err = srv.Document(vaultID, document.ID)
+	require.NoError(t, err)
+}
+
+func TestIsOffline(t *testing.T) {
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	srv.Close()
+
+	_, err := srv.Client().ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+	require.True(t, isOffline(context.Background(), err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.False(t, isOffline(ctx, err))
+	require.False(t, isOffline(context.Background(), &client.Error{StatusCode: http.StatusInternalServerError}))
+	require.True(t, isOffline(context.Background(), &client.Error{StatusCode: http.StatusBadGateway}))
+	require.False(t, isOffline(context.Background(), errors.New("error")))
+}
+
+// setUpConflict returns a client with a queued update of a document from sequence 0 to 1, and sets the sequence of
+// the document on the server to 5.
+func setUpConflict(t *testing.T, opts ...Option) (*edvtest.Server, string, *Client, *models.EncryptedDocument) {
+	t.Helper()
+
+	srv := edvtest.NewServer(t)
+	vaultID := createVault(t, srv)
+	c := New(srv.Client(), opts...)
+
+	document := newDocument(t, 0)
+
+	_, err := c.CreateDocument(vaultID, document)
+	require.NoError(t, err)
+
+	srv.FailNextRequests(offlineRequests, http.StatusServiceUnavailable)
+
+	require.NoError(t, c.UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 1)))
+
+	srv.FailNextRequests(0, 0)
+
+	require.NoError(t, srv.Client().UpdateDocument(vaultID, document.ID, newDocumentWithID(document.ID, 5)))
+
+	return srv, vaultID, c, document
+}
+
+func createVault(t *testing.T, srv *edvtest.Server) string {
+	t.Helper()
+
+	location, _, err := srv.Client().CreateDataVault(&models.DataVaultConfiguration{
+		Controller: "did:example:123",
+		KEK:        models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+		HMAC:       models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+	})
+	require.NoError(t, err)
+
+	return location[strings.LastIndex(location, "/")+1:]
+}
+
+func newDocument(t *testing.T, sequence uint64) *models.EncryptedDocument {
+	t.Helper()
+
+	docID, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	return newDocumentWithID(docID, sequence)
+}
+
+func newDocumentWithID(docID string, sequence uint64) *models.EncryptedDocument {
+	return &models.EncryptedDocument{ID: docID, Sequence: sequence, JWE: []byte(testJWE)}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cache
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by stores for keys that have no value.
+var ErrNotFound = errors.New("not found")
+
+// Store persists the cached documents and queued writes of a client. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// Put stores the value for the key, replacing the previous one.
+	Put(key string, value []byte) error
+	// Get returns the value for the key, or ErrNotFound if there's none.
+	Get(key string) ([]byte, error)
+	// Delete deletes the value for the key. Deleting a key that has no value isn't an error.
+	Delete(key string) error
+	// Keys returns the keys that start with prefix, in ascending order.
+	Keys(prefix string) ([]string, error)
+}
+
+// MemStore is a Store that keeps values in memory, so they're lost when the process exits.
+type MemStore struct {
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+// NewMemStore returns a new, empty in-memory store.
+func NewMemStore() *MemStore {
+	return &MemStore{values: make(map[string][]byte)}
+}
+
+// Put stores the value for the key.
+func (s *MemStore) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.values[key] = append([]byte(nil), value...)
+
+	return nil
+}
+
+// Get returns the value for the key.
+func (s *MemStore) Get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value, found := s.values[key]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), value...), nil
+}
+
+// Delete deletes the value for the key.
+func (s *MemStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.values, key)
+
+	return nil
+}
+
+// Keys returns the keys that start with prefix.
+func (s *MemStore) Keys(prefix string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var keys []string
+
+	for key := range s.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// FileStore is a Store that keeps every value in a file in a directory, so that the cache survives restarts.
+type FileStore struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+// NewFileStore returns a store that keeps values in files in dir, which is created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Put stores the value for the key. The file is replaced atomically, so a crash never leaves a partial value.
+func (s *FileStore) Put(key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tmpFile, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return fmt.Errorf("failed to create file for %s: %w", key, err)
+	}
+
+	_, err = tmpFile.Write(value)
+
+	if errClose := tmpFile.Close(); err == nil {
+		err = errClose
+	}
+
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), s.path(key))
+	}
+
+	if err != nil {
+		_ = os.Remove(tmpFile.Name()) //nolint: errcheck
+
+		return fmt.Errorf("failed to write file for %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Get returns the value for the key.
+func (s *FileStore) Get(key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	value, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to read file for %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// Delete deletes the value for the key.
+func (s *FileStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file for %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Keys returns the keys that start with prefix.
+func (s *FileStore) Keys(prefix string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory %s: %w", s.dir, err)
+	}
+
+	var keys []string
+
+	for _, file := range files {
+		key, err := base64.RawURLEncoding.DecodeString(file.Name())
+		if err != nil || file.IsDir() { // Not a value, e.g. a temporary file.
+			continue
+		}
+
+		if strings.HasPrefix(string(key), prefix) {
+			keys = append(keys, string(key))
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// path returns the path of the file for the key. Keys are encoded so that they're valid file names.
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, base64.RawURLEncoding.EncodeToString([]byte(key)))
+}
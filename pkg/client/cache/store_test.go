@@ -0,0 +1,103 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "cache"))
+	require.NoError(t, err)
+
+	for name, store := range map[string]Store{"mem": NewMemStore(), "file": fileStore} {
+		store := store
+
+		t.Run(name, func(t *testing.T) {
+			_, err := store.Get("document/vault/doc1")
+			require.True(t, errors.Is(err, ErrNotFound))
+
+			require.NoError(t, store.Put("document/vault/doc1", []byte("value1")))
+			require.NoError(t, store.Put("document/vault/doc1", []byte("value2")))
+			require.NoError(t, store.Put("document/vault/doc0", []byte("value3")))
+			require.NoError(t, store.Put("write/00000000000000000000", []byte("value4")))
+
+			value, err := store.Get("document/vault/doc1")
+			require.NoError(t, err)
+			require.Equal(t, "value2", string(value))
+
+			keys, err := store.Keys("document/")
+			require.NoError(t, err)
+			require.Equal(t, []string{"document/vault/doc0", "document/vault/doc1"}, keys)
+
+			require.NoError(t, store.Delete("document/vault/doc1"))
+			require.NoError(t, store.Delete("document/vault/doc1"))
+
+			_, err = store.Get("document/vault/doc1")
+			require.True(t, errors.Is(err, ErrNotFound))
+
+			keys, err = store.Keys("")
+			require.NoError(t, err)
+			require.Equal(t, []string{"document/vault/doc0", "write/00000000000000000000"}, keys)
+		})
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	t.Run("values are kept across instances", func(t *testing.T) {
+		dir := t.TempDir()
+
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		require.NoError(t, store.Put("key", []byte("value")))
+
+		// Leftover temporary files aren't values.
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("partial"), 0600))
+
+		store, err = NewFileStore(dir)
+		require.NoError(t, err)
+
+		value, err := store.Get("key")
+		require.NoError(t, err)
+		require.Equal(t, "value", string(value))
+
+		keys, err := store.Keys("")
+		require.NoError(t, err)
+		require.Equal(t, []string{"key"}, keys)
+	})
+
+	t.Run("invalid directory", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, ioutil.WriteFile(file, nil, 0600))
+
+		_, err := NewFileStore(file)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to create cache directory")
+	})
+
+	t.Run("directory removed", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "cache")
+
+		store, err := NewFileStore(dir)
+		require.NoError(t, err)
+		require.NoError(t, os.RemoveAll(dir))
+
+		err = store.Put("key", []byte("value"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to create file for key")
+
+		_, err = store.Keys("")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to read cache directory")
+	})
+}
@@ -0,0 +1,347 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// Operation is the kind of a queued write.
+type Operation string
+
+// Operations of queued writes.
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+)
+
+// Write is a write that was queued because the EDV server couldn't be reached. There is at most one queued write
+// per document: later writes of the document are merged into it.
+type Write struct {
+	Operation  Operation `json:"operation"`
+	VaultID    string    `json:"vaultId"`
+	DocumentID string    `json:"documentId"`
+	// Document is the document to create or update. It's nil for deletions.
+	Document *models.EncryptedDocument `json:"document,omitempty"`
+	// BaseSequence is the sequence of the document on the server when it was written, if it's known. The write
+	// conflicts with changes on the server if the sequence of the document on the server is different when it's sent.
+	BaseSequence *uint64   `json:"baseSequence,omitempty"`
+	QueuedAt     time.Time `json:"queuedAt"`
+
+	key string
+}
+
+// Sync sends the queued writes to the EDV server in the order they were made, and resolves conflicts with the
+// conflict handler. Queued writes are also sent by the next write, or read from the server, after the server can be
+// reached again. Request options passed to queued writes aren't kept: the writes are sent with the given options.
+// If a write fails, Sync stops and returns the error; the write and the ones after it stay queued.
+func (c *Client) Sync(ctx context.Context, opts ...client.ReqOption) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	return c.sync(ctx, opts)
+}
+
+// PendingWrites returns the queued writes, in the order they'll be sent.
+func (c *Client) PendingWrites() ([]Write, error) {
+	return c.writes()
+}
+
+// Discard removes the queued write of the given document, if any, and the document from the cache, so that it's
+// read from the server again. Use it for writes that the server rejects.
+func (c *Client) Discard(vaultID, docID string) error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	write, err := c.pendingWrite(vaultID, docID)
+	if err != nil {
+		return err
+	}
+
+	if write != nil {
+		if err := c.store.Delete(write.key); err != nil {
+			return fmt.Errorf("failed to delete queued write of document %s in vault %s: %w", docID, vaultID, err)
+		}
+	}
+
+	return c.store.Delete(documentKey(vaultID, docID))
+}
+
+// queue queues a write of a document, merging it into the document's queued write if there's one, and caches the
+// document as written.
+func (c *Client) queue(vaultID, docID string, operation Operation, document *models.EncryptedDocument) error {
+	cached, err := c.getCachedDocument(vaultID, docID)
+	if err != nil {
+		return err
+	}
+
+	write, err := c.pendingWrite(vaultID, docID)
+	if err != nil {
+		return err
+	}
+
+	if write == nil {
+		write = &Write{VaultID: vaultID, DocumentID: docID, Operation: operation, QueuedAt: c.now()}
+
+		if write.key, err = c.nextWriteKey(); err != nil {
+			return err
+		}
+
+		if cached != nil {
+			write.BaseSequence = cached.RemoteSequence
+		}
+	} else if write.Operation, err = merge(write.Operation, operation); err != nil {
+		return fmt.Errorf("failed to queue %s of document %s in vault %s: %w", operation, docID, vaultID, err)
+	}
+
+	write.Document = document
+
+	// A document that is created and deleted while offline never reaches the server.
+	if write.Operation == "" {
+		if err := c.store.Delete(write.key); err != nil {
+			return fmt.Errorf("failed to delete queued write of document %s in vault %s: %w", docID, vaultID, err)
+		}
+
+		return c.store.Delete(documentKey(vaultID, docID))
+	}
+
+	value, err := json.Marshal(write)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queued write of document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	if err := c.store.Put(write.key, value); err != nil {
+		return fmt.Errorf("failed to queue write of document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	return c.putCachedDocument(vaultID, docID, &cachedDocument{
+		Document: document, RemoteSequence: write.BaseSequence, Pending: true,
+	})
+}
+
+// merge returns the operation of a queued write after another write of the same document, or "" if the queued write
+// is canceled out.
+func merge(queued, next Operation) (Operation, error) {
+	switch {
+	case next == OperationCreate && queued == OperationDelete:
+		return OperationUpdate, nil
+	case next == OperationCreate:
+		return "", client.ErrDuplicateDocument
+	case next == OperationUpdate && queued == OperationDelete:
+		return "", client.ErrDocumentNotFound
+	case next == OperationUpdate:
+		return queued, nil
+	case queued == OperationCreate: // Deletion of a document that was created while offline.
+		return "", nil
+	default:
+		return OperationDelete, nil
+	}
+}
+
+func (c *Client) writes() ([]Write, error) {
+	keys, err := c.store.Keys(writeKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queued writes: %w", err)
+	}
+
+	writes := make([]Write, 0, len(keys))
+
+	for _, key := range keys {
+		value, err := c.store.Get(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get queued write %s: %w", key, err)
+		}
+
+		var write Write
+
+		if err := json.Unmarshal(value, &write); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queued write %s: %w", key, err)
+		}
+
+		write.key = key
+		writes = append(writes, write)
+	}
+
+	return writes, nil
+}
+
+func (c *Client) pendingWrite(vaultID, docID string) (*Write, error) {
+	writes, err := c.writes()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range writes {
+		if writes[i].VaultID == vaultID && writes[i].DocumentID == docID {
+			return &writes[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// nextWriteKey returns the key of a new queued write. Keys are zero-padded numbers, so that their order is the
+// order of the writes.
+func (c *Client) nextWriteKey() (string, error) {
+	keys, err := c.store.Keys(writeKeyPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to get queued writes: %w", err)
+	}
+
+	var next uint64
+
+	if len(keys) > 0 {
+		last, err := strconv.ParseUint(strings.TrimPrefix(keys[len(keys)-1], writeKeyPrefix), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid queued write key %s: %w", keys[len(keys)-1], err)
+		}
+
+		next = last + 1
+	}
+
+	return fmt.Sprintf("%s%020d", writeKeyPrefix, next), nil
+}
+
+func (c *Client) sync(ctx context.Context, opts []client.ReqOption) error {
+	writes, err := c.writes()
+	if err != nil {
+		return err
+	}
+
+	for i := range writes {
+		write := &writes[i]
+
+		if err := c.syncWrite(ctx, write, opts); err != nil {
+			return fmt.Errorf("failed to send queued %s of document %s in vault %s: %w", write.Operation,
+				write.DocumentID, write.VaultID, err)
+		}
+
+		if err := c.store.Delete(write.key); err != nil {
+			return fmt.Errorf("failed to delete queued write of document %s in vault %s: %w", write.DocumentID,
+				write.VaultID, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) syncWrite(ctx context.Context, write *Write, opts []client.ReqOption) error {
+	if write.Operation == OperationCreate {
+		_, err := c.edvClient.CreateDocumentWithContext(ctx, write.VaultID, write.Document, opts...)
+		if err == nil {
+			return c.putRemoteDocument(write.VaultID, write.Document)
+		}
+
+		if !errors.Is(err, client.ErrDuplicateDocument) {
+			return err
+		}
+	}
+
+	remote, err := c.edvClient.ReadDocumentWithContext(ctx, write.VaultID, write.DocumentID, opts...)
+	if err != nil {
+		if !errors.Is(err, client.ErrDocumentNotFound) {
+			return err
+		}
+
+		remote = nil
+	}
+
+	switch {
+	case write.Operation == OperationCreate:
+		// The document was created on the server too.
+	case remote == nil && write.Operation == OperationDelete:
+		return c.store.Delete(documentKey(write.VaultID, write.DocumentID))
+	case remote != nil && (write.BaseSequence == nil || remote.Sequence == *write.BaseSequence):
+		return c.send(ctx, write.VaultID, write.DocumentID, write.Document, remote, opts)
+	}
+
+	return c.resolve(ctx, write, remote, opts)
+}
+
+// resolve resolves a conflict between a queued write and the document on the server.
+func (c *Client) resolve(ctx context.Context, write *Write, remote *models.EncryptedDocument,
+	opts []client.ReqOption) error {
+	conflict := &Conflict{
+		VaultID: write.VaultID, DocumentID: write.DocumentID, Local: write.Document, Remote: remote,
+	}
+
+	if c.conflictHandler == nil {
+		logger.Warnf("Discarding queued %s of document %s in vault %s, which conflicts with the document on the "+
+			"server", write.Operation, write.DocumentID, write.VaultID)
+
+		return c.keepRemote(conflict)
+	}
+
+	resolved, err := c.conflictHandler(conflict)
+	if err != nil {
+		return fmt.Errorf("failed to resolve conflict: %w", err)
+	}
+
+	if resolved == nil {
+		return c.keepRemote(conflict)
+	}
+
+	return c.send(ctx, write.VaultID, write.DocumentID, resolved, remote, opts)
+}
+
+// send writes the document to the server, where remote is the current document. A nil document deletes it.
+func (c *Client) send(ctx context.Context, vaultID, docID string, document, remote *models.EncryptedDocument,
+	opts []client.ReqOption) error {
+	var err error
+
+	switch {
+	case document == nil:
+		err = c.edvClient.DeleteDocumentWithContext(ctx, vaultID, docID, opts...)
+	case remote == nil:
+		_, err = c.edvClient.CreateDocumentWithContext(ctx, vaultID, document, opts...)
+	default:
+		document = advance(document, remote.Sequence)
+		err = c.edvClient.UpdateDocumentWithContext(ctx, vaultID, docID, document, opts...)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if document == nil {
+		return c.store.Delete(documentKey(vaultID, docID))
+	}
+
+	return c.putRemoteDocument(vaultID, document)
+}
+
+// advance returns the document to send as an update of the version of the document with the given sequence: a copy
+// with the next sequence, unless the document already has a later one. The sequence of the document on the server
+// then changes with every update, so that other clients detect the update as a conflict with their queued writes.
+func advance(document *models.EncryptedDocument, sequence uint64) *models.EncryptedDocument {
+	if document.Sequence > sequence {
+		return document
+	}
+
+	next := *document
+	next.Sequence = sequence + 1
+
+	return &next
+}
+
+func (c *Client) keepRemote(conflict *Conflict) error {
+	if conflict.Remote == nil {
+		return c.store.Delete(documentKey(conflict.VaultID, conflict.DocumentID))
+	}
+
+	return c.putRemoteDocument(conflict.VaultID, conflict.Remote)
+}
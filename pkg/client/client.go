@@ -8,20 +8,31 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/trustbloc/edge-core/pkg/log"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+	"go.opentelemetry.io/otel/propagation"
 
+	"github.com/trustbloc/edv/pkg/audit"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
 
 const (
+	edvEndpointPathRoot   = "/encrypted-data-vaults"
+	configurationEndpoint = "/.well-known/edv-configuration"
+
 	failSendRequestForAllDocuments = "failure while sending request to retrieve all documents from vault %s: %w"
 	failSendRequestForDocument     = "failure while sending request to vault %s to retrieve document %s: %w"
 )
@@ -38,6 +49,15 @@ type Client struct {
 	httpClient   *http.Client
 	marshal      marshalFunc
 	headersFunc  addHeaders
+	retryPolicy  *RetryPolicy
+	invoker      *httpSignature
+	propagator   propagation.TextMapPropagator
+
+	capabilitiesMutex sync.RWMutex
+	capabilities      map[string]*zcapld.Capability
+
+	extensionsMutex sync.Mutex
+	extensions      []string
 }
 
 // Option configures the edv client
@@ -50,6 +70,14 @@ func WithTLSConfig(tlsConfig *tls.Config) Option {
 	}
 }
 
+// WithTimeout option sets a time limit for requests to the EDV server, including reading their response.
+// By default, requests only time out when their context is done.
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *Client) {
+		opts.httpClient.Timeout = timeout
+	}
+}
+
 // WithHeaders option is for setting additional http request headers
 func WithHeaders(addHeadersFunc addHeaders) Option {
 	return func(opts *Client) {
@@ -57,9 +85,23 @@ func WithHeaders(addHeadersFunc addHeaders) Option {
 	}
 }
 
+// WithPropagator option sets the propagator that adds the trace context of requests (i.e. the span in their context)
+// to their headers, so that the EDV server can continue the trace. By default, the W3C trace context headers
+// (traceparent and tracestate) are added.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(opts *Client) {
+		opts.propagator = propagator
+	}
+}
+
 // ReqOpts is used to interact with an EDV operation.
 type ReqOpts struct {
 	addHeadersFunc addHeaders
+	signature      *httpSignature
+	capability     *zcapld.Capability
+	idempotencyKey string
+	concurrency    int
+	batchSize      int
 }
 
 // ReqOption edv req option
@@ -74,7 +116,10 @@ func WithRequestHeader(addHeadersFunc addHeaders) ReqOption {
 
 // New returns a new instance of an EDV client.
 func New(edvServerURL string, opts ...Option) *Client {
-	c := &Client{edvServerURL: edvServerURL, httpClient: &http.Client{}, marshal: json.Marshal}
+	c := &Client{
+		edvServerURL: edvServerURL, httpClient: &http.Client{}, marshal: json.Marshal,
+		capabilities: make(map[string]*zcapld.Capability), propagator: propagation.TraceContext{},
+	}
 
 	for _, opt := range opts {
 		opt(c)
@@ -86,12 +131,20 @@ func New(edvServerURL string, opts ...Option) *Client {
 // CreateDataVault sends the EDV server a request to create a new data vault.
 // The location of the newly created data vault is returned.
 func (c *Client) CreateDataVault(config *models.DataVaultConfiguration, opts ...ReqOption) (string, []byte, error) {
+	return c.CreateDataVaultWithContext(context.Background(), config, opts...)
+}
+
+// CreateDataVaultWithContext is like CreateDataVault, but sends the request with the given context.
+func (c *Client) CreateDataVaultWithContext(ctx context.Context, config *models.DataVaultConfiguration,
+	opts ...ReqOption) (string, []byte, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
 		o(reqOpt)
 	}
 
+	reqOpt.idempotencyKey = c.idempotencyKey(reqOpt)
+
 	jsonToSend, err := c.marshal(config)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to marshal data vault configuration: %w", err)
@@ -100,29 +153,38 @@ func (c *Client) CreateDataVault(config *models.DataVaultConfiguration, opts ...
 	logger.Debugf("Sending request to create a new data vault with the following data vault configuration: %s",
 		jsonToSend)
 
-	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(http.MethodPost, c.edvServerURL, jsonToSend,
-		c.getHeaderFunc(reqOpt))
+	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, c.edvServerURL, jsonToSend,
+		c.getHeaderFunc("", reqOpt))
 	if err != nil {
 		return "", nil, err
 	}
 
 	if statusCode == http.StatusCreated {
+		c.setCapabilityFromResponse(httpHdr.Get("Location"), respBytes)
+
 		return httpHdr.Get("Location"), respBytes, nil
 	}
 
-	return "", nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return "", nil, newError(statusCode, respBytes)
 }
 
 // CreateDocument sends the EDV server a request to store the specified document.
 // The location of the newly created document is returned.
 func (c *Client) CreateDocument(vaultID string, document *models.EncryptedDocument, opts ...ReqOption) (string, error) {
+	return c.CreateDocumentWithContext(context.Background(), vaultID, document, opts...)
+}
+
+// CreateDocumentWithContext is like CreateDocument, but sends the request with the given context.
+func (c *Client) CreateDocumentWithContext(ctx context.Context, vaultID string, document *models.EncryptedDocument,
+	opts ...ReqOption) (string, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
 		o(reqOpt)
 	}
 
+	reqOpt.idempotencyKey = c.idempotencyKey(reqOpt)
+
 	jsonToSend, err := c.marshal(document)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal document: %w", err)
@@ -130,8 +192,9 @@ func (c *Client) CreateDocument(vaultID string, document *models.EncryptedDocume
 
 	logger.Debugf("Sending request to create the following document: %s", jsonToSend)
 
-	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(http.MethodPost,
-		c.edvServerURL+fmt.Sprintf("/%s/documents", url.PathEscape(vaultID)), jsonToSend, c.getHeaderFunc(reqOpt))
+	statusCode, httpHdr, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost,
+		c.edvServerURL+fmt.Sprintf("/%s/documents", url.PathEscape(vaultID)), jsonToSend,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return "", err
 	}
@@ -140,12 +203,17 @@ func (c *Client) CreateDocument(vaultID string, document *models.EncryptedDocume
 		return httpHdr.Get("Location"), nil
 	}
 
-	return "", fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return "", newError(statusCode, respBytes)
 }
 
 // ReadAllDocuments sends the EDV server a request to retrieve all the documents within the specified vault.
 func (c *Client) ReadAllDocuments(vaultID string, opts ...ReqOption) ([]models.EncryptedDocument, error) {
+	return c.ReadAllDocumentsWithContext(context.Background(), vaultID, opts...)
+}
+
+// ReadAllDocumentsWithContext is like ReadAllDocuments, but sends the request with the given context.
+func (c *Client) ReadAllDocumentsWithContext(ctx context.Context, vaultID string,
+	opts ...ReqOption) ([]models.EncryptedDocument, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -154,7 +222,8 @@ func (c *Client) ReadAllDocuments(vaultID string, opts ...ReqOption) ([]models.E
 
 	endpoint := fmt.Sprintf("%s/%s/documents", c.edvServerURL, url.PathEscape(vaultID))
 
-	statusCode, _, respBody, err := c.sendHTTPRequest(http.MethodGet, endpoint, nil, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBody, err := c.sendHTTPRequest(ctx, http.MethodGet, endpoint, nil,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return nil, fmt.Errorf(failSendRequestForAllDocuments, vaultID, err)
 	}
@@ -170,14 +239,19 @@ func (c *Client) ReadAllDocuments(vaultID string, opts ...ReqOption) ([]models.E
 
 		return documents, nil
 	default:
-		return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-			statusCode, respBody)
+		return nil, newError(statusCode, respBody)
 	}
 }
 
 // ReadDocument sends the EDV server a request to retrieve the specified document.
 // The requested document is returned.
 func (c *Client) ReadDocument(vaultID, docID string, opts ...ReqOption) (*models.EncryptedDocument, error) {
+	return c.ReadDocumentWithContext(context.Background(), vaultID, docID, opts...)
+}
+
+// ReadDocumentWithContext is like ReadDocument, but sends the request with the given context.
+func (c *Client) ReadDocumentWithContext(ctx context.Context, vaultID, docID string,
+	opts ...ReqOption) (*models.EncryptedDocument, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -186,7 +260,8 @@ func (c *Client) ReadDocument(vaultID, docID string, opts ...ReqOption) (*models
 
 	endpoint := fmt.Sprintf("%s/%s/documents/%s", c.edvServerURL, url.PathEscape(vaultID), url.PathEscape(docID))
 
-	statusCode, _, respBody, err := c.sendHTTPRequest(http.MethodGet, endpoint, nil, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBody, err := c.sendHTTPRequest(ctx, http.MethodGet, endpoint, nil,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return nil, fmt.Errorf(failSendRequestForDocument, vaultID, docID, err)
 	}
@@ -202,13 +277,18 @@ func (c *Client) ReadDocument(vaultID, docID string, opts ...ReqOption) (*models
 
 		return &document, nil
 	default:
-		return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-			statusCode, respBody)
+		return nil, newError(statusCode, respBody)
 	}
 }
 
 // QueryVault queries the given vault and returns the URLs of all documents that match the given query.
 func (c *Client) QueryVault(vaultID, name, value string, opts ...ReqOption) ([]string, error) {
+	return c.QueryVaultWithContext(context.Background(), vaultID, name, value, opts...)
+}
+
+// QueryVaultWithContext is like QueryVault, but sends the request with the given context.
+func (c *Client) QueryVaultWithContext(ctx context.Context, vaultID, name, value string,
+	opts ...ReqOption) ([]string, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -228,7 +308,8 @@ func (c *Client) QueryVault(vaultID, name, value string, opts ...ReqOption) ([]s
 
 	endpoint := fmt.Sprintf("%s/%s/query", c.edvServerURL, url.PathEscape(vaultID))
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, endpoint, jsonToSend,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return nil, err
 	}
@@ -244,13 +325,19 @@ func (c *Client) QueryVault(vaultID, name, value string, opts ...ReqOption) ([]s
 		return docURLs, nil
 	}
 
-	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return nil, newError(statusCode, respBytes)
 }
 
 // QueryVaultForFullDocuments queries the given vault and returns all documents that match the given query.
 // Requires the EDV server to support the ReturnFullDocumentsOnQuery extension.
 func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
+	opts ...ReqOption) ([]models.EncryptedDocument, error) {
+	return c.QueryVaultForFullDocumentsWithContext(context.Background(), vaultID, name, value, opts...)
+}
+
+// QueryVaultForFullDocumentsWithContext is like QueryVaultForFullDocuments, but sends the request with the given
+// context.
+func (c *Client) QueryVaultForFullDocumentsWithContext(ctx context.Context, vaultID, name, value string,
 	opts ...ReqOption) ([]models.EncryptedDocument, error) {
 	reqOpt := &ReqOpts{}
 
@@ -271,7 +358,8 @@ func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
 
 	endpoint := fmt.Sprintf("%s/%s/query", c.edvServerURL, url.PathEscape(vaultID))
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, endpoint, jsonToSend,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return nil, err
 	}
@@ -287,12 +375,17 @@ func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
 		return documents, nil
 	}
 
-	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return nil, newError(statusCode, respBytes)
 }
 
 // UpdateDocument sends the EDV server a request to update the specified document.
 func (c *Client) UpdateDocument(vaultID, docID string, document *models.EncryptedDocument, opts ...ReqOption) error {
+	return c.UpdateDocumentWithContext(context.Background(), vaultID, docID, document, opts...)
+}
+
+// UpdateDocumentWithContext is like UpdateDocument, but sends the request with the given context.
+func (c *Client) UpdateDocumentWithContext(ctx context.Context, vaultID, docID string,
+	document *models.EncryptedDocument, opts ...ReqOption) error {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -308,7 +401,8 @@ func (c *Client) UpdateDocument(vaultID, docID string, document *models.Encrypte
 
 	endpoint := c.edvServerURL + fmt.Sprintf("/%s/documents/%s", url.PathEscape(vaultID), url.PathEscape(docID))
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, endpoint, jsonToSend,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return err
 	}
@@ -317,12 +411,16 @@ func (c *Client) UpdateDocument(vaultID, docID string, document *models.Encrypte
 		return nil
 	}
 
-	return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return newError(statusCode, respBytes)
 }
 
 // DeleteDocument sends the EDV server a request to delete the specified document.
 func (c *Client) DeleteDocument(vaultID, docID string, opts ...ReqOption) error {
+	return c.DeleteDocumentWithContext(context.Background(), vaultID, docID, opts...)
+}
+
+// DeleteDocumentWithContext is like DeleteDocument, but sends the request with the given context.
+func (c *Client) DeleteDocumentWithContext(ctx context.Context, vaultID, docID string, opts ...ReqOption) error {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
@@ -331,8 +429,8 @@ func (c *Client) DeleteDocument(vaultID, docID string, opts ...ReqOption) error
 
 	endpoint := c.edvServerURL + fmt.Sprintf("/%s/documents/%s", url.PathEscape(vaultID), url.PathEscape(docID))
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(
-		http.MethodDelete, endpoint, nil, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx,
+		http.MethodDelete, endpoint, nil, c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return err
 	}
@@ -341,18 +439,25 @@ func (c *Client) DeleteDocument(vaultID, docID string, opts ...ReqOption) error
 		return nil
 	}
 
-	return fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return newError(statusCode, respBytes)
 }
 
 // Batch performs batch operations within a vault. Requires the EDV server to support the Batch extension.
 func (c *Client) Batch(vaultID string, batch *models.Batch, opts ...ReqOption) ([]string, error) {
+	return c.BatchWithContext(context.Background(), vaultID, batch, opts...)
+}
+
+// BatchWithContext is like Batch, but sends the request with the given context.
+func (c *Client) BatchWithContext(ctx context.Context, vaultID string, batch *models.Batch,
+	opts ...ReqOption) ([]string, error) {
 	reqOpt := &ReqOpts{}
 
 	for _, o := range opts {
 		o(reqOpt)
 	}
 
+	reqOpt.idempotencyKey = c.idempotencyKey(reqOpt)
+
 	jsonToSend, err := c.marshal(batch)
 	if err != nil {
 		return nil, err
@@ -360,7 +465,8 @@ func (c *Client) Batch(vaultID string, batch *models.Batch, opts ...ReqOption) (
 
 	endpoint := fmt.Sprintf("%s/%s/batch", c.edvServerURL, url.PathEscape(vaultID))
 
-	statusCode, _, respBytes, err := c.sendHTTPRequest(http.MethodPost, endpoint, jsonToSend, c.getHeaderFunc(reqOpt))
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, endpoint, jsonToSend,
+		c.getHeaderFunc(vaultID, reqOpt))
 	if err != nil {
 		return nil, err
 	}
@@ -376,13 +482,208 @@ func (c *Client) Batch(vaultID string, batch *models.Batch, opts ...ReqOption) (
 		return responses, nil
 	}
 
-	return nil, fmt.Errorf("the EDV server returned status code %d along with the following message: %s",
-		statusCode, respBytes)
+	return nil, newError(statusCode, respBytes)
+}
+
+// RevokeCapability revokes the capability with the given ID of a vault. Only the vault's controller may revoke
+// capabilities, so the request must be authorized as the controller, e.g. signed with WithHTTPSignature using one of
+// the controller's keys.
+func (c *Client) RevokeCapability(vaultID, capabilityID string, opts ...ReqOption) error {
+	return c.RevokeCapabilityWithContext(context.Background(), vaultID, capabilityID, opts...)
+}
+
+// RevokeCapabilityWithContext is like RevokeCapability, but sends the request with the given context.
+func (c *Client) RevokeCapabilityWithContext(ctx context.Context, vaultID, capabilityID string,
+	opts ...ReqOption) error {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/capabilities/%s/revoke", c.edvServerURL, url.PathEscape(vaultID),
+		url.PathEscape(capabilityID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodPost, endpoint, nil,
+		c.getHeaderFunc(vaultID, reqOpt))
+	if err != nil {
+		return fmt.Errorf("failure while sending request to revoke capability %s of vault %s: %w",
+			capabilityID, vaultID, err)
+	}
+
+	if statusCode == http.StatusOK {
+		return nil
+	}
+
+	return newError(statusCode, respBytes)
 }
 
-func (c *Client) sendHTTPRequest(method, endpoint string, body []byte,
+// ReadAuditLog returns the entries of a vault's audit log, in order. Like RevokeCapability, the request must be
+// authorized as the vault's controller. The EDV server must have an audit log enabled.
+func (c *Client) ReadAuditLog(vaultID string, opts ...ReqOption) ([]*audit.Entry, error) {
+	return c.ReadAuditLogWithContext(context.Background(), vaultID, opts...)
+}
+
+// ReadAuditLogWithContext is like ReadAuditLog, but sends the request with the given context.
+func (c *Client) ReadAuditLogWithContext(ctx context.Context, vaultID string,
+	opts ...ReqOption) ([]*audit.Entry, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/audit", c.edvServerURL, url.PathEscape(vaultID))
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodGet, endpoint, nil,
+		c.getHeaderFunc(vaultID, reqOpt))
+	if err != nil {
+		return nil, fmt.Errorf("failure while sending request to read the audit log of vault %s: %w", vaultID, err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, newError(statusCode, respBytes)
+	}
+
+	var entries []*audit.Entry
+
+	err = json.Unmarshal(respBytes, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal audit log entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// GetConfiguration returns the configuration of the EDV server from its /.well-known/edv-configuration endpoint,
+// which is served next to the /encrypted-data-vaults endpoints that the client was created with.
+func (c *Client) GetConfiguration(opts ...ReqOption) (*models.ServerConfiguration, error) {
+	return c.GetConfigurationWithContext(context.Background(), opts...)
+}
+
+// GetConfigurationWithContext is like GetConfiguration, but sends the request with the given context.
+func (c *Client) GetConfigurationWithContext(ctx context.Context,
+	opts ...ReqOption) (*models.ServerConfiguration, error) {
+	reqOpt := &ReqOpts{}
+
+	for _, o := range opts {
+		o(reqOpt)
+	}
+
+	statusCode, _, respBytes, err := c.sendHTTPRequest(ctx, http.MethodGet, c.configurationURL(), nil,
+		c.getHeaderFunc("", reqOpt))
+	if err != nil {
+		return nil, fmt.Errorf("failure while sending request to get server configuration: %w", err)
+	}
+
+	if statusCode != http.StatusOK {
+		return nil, newError(statusCode, respBytes)
+	}
+
+	var config models.ServerConfiguration
+
+	err = json.Unmarshal(respBytes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal server configuration: %w", err)
+	}
+
+	return &config, nil
+}
+
+// GetExtensions returns the names of the extensions that are enabled on the EDV server, e.g. models.BatchExtension,
+// from its configuration.
+func (c *Client) GetExtensions(opts ...ReqOption) ([]string, error) {
+	return c.GetExtensionsWithContext(context.Background(), opts...)
+}
+
+// GetExtensionsWithContext is like GetExtensions, but sends the request with the given context.
+func (c *Client) GetExtensionsWithContext(ctx context.Context, opts ...ReqOption) ([]string, error) {
+	config, err := c.GetConfigurationWithContext(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := config.Extensions
+	if extensions == nil {
+		extensions = []string{}
+	}
+
+	c.extensionsMutex.Lock()
+	c.extensions = extensions
+	c.extensionsMutex.Unlock()
+
+	return extensions, nil
+}
+
+// configurationURL returns the URL of the configuration endpoint, at the root of the EDV server.
+func (c *Client) configurationURL() string {
+	return strings.TrimSuffix(strings.TrimSuffix(c.edvServerURL, "/"), edvEndpointPathRoot) + configurationEndpoint
+}
+
+// supportsExtension returns true if the extension is enabled on the EDV server. The extensions are read from the
+// server once. Servers that don't list their extensions are assumed not to have any.
+func (c *Client) supportsExtension(ctx context.Context, extension string, reqOpt []ReqOption) bool {
+	c.extensionsMutex.Lock()
+	extensions := c.extensions
+	c.extensionsMutex.Unlock()
+
+	if extensions == nil {
+		var err error
+
+		extensions, err = c.GetExtensionsWithContext(ctx, reqOpt...)
+		if err != nil {
+			logger.Debugf("Failed to get the extensions of the EDV server: %s", err)
+
+			if !errors.Is(err, ErrNotFound) {
+				return false
+			}
+
+			// Servers from before the configuration endpoint don't have it.
+			c.extensionsMutex.Lock()
+			c.extensions = []string{}
+			c.extensionsMutex.Unlock()
+		}
+	}
+
+	for _, e := range extensions {
+		if e == extension {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Client) sendHTTPRequest(ctx context.Context, method, endpoint string, body []byte,
+	addHeadersFunc addHeaders) (int, http.Header, []byte, error) {
+	if c.retryPolicy == nil {
+		return c.sendHTTPRequestOnce(ctx, method, endpoint, body, addHeadersFunc)
+	}
+
+	for attempt := 1; ; attempt++ {
+		statusCode, httpHdr, respBytes, err := c.sendHTTPRequestOnce(ctx, method, endpoint, body, addHeadersFunc)
+		if attempt == c.retryPolicy.MaxAttempts || !c.retryPolicy.shouldRetry(ctx, err, statusCode) {
+			return statusCode, httpHdr, respBytes, err
+		}
+
+		backoff := c.retryPolicy.backoff(attempt)
+
+		if err != nil {
+			logger.Debugf("%s request to %s failed: %s. Retrying in %s", method, endpoint, err, backoff)
+		} else {
+			logger.Debugf("%s request to %s returned status code %d. Retrying in %s", method, endpoint,
+				statusCode, backoff)
+		}
+
+		if errWait := wait(ctx, backoff); errWait != nil {
+			return -1, nil, nil, errWait
+		}
+	}
+}
+
+func (c *Client) sendHTTPRequestOnce(ctx context.Context, method, endpoint string, body []byte,
 	addHeadersFunc addHeaders) (int, http.Header, []byte, error) {
-	req, errReq := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
+	req, errReq := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewBuffer(body))
 	if errReq != nil {
 		return -1, nil, nil, errReq
 	}
@@ -402,6 +703,8 @@ func (c *Client) sendHTTPRequest(method, endpoint string, body []byte,
 		req.Header.Set("Content-Type", "application/json")
 	}
 
+	c.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
 	resp, err := c.httpClient.Do(req) //nolint: bodyclose
 	if err != nil {
 		return -1, nil, nil, err
@@ -420,13 +723,23 @@ func (c *Client) sendHTTPRequest(method, endpoint string, body []byte,
 	return resp.StatusCode, resp.Header, respBytes, nil
 }
 
-func (c *Client) getHeaderFunc(reqOpt *ReqOpts) addHeaders {
+// getHeaderFunc returns the function that adds the headers of a request to the given vault ("" for requests that
+// don't target a vault).
+func (c *Client) getHeaderFunc(vaultID string, reqOpt *ReqOpts) addHeaders {
 	headersFunc := c.headersFunc
 
 	if reqOpt.addHeadersFunc != nil {
 		headersFunc = reqOpt.addHeadersFunc
 	}
 
+	if reqOpt.idempotencyKey != "" {
+		headersFunc = withIdempotencyKey(reqOpt.idempotencyKey, headersFunc)
+	}
+
+	if signature := c.signature(vaultID, reqOpt); signature != nil {
+		headersFunc = signature.addHeaders(headersFunc)
+	}
+
 	return headersFunc
 }
 
@@ -14,12 +14,15 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
 	"github.com/trustbloc/edv/pkg/internal/common/support"
@@ -378,6 +381,9 @@ func TestClient_ReadDocument_VaultNotFound(t *testing.T) {
 	require.Nil(t, document)
 	require.Contains(t, err.Error(), messages.ErrVaultNotFound.Error())
 	require.Contains(t, err.Error(), "status code 404")
+	require.True(t, errors.Is(err, ErrVaultNotFound))
+	require.True(t, errors.Is(err, ErrNotFound))
+	require.False(t, errors.Is(err, ErrDocumentNotFound))
 
 	err = srv.Shutdown(context.Background())
 	require.NoError(t, err)
@@ -401,6 +407,13 @@ func TestClient_ReadDocument_NotFound(t *testing.T) {
 	document, err := client.ReadDocument(vaultID, testDocumentID)
 	require.Nil(t, document)
 	require.Contains(t, err.Error(), messages.ErrDocumentNotFound.Error())
+	require.True(t, errors.Is(err, ErrDocumentNotFound))
+
+	var edvErr *Error
+
+	require.True(t, errors.As(err, &edvErr))
+	require.Equal(t, http.StatusNotFound, edvErr.StatusCode)
+	require.Equal(t, messages.CodeDocumentNotFound, edvErr.Code)
 
 	err = srv.Shutdown(context.Background())
 	require.NoError(t, err)
@@ -559,6 +572,79 @@ func TestClient_DeleteDocument_ServerUnreachable(t *testing.T) {
 	require.True(t, testPassed)
 }
 
+func TestClient_RevokeCapability(t *testing.T) {
+	var method, requestURI string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		method, requestURI = req.Method, req.RequestURI
+
+		if strings.Contains(requestURI, "unknown") {
+			rw.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		rw.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL + "/encrypted-data-vaults")
+
+	t.Run("success", func(t *testing.T) {
+		require.NoError(t, client.RevokeCapability("vault1", "urn:uuid:zcap/1"))
+		require.Equal(t, http.MethodPost, method)
+		require.Equal(t, "/encrypted-data-vaults/vault1/capabilities/urn:uuid:zcap%2F1/revoke", requestURI)
+	})
+
+	t.Run("capability not found", func(t *testing.T) {
+		err := client.RevokeCapability("vault1", "unknown")
+		require.True(t, errors.Is(err, ErrNotFound), err)
+	})
+
+	t.Run("server unreachable", func(t *testing.T) {
+		err := New("http://"+randomURL()).RevokeCapability("vault1", "zcap1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failure while sending request to revoke capability zcap1 of vault vault1")
+	})
+}
+
+func TestClient_ReadAuditLog(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/encrypted-data-vaults/vault1/audit":
+			_, err := rw.Write([]byte(`[{"sequence":1,"action":"POST /encrypted-data-vaults","vaultID":"vault1"}]`))
+			require.NoError(t, err)
+		case "/encrypted-data-vaults/invalid/audit":
+			_, err := rw.Write([]byte(`{`))
+			require.NoError(t, err)
+		default:
+			rw.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL + "/encrypted-data-vaults")
+
+	t.Run("success", func(t *testing.T) {
+		entries, err := client.ReadAuditLog("vault1")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "vault1", entries[0].VaultID)
+	})
+
+	t.Run("not the controller", func(t *testing.T) {
+		entries, err := client.ReadAuditLog("vault2")
+		require.True(t, errors.Is(err, ErrUnauthorized), err)
+		require.Nil(t, entries)
+	})
+
+	t.Run("invalid response", func(t *testing.T) {
+		_, err := client.ReadAuditLog("invalid")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unmarshal audit log entries")
+	})
+}
+
 func TestClient_QueryVault(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		srvAddr := randomURL()
@@ -855,6 +941,113 @@ func TestClient_Batch(t *testing.T) {
 	})
 }
 
+func TestClient_WithContext(t *testing.T) {
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-release:
+		case <-req.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client := New(srv.URL + "/encrypted-data-vaults")
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := client.CreateDataVaultWithContext(ctx, &models.DataVaultConfiguration{})
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.CreateDocumentWithContext(ctx, "vault1", &models.EncryptedDocument{})
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.ReadAllDocumentsWithContext(ctx, "vault1")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.ReadDocumentWithContext(ctx, "vault1", "doc1")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.QueryVaultWithContext(ctx, "vault1", "name", "value")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.QueryVaultForFullDocumentsWithContext(ctx, "vault1", "name", "value")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		err = client.UpdateDocumentWithContext(ctx, "vault1", "doc1", &models.EncryptedDocument{})
+		require.True(t, errors.Is(err, context.Canceled))
+
+		err = client.DeleteDocumentWithContext(ctx, "vault1", "doc1")
+		require.True(t, errors.Is(err, context.Canceled))
+
+		_, err = client.BatchWithContext(ctx, "vault1", &models.Batch{})
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("context deadline exceeded while waiting for the server", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.ReadDocumentWithContext(ctx, "vault1", "doc1")
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("client timeout", func(t *testing.T) {
+		client := New(srv.URL+"/encrypted-data-vaults", WithTimeout(50*time.Millisecond))
+
+		_, err := client.ReadDocument("vault1", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "Client.Timeout exceeded")
+	})
+}
+
+func TestClient_TraceContext(t *testing.T) {
+	headers := make(chan http.Header, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		headers <- req.Header
+
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+
+	t.Run("W3C trace context by default", func(t *testing.T) {
+		_, err := New(srv.URL+"/encrypted-data-vaults").ReadDocumentWithContext(ctx, "vault1", "doc1")
+		require.Error(t, err)
+
+		require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", (<-headers).Get("traceparent"))
+	})
+
+	t.Run("without trace context", func(t *testing.T) {
+		_, err := New(srv.URL+"/encrypted-data-vaults").ReadDocument("vault1", "doc1")
+		require.Error(t, err)
+
+		require.Empty(t, (<-headers).Get("traceparent"))
+	})
+
+	t.Run("custom propagator", func(t *testing.T) {
+		client := New(srv.URL+"/encrypted-data-vaults", WithPropagator(propagation.NewCompositeTextMapPropagator()))
+
+		_, err := client.ReadDocumentWithContext(ctx, "vault1", "doc1")
+		require.Error(t, err)
+
+		require.Empty(t, (<-headers).Get("traceparent"))
+	})
+}
+
 func getTestValidDataVaultConfiguration() models.DataVaultConfiguration {
 	testDataVaultConfiguration := models.DataVaultConfiguration{
 		Sequence:   0,
@@ -0,0 +1,337 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package encrypted provides an EDV client that encrypts structured documents before they're sent to an EDV server
+// and decrypts them after they're read, so that the server only ever sees encrypted documents and blinded indexes.
+package encrypted
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/jose"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// EDVClient sends encrypted documents to an EDV server. *client.Client implements this interface.
+type EDVClient interface {
+	CreateDocumentWithContext(ctx context.Context, vaultID string, document *models.EncryptedDocument,
+		opts ...client.ReqOption) (string, error)
+	ReadAllDocumentsWithContext(ctx context.Context, vaultID string,
+		opts ...client.ReqOption) ([]models.EncryptedDocument, error)
+	ReadDocumentWithContext(ctx context.Context, vaultID, docID string,
+		opts ...client.ReqOption) (*models.EncryptedDocument, error)
+	QueryVaultWithContext(ctx context.Context, vaultID, name, value string, opts ...client.ReqOption) ([]string, error)
+	QueryVaultForFullDocumentsWithContext(ctx context.Context, vaultID, name, value string,
+		opts ...client.ReqOption) ([]models.EncryptedDocument, error)
+	UpdateDocumentWithContext(ctx context.Context, vaultID, docID string, document *models.EncryptedDocument,
+		opts ...client.ReqOption) error
+}
+
+// Key is a key kept in an aries KMS.
+type Key struct {
+	// KMSKeyID is the ID of the key in the KMS.
+	KMSKeyID string
+	// Reference identifies the key in data vault configurations and indexed attribute collections.
+	// The EDV server requires the ID of a KEK reference to be a URI.
+	Reference models.IDTypePair
+}
+
+// Client encrypts structured documents into JWEs with a key encryption key (KEK) and blinds their indexed
+// attributes with an HMAC key.
+type Client struct {
+	edvClient  EDVClient
+	keyManager kms.KeyManager
+	crypto     cryptoapi.Crypto
+	kekPubKey  *cryptoapi.PublicKey
+	kek        models.IDTypePair
+	hmac       models.IDTypePair
+	hmacKH     interface{}
+}
+
+// New returns a new encrypting client that sends documents to the EDV server with edvClient. The KEK must be
+// an ECDH P-256 key (kms.ECDH256KWAES256GCMType) and the HMAC key an HMAC-SHA256 key (kms.HMACSHA256Tag256Type).
+// The KEK and HMAC of the data vault configurations of the vaults that the client is used with are expected to be
+// the references of these keys, as in the configurations returned by DataVaultConfiguration.
+func New(edvClient EDVClient, keyManager kms.KeyManager, crypto cryptoapi.Crypto, kek, hmac Key) (*Client, error) {
+	kekPubKeyBytes, err := keyManager.ExportPubKeyBytes(kek.KMSKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export KEK %s: %w", kek.KMSKeyID, err)
+	}
+
+	kekPubKey := &cryptoapi.PublicKey{}
+
+	err = json.Unmarshal(kekPubKeyBytes, kekPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal KEK %s: %w", kek.KMSKeyID, err)
+	}
+
+	hmacKH, err := keyManager.Get(hmac.KMSKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HMAC key %s: %w", hmac.KMSKeyID, err)
+	}
+
+	return &Client{
+		edvClient:  edvClient,
+		keyManager: keyManager,
+		crypto:     crypto,
+		kekPubKey:  kekPubKey,
+		kek:        kek.Reference,
+		hmac:       hmac.Reference,
+		hmacKH:     hmacKH,
+	}, nil
+}
+
+// DataVaultConfiguration returns the configuration of a data vault with the given controller and reference ID
+// whose KEK and HMAC are the references of the client's keys. It can be passed to client.Client.CreateDataVault
+// to create a vault that the client can be used with.
+func (c *Client) DataVaultConfiguration(controller, referenceID string) *models.DataVaultConfiguration {
+	return &models.DataVaultConfiguration{
+		Controller:  controller,
+		ReferenceID: referenceID,
+		KEK:         c.kek,
+		HMAC:        c.hmac,
+	}
+}
+
+// CreateDocument encrypts the document, blinds the given plaintext attributes and stores the document in the vault.
+// A new document ID is generated if the document doesn't have one. The document isn't modified: the generated ID
+// is the last path segment of the location of the new document, which is returned.
+func (c *Client) CreateDocument(vaultID string, document *models.StructuredDocument,
+	attributes []models.IndexedAttribute, opts ...client.ReqOption) (string, error) {
+	return c.CreateDocumentWithContext(context.Background(), vaultID, document, attributes, opts...)
+}
+
+// CreateDocumentWithContext is like CreateDocument, but sends the request with the given context.
+func (c *Client) CreateDocumentWithContext(ctx context.Context, vaultID string, document *models.StructuredDocument,
+	attributes []models.IndexedAttribute, opts ...client.ReqOption) (string, error) {
+	if document.ID == "" {
+		id, err := edvutils.GenerateEDVCompatibleID()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate document ID: %w", err)
+		}
+
+		withID := *document
+		withID.ID = id
+		document = &withID
+	}
+
+	encryptedDocument, err := c.EncryptDocument(document, attributes)
+	if err != nil {
+		return "", err
+	}
+
+	return c.edvClient.CreateDocumentWithContext(ctx, vaultID, encryptedDocument, opts...)
+}
+
+// ReadDocument reads the document from the vault and decrypts it.
+func (c *Client) ReadDocument(vaultID, docID string, opts ...client.ReqOption) (*models.StructuredDocument, error) {
+	return c.ReadDocumentWithContext(context.Background(), vaultID, docID, opts...)
+}
+
+// ReadDocumentWithContext is like ReadDocument, but sends the request with the given context.
+func (c *Client) ReadDocumentWithContext(ctx context.Context, vaultID, docID string,
+	opts ...client.ReqOption) (*models.StructuredDocument, error) {
+	encryptedDocument, err := c.edvClient.ReadDocumentWithContext(ctx, vaultID, docID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.DecryptDocument(encryptedDocument)
+}
+
+// ReadAllDocuments reads all the documents from the vault and decrypts them.
+func (c *Client) ReadAllDocuments(vaultID string, opts ...client.ReqOption) ([]models.StructuredDocument, error) {
+	return c.ReadAllDocumentsWithContext(context.Background(), vaultID, opts...)
+}
+
+// ReadAllDocumentsWithContext is like ReadAllDocuments, but sends the request with the given context.
+func (c *Client) ReadAllDocumentsWithContext(ctx context.Context, vaultID string,
+	opts ...client.ReqOption) ([]models.StructuredDocument, error) {
+	encryptedDocuments, err := c.edvClient.ReadAllDocumentsWithContext(ctx, vaultID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decryptDocuments(encryptedDocuments)
+}
+
+// UpdateDocument encrypts the document, blinds the given plaintext attributes and replaces the document with
+// the same ID in the vault. The attributes replace those of the stored document.
+func (c *Client) UpdateDocument(vaultID string, document *models.StructuredDocument,
+	attributes []models.IndexedAttribute, opts ...client.ReqOption) error {
+	return c.UpdateDocumentWithContext(context.Background(), vaultID, document, attributes, opts...)
+}
+
+// UpdateDocumentWithContext is like UpdateDocument, but sends the request with the given context.
+func (c *Client) UpdateDocumentWithContext(ctx context.Context, vaultID string, document *models.StructuredDocument,
+	attributes []models.IndexedAttribute, opts ...client.ReqOption) error {
+	encryptedDocument, err := c.EncryptDocument(document, attributes)
+	if err != nil {
+		return err
+	}
+
+	return c.edvClient.UpdateDocumentWithContext(ctx, vaultID, document.ID, encryptedDocument, opts...)
+}
+
+// QueryVault blinds the plaintext attribute name and value and returns the URLs of all documents in the vault
+// that have the attribute.
+func (c *Client) QueryVault(vaultID, name, value string, opts ...client.ReqOption) ([]string, error) {
+	return c.QueryVaultWithContext(context.Background(), vaultID, name, value, opts...)
+}
+
+// QueryVaultWithContext is like QueryVault, but sends the request with the given context.
+func (c *Client) QueryVaultWithContext(ctx context.Context, vaultID, name, value string,
+	opts ...client.ReqOption) ([]string, error) {
+	blindedName, blindedValue, err := c.blindAttribute(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.edvClient.QueryVaultWithContext(ctx, vaultID, blindedName, blindedValue, opts...)
+}
+
+// QueryVaultForFullDocuments blinds the plaintext attribute name and value and returns all the decrypted documents
+// in the vault that have the attribute. Requires the EDV server to support the ReturnFullDocumentsOnQuery extension.
+func (c *Client) QueryVaultForFullDocuments(vaultID, name, value string,
+	opts ...client.ReqOption) ([]models.StructuredDocument, error) {
+	return c.QueryVaultForFullDocumentsWithContext(context.Background(), vaultID, name, value, opts...)
+}
+
+// QueryVaultForFullDocumentsWithContext is like QueryVaultForFullDocuments, but sends the request with the given
+// context.
+func (c *Client) QueryVaultForFullDocumentsWithContext(ctx context.Context, vaultID, name, value string,
+	opts ...client.ReqOption) ([]models.StructuredDocument, error) {
+	blindedName, blindedValue, err := c.blindAttribute(name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedDocuments, err := c.edvClient.QueryVaultForFullDocumentsWithContext(ctx, vaultID, blindedName,
+		blindedValue, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.decryptDocuments(encryptedDocuments)
+}
+
+// EncryptDocument encrypts the document into a JWE for the KEK and indexes it by the given plaintext attributes,
+// whose names and values are blinded with the HMAC key. It can be used to build the documents of batch operations.
+func (c *Client) EncryptDocument(document *models.StructuredDocument,
+	attributes []models.IndexedAttribute) (*models.EncryptedDocument, error) {
+	documentBytes, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal document: %w", err)
+	}
+
+	encrypter, err := jose.NewJWEEncrypt(jose.A256GCM, jose.DIDCommEncType, "", nil,
+		[]*cryptoapi.PublicKey{c.kekPubKey}, c.crypto)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWE encrypter: %w", err)
+	}
+
+	jwe, err := encrypter.Encrypt(documentBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt document: %w", err)
+	}
+
+	serializedJWE, err := jwe.FullSerialize(json.Marshal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize JWE: %w", err)
+	}
+
+	encryptedDocument := &models.EncryptedDocument{ID: document.ID, JWE: []byte(serializedJWE)}
+
+	if len(attributes) == 0 {
+		return encryptedDocument, nil
+	}
+
+	indexedAttributes := make([]models.IndexedAttribute, len(attributes))
+
+	for i, attribute := range attributes {
+		blindedName, blindedValue, err := c.blindAttribute(attribute.Name, attribute.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		indexedAttributes[i] = models.IndexedAttribute{Name: blindedName, Value: blindedValue, Unique: attribute.Unique}
+	}
+
+	encryptedDocument.IndexedAttributeCollections = []models.IndexedAttributeCollection{
+		{HMAC: c.hmac, IndexedAttributes: indexedAttributes},
+	}
+
+	return encryptedDocument, nil
+}
+
+// DecryptDocument decrypts the JWE of the encrypted document with the KEK.
+func (c *Client) DecryptDocument(encryptedDocument *models.EncryptedDocument) (*models.StructuredDocument, error) {
+	jwe, err := jose.Deserialize(string(encryptedDocument.JWE))
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize JWE of document %s: %w", encryptedDocument.ID, err)
+	}
+
+	documentBytes, err := jose.NewJWEDecrypt(nil, c.crypto, c.keyManager).Decrypt(jwe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt document %s: %w", encryptedDocument.ID, err)
+	}
+
+	document := &models.StructuredDocument{}
+
+	err = json.Unmarshal(documentBytes, document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal decrypted document %s: %w", encryptedDocument.ID, err)
+	}
+
+	return document, nil
+}
+
+func (c *Client) decryptDocuments(encryptedDocuments []models.EncryptedDocument) ([]models.StructuredDocument, error) {
+	documents := make([]models.StructuredDocument, len(encryptedDocuments))
+
+	for i := range encryptedDocuments {
+		document, err := c.DecryptDocument(&encryptedDocuments[i])
+		if err != nil {
+			return nil, err
+		}
+
+		documents[i] = *document
+	}
+
+	return documents, nil
+}
+
+// blindAttribute returns the base64url-encoded HMACs of the attribute's name and value.
+func (c *Client) blindAttribute(name, value string) (string, string, error) {
+	blindedName, err := c.blind(name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to blind attribute name: %w", err)
+	}
+
+	blindedValue, err := c.blind(value)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to blind value of attribute %s: %w", name, err)
+	}
+
+	return blindedName, blindedValue, nil
+}
+
+func (c *Client) blind(data string) (string, error) {
+	mac, err := c.crypto.ComputeMAC([]byte(data), c.hmacKH)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(mac), nil
+}
@@ -0,0 +1,397 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package encrypted
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+const (
+	kekType  = "EcdhKeyAgreementKey2019"
+	hmacType = "Sha256HmacKey2019"
+)
+
+func TestNew(t *testing.T) {
+	keyManager, kek, hmac := newTestKeys(t)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		c, err := New(client.New("http://localhost"), keyManager, crypto, kek, hmac)
+		require.NoError(t, err)
+		require.NotNil(t, c)
+	})
+
+	t.Run("unknown KEK", func(t *testing.T) {
+		c, err := New(client.New("http://localhost"), keyManager, crypto, Key{KMSKeyID: "unknown"}, hmac)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to export KEK unknown")
+		require.Nil(t, c)
+	})
+
+	t.Run("unknown HMAC key", func(t *testing.T) {
+		c, err := New(client.New("http://localhost"), keyManager, crypto, kek, Key{KMSKeyID: "unknown"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get HMAC key unknown")
+		require.Nil(t, c)
+	})
+}
+
+func TestClient(t *testing.T) {
+	edvClient := startEDVServer(t)
+	keyManager, kek, hmac := newTestKeys(t)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	c, err := New(edvClient, keyManager, crypto, kek, hmac)
+	require.NoError(t, err)
+
+	config := c.DataVaultConfiguration("did:example:123", "refID")
+	require.Equal(t, &models.DataVaultConfiguration{
+		Controller:  "did:example:123",
+		ReferenceID: "refID",
+		KEK:         kek.Reference,
+		HMAC:        hmac.Reference,
+	}, config)
+
+	vaultLocation, _, err := edvClient.CreateDataVault(config)
+	require.NoError(t, err)
+
+	vaultID := vaultLocation[strings.LastIndex(vaultLocation, "/")+1:]
+
+	newDocument := &models.StructuredDocument{Content: map[string]interface{}{"message": "hello"}}
+
+	docLocation, err := c.CreateDocument(vaultID, newDocument, []models.IndexedAttribute{
+		{Name: "email", Value: "alice@example.com", Unique: true},
+	})
+	require.NoError(t, err)
+	require.Empty(t, newDocument.ID, "the caller's document must not be modified")
+
+	document := &models.StructuredDocument{ID: docLocation[strings.LastIndex(docLocation, "/")+1:]}
+	require.NoError(t, edvutils.CheckIfBase58Encoded128BitValue(document.ID))
+
+	t.Run("stored document is encrypted and blinded", func(t *testing.T) {
+		encryptedDocument, err := edvClient.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.NoError(t, edvutils.ValidateJWE(encryptedDocument.JWE))
+		require.NotContains(t, string(encryptedDocument.JWE), "hello")
+
+		require.Len(t, encryptedDocument.IndexedAttributeCollections, 1)
+		require.Equal(t, hmac.Reference, encryptedDocument.IndexedAttributeCollections[0].HMAC)
+
+		attributes := encryptedDocument.IndexedAttributeCollections[0].IndexedAttributes
+		require.Len(t, attributes, 1)
+		require.NotEqual(t, "email", attributes[0].Name)
+		require.NotEqual(t, "alice@example.com", attributes[0].Value)
+		require.True(t, attributes[0].Unique)
+	})
+
+	t.Run("read document", func(t *testing.T) {
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, document.ID, readDocument.ID)
+		require.Equal(t, "hello", readDocument.Content["message"])
+	})
+
+	t.Run("update document", func(t *testing.T) {
+		updatedDocument := &models.StructuredDocument{
+			ID:      document.ID,
+			Content: map[string]interface{}{"message": "goodbye"},
+		}
+
+		err := c.UpdateDocument(vaultID, updatedDocument, []models.IndexedAttribute{
+			{Name: "email", Value: "bob@example.com"},
+		})
+		require.NoError(t, err)
+
+		readDocument, err := c.ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, "goodbye", readDocument.Content["message"])
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := c.ReadDocumentWithContext(ctx, vaultID, document.ID)
+		require.True(t, errors.Is(err, context.Canceled))
+	})
+
+	t.Run("read all documents", func(t *testing.T) {
+		_, err := c.CreateDocument(vaultID, &models.StructuredDocument{
+			Content: map[string]interface{}{"message": "second"},
+		}, nil)
+		require.NoError(t, err)
+
+		documents, err := c.ReadAllDocuments(vaultID)
+		require.NoError(t, err)
+		require.Len(t, documents, 2)
+	})
+}
+
+func TestClient_Query(t *testing.T) {
+	keyManager, kek, hmac := newTestKeys(t)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	edvClient := &mockEDVClient{}
+
+	c, err := New(edvClient, keyManager, crypto, kek, hmac)
+	require.NoError(t, err)
+
+	_, err = c.CreateDocument("vault1", &models.StructuredDocument{
+		ID:      "doc1",
+		Content: map[string]interface{}{"message": "hello"},
+	}, []models.IndexedAttribute{{Name: "email", Value: "alice@example.com"}})
+	require.NoError(t, err)
+
+	t.Run("query by plaintext attribute", func(t *testing.T) {
+		docURLs, err := c.QueryVault("vault1", "email", "alice@example.com")
+		require.NoError(t, err)
+		require.Equal(t, []string{"vault1/documents/doc1"}, docURLs)
+
+		docURLs, err = c.QueryVault("vault1", "email", "bob@example.com")
+		require.NoError(t, err)
+		require.Empty(t, docURLs)
+	})
+
+	t.Run("query for full documents", func(t *testing.T) {
+		documents, err := c.QueryVaultForFullDocuments("vault1", "email", "alice@example.com")
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+		require.Equal(t, "hello", documents[0].Content["message"])
+	})
+
+	t.Run("documents of another client can't be decrypted", func(t *testing.T) {
+		otherKeyManager, otherKEK, otherHMAC := newTestKeys(t)
+
+		other, err := New(edvClient, otherKeyManager, crypto, otherKEK, otherHMAC)
+		require.NoError(t, err)
+
+		docURLs, err := other.QueryVault("vault1", "email", "alice@example.com")
+		require.NoError(t, err)
+		require.Empty(t, docURLs)
+
+		_, err = other.ReadDocument("vault1", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt document doc1")
+	})
+}
+
+func TestClient_Errors(t *testing.T) {
+	keyManager, kek, hmac := newTestKeys(t)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	errTest := errors.New("test error")
+
+	c, err := New(&mockEDVClient{err: errTest}, keyManager, crypto, kek, hmac)
+	require.NoError(t, err)
+
+	t.Run("EDV client errors are returned", func(t *testing.T) {
+		_, err := c.CreateDocument("vault1", &models.StructuredDocument{}, nil)
+		require.True(t, errors.Is(err, errTest))
+
+		_, err = c.ReadDocument("vault1", "doc1")
+		require.True(t, errors.Is(err, errTest))
+
+		_, err = c.ReadAllDocuments("vault1")
+		require.True(t, errors.Is(err, errTest))
+
+		err = c.UpdateDocument("vault1", &models.StructuredDocument{ID: "doc1"}, nil)
+		require.True(t, errors.Is(err, errTest))
+
+		_, err = c.QueryVault("vault1", "name", "value")
+		require.True(t, errors.Is(err, errTest))
+
+		_, err = c.QueryVaultForFullDocuments("vault1", "name", "value")
+		require.True(t, errors.Is(err, errTest))
+	})
+
+	t.Run("invalid JWE", func(t *testing.T) {
+		document, err := c.DecryptDocument(&models.EncryptedDocument{ID: "doc1", JWE: []byte("{}")})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "doc1")
+		require.Nil(t, document)
+	})
+
+	t.Run("blinding fails", func(t *testing.T) {
+		c, err := New(&mockEDVClient{}, keyManager, crypto, kek, hmac)
+		require.NoError(t, err)
+
+		c.hmacKH = "not a key handle"
+
+		_, err = c.QueryVault("vault1", "name", "value")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to blind attribute name")
+
+		_, err = c.EncryptDocument(&models.StructuredDocument{ID: "doc1"},
+			[]models.IndexedAttribute{{Name: "name", Value: "value"}})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to blind attribute name")
+	})
+}
+
+func newTestKeys(t *testing.T) (kms.KeyManager, Key, Key) {
+	t.Helper()
+
+	keyManager, err := localkms.New("local-lock://test/master/key/",
+		&kmsProvider{storageProvider: ariesmemstorage.NewProvider(), secretLock: &noop.NoLock{}})
+	require.NoError(t, err)
+
+	kekID, _, err := keyManager.Create(kms.ECDH256KWAES256GCMType)
+	require.NoError(t, err)
+
+	hmacID, _, err := keyManager.Create(kms.HMACSHA256Tag256Type)
+	require.NoError(t, err)
+
+	return keyManager,
+		Key{KMSKeyID: kekID, Reference: models.IDTypePair{ID: "https://example.com/kms/" + kekID, Type: kekType}},
+		Key{KMSKeyID: hmacID, Reference: models.IDTypePair{ID: "https://example.com/kms/" + hmacID, Type: hmacType}}
+}
+
+func startEDVServer(t *testing.T) *client.Client {
+	t.Helper()
+
+	memProv := memedvprovider.NewProvider()
+	require.NoError(t, memProv.CreateStore("data_vault_configurations"))
+
+	edvService, err := restapi.New(&operation.Config{
+		Provider:          memProv,
+		EnabledExtensions: &operation.EnabledExtensions{ReadAllDocumentsEndpoint: true},
+	})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range edvService.GetOperations() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+
+	return client.New(srv.URL + "/encrypted-data-vaults")
+}
+
+type kmsProvider struct {
+	storageProvider ariesstorage.Provider
+	secretLock      secretlock.Service
+}
+
+func (k *kmsProvider) StorageProvider() ariesstorage.Provider {
+	return k.storageProvider
+}
+
+func (k *kmsProvider) SecretLock() secretlock.Service {
+	return k.secretLock
+}
+
+// mockEDVClient keeps documents in memory and matches queries against their indexed attributes like an EDV server.
+type mockEDVClient struct {
+	documents []models.EncryptedDocument
+	err       error
+}
+
+func (m *mockEDVClient) CreateDocumentWithContext(_ context.Context, vaultID string, document *models.EncryptedDocument,
+	_ ...client.ReqOption) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+
+	m.documents = append(m.documents, *document)
+
+	return vaultID + "/documents/" + document.ID, nil
+}
+
+func (m *mockEDVClient) ReadAllDocumentsWithContext(context.Context, string,
+	...client.ReqOption) ([]models.EncryptedDocument, error) {
+	return m.documents, m.err
+}
+
+func (m *mockEDVClient) ReadDocumentWithContext(_ context.Context, _, docID string,
+	_ ...client.ReqOption) (*models.EncryptedDocument, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	for i := range m.documents {
+		if m.documents[i].ID == docID {
+			return &m.documents[i], nil
+		}
+	}
+
+	return nil, errors.New("document not found")
+}
+
+func (m *mockEDVClient) QueryVaultWithContext(_ context.Context, vaultID, name, value string,
+	_ ...client.ReqOption) ([]string, error) {
+	documents, err := m.QueryVaultForFullDocumentsWithContext(context.Background(), vaultID, name, value)
+	if err != nil {
+		return nil, err
+	}
+
+	var docURLs []string
+
+	for _, document := range documents {
+		docURLs = append(docURLs, vaultID+"/documents/"+document.ID)
+	}
+
+	return docURLs, nil
+}
+
+func (m *mockEDVClient) QueryVaultForFullDocumentsWithContext(_ context.Context, _, name, value string,
+	_ ...client.ReqOption) ([]models.EncryptedDocument, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var documents []models.EncryptedDocument
+
+	for _, document := range m.documents {
+		for _, collection := range document.IndexedAttributeCollections {
+			for _, attribute := range collection.IndexedAttributes {
+				if attribute.Name == name && attribute.Value == value {
+					documents = append(documents, document)
+				}
+			}
+		}
+	}
+
+	return documents, nil
+}
+
+func (m *mockEDVClient) UpdateDocumentWithContext(context.Context, string, string, *models.EncryptedDocument,
+	...client.ReqOption) error {
+	return m.err
+}
@@ -0,0 +1,89 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// Errors that the errors returned for error responses match with errors.Is, depending on their code.
+var (
+	// ErrVaultNotFound is matched by errors for requests to a vault that doesn't exist.
+	ErrVaultNotFound = errors.New("vault not found")
+	// ErrDocumentNotFound is matched by errors for requests to a document that doesn't exist.
+	ErrDocumentNotFound = errors.New("document not found")
+	// ErrNotFound is matched by all errors for 404 Not Found responses, including the two above.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicateVault is matched by errors for requests to create a vault that already exists.
+	ErrDuplicateVault = errors.New("duplicate vault")
+	// ErrDuplicateDocument is matched by errors for requests to create a document that already exists.
+	ErrDuplicateDocument = errors.New("duplicate document")
+	// ErrInvalidDocumentID is matched by errors for requests with a document ID that isn't a base58-encoded
+	// 128-bit value.
+	ErrInvalidDocumentID = errors.New("invalid document ID")
+	// ErrUnauthorized is matched by errors for 401 Unauthorized responses.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is matched by errors for 403 Forbidden responses.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// nolint: gochecknoglobals
+var codeErrors = map[string]error{
+	messages.CodeVaultNotFound:     ErrVaultNotFound,
+	messages.CodeDocumentNotFound:  ErrDocumentNotFound,
+	messages.CodeDuplicateVault:    ErrDuplicateVault,
+	messages.CodeDuplicateDocument: ErrDuplicateDocument,
+	messages.CodeInvalidDocumentID: ErrInvalidDocumentID,
+	messages.CodeUnauthorized:      ErrUnauthorized,
+	messages.CodeForbidden:         ErrForbidden,
+}
+
+// Error is returned for error responses from the EDV server. Use errors.As to get it, or errors.Is with the
+// errors above to check what went wrong.
+type Error struct {
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Code is one of the error codes defined in the messages package. For responses from servers that don't
+	// return error codes, it's derived from the status code.
+	Code string
+	// Message is the error message returned by the server.
+	Message string
+}
+
+// Error returns the status code and message of the error response.
+func (e *Error) Error() string {
+	return fmt.Sprintf("the EDV server returned status code %d along with the following message: %s",
+		e.StatusCode, e.Message)
+}
+
+// Is returns true if target is the error for the code of e.
+func (e *Error) Is(target error) bool {
+	if target == ErrNotFound {
+		return e.StatusCode == http.StatusNotFound
+	}
+
+	codeErr, found := codeErrors[e.Code]
+
+	return found && codeErr == target
+}
+
+// newError returns the error for an error response with the given status code and body.
+func newError(statusCode int, body []byte) *Error {
+	var errResponse models.ErrorResponse
+
+	if err := json.Unmarshal(body, &errResponse); err != nil || errResponse.Code == "" {
+		return &Error{StatusCode: statusCode, Code: messages.ErrorCode(nil, statusCode), Message: string(body)}
+	}
+
+	return &Error{StatusCode: statusCode, Code: errResponse.Code, Message: errResponse.Message}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+func TestError(t *testing.T) {
+	t.Run("JSON error response", func(t *testing.T) {
+		err := newError(http.StatusConflict,
+			[]byte(`{"code":"duplicate_document","message":"a document with the given ID already exists"}`))
+		require.Equal(t, &Error{
+			StatusCode: http.StatusConflict,
+			Code:       messages.CodeDuplicateDocument,
+			Message:    "a document with the given ID already exists",
+		}, err)
+		require.EqualError(t, err, "the EDV server returned status code 409 along with the following message: "+
+			"a document with the given ID already exists")
+		require.True(t, errors.Is(err, ErrDuplicateDocument))
+		require.False(t, errors.Is(err, ErrDuplicateVault))
+		require.False(t, errors.Is(err, ErrNotFound))
+	})
+
+	t.Run("plain text error response", func(t *testing.T) {
+		err := newError(http.StatusUnauthorized, []byte("missing bearer access token"))
+		require.Equal(t, messages.CodeUnauthorized, err.Code)
+		require.Equal(t, "missing bearer access token", err.Message)
+		require.True(t, errors.Is(err, ErrUnauthorized))
+	})
+
+	t.Run("JSON response that isn't an error response", func(t *testing.T) {
+		err := newError(http.StatusBadRequest, []byte(`["validated but not executed"]`))
+		require.Equal(t, messages.CodeInvalidRequest, err.Code)
+		require.Equal(t, `["validated but not executed"]`, err.Message)
+	})
+
+	t.Run("errors.As through wrapping", func(t *testing.T) {
+		err := fmt.Errorf("failed to read document: %w",
+			newError(http.StatusForbidden, []byte(`{"code":"forbidden","message":"not allowed"}`)))
+		require.True(t, errors.Is(err, ErrForbidden))
+
+		var edvErr *Error
+
+		require.True(t, errors.As(err, &edvErr))
+		require.Equal(t, "not allowed", edvErr.Message)
+	})
+}
@@ -0,0 +1,108 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	httpsig "github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+// ariesSignatureAlgorithm is the HTTP signature algorithm name expected by EDV servers with authorization enabled.
+const ariesSignatureAlgorithm = "https://github.com/hyperledger/aries-framework-go/zcaps"
+
+// Signer signs data with a private key.
+// The CryptoSigner in github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite implements this interface.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// WithHTTPSignature option is for signing the request with an HTTP signature created by signer. keyID is the DID URL
+// of the signing key (e.g. did:example:123#key-1) and is sent to the server, which uses it to resolve the public key.
+// The signature covers the request target and, for requests with a body, the digest of the body. EDV servers that
+// require proof of controller only create data vaults if the signing key belongs to the vault's controller.
+func WithHTTPSignature(keyID string, signer Signer) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.signature = &httpSignature{keyID: keyID, signer: signer}
+	}
+}
+
+type httpSignature struct {
+	keyID      string
+	signer     Signer
+	capability *zcapld.Capability
+}
+
+// addHeaders returns a function that adds the headers returned by addHeadersFunc (if any) to the request and
+// then signs it. If the signature has a capability, the request invokes it.
+func (s *httpSignature) addHeaders(addHeadersFunc addHeaders) addHeaders {
+	return func(req *http.Request) (*http.Header, error) {
+		if addHeadersFunc != nil {
+			httpHeaders, err := addHeadersFunc(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if httpHeaders != nil {
+				req.Header = httpHeaders.Clone()
+			}
+		}
+
+		signedHeaders := []string{"(request-target)", "(created)", "(expires)"}
+
+		if req.ContentLength > 0 {
+			signedHeaders = append(signedHeaders, "digest")
+		}
+
+		if s.capability != nil {
+			invocation, err := invocationHeader(s.capability, req)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set(zcapld.CapabilityInvocationHTTPHeader, invocation)
+
+			signedHeaders = append(signedHeaders, zcapld.CapabilityInvocationHTTPHeader)
+		}
+
+		hs := httpsig.NewHTTPSignatures(httpsig.NewSimpleSecretsStorage(map[string]httpsig.Secret{
+			s.keyID: {KeyID: s.keyID, Algorithm: ariesSignatureAlgorithm},
+		}))
+		hs.SetDefaultSignatureHeaders(signedHeaders)
+		hs.SetSignatureHashAlgorithm(&signatureHashAlgorithm{signer: s.signer})
+
+		err := hs.Sign(s.keyID, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+
+		return &req.Header, nil
+	}
+}
+
+// signatureHashAlgorithm creates HTTP signatures with a Signer.
+type signatureHashAlgorithm struct {
+	signer Signer
+}
+
+// Algorithm returns this algorithm's name.
+func (a *signatureHashAlgorithm) Algorithm() string {
+	return ariesSignatureAlgorithm
+}
+
+// Create signs data with the algorithm's signer.
+func (a *signatureHashAlgorithm) Create(_ httpsig.Secret, data []byte) ([]byte, error) {
+	return a.signer.Sign(data)
+}
+
+// Verify is not supported since the client only creates HTTP signatures.
+func (a *signatureHashAlgorithm) Verify(httpsig.Secret, []byte, []byte) error {
+	return errors.New("verifying HTTP signatures is not supported")
+}
@@ -0,0 +1,157 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	httpsig "github.com/igor-pavlenko/httpsignatures-go"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testKeyID = "did:example:123#key-1"
+
+func TestClient_WithHTTPSignature(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	t.Run("request with body is signed including its digest", func(t *testing.T) {
+		var verifyErr error
+
+		var signature, userHeader string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			signature = req.Header.Get("Signature")
+			userHeader = req.Header.Get("X-User")
+			verifyErr = newTestVerifier(pubKey).Verify(req)
+
+			rw.Header().Set("Location", "https://example.com/encrypted-data-vaults/vault1")
+			rw.WriteHeader(http.StatusCreated)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithHeaders(func(req *http.Request) (*http.Header, error) {
+			req.Header.Set("X-User", "user1")
+
+			return &req.Header, nil
+		}))
+
+		location, _, err := client.CreateDataVault(&models.DataVaultConfiguration{Controller: "did:example:123"},
+			WithHTTPSignature(testKeyID, &ed25519Signer{privKey: privKey}))
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/encrypted-data-vaults/vault1", location)
+
+		require.NoError(t, verifyErr)
+		require.Contains(t, signature, `keyId="`+testKeyID+`"`)
+		require.Contains(t, signature, `headers="(request-target) (created) (expires) digest"`)
+		require.Equal(t, "user1", userHeader)
+	})
+
+	t.Run("request without body is signed without digest", func(t *testing.T) {
+		var verifyErr error
+
+		var signature string
+
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			signature = req.Header.Get("Signature")
+			verifyErr = newTestVerifier(pubKey).Verify(req)
+
+			rw.WriteHeader(http.StatusOK)
+		}))
+		defer srv.Close()
+
+		client := New(srv.URL + "/encrypted-data-vaults")
+
+		err := client.DeleteDocument("vault1", "doc1", WithHTTPSignature(testKeyID, &ed25519Signer{privKey: privKey}))
+		require.NoError(t, err)
+
+		require.NoError(t, verifyErr)
+		require.Contains(t, signature, `headers="(request-target) (created) (expires)"`)
+	})
+
+	t.Run("error from signer", func(t *testing.T) {
+		client := New("http://localhost:8080/encrypted-data-vaults")
+
+		_, _, err := client.CreateDataVault(&models.DataVaultConfiguration{Controller: "did:example:123"},
+			WithHTTPSignature(testKeyID, &ed25519Signer{err: errors.New("signer error")}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to sign request")
+		require.Contains(t, err.Error(), "signer error")
+	})
+
+	t.Run("error from headers func", func(t *testing.T) {
+		client := New("http://localhost:8080/encrypted-data-vaults",
+			WithHeaders(func(req *http.Request) (*http.Header, error) {
+				return nil, errors.New("headers error")
+			}))
+
+		_, _, err := client.CreateDataVault(&models.DataVaultConfiguration{Controller: "did:example:123"},
+			WithHTTPSignature(testKeyID, &ed25519Signer{privKey: privKey}))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "headers error")
+	})
+}
+
+func TestSignatureHashAlgorithm(t *testing.T) {
+	a := &signatureHashAlgorithm{signer: &ed25519Signer{err: errors.New("signer error")}}
+
+	require.Equal(t, ariesSignatureAlgorithm, a.Algorithm())
+
+	_, err := a.Create(httpsig.Secret{}, []byte("data"))
+	require.EqualError(t, err, "signer error")
+
+	require.Error(t, a.Verify(httpsig.Secret{}, []byte("data"), []byte("signature")))
+}
+
+func newTestVerifier(pubKey ed25519.PublicKey) *httpsig.HTTPSignatures {
+	hs := httpsig.NewHTTPSignatures(httpsig.NewSimpleSecretsStorage(map[string]httpsig.Secret{
+		testKeyID: {KeyID: testKeyID, Algorithm: ariesSignatureAlgorithm},
+	}))
+	hs.SetSignatureHashAlgorithm(&ed25519Verifier{pubKey: pubKey})
+
+	return hs
+}
+
+type ed25519Signer struct {
+	privKey ed25519.PrivateKey
+	err     error
+}
+
+func (s *ed25519Signer) Sign(data []byte) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return ed25519.Sign(s.privKey, data), nil
+}
+
+type ed25519Verifier struct {
+	pubKey ed25519.PublicKey
+}
+
+func (v *ed25519Verifier) Algorithm() string {
+	return ariesSignatureAlgorithm
+}
+
+func (v *ed25519Verifier) Create(httpsig.Secret, []byte) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func (v *ed25519Verifier) Verify(_ httpsig.Secret, data, signature []byte) error {
+	if !ed25519.Verify(v.pubKey, data, signature) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
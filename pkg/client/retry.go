@@ -0,0 +1,189 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKeyHeader is the request header that carries idempotency keys. EDV servers that support idempotency
+// keys return the stored response of the first request with a given key to all later requests with the same key,
+// instead of processing them again.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+)
+
+// RetryPolicy defines how requests that fail with a transient error are retried.
+// Zero fields are set to their defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is sent, including the first attempt. Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry. It doubles with every retry. Defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the time to wait between retries. Defaults to 5s.
+	MaxBackoff time.Duration
+	// RetryableStatusCodes are the response status codes that cause a request to be retried.
+	// Defaults to 429, 500, 502, 503 and 504.
+	RetryableStatusCodes []int
+}
+
+// WithRetryPolicy option is for retrying requests that fail with a connection error or a retryable status code.
+// Requests are retried with exponential backoff and jitter until they succeed, the policy's maximum number of
+// attempts is reached or their context is done.
+// With a retry policy, CreateDataVault, CreateDocument and Batch requests are sent with an idempotency key (see
+// WithIdempotencyKey), so that EDV servers that support idempotency keys don't process a retried request twice.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(opts *Client) {
+		opts.retryPolicy = policy.withDefaults()
+	}
+}
+
+// WithIdempotencyKey option is for sending the request with the given idempotency key. Sending a request again
+// with the same key (e.g. after a restart) returns the response of the first request instead of creating
+// another vault or document. EDV servers only honor idempotency keys on CreateDataVault, CreateDocument and Batch
+// requests.
+func WithIdempotencyKey(key string) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.idempotencyKey = key
+	}
+}
+
+func (p *RetryPolicy) withDefaults() *RetryPolicy {
+	policy := *p
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaultInitialBackoff
+	}
+
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxBackoff
+	}
+
+	if policy.RetryableStatusCodes == nil {
+		policy.RetryableStatusCodes = []int{
+			http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+		}
+	}
+
+	return &policy
+}
+
+// shouldRetry returns true if a request that failed with the given error (returned by the HTTP client) or status
+// code should be sent again.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, err error, statusCode int) bool {
+	if err != nil {
+		// Requests cancelled by their context mustn't be retried.
+		return ctx.Err() == nil
+	}
+
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the time to wait before the given retry (starting from 1): the initial backoff doubled for every
+// previous retry, capped by the max backoff, of which a random part of up to half is subtracted so that clients
+// that failed at the same time don't retry at the same time.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	return backoff - time.Duration(jitter.Int63n(int64(backoff/2)+1))
+}
+
+// wait waits for the given duration. It returns early with the context's error if the context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// idempotencyKey returns the idempotency key to send with a request that creates a resource: the key set with
+// WithIdempotencyKey or, if requests are retried, a new one.
+func (c *Client) idempotencyKey(reqOpt *ReqOpts) string {
+	if reqOpt.idempotencyKey == "" && c.retryPolicy != nil {
+		return uuid.New().String()
+	}
+
+	return reqOpt.idempotencyKey
+}
+
+// withIdempotencyKey returns a function that adds the headers returned by addHeadersFunc (if any) and the
+// idempotency key to the request.
+func withIdempotencyKey(key string, addHeadersFunc addHeaders) addHeaders {
+	return func(req *http.Request) (*http.Header, error) {
+		if addHeadersFunc != nil {
+			httpHeaders, err := addHeadersFunc(req)
+			if err != nil {
+				return nil, err
+			}
+
+			if httpHeaders != nil {
+				req.Header = httpHeaders.Clone()
+			}
+		}
+
+		req.Header.Set(IdempotencyKeyHeader, key)
+
+		return &req.Header, nil
+	}
+}
+
+// lockedSource is a rand.Source that can be used concurrently.
+type lockedSource struct {
+	mutex  sync.Mutex
+	source rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.source.Seed(seed)
+}
+
+// jitter randomizes backoffs. It doesn't need to be cryptographically secure.
+var jitter = rand.New(&lockedSource{source: rand.NewSource(time.Now().UnixNano())}) //nolint: gosec
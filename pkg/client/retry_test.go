@@ -0,0 +1,254 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/restapi"
+	"github.com/trustbloc/edv/pkg/restapi/idempotency"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+func TestClient_WithRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	t.Run("retryable status codes are retried with the same idempotency key", func(t *testing.T) {
+		srv, requests := newFlakyServer(2, http.StatusServiceUnavailable, http.StatusCreated)
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(policy))
+
+		location, err := client.CreateDocument("vault1", getTestValidEncryptedDocument(testJWE))
+		require.NoError(t, err)
+		require.Equal(t, "https://example.com/location", location)
+
+		require.Len(t, *requests, 3)
+		require.NotEmpty(t, (*requests)[0].Header.Get(IdempotencyKeyHeader))
+
+		for _, req := range *requests {
+			require.Equal(t, (*requests)[0].Header.Get(IdempotencyKeyHeader), req.Header.Get(IdempotencyKeyHeader))
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		srv, requests := newFlakyServer(5, http.StatusBadGateway, http.StatusOK)
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(policy))
+
+		_, err := client.ReadDocument("vault1", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status code 502")
+		require.Len(t, *requests, 3)
+	})
+
+	t.Run("status codes that aren't retryable aren't retried", func(t *testing.T) {
+		srv, requests := newFlakyServer(1, http.StatusNotFound, http.StatusOK)
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(policy))
+
+		_, err := client.ReadDocument("vault1", "doc1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "status code 404")
+		require.Len(t, *requests, 1)
+	})
+
+	t.Run("custom retryable status codes", func(t *testing.T) {
+		srv, requests := newFlakyServer(1, http.StatusConflict, http.StatusOK)
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(&RetryPolicy{
+			MaxAttempts: 2, InitialBackoff: time.Millisecond, RetryableStatusCodes: []int{http.StatusConflict},
+		}))
+
+		err := client.DeleteDocument("vault1", "doc1")
+		require.NoError(t, err)
+		require.Len(t, *requests, 2)
+	})
+
+	t.Run("connection errors are retried", func(t *testing.T) {
+		srv, requests := newFlakyServer(0, 0, http.StatusOK)
+		defer srv.Close()
+
+		attempts := 0
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(policy))
+		client.httpClient.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				attempts++
+
+				if attempts == 1 {
+					return nil, errors.New("connection reset")
+				}
+
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+
+		err := client.DeleteDocument("vault1", "doc1")
+		require.NoError(t, err)
+		require.Equal(t, 2, attempts)
+		require.Len(t, *requests, 1)
+	})
+
+	t.Run("context done while waiting to retry", func(t *testing.T) {
+		srv, requests := newFlakyServer(5, http.StatusServiceUnavailable, http.StatusOK)
+		defer srv.Close()
+
+		client := New(srv.URL+"/encrypted-data-vaults", WithRetryPolicy(&RetryPolicy{InitialBackoff: time.Hour}))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := client.ReadDocumentWithContext(ctx, "vault1", "doc1")
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Len(t, *requests, 1)
+	})
+
+	t.Run("requests aren't retried without a retry policy", func(t *testing.T) {
+		srv, requests := newFlakyServer(1, http.StatusServiceUnavailable, http.StatusCreated)
+		defer srv.Close()
+
+		client := New(srv.URL + "/encrypted-data-vaults")
+
+		_, err := client.CreateDocument("vault1", getTestValidEncryptedDocument(testJWE))
+		require.Error(t, err)
+		require.Len(t, *requests, 1)
+		require.Empty(t, (*requests)[0].Header.Get(IdempotencyKeyHeader))
+	})
+}
+
+func TestClient_WithIdempotencyKey(t *testing.T) {
+	srv, requests := newFlakyServer(0, 0, http.StatusCreated)
+	defer srv.Close()
+
+	client := New(srv.URL+"/encrypted-data-vaults", WithHeaders(func(req *http.Request) (*http.Header, error) {
+		req.Header.Set("X-User", "user1")
+
+		return &req.Header, nil
+	}))
+
+	_, _, err := client.CreateDataVault(&models.DataVaultConfiguration{}, WithIdempotencyKey("key1"))
+	require.NoError(t, err)
+
+	_, err = client.CreateDocument("vault1", &models.EncryptedDocument{}, WithIdempotencyKey("key2"))
+	require.NoError(t, err)
+
+	require.Len(t, *requests, 2)
+	require.Equal(t, "key1", (*requests)[0].Header.Get(IdempotencyKeyHeader))
+	require.Equal(t, "user1", (*requests)[0].Header.Get("X-User"))
+	require.Equal(t, "key2", (*requests)[1].Header.Get(IdempotencyKeyHeader))
+}
+
+func TestClient_RetryWithIdempotencyKeys(t *testing.T) {
+	memProv := memedvprovider.NewProvider()
+	require.NoError(t, memProv.CreateStore(dataVaultConfigurationStoreName))
+
+	keys, err := idempotency.New(ariesmemstorage.NewProvider(), time.Hour)
+	require.NoError(t, err)
+
+	edvService, err := restapi.New(&operation.Config{Provider: memProv, IdempotencyKeys: keys})
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range edvService.GetOperations() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	// The first request is processed, but its response is lost on the way back to the client.
+	responseLost := false
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !responseLost {
+			responseLost = true
+
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			rw.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		router.ServeHTTP(rw, req)
+	}))
+	defer srv.Close()
+
+	client := New(srv.URL+"/encrypted-data-vaults",
+		WithRetryPolicy(&RetryPolicy{InitialBackoff: time.Millisecond}))
+
+	config := getTestValidDataVaultConfiguration()
+
+	location, _, err := client.CreateDataVault(&config)
+	require.NoError(t, err)
+	require.NotEmpty(t, location)
+
+	// Without the idempotency key, the retried request would have been rejected as a duplicate.
+	_, _, err = client.CreateDataVault(&config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status code 409")
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	policy := (&RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}).withDefaults()
+
+	require.Equal(t, defaultMaxAttempts, policy.MaxAttempts)
+	require.Len(t, policy.RetryableStatusCodes, 5)
+
+	for i := 0; i < 100; i++ {
+		backoff := policy.backoff(1)
+		require.True(t, backoff >= 50*time.Millisecond && backoff <= 100*time.Millisecond, backoff)
+
+		backoff = policy.backoff(3)
+		require.True(t, backoff >= 200*time.Millisecond && backoff <= 400*time.Millisecond, backoff)
+
+		backoff = policy.backoff(10)
+		require.True(t, backoff >= 500*time.Millisecond && backoff <= time.Second, backoff)
+	}
+}
+
+// newFlakyServer returns a server that fails the first failures requests with failureStatusCode and then responds
+// with statusCode, along with the requests it received.
+func newFlakyServer(failures, failureStatusCode, statusCode int) (*httptest.Server, *[]*http.Request) {
+	var (
+		mutex    sync.Mutex
+		requests []*http.Request
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mutex.Lock()
+		requests = append(requests, req)
+		attempt := len(requests)
+		mutex.Unlock()
+
+		if attempt <= failures {
+			rw.WriteHeader(failureStatusCode)
+
+			return
+		}
+
+		rw.Header().Set("Location", "https://example.com/location")
+		rw.WriteHeader(statusCode)
+	}))
+
+	return srv, &requests
+}
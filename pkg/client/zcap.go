@@ -0,0 +1,150 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cryptoapi "github.com/hyperledger/aries-framework-go/pkg/crypto"
+	"github.com/hyperledger/aries-framework-go/pkg/doc/signature/suite"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+)
+
+const (
+	readAction  = "read"
+	writeAction = "write"
+)
+
+// WithCapabilityInvoker option is for invoking capabilities (zcaps) with requests to EDV servers that have zcap
+// authorization enabled. keyID is the DID URL of the invoker's key (e.g. did:example:123#key-1) and signer signs
+// with that key (see NewKMSSigner).
+// Requests to a vault carry the vault's capability (see SetCapability) in their capability-invocation header,
+// along with the action the server expects for the request (read for GET requests, write for all others), and are
+// signed with an HTTP signature that covers it. The capability returned by CreateDataVault is set for the new vault
+// automatically. CreateDataVault requests are signed too, as proof of controller.
+func WithCapabilityInvoker(keyID string, signer Signer) Option {
+	return func(opts *Client) {
+		opts.invoker = &httpSignature{keyID: keyID, signer: signer}
+	}
+}
+
+// WithCapability option is for invoking the given capability with the request instead of the capability set for
+// the vault, e.g. a capability that was delegated for a single document. Delegated capabilities carry their chain
+// in their proof. The request is signed with the client's capability invoker, or with its HTTP signature if it has
+// one (see WithHTTPSignature).
+func WithCapability(capability *zcapld.Capability) ReqOption {
+	return func(opts *ReqOpts) {
+		opts.capability = capability
+	}
+}
+
+// NewKMSSigner returns a Signer that signs with the key with the given ID in keyManager, using crypto.
+func NewKMSSigner(keyManager kms.KeyManager, crypto cryptoapi.Crypto, kmsKeyID string) (Signer, error) {
+	kh, err := keyManager.Get(kmsKeyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %s from kms: %w", kmsKeyID, err)
+	}
+
+	return suite.NewCryptoSigner(crypto, kh), nil
+}
+
+// SetCapability sets the capability to invoke with requests to the given vault. It can be the capability returned
+// by CreateDataVault for a vault that was created by another client, or a capability delegated from it.
+func (c *Client) SetCapability(vaultID string, capability *zcapld.Capability) {
+	c.capabilitiesMutex.Lock()
+	defer c.capabilitiesMutex.Unlock()
+
+	c.capabilities[vaultID] = capability
+}
+
+// Capability returns the capability set for the given vault, or nil if there's none.
+func (c *Client) Capability(vaultID string) *zcapld.Capability {
+	c.capabilitiesMutex.RLock()
+	defer c.capabilitiesMutex.RUnlock()
+
+	return c.capabilities[vaultID]
+}
+
+// setCapabilityFromResponse sets the capability in the response to a CreateDataVault request for the new vault.
+func (c *Client) setCapabilityFromResponse(vaultLocation string, respBytes []byte) {
+	if c.invoker == nil || len(respBytes) == 0 {
+		return
+	}
+
+	capability, err := zcapld.ParseCapability(respBytes)
+	if err != nil || capability.ID == "" {
+		logger.Warnf("response to create data vault %s doesn't contain a capability: %v", vaultLocation, err)
+
+		return
+	}
+
+	vaultID, err := url.PathUnescape(vaultLocation[strings.LastIndex(vaultLocation, "/")+1:])
+	if err != nil {
+		logger.Warnf("failed to get vault ID from data vault location %s: %s", vaultLocation, err)
+
+		return
+	}
+
+	c.SetCapability(vaultID, capability)
+}
+
+// signature returns the HTTP signature for a request to the given vault ("" for requests that don't target a
+// vault): the request's or the invoker's, invoking the request's capability or, failing that, the vault's.
+func (c *Client) signature(vaultID string, reqOpt *ReqOpts) *httpSignature {
+	signature := reqOpt.signature
+	if signature == nil {
+		signature = c.invoker
+	}
+
+	if signature == nil {
+		return nil
+	}
+
+	capability := reqOpt.capability
+	if capability == nil && vaultID != "" {
+		capability = c.Capability(vaultID)
+	}
+
+	return &httpSignature{keyID: signature.keyID, signer: signature.signer, capability: capability}
+}
+
+// invocationHeader returns the capability-invocation header that invokes the capability with the action the EDV
+// server expects for the request.
+func invocationHeader(capability *zcapld.Capability, req *http.Request) (string, error) {
+	capabilityBytes, err := json.Marshal(capability)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal capability: %w", err)
+	}
+
+	compressed := &bytes.Buffer{}
+
+	w := gzip.NewWriter(compressed)
+
+	if _, err := w.Write(capabilityBytes); err != nil {
+		return "", fmt.Errorf("failed to compress capability: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress capability: %w", err)
+	}
+
+	action := writeAction
+	if req.Method == http.MethodGet {
+		action = readAction
+	}
+
+	return fmt.Sprintf(`zcap capability="%s",action="%s"`,
+		base64.URLEncoding.EncodeToString(compressed.Bytes()), action), nil
+}
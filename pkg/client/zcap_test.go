@@ -0,0 +1,252 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/hyperledger/aries-framework-go/pkg/crypto/tinkcrypto"
+	"github.com/hyperledger/aries-framework-go/pkg/kms"
+	"github.com/hyperledger/aries-framework-go/pkg/kms/localkms"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock"
+	"github.com/hyperledger/aries-framework-go/pkg/secretlock/noop"
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+	"github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+func TestClient_WithCapabilityInvoker(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	vaultCapability := &zcapld.Capability{
+		ID:               "urn:uuid:vault1-capability",
+		Invoker:          testKeyID,
+		AllowedAction:    []string{readAction, writeAction},
+		InvocationTarget: zcapld.InvocationTarget{ID: "vault1", Type: "urn:edv:vault"},
+	}
+
+	t.Run("capability returned by CreateDataVault is invoked with requests to the vault", func(t *testing.T) {
+		srv := newTestZCAPServer(t, pubKey, vaultCapability)
+
+		client := New(srv.URL+"/encrypted-data-vaults",
+			WithCapabilityInvoker(testKeyID, &ed25519Signer{privKey: privKey}))
+
+		location, _, err := client.CreateDataVault(&models.DataVaultConfiguration{Controller: "did:example:123"})
+		require.NoError(t, err)
+		require.Equal(t, srv.URL+"/encrypted-data-vaults/vault1", location)
+		require.Equal(t, vaultCapability, client.Capability("vault1"))
+
+		require.NoError(t, srv.verifyErr)
+		require.Empty(t, srv.invocation)
+		require.Contains(t, srv.signature, `headers="(request-target) (created) (expires) digest"`)
+
+		_, err = client.ReadDocument("vault1", "doc1")
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Equal(t, readAction, srv.action)
+		require.Equal(t, vaultCapability, srv.capability)
+		require.Contains(t, srv.signature, `headers="(request-target) (created) (expires) capability-invocation"`)
+
+		err = client.UpdateDocument("vault1", "doc1", &models.EncryptedDocument{ID: "doc1"})
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Equal(t, writeAction, srv.action)
+		require.Equal(t, vaultCapability, srv.capability)
+		require.Contains(t, srv.signature,
+			`headers="(request-target) (created) (expires) digest capability-invocation"`)
+
+		err = client.DeleteDocument("vault1", "doc1")
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Equal(t, writeAction, srv.action)
+	})
+
+	t.Run("capability passed with request is invoked instead of the vault's", func(t *testing.T) {
+		srv := newTestZCAPServer(t, pubKey, nil)
+
+		client := New(srv.URL+"/encrypted-data-vaults",
+			WithCapabilityInvoker(testKeyID, &ed25519Signer{privKey: privKey}))
+		client.SetCapability("vault1", vaultCapability)
+
+		docCapability := &zcapld.Capability{
+			ID:               "urn:uuid:doc1-capability",
+			Parent:           vaultCapability.ID,
+			Invoker:          testKeyID,
+			AllowedAction:    []string{readAction},
+			InvocationTarget: zcapld.InvocationTarget{ID: "doc1", Type: "urn:edv:document"},
+		}
+
+		_, err := client.ReadDocument("vault1", "doc1", WithCapability(docCapability))
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Equal(t, docCapability, srv.capability)
+	})
+
+	t.Run("request to vault without capability is signed without invocation", func(t *testing.T) {
+		srv := newTestZCAPServer(t, pubKey, nil)
+
+		client := New(srv.URL+"/encrypted-data-vaults",
+			WithCapabilityInvoker(testKeyID, &ed25519Signer{privKey: privKey}))
+
+		location, _, err := client.CreateDataVault(&models.DataVaultConfiguration{Controller: "did:example:123"})
+		require.NoError(t, err)
+		require.Equal(t, srv.URL+"/encrypted-data-vaults/vault1", location)
+		require.Nil(t, client.Capability("vault1"))
+
+		_, err = client.ReadDocument("vault1", "doc1")
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Empty(t, srv.invocation)
+		require.Contains(t, srv.signature, `headers="(request-target) (created) (expires)"`)
+	})
+
+	t.Run("capability is invoked with HTTP signature of request", func(t *testing.T) {
+		srv := newTestZCAPServer(t, pubKey, nil)
+
+		client := New(srv.URL + "/encrypted-data-vaults")
+		client.SetCapability("vault1", vaultCapability)
+
+		_, err := client.ReadDocument("vault1", "doc1")
+		require.NoError(t, err)
+		require.Empty(t, srv.signature)
+
+		_, err = client.ReadDocument("vault1", "doc1", WithHTTPSignature(testKeyID, &ed25519Signer{privKey: privKey}))
+		require.NoError(t, err)
+
+		require.NoError(t, srv.verifyErr)
+		require.Equal(t, vaultCapability, srv.capability)
+	})
+}
+
+func TestNewKMSSigner(t *testing.T) {
+	keyManager, err := localkms.New("local-lock://test/master/key/",
+		&kmsProvider{storageProvider: ariesmemstorage.NewProvider(), secretLock: &noop.NoLock{}})
+	require.NoError(t, err)
+
+	crypto, err := tinkcrypto.New()
+	require.NoError(t, err)
+
+	t.Run("success", func(t *testing.T) {
+		keyID, _, err := keyManager.Create(kms.ED25519Type)
+		require.NoError(t, err)
+
+		pubKey, err := keyManager.ExportPubKeyBytes(keyID)
+		require.NoError(t, err)
+
+		signer, err := NewKMSSigner(keyManager, crypto, keyID)
+		require.NoError(t, err)
+
+		signature, err := signer.Sign([]byte("data"))
+		require.NoError(t, err)
+		require.True(t, ed25519.Verify(pubKey, []byte("data"), signature))
+	})
+
+	t.Run("key not found", func(t *testing.T) {
+		signer, err := NewKMSSigner(keyManager, crypto, "unknown")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get key unknown from kms")
+		require.Nil(t, signer)
+	})
+}
+
+// testZCAPServer verifies the HTTP signatures of the requests it receives and records the capabilities they invoke.
+// It responds to requests to create a data vault with capability, if it's not nil.
+type testZCAPServer struct {
+	*httptest.Server
+	signature  string
+	invocation string
+	action     string
+	capability *zcapld.Capability
+	verifyErr  error
+}
+
+func newTestZCAPServer(t *testing.T, pubKey ed25519.PublicKey, capability *zcapld.Capability) *testZCAPServer {
+	t.Helper()
+
+	invocationRegex := regexp.MustCompile(`^zcap capability="([^"]+)",action="([^"]+)"$`)
+
+	srv := &testZCAPServer{}
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		srv.signature = req.Header.Get("Signature")
+		srv.invocation = req.Header.Get(zcapld.CapabilityInvocationHTTPHeader)
+		srv.verifyErr = newTestVerifier(pubKey).Verify(req)
+		srv.action, srv.capability = "", nil
+
+		if matches := invocationRegex.FindStringSubmatch(srv.invocation); matches != nil {
+			srv.capability = decodeTestCapability(t, matches[1])
+			srv.action = matches[2]
+		}
+
+		switch {
+		case req.URL.Path == "/encrypted-data-vaults":
+			rw.Header().Set("Location", srv.URL+"/encrypted-data-vaults/vault1")
+			rw.WriteHeader(http.StatusCreated)
+
+			if capability != nil {
+				require.NoError(t, json.NewEncoder(rw).Encode(capability))
+			}
+		case req.Method == http.MethodGet:
+			require.NoError(t, json.NewEncoder(rw).Encode(models.EncryptedDocument{ID: "doc1"}))
+		default:
+			rw.WriteHeader(http.StatusOK)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func decodeTestCapability(t *testing.T, encoded string) *zcapld.Capability {
+	t.Helper()
+
+	compressed, err := base64.URLEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+
+	capabilityBytes, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+
+	capability, err := zcapld.ParseCapability(capabilityBytes)
+	require.NoError(t, err)
+
+	return capability
+}
+
+type kmsProvider struct {
+	storageProvider ariesstorage.Provider
+	secretLock      secretlock.Service
+}
+
+func (k *kmsProvider) StorageProvider() ariesstorage.Provider {
+	return k.storageProvider
+}
+
+func (k *kmsProvider) SecretLock() secretlock.Service {
+	return k.secretLock
+}
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package couchdbedvprovider
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -17,11 +18,15 @@ import (
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/storage"
 	couchdbstore "github.com/trustbloc/edge-core/pkg/storage/couchdb"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvutils"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/tracing"
 )
 
 const (
@@ -49,6 +54,9 @@ Document content: %s`
 
 var logger = log.New(logModuleName)
 
+// pageKey is the span attribute that holds the page number of a paginated CouchDB query.
+const pageKey = attribute.Key("edv.couchdb.page")
+
 // ErrMissingDatabaseURL is returned when an attempt is made to instantiate a new CouchDBEDVProvider with a blank URL.
 var ErrMissingDatabaseURL = errors.New("couchDB database URL not set")
 
@@ -95,6 +103,11 @@ func (c *CouchDBEDVProvider) CreateStore(name string) error {
 	return c.coreProvider.CreateStore(name)
 }
 
+// Close closes all stores opened by the provider.
+func (c *CouchDBEDVProvider) Close() error {
+	return c.coreProvider.Close()
+}
+
 // OpenStore opens an existing store and returns it. The name is converted to a uuid if it is a base58-encoded
 // 128-bit value.
 func (c *CouchDBEDVProvider) OpenStore(name string) (edvprovider.EDVStore, error) {
@@ -114,7 +127,9 @@ func (c *CouchDBEDVProvider) OpenStore(name string) (edvprovider.EDVStore, error
 		return nil, err
 	}
 
-	return &CouchDBEDVStore{coreStore: coreStore, name: name, retrievalPageSize: c.retrievalPageSize}, nil
+	return &CouchDBEDVStore{
+		coreStore: coreStore, name: name, retrievalPageSize: c.retrievalPageSize, ctx: context.Background(),
+	}, nil
 }
 
 // CouchDBEDVStore represents a CouchDB store with functionality needed for EDV data storage.
@@ -123,6 +138,32 @@ type CouchDBEDVStore struct {
 	coreStore         storage.Store
 	name              string
 	retrievalPageSize uint
+	ctx               context.Context
+}
+
+// WithContext returns a copy of the store whose CouchDB round trips are traced as part of ctx.
+func (c *CouchDBEDVStore) WithContext(ctx context.Context) edvprovider.EDVStore {
+	store := *c
+	store.ctx = ctx
+
+	return &store
+}
+
+// context returns the context the store's calls are made in.
+func (c *CouchDBEDVStore) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+
+	return c.ctx
+}
+
+// startRoundTrip starts the span of a CouchDB round trip with the given operation, as a child of the span in ctx.
+func (c *CouchDBEDVStore) startRoundTrip(ctx context.Context, operation string) trace.Span {
+	_, span := tracing.StartClientSpan(ctx, "CouchDB."+operation,
+		semconv.DBSystemCouchDB, semconv.DBNameKey.String(c.name), semconv.DBOperationKey.String(operation))
+
+	return span
 }
 
 // Put stores the given document.
@@ -170,7 +211,10 @@ func (c *CouchDBEDVStore) UpsertBulk(documents []models.EncryptedDocument) error
 		valuesToStore[i] = documentBytes
 	}
 
+	span := c.startRoundTrip(c.context(), "PutBulk")
 	err := c.coreStore.PutBulk(keysToStore, valuesToStore)
+	tracing.EndSpan(span, err)
+
 	if err != nil {
 		return fmt.Errorf("failed to put encrypted document(s) and their associated mapping document(s) into "+
 			"CouchDB: %w", err)
@@ -198,7 +242,10 @@ func (c *CouchDBEDVStore) createMappingDocuments(documents []models.EncryptedDoc
 // GetAll fetches all the documents within this store.
 // TODO: Support pagination #106
 func (c *CouchDBEDVStore) GetAll() ([][]byte, error) {
+	span := c.startRoundTrip(c.context(), "GetAll")
 	allKeyValuePairs, err := c.coreStore.GetAll()
+	tracing.EndSpan(span, err)
+
 	if err != nil {
 		return nil, fmt.Errorf(failGetKeyValuePairsFromCoreStoreErrMsg, err)
 	}
@@ -218,7 +265,11 @@ func (c *CouchDBEDVStore) GetAll() ([][]byte, error) {
 
 // Get fetches the document associated with the given key.
 func (c *CouchDBEDVStore) Get(k string) ([]byte, error) {
-	return c.coreStore.Get(k)
+	span := c.startRoundTrip(c.context(), "Get")
+	value, err := c.coreStore.Get(k)
+	tracing.EndSpan(span, err)
+
+	return value, err
 }
 
 // Update updates the given document.
@@ -238,7 +289,7 @@ func (c *CouchDBEDVStore) Update(newDoc models.EncryptedDocument) error {
 		return err
 	}
 
-	return c.coreStore.Put(newDoc.ID, newDocBytes)
+	return c.put(newDoc.ID, newDocBytes)
 }
 
 // Delete deletes the given document and its mapping document(s).
@@ -255,7 +306,7 @@ func (c *CouchDBEDVStore) Delete(docID string) error {
 		}
 	}
 
-	return c.coreStore.Delete(docID)
+	return c.delete(docID)
 }
 
 // CreateEDVIndex creates the index which will allow for encrypted indices to work.
@@ -266,7 +317,7 @@ func (c *CouchDBEDVStore) CreateEDVIndex() error {
 		WhatToIndex:          `{"fields": ["` + mapDocumentIndexedField + `"]}`,
 	}
 
-	return c.coreStore.CreateIndex(createIndexRequest)
+	return c.createIndex(createIndexRequest)
 }
 
 // CreateReferenceIDIndex creates index for the referenceId field in config documents
@@ -277,7 +328,7 @@ func (c *CouchDBEDVStore) CreateReferenceIDIndex() error {
 		WhatToIndex:          `{"fields": ["` + mapConfigReferenceIDField + `"]}`,
 	}
 
-	return c.coreStore.CreateIndex(createIndexRequest)
+	return c.createIndex(createIndexRequest)
 }
 
 // CreateEncryptedDocIDIndex creates index for the MatchingEncryptedDocID field in mapping documents.
@@ -288,7 +339,7 @@ func (c *CouchDBEDVStore) CreateEncryptedDocIDIndex() error {
 		WhatToIndex:          `{"fields": ["` + mapDocumentDocIDField + `"]}`,
 	}
 
-	return c.coreStore.CreateIndex(createIndexRequest)
+	return c.createIndex(createIndexRequest)
 }
 
 // Query does an EDV encrypted index query.
@@ -297,9 +348,20 @@ func (c *CouchDBEDVStore) CreateEncryptedDocIDIndex() error {
 // TODO (#168): Add support for pagination (not currently in the spec).
 //  The c.retrievalPageSize parameter is passed in from the startup args and could be used with pagination.
 func (c *CouchDBEDVStore) Query(query *models.Query) ([]models.EncryptedDocument, error) {
+	ctx, span := tracing.StartSpan(c.context(), "CouchDBEDVStore.Query", tracing.VaultIDKey.String(c.name))
+
+	documents, err := c.query(ctx, query)
+
+	span.SetAttributes(tracing.DocumentsKey.Int(len(documents)))
+	tracing.EndSpan(span, err)
+
+	return documents, err
+}
+
+func (c *CouchDBEDVStore) query(ctx context.Context, query *models.Query) ([]models.EncryptedDocument, error) {
 	// TODO (#169): Use c.retrievalPageSize to do pagination within this method to help control the maximum amount of
 	//  memory used here. Without official pagination support it won't be possible to truly cap memory usage, however.
-	idsOfDocsWithMatchingQueryIndexName, err := c.findDocsMatchingQueryIndexName(query.Name)
+	idsOfDocsWithMatchingQueryIndexName, err := c.findDocsMatchingQueryIndexName(ctx, query.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -308,7 +370,7 @@ func (c *CouchDBEDVStore) Query(query *models.Query) ([]models.EncryptedDocument
 		return nil, nil
 	}
 
-	idsOfMatchingDocs, err := c.filterDocsByQuery(idsOfDocsWithMatchingQueryIndexName, query)
+	idsOfMatchingDocs, err := c.filterDocsByQuery(ctx, idsOfDocsWithMatchingQueryIndexName, query)
 	if err != nil {
 		return nil, fmt.Errorf(failFilterDocsByQueryErrMsg, err)
 	}
@@ -319,7 +381,10 @@ func (c *CouchDBEDVStore) Query(query *models.Query) ([]models.EncryptedDocument
 
 	matchingEncryptedDocs := make([]models.EncryptedDocument, len(idsOfMatchingDocs))
 
+	span := c.startRoundTrip(ctx, "GetBulk")
 	encryptedDocsBytes, err := c.coreStore.GetBulk(idsOfMatchingDocs...)
+	tracing.EndSpan(span, err)
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all documents with matching IDs: %w", err)
 	}
@@ -356,13 +421,16 @@ func (c *CouchDBEDVStore) StoreDataVaultConfiguration(config *models.DataVaultCo
 		return fmt.Errorf(messages.FailToMarshalConfig, err)
 	}
 
-	return c.coreStore.Put(vaultID, configBytes)
+	return c.put(vaultID, configBytes)
 }
 
-func (c *CouchDBEDVStore) checkDuplicateReferenceID(referenceID string) error {
+func (c *CouchDBEDVStore) checkDuplicateReferenceID(referenceID string) (err error) {
 	query := `{"selector":{"` + mapConfigReferenceIDField + `":"` + referenceID +
 		`"},"use_index": ["EDV_ConfigStoreDesignDoc", "EDV_ReferenceId"]}`
 
+	span := c.startRoundTrip(c.context(), "Query")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	itr, err := c.coreStore.Query(query)
 	if err != nil {
 		return err
@@ -523,7 +591,7 @@ func (c *CouchDBEDVStore) createAndStoreMappingDocument(indexedAttributeName, en
 Name: %s,
 Contents: %s`, c.name, mappingDocumentName, documentBytes)
 
-	return c.coreStore.Put(mappingDocumentName, documentBytes)
+	return c.put(mappingDocumentName, documentBytes)
 }
 
 // updateMappingDocuments first queries mapping document names and indexNames with matching encrypted document ID.
@@ -605,17 +673,45 @@ func (c *CouchDBEDVStore) checkAndCleanUpOldMappingDocuments(
 }
 
 func (c *CouchDBEDVStore) deleteMappingDocument(mappingDocName string) error {
-	return c.coreStore.Delete(mappingDocName)
+	return c.delete(mappingDocName)
+}
+
+func (c *CouchDBEDVStore) put(k string, v []byte) error {
+	span := c.startRoundTrip(c.context(), "Put")
+	err := c.coreStore.Put(k, v)
+	tracing.EndSpan(span, err)
+
+	return err
+}
+
+func (c *CouchDBEDVStore) delete(k string) error {
+	span := c.startRoundTrip(c.context(), "Delete")
+	err := c.coreStore.Delete(k)
+	tracing.EndSpan(span, err)
+
+	return err
+}
+
+func (c *CouchDBEDVStore) createIndex(createIndexRequest storage.CreateIndexRequest) error {
+	span := c.startRoundTrip(c.context(), "CreateIndex")
+	err := c.coreStore.CreateIndex(createIndexRequest)
+	tracing.EndSpan(span, err)
+
+	return err
 }
 
 // findDocsMatchingQueryEncryptedDocID does an encrypted document ID query to obtain mapping document names and
 // indexNames. It returns a map that uses the mapping document name as key and the indexName as value.
-func (c *CouchDBEDVStore) findDocsMatchingQueryEncryptedDocID(encryptedDocID string) (map[string]string, error) {
+func (c *CouchDBEDVStore) findDocsMatchingQueryEncryptedDocID(encryptedDocID string) (_ map[string]string,
+	err error) {
 	query := `{"selector":{"` + mapDocumentDocIDField + `":"` + encryptedDocID +
 		`"},"use_index": ["EDV_EncryptedIndexesDesignDoc", "EDV_MatchingEncryptedDocID"]}`
 
 	logger.Debugf(`Querying config store with the following query: %s`, query)
 
+	span := c.startRoundTrip(c.context(), "Query")
+	defer func() { tracing.EndSpan(span, err) }()
+
 	itr, err := c.coreStore.Query(query)
 	if err != nil {
 		return nil, err
@@ -657,65 +753,94 @@ func (c *CouchDBEDVStore) findDocsMatchingQueryEncryptedDocID(encryptedDocID str
 	return mappingDocNamesAndIndexNames, nil
 }
 
-func (c *CouchDBEDVStore) findDocsMatchingQueryIndexName(queryIndexName string) (map[string]struct{}, error) {
-	query := c.generateStringForMappingDocumentQuery(queryIndexName, "")
+func (c *CouchDBEDVStore) findDocsMatchingQueryIndexName(ctx context.Context,
+	queryIndexName string) (map[string]struct{}, error) {
+	ctx, span := tracing.StartSpan(ctx, "CouchDBEDVStore.findDocsMatchingQueryIndexName",
+		tracing.VaultIDKey.String(c.name))
 
 	idsOfDocsWithAMatchingIndex := make(map[string]struct{})
 
-	doneWithQuery := false
-
-	for !doneWithQuery {
-		logger.Debugf(`Querying store %s with the following query: %s`, c.name, query)
+	query := c.generateStringForMappingDocumentQuery(queryIndexName, "")
 
-		itr, err := c.coreStore.Query(query)
+	for page := 1; ; page++ {
+		numDocumentsReturned, bookmark, err := c.queryMappingDocumentsPage(ctx, query, page,
+			idsOfDocsWithAMatchingIndex)
 		if err != nil {
+			tracing.EndSpan(span, err)
+
 			return nil, err
 		}
 
-		ok, err := itr.Next()
-		if err != nil {
-			return nil, err
+		// A page that isn't full is the last one.
+		if numDocumentsReturned < c.retrievalPageSize {
+			break
 		}
 
-		var numDocumentsReturned uint
+		// This means that there are (potentially) more pages of documents to get. Need to do another query.
+		query = c.generateStringForMappingDocumentQuery(queryIndexName, bookmark)
+	}
 
-		for ok {
-			value, valueErr := itr.Value()
-			if valueErr != nil {
-				return nil, valueErr
-			}
+	span.SetAttributes(tracing.DocumentsKey.Int(len(idsOfDocsWithAMatchingIndex)))
+	tracing.EndSpan(span, nil)
 
-			receivedCouchDBIndexMappingDocument := indexMappingDocument{}
+	return idsOfDocsWithAMatchingIndex, nil
+}
 
-			err = json.Unmarshal(value, &receivedCouchDBIndexMappingDocument)
-			if err != nil {
-				return nil, err
-			}
+// queryMappingDocumentsPage does the given mapping document query, which returns a single page of mapping documents,
+// and adds the IDs of the documents they map to to docIDs. It returns the number of mapping documents in the page
+// and the bookmark of the next page.
+func (c *CouchDBEDVStore) queryMappingDocumentsPage(ctx context.Context, query string, page int,
+	docIDs map[string]struct{}) (_ uint, _ string, err error) {
+	logger.Debugf(`Querying store %s with the following query: %s`, c.name, query)
 
-			idsOfDocsWithAMatchingIndex[receivedCouchDBIndexMappingDocument.MatchingEncryptedDocID] = struct{}{}
+	span := c.startRoundTrip(ctx, "Query")
+	span.SetAttributes(pageKey.Int(page))
 
-			ok, err = itr.Next()
-			if err != nil {
-				return nil, err
-			}
+	defer func() { tracing.EndSpan(span, err) }()
+
+	itr, err := c.coreStore.Query(query)
+	if err != nil {
+		return 0, "", err
+	}
+
+	ok, err := itr.Next()
+	if err != nil {
+		return 0, "", err
+	}
+
+	var numDocumentsReturned uint
 
-			numDocumentsReturned++
+	for ok {
+		value, valueErr := itr.Value()
+		if valueErr != nil {
+			return 0, "", valueErr
 		}
 
-		// This means that there are (potentially) more pages of documents to get. Need to do another query.
-		if numDocumentsReturned >= c.retrievalPageSize {
-			query = c.generateStringForMappingDocumentQuery(queryIndexName, itr.Bookmark())
-		} else {
-			doneWithQuery = true
+		receivedCouchDBIndexMappingDocument := indexMappingDocument{}
+
+		err = json.Unmarshal(value, &receivedCouchDBIndexMappingDocument)
+		if err != nil {
+			return 0, "", err
 		}
 
-		err = itr.Release()
+		docIDs[receivedCouchDBIndexMappingDocument.MatchingEncryptedDocID] = struct{}{}
+
+		ok, err = itr.Next()
 		if err != nil {
-			return nil, err
+			return 0, "", err
 		}
+
+		numDocumentsReturned++
 	}
 
-	return idsOfDocsWithAMatchingIndex, nil
+	bookmark := itr.Bookmark()
+
+	err = itr.Release()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return numDocumentsReturned, bookmark, nil
 }
 
 func (c *CouchDBEDVStore) generateStringForMappingDocumentQuery(queryIndexName, bookmark string) string {
@@ -729,7 +854,12 @@ func (c *CouchDBEDVStore) generateStringForMappingDocumentQuery(queryIndexName,
 }
 
 // Given a set of documents, returns the document IDs that satisfy the query.
-func (c *CouchDBEDVStore) filterDocsByQuery(docIDs map[string]struct{}, query *models.Query) ([]string, error) {
+func (c *CouchDBEDVStore) filterDocsByQuery(ctx context.Context, docIDs map[string]struct{},
+	query *models.Query) (_ []string, err error) {
+	ctx, span := tracing.StartSpan(ctx, "CouchDBEDVStore.filterDocsByQuery", tracing.VaultIDKey.String(c.name),
+		tracing.DocumentsKey.Int(len(docIDs)))
+	defer func() { tracing.EndSpan(span, err) }()
+
 	matchingDocIDs := make([]string, 0)
 
 	var docIDsList []string
@@ -738,7 +868,10 @@ func (c *CouchDBEDVStore) filterDocsByQuery(docIDs map[string]struct{}, query *m
 		docIDsList = append(docIDsList, docID)
 	}
 
+	getBulkSpan := c.startRoundTrip(ctx, "GetBulk")
 	documentsBytes, err := c.coreStore.GetBulk(docIDsList...)
+	tracing.EndSpan(getBulkSpan, err)
+
 	if err != nil {
 		if errors.Is(err, storage.ErrValueNotFound) {
 			return nil, messages.ErrDocumentNotFound
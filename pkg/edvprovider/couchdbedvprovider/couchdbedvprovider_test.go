@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package couchdbedvprovider
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +17,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/trustbloc/edge-core/pkg/storage"
 	"github.com/trustbloc/edge-core/pkg/storage/mockstore"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
@@ -204,6 +209,12 @@ func TestCouchDBEDVProvider_OpenStore(t *testing.T) {
 	})
 }
 
+func TestCouchDBEDVProvider_Close(t *testing.T) {
+	prov := CouchDBEDVProvider{coreProvider: mockstore.NewMockStoreProvider()}
+
+	require.NoError(t, prov.Close())
+}
+
 func TestCouchDBEDVStore_Put(t *testing.T) {
 	t.Run("Success - no new encrypted indices", func(t *testing.T) {
 		mockCoreStore := mockstore.MockStore{Store: make(map[string][]byte)}
@@ -772,6 +783,72 @@ func TestCouchDBEDVStore_Query(t *testing.T) {
 	})
 }
 
+func TestCouchDBEDVStore_WithContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+
+	mockCoreStore := wrappedMockStore{
+		mockStoreToWrap: mockstore.MockStore{
+			Store: make(map[string][]byte),
+			ResultsIteratorToReturn: &mockIterator{
+				maxTimesNextCanBeCalled: 25,
+				valueReturn:             []byte(testQuery),
+			},
+		},
+		mockIterator: &mockIterator{
+			maxTimesNextCanBeCalled: 10,
+			valueReturn:             []byte(testQuery),
+		},
+	}
+
+	require.NoError(t, mockCoreStore.Put(testDocID1, []byte(testEncryptedDoc)))
+
+	ctx, requestSpan := otel.Tracer("test").Start(context.Background(), "request")
+
+	store := (&CouchDBEDVStore{coreStore: &mockCoreStore, name: testVaultID, retrievalPageSize: 25}).WithContext(ctx)
+
+	docs, err := store.Query(&models.Query{
+		Name:  "CUQaxPtSLtd8L3WBAIkJ4DiVJeqoF6bdnhR7lSaPloZ",
+		Value: "RV58Va4904K-18_L5g_vfARXRWEB00knFSGPpukUBro",
+	})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	requestSpan.End()
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+
+	var names []string
+
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		spans[span.Name()] = span
+
+		require.Equal(t, requestSpan.SpanContext().TraceID(), span.SpanContext().TraceID())
+	}
+
+	// Two pages of mapping documents are queried, then the documents are fetched once to filter them by the query
+	// and once to return them.
+	require.Equal(t, []string{
+		"CouchDB.Query", "CouchDB.Query", "CouchDBEDVStore.findDocsMatchingQueryIndexName", "CouchDB.GetBulk",
+		"CouchDBEDVStore.filterDocsByQuery", "CouchDB.GetBulk", "CouchDBEDVStore.Query", "request",
+	}, names)
+
+	requireParent := func(parent, child sdktrace.ReadOnlySpan) {
+		require.Equal(t, parent.SpanContext().SpanID(), child.Parent().SpanID(), child.Name())
+	}
+
+	requireParent(spans["request"], spans["CouchDBEDVStore.Query"])
+	requireParent(spans["CouchDBEDVStore.Query"], spans["CouchDBEDVStore.findDocsMatchingQueryIndexName"])
+	requireParent(spans["CouchDBEDVStore.findDocsMatchingQueryIndexName"], spans["CouchDB.Query"])
+	requireParent(spans["CouchDBEDVStore.Query"], spans["CouchDBEDVStore.filterDocsByQuery"])
+	require.Contains(t, spans["CouchDB.Query"].Attributes(), pageKey.Int(2))
+	require.Contains(t, spans["CouchDB.Query"].Attributes(), semconv.DBNameKey.String(testVaultID))
+}
+
 func TestCouchDBEDVStore_StoreDataVaultConfiguration(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		mockCoreStore := mockstore.MockStore{
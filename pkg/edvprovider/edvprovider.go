@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package edvprovider
 
 import (
+	"context"
 	"errors"
 
 	"github.com/trustbloc/edv/pkg/restapi/models"
@@ -36,6 +37,9 @@ type EDVProvider interface {
 
 	// OpenStore opens an existing store and returns it.
 	OpenStore(name string) (EDVStore, error)
+
+	// Close closes the stores of the provider and releases its resources, such as database connections.
+	Close() error
 }
 
 // EDVStore represents a store with functionality needed for EDV data storage.
@@ -73,3 +77,20 @@ type EDVStore interface {
 	// StoreDataVaultConfiguration stores the given DataVaultConfiguration and vaultID
 	StoreDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error
 }
+
+// ContextStore is implemented by stores that can bind a context to their calls, e.g. to trace them as part of the
+// request they were made for.
+type ContextStore interface {
+	// WithContext returns a copy of the store whose calls use ctx.
+	WithContext(ctx context.Context) EDVStore
+}
+
+// StoreWithContext returns a copy of the given store whose calls use ctx if the store implements ContextStore,
+// or the store itself otherwise.
+func StoreWithContext(ctx context.Context, store EDVStore) EDVStore {
+	if contextStore, ok := store.(ContextStore); ok {
+		return contextStore.WithContext(ctx)
+	}
+
+	return store
+}
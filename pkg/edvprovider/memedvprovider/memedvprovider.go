@@ -41,6 +41,11 @@ func (m MemEDVProvider) CreateStore(name string) error {
 	return m.coreProvider.CreateStore(name)
 }
 
+// Close closes all stores of the provider.
+func (m MemEDVProvider) Close() error {
+	return m.coreProvider.Close()
+}
+
 // OpenStore opens an existing store and returns it.
 func (m MemEDVProvider) OpenStore(name string) (edvprovider.EDVStore, error) {
 	coreStore, err := m.coreProvider.OpenStore(name)
@@ -29,6 +29,16 @@ func TestNewProvider(t *testing.T) {
 	require.NotNil(t, prov)
 }
 
+func TestMemEDVProvider_Close(t *testing.T) {
+	prov := NewProvider()
+
+	require.NoError(t, prov.CreateStore(testStoreName))
+	require.NoError(t, prov.Close())
+
+	_, err := prov.OpenStore(testStoreName)
+	require.True(t, errors.Is(err, storage.ErrStoreNotFound))
+}
+
 func TestMemEDVStore_GetAll(t *testing.T) {
 	t.Run("Success", func(t *testing.T) {
 		store := createAndOpenStoreExpectSuccess(t)
@@ -0,0 +1,207 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvtest
+
+import (
+	"sync"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// Op is a call to the EDV provider of the server, or to one of its stores.
+type Op string
+
+// Calls to the EDV provider and its stores that failures can be injected into.
+const (
+	OpCreateStore                 Op = "CreateStore"
+	OpOpenStore                   Op = "OpenStore"
+	OpPut                         Op = "Put"
+	OpUpsertBulk                  Op = "UpsertBulk"
+	OpGetAll                      Op = "GetAll"
+	OpGet                         Op = "Get"
+	OpUpdate                      Op = "Update"
+	OpDelete                      Op = "Delete"
+	OpCreateEDVIndex              Op = "CreateEDVIndex"
+	OpCreateEncryptedDocIDIndex   Op = "CreateEncryptedDocIDIndex"
+	OpQuery                       Op = "Query"
+	OpCreateReferenceIDIndex      Op = "CreateReferenceIDIndex"
+	OpStoreDataVaultConfiguration Op = "StoreDataVaultConfiguration"
+)
+
+// FailureHook is called before every call to the EDV provider of the server and its stores, with the call and the
+// name of the store (the vault ID for vault stores). A non-nil error fails the call with that error.
+type FailureHook func(op Op, storeName string) error
+
+// failingProvider wraps an EDV provider so that failures can be injected into its calls.
+type failingProvider struct {
+	provider edvprovider.EDVProvider
+
+	mutex    sync.Mutex
+	hook     FailureHook
+	failNext map[Op][]error
+}
+
+func newFailingProvider(provider edvprovider.EDVProvider) *failingProvider {
+	return &failingProvider{provider: provider, failNext: make(map[Op][]error)}
+}
+
+func (p *failingProvider) setHook(hook FailureHook) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.hook = hook
+}
+
+func (p *failingProvider) addFailure(op Op, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.failNext[op] = append(p.failNext[op], err)
+}
+
+// fail returns the injected failure of the call, if any.
+func (p *failingProvider) fail(op Op, storeName string) error {
+	p.mutex.Lock()
+
+	if errs := p.failNext[op]; len(errs) > 0 {
+		p.failNext[op] = errs[1:]
+		p.mutex.Unlock()
+
+		return errs[0]
+	}
+
+	hook := p.hook
+
+	p.mutex.Unlock()
+
+	if hook != nil {
+		return hook(op, storeName)
+	}
+
+	return nil
+}
+
+func (p *failingProvider) CreateStore(name string) error {
+	if err := p.fail(OpCreateStore, name); err != nil {
+		return err
+	}
+
+	return p.provider.CreateStore(name)
+}
+
+func (p *failingProvider) Close() error {
+	return p.provider.Close()
+}
+
+func (p *failingProvider) OpenStore(name string) (edvprovider.EDVStore, error) {
+	if err := p.fail(OpOpenStore, name); err != nil {
+		return nil, err
+	}
+
+	store, err := p.provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failingStore{store: store, name: name, provider: p}, nil
+}
+
+// failingStore wraps an EDV store so that failures can be injected into its calls.
+type failingStore struct {
+	store    edvprovider.EDVStore
+	name     string
+	provider *failingProvider
+}
+
+func (s *failingStore) Put(document models.EncryptedDocument) error {
+	if err := s.provider.fail(OpPut, s.name); err != nil {
+		return err
+	}
+
+	return s.store.Put(document)
+}
+
+func (s *failingStore) UpsertBulk(documents []models.EncryptedDocument) error {
+	if err := s.provider.fail(OpUpsertBulk, s.name); err != nil {
+		return err
+	}
+
+	return s.store.UpsertBulk(documents)
+}
+
+func (s *failingStore) GetAll() ([][]byte, error) {
+	if err := s.provider.fail(OpGetAll, s.name); err != nil {
+		return nil, err
+	}
+
+	return s.store.GetAll()
+}
+
+func (s *failingStore) Get(k string) ([]byte, error) {
+	if err := s.provider.fail(OpGet, s.name); err != nil {
+		return nil, err
+	}
+
+	return s.store.Get(k)
+}
+
+func (s *failingStore) Update(document models.EncryptedDocument) error {
+	if err := s.provider.fail(OpUpdate, s.name); err != nil {
+		return err
+	}
+
+	return s.store.Update(document)
+}
+
+func (s *failingStore) Delete(docID string) error {
+	if err := s.provider.fail(OpDelete, s.name); err != nil {
+		return err
+	}
+
+	return s.store.Delete(docID)
+}
+
+func (s *failingStore) CreateEDVIndex() error {
+	if err := s.provider.fail(OpCreateEDVIndex, s.name); err != nil {
+		return err
+	}
+
+	return s.store.CreateEDVIndex()
+}
+
+func (s *failingStore) CreateEncryptedDocIDIndex() error {
+	if err := s.provider.fail(OpCreateEncryptedDocIDIndex, s.name); err != nil {
+		return err
+	}
+
+	return s.store.CreateEncryptedDocIDIndex()
+}
+
+func (s *failingStore) Query(query *models.Query) ([]models.EncryptedDocument, error) {
+	if err := s.provider.fail(OpQuery, s.name); err != nil {
+		return nil, err
+	}
+
+	return s.store.Query(query)
+}
+
+func (s *failingStore) CreateReferenceIDIndex() error {
+	if err := s.provider.fail(OpCreateReferenceIDIndex, s.name); err != nil {
+		return err
+	}
+
+	return s.store.CreateReferenceIDIndex()
+}
+
+func (s *failingStore) StoreDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
+	if err := s.provider.fail(OpStoreDataVaultConfiguration, s.name); err != nil {
+		return err
+	}
+
+	return s.store.StoreDataVaultConfiguration(config, vaultID)
+}
@@ -0,0 +1,294 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package edvtest provides an in-process EDV server for integration tests of code that uses EDV servers, so that
+// they don't need to run the EDV server in a container. The server runs the same REST API as the EDV server, on an
+// httptest.Server, with an in-memory provider by default.
+package edvtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/restapi"
+	"github.com/trustbloc/edv/pkg/restapi/idempotency"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+const (
+	// EndpointPath is the path of the encrypted data vaults endpoint of the server.
+	EndpointPath = "/encrypted-data-vaults"
+)
+
+// AuthService authorizes requests to vault and document endpoints, and creates the authorization payload (e.g. a
+// capability) returned with new vaults. The zcapld and oauth2 services in the auth packages implement it.
+type AuthService interface {
+	restapi.AuthService
+	Create(resourceID, verificationMethod string) ([]byte, error)
+}
+
+// Option configures the server.
+type Option func(s *Server)
+
+// WithProvider sets the EDV provider of the server. Defaults to an in-memory provider, which doesn't support
+// encrypted index queries.
+func WithProvider(provider edvprovider.EDVProvider) Option {
+	return func(s *Server) {
+		s.edvProvider = provider
+	}
+}
+
+// WithExtensions sets the extensions that are enabled on the server. No extensions are enabled by default, like on
+// the EDV server.
+func WithExtensions(extensions *operation.EnabledExtensions) Option {
+	return func(s *Server) {
+		s.extensions = extensions
+	}
+}
+
+// WithAuth enables authorization with the given auth service. handlers are additional REST handlers to serve,
+// such as the capability management endpoints of the zcapld service.
+func WithAuth(authService AuthService, handlers ...operation.Handler) Option {
+	return func(s *Server) {
+		s.authService = authService
+		s.authHandlers = handlers
+	}
+}
+
+// WithIdempotencyKeys makes requests that create data vaults and documents idempotent by their Idempotency-Key
+// header, with responses stored in memory for the given duration.
+func WithIdempotencyKeys(ttl time.Duration) Option {
+	return func(s *Server) {
+		s.idempotencyKeyTTL = ttl
+	}
+}
+
+// WithClientOptions sets the options of the client returned by Client.
+func WithClientOptions(opts ...client.Option) Option {
+	return func(s *Server) {
+		s.clientOpts = opts
+	}
+}
+
+// Server is an in-process EDV server.
+type Server struct {
+	// URL is the URL of the encrypted data vaults endpoint of the server,
+	// e.g. http://127.0.0.1:1234/encrypted-data-vaults.
+	URL string
+
+	httpServer        *httptest.Server
+	client            *client.Client
+	edvProvider       edvprovider.EDVProvider
+	provider          *failingProvider
+	extensions        *operation.EnabledExtensions
+	authService       AuthService
+	authHandlers      []operation.Handler
+	idempotencyKeyTTL time.Duration
+	clientOpts        []client.Option
+
+	mutex          sync.Mutex
+	failedRequests int
+	failStatusCode int
+}
+
+// NewServer starts a new EDV server, which is closed when the test and its subtests complete.
+func NewServer(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	s, err := Start(opts...)
+	if err != nil {
+		t.Fatalf("failed to start EDV server: %s", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Start starts a new EDV server. It must be closed with Close.
+func Start(opts ...Option) (*Server, error) {
+	s := &Server{edvProvider: memedvprovider.NewProvider()}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.provider = newFailingProvider(s.edvProvider)
+
+	router, err := s.createRouter()
+	if err != nil {
+		return nil, err
+	}
+
+	s.httpServer = httptest.NewServer(s.failRequests(router))
+	s.URL = s.httpServer.URL + EndpointPath
+	s.client = client.New(s.URL, s.clientOpts...)
+
+	return s, nil
+}
+
+func (s *Server) createRouter() (*mux.Router, error) {
+	if err := operation.CreateConfigStore(s.edvProvider); err != nil {
+		return nil, fmt.Errorf("failed to create data vault configuration store: %w", err)
+	}
+
+	config := &operation.Config{Provider: s.provider, EnabledExtensions: s.extensions}
+
+	if s.authService != nil {
+		config.AuthEnable = true
+		config.AuthService = s.authService
+	}
+
+	if s.idempotencyKeyTTL > 0 {
+		keys, err := idempotency.New(ariesmemstorage.NewProvider(), s.idempotencyKeyTTL)
+		if err != nil {
+			return nil, err
+		}
+
+		config.IdempotencyKeys = keys
+	}
+
+	edvService, err := restapi.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	authMiddleware := restapi.NewAuthMiddleware(s.authService)
+
+	if s.authService != nil {
+		router.Use(authMiddleware.Middleware)
+	}
+
+	for _, handler := range append(edvService.GetOperations(), s.authHandlers...) {
+		authMiddleware.HandleFunc(router, handler)
+	}
+
+	return router, nil
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// Client returns a client for the server.
+func (s *Server) Client() *client.Client {
+	return s.client
+}
+
+// NewClient returns a new client for the server with the given options.
+func (s *Server) NewClient(opts ...client.Option) *client.Client {
+	return client.New(s.URL, opts...)
+}
+
+// FailNext makes the next call to op fail with err. Calls to FailNext for the same op add up: the next calls fail
+// with the errors in the order they were added.
+func (s *Server) FailNext(op Op, err error) {
+	s.provider.addFailure(op, err)
+}
+
+// SetFailureHook sets a hook that can fail calls to the EDV provider and its stores (see FailureHook). Failures
+// added with FailNext take precedence. A nil hook removes the hook.
+func (s *Server) SetFailureHook(hook FailureHook) {
+	s.provider.setHook(hook)
+}
+
+// FailNextRequests makes the server respond to the next n requests with the given status code without processing
+// them, e.g. to test retries. The responses have the same JSON error body as the ones of the EDV server.
+func (s *Server) FailNextRequests(n, statusCode int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failedRequests = n
+	s.failStatusCode = statusCode
+}
+
+func (s *Server) failRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s.mutex.Lock()
+
+		fail, statusCode := s.failedRequests > 0, s.failStatusCode
+		if fail {
+			s.failedRequests--
+		}
+
+		s.mutex.Unlock()
+
+		if fail {
+			_ = support.WriteError(rw, statusCode, nil, http.StatusText(statusCode)) //nolint: errcheck
+
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// Documents returns the encrypted documents stored in the given vault. Failures injected with FailNext and
+// SetFailureHook don't apply.
+func (s *Server) Documents(vaultID string) ([]models.EncryptedDocument, error) {
+	store, err := s.edvProvider.OpenStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault %s: %w", vaultID, err)
+	}
+
+	values, err := store.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get documents in vault %s: %w", vaultID, err)
+	}
+
+	documents := make([]models.EncryptedDocument, 0, len(values))
+
+	for _, value := range values {
+		var document models.EncryptedDocument
+
+		if err := json.Unmarshal(value, &document); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal document in vault %s: %w", vaultID, err)
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// Document returns the encrypted document with the given ID stored in the given vault. Failures injected with
+// FailNext and SetFailureHook don't apply.
+func (s *Server) Document(vaultID, docID string) (*models.EncryptedDocument, error) {
+	store, err := s.edvProvider.OpenStore(vaultID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault %s: %w", vaultID, err)
+	}
+
+	value, err := store.Get(docID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	var document models.EncryptedDocument
+
+	if err := json.Unmarshal(value, &document); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal document %s in vault %s: %w", docID, vaultID, err)
+	}
+
+	return &document, nil
+}
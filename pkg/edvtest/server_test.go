@@ -0,0 +1,337 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package edvtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/client"
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/edvutils"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+const (
+	testJWE = `{"protected":"eyJlbmMiOiJDMjBQIn0","recipients":[{"header":{"alg":"A256KW","kid":"https://exam` +
+		`ple.com/kms/z7BgF536GaR"},"encrypted_key":"OR1vdCNvf_B68mfUxFQVT-vyXVrBembuiM40mAAjDC1-Qu5iArDbug"}],` +
+		`"iv":"i8Nins2vTI3PlrYW","ciphertext":"Cb-963UCXblINT8F6MDHzMJN9EAhK3I","tag":"pfZO0JulJcrc3trOZy8rjA"}`
+
+	testCapability = `{"id":"urn:uuid:1234"}`
+)
+
+func TestNewServer(t *testing.T) {
+	t.Run("create, read, update and delete documents", func(t *testing.T) {
+		srv := NewServer(t)
+		require.True(t, strings.HasSuffix(srv.URL, EndpointPath))
+
+		vaultID := createVault(t, srv.Client())
+		document := newDocument(t)
+
+		_, err := srv.Client().CreateDocument(vaultID, document)
+		require.NoError(t, err)
+
+		readDocument, err := srv.Client().ReadDocument(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, document.ID, readDocument.ID)
+
+		document.Sequence = 1
+		require.NoError(t, srv.Client().UpdateDocument(vaultID, document.ID, document))
+
+		storedDocument, err := srv.Document(vaultID, document.ID)
+		require.NoError(t, err)
+		require.Equal(t, uint64(1), storedDocument.Sequence)
+
+		require.NoError(t, srv.Client().DeleteDocument(vaultID, document.ID))
+
+		_, err = srv.Client().ReadDocument(vaultID, document.ID)
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+	})
+
+	t.Run("extensions", func(t *testing.T) {
+		srv := NewServer(t, WithExtensions(&operation.EnabledExtensions{
+			ReadAllDocumentsEndpoint: true,
+			Batch:                    true,
+		}))
+
+		vaultID := createVault(t, srv.Client())
+		document := newDocument(t)
+
+		_, err := srv.Client().Batch(vaultID, &models.Batch{
+			{Operation: models.UpsertDocumentVaultOperation, EncryptedDocument: *document},
+		})
+		require.NoError(t, err)
+
+		documents, err := srv.Client().ReadAllDocuments(vaultID)
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+		require.Equal(t, document.ID, documents[0].ID)
+	})
+
+	t.Run("extensions disabled by default", func(t *testing.T) {
+		srv := NewServer(t)
+
+		_, err := srv.Client().ReadAllDocuments(createVault(t, srv.Client()))
+		require.Error(t, err)
+	})
+
+	t.Run("with provider", func(t *testing.T) {
+		provider := memedvprovider.NewProvider()
+
+		srv := NewServer(t, WithProvider(provider))
+
+		vaultID := createVault(t, srv.Client())
+
+		store, err := provider.OpenStore(vaultID)
+		require.NoError(t, err)
+		require.NotNil(t, store)
+	})
+
+	t.Run("with idempotency keys", func(t *testing.T) {
+		srv := NewServer(t, WithIdempotencyKeys(time.Minute))
+
+		vaultID := createVault(t, srv.Client())
+		document := newDocument(t)
+
+		location1, err := srv.Client().CreateDocument(vaultID, document, client.WithIdempotencyKey("key"))
+		require.NoError(t, err)
+
+		location2, err := srv.Client().CreateDocument(vaultID, document, client.WithIdempotencyKey("key"))
+		require.NoError(t, err)
+		require.Equal(t, location1, location2)
+	})
+
+	t.Run("with auth", func(t *testing.T) {
+		authService := &mockAuthService{}
+
+		srv := NewServer(t, WithAuth(authService))
+
+		location, capability, err := srv.Client().CreateDataVault(testDataVaultConfiguration(t))
+		require.NoError(t, err)
+		require.Equal(t, testCapability, string(capability))
+
+		vaultID := location[strings.LastIndex(location, "/")+1:]
+
+		_, err = srv.Client().CreateDocument(vaultID, newDocument(t))
+		require.NoError(t, err)
+
+		authService.reject = true
+
+		_, err = srv.Client().CreateDocument(vaultID, newDocument(t))
+		require.True(t, errors.Is(err, client.ErrUnauthorized))
+	})
+
+	t.Run("with client options", func(t *testing.T) {
+		srv := NewServer(t, WithClientOptions(client.WithRetryPolicy(&client.RetryPolicy{
+			InitialBackoff: time.Millisecond,
+		})))
+
+		srv.FailNextRequests(2, http.StatusServiceUnavailable)
+
+		createVault(t, srv.Client())
+	})
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv := NewServer(t)
+
+	vaultID := createVault(t, srv.Client())
+
+	t.Run("fails the next calls", func(t *testing.T) {
+		srv.FailNext(OpPut, errors.New("put failure 1"))
+		srv.FailNext(OpPut, errors.New("put failure 2"))
+
+		document := newDocument(t)
+
+		_, err := srv.Client().CreateDocument(vaultID, document)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "put failure 1")
+
+		_, err = srv.Client().CreateDocument(vaultID, document)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "put failure 2")
+
+		_, err = srv.Client().CreateDocument(vaultID, document)
+		require.NoError(t, err)
+	})
+
+	t.Run("failure hook", func(t *testing.T) {
+		srv.SetFailureHook(func(op Op, storeName string) error {
+			if op == OpGet && storeName == vaultID {
+				return errors.New("get failure")
+			}
+
+			return nil
+		})
+
+		_, err := srv.Client().ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "get failure")
+
+		srv.SetFailureHook(nil)
+
+		_, err = srv.Client().ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+	})
+
+	t.Run("fail next requests", func(t *testing.T) {
+		srv.FailNextRequests(1, http.StatusServiceUnavailable)
+
+		_, err := srv.Client().ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "503")
+
+		_, err = srv.Client().ReadDocument(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.True(t, errors.Is(err, client.ErrDocumentNotFound))
+	})
+
+	t.Run("failed requests have a JSON error body", func(t *testing.T) {
+		srv.FailNextRequests(1, http.StatusServiceUnavailable)
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet,
+			srv.URL+"/"+vaultID+"/documents/VJYHHJx4C8J9Fsgz7rZqSp", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		defer func() {
+			require.NoError(t, resp.Body.Close())
+		}()
+
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+		var errResp models.ErrorResponse
+
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&errResp))
+		require.Equal(t, http.StatusText(http.StatusServiceUnavailable), errResp.Message)
+		require.NotEmpty(t, errResp.Code)
+	})
+}
+
+func TestServer_Documents(t *testing.T) {
+	srv := NewServer(t)
+
+	vaultID := createVault(t, srv.Client())
+
+	t.Run("success", func(t *testing.T) {
+		documents, err := srv.Documents(vaultID)
+		require.NoError(t, err)
+		require.Empty(t, documents)
+
+		document := newDocument(t)
+
+		_, err = srv.Client().CreateDocument(vaultID, document)
+		require.NoError(t, err)
+
+		srv.FailNext(OpGetAll, errors.New("get all failure"))
+
+		documents, err = srv.Documents(vaultID)
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+		require.Equal(t, document.ID, documents[0].ID)
+		require.JSONEq(t, testJWE, string(documents[0].JWE))
+	})
+
+	t.Run("vault not found", func(t *testing.T) {
+		_, err := srv.Documents("vault")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to open vault vault")
+
+		_, err = srv.Document("vault", "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to open vault vault")
+	})
+
+	t.Run("document not found", func(t *testing.T) {
+		_, err := srv.Document(vaultID, "VJYHHJx4C8J9Fsgz7rZqSp")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get document VJYHHJx4C8J9Fsgz7rZqSp")
+	})
+}
+
+func TestStart(t *testing.T) {
+	srv, err := Start()
+	require.NoError(t, err)
+
+	createVault(t, srv.Client())
+	createVault(t, srv.NewClient(client.WithTimeout(time.Second)))
+
+	srv.Close()
+
+	_, _, err = srv.Client().CreateDataVault(testDataVaultConfiguration(t))
+	require.Error(t, err)
+}
+
+func createVault(t *testing.T, c *client.Client) string {
+	t.Helper()
+
+	location, _, err := c.CreateDataVault(testDataVaultConfiguration(t))
+	require.NoError(t, err)
+
+	return location[strings.LastIndex(location, "/")+1:]
+}
+
+func newDocument(t *testing.T) *models.EncryptedDocument {
+	t.Helper()
+
+	docID, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	return &models.EncryptedDocument{ID: docID, JWE: []byte(testJWE)}
+}
+
+func testDataVaultConfiguration(t *testing.T) *models.DataVaultConfiguration {
+	t.Helper()
+
+	referenceID, err := edvutils.GenerateEDVCompatibleID()
+	require.NoError(t, err)
+
+	return &models.DataVaultConfiguration{
+		Controller:  "did:example:123",
+		ReferenceID: referenceID,
+		KEK:         models.IDTypePair{ID: "https://example.com/kms/12345", Type: "AesKeyWrappingKey2019"},
+		HMAC:        models.IDTypePair{ID: "https://example.com/kms/67891", Type: "Sha256HmacKey2019"},
+	}
+}
+
+type mockAuthService struct {
+	reject bool
+}
+
+func (m *mockAuthService) Create(_, _ string) ([]byte, error) {
+	return []byte(testCapability), nil
+}
+
+func (m *mockAuthService) Handler(_ string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return m.handler(next), nil
+}
+
+func (m *mockAuthService) DocumentHandler(_, _ string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	return m.handler(next), nil
+}
+
+func (m *mockAuthService) handler(next http.HandlerFunc) http.HandlerFunc {
+	if m.reject {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}
+
+	return next
+}
@@ -24,6 +24,9 @@ import (
 const (
 	jweAlgField = "alg"
 	none        = "none"
+
+	// IDBytes is the number of bytes that EDV compatible IDs are base58 encodings of.
+	IDBytes = 16
 )
 
 type generateRandomBytesFunc func([]byte) (int, error)
@@ -34,7 +37,7 @@ func GenerateEDVCompatibleID() (string, error) {
 }
 
 func generateEDVCompatibleID(generateRandomBytes generateRandomBytesFunc) (string, error) {
-	randomBytes := make([]byte, 16)
+	randomBytes := make([]byte, IDBytes)
 
 	_, err := generateRandomBytes(randomBytes)
 	if err != nil {
@@ -51,14 +54,12 @@ func generateEDVCompatibleID(generateRandomBytes generateRandomBytesFunc) (strin
 // So the closest I can do is see if the decoded byte array is 16 bytes long,
 // however this means that if the original value was 121 bits to 127 bits long it'll still be accepted.
 func CheckIfBase58Encoded128BitValue(id string) error {
-	const number16 = 16
-
 	decodedBytes := base58.Decode(id)
 	if len(decodedBytes) == 0 {
 		return messages.ErrNotBase58Encoded
 	}
 
-	if len(decodedBytes) != number16 {
+	if len(decodedBytes) != IDBytes {
 		return messages.ErrNot128BitValue
 	}
 
@@ -98,6 +99,12 @@ func CheckIfArrayIsURI(arr []string) error {
 	return nil
 }
 
+// RejectedJWEAlgorithms returns the JWE key management algorithms that ValidateJWE rejects. Any other algorithm
+// is accepted, since documents are encrypted and decrypted by clients.
+func RejectedJWEAlgorithms() []string {
+	return []string{none}
+}
+
 // ValidateJWE returns an error if the given raw JWE is empty or has invalid alg fields.
 func ValidateJWE(rawJWE []byte) error {
 	if len(rawJWE) == 0 {
@@ -0,0 +1,27 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package support
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// WriteError writes a JSON error response with the given status code and message. The code of the response is
+// the code of the EDV error that err wraps (see messages.ErrorCode). err may be nil.
+func WriteError(rw http.ResponseWriter, statusCode int, err error, msg string) error {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+
+	return json.NewEncoder(rw).Encode(models.ErrorResponse{
+		Code:    messages.ErrorCode(err, statusCode),
+		Message: msg,
+	})
+}
@@ -0,0 +1,49 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package support
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+)
+
+func TestWriteError(t *testing.T) {
+	t.Run("code of wrapped EDV error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		err := WriteError(rr, http.StatusNotFound, fmt.Errorf("read failed: %w", messages.ErrVaultNotFound),
+			"vault not found")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusNotFound, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		require.JSONEq(t, `{"code":"vault_not_found","message":"vault not found"}`, rr.Body.String())
+	})
+
+	t.Run("code of status code", func(t *testing.T) {
+		for statusCode, code := range map[int]string{
+			http.StatusBadRequest:          messages.CodeInvalidRequest,
+			http.StatusUnauthorized:        messages.CodeUnauthorized,
+			http.StatusForbidden:           messages.CodeForbidden,
+			http.StatusNotFound:            messages.CodeNotFound,
+			http.StatusConflict:            messages.CodeConflict,
+			http.StatusUnprocessableEntity: messages.CodeInvalidRequest,
+			http.StatusServiceUnavailable:  messages.CodeInternal,
+		} {
+			rr := httptest.NewRecorder()
+
+			require.NoError(t, WriteError(rr, statusCode, errors.New("error"), "message"))
+			require.JSONEq(t, `{"code":"`+code+`","message":"message"}`, rr.Body.String())
+		}
+	})
+}
@@ -8,6 +8,8 @@ package support
 
 import (
 	"net/http"
+
+	"github.com/trustbloc/edv/pkg/auth"
 )
 
 // NewHTTPHandler returns instance of HTTPHandler which can be used to handle http requests
@@ -15,12 +17,20 @@ func NewHTTPHandler(path, method string, handle http.HandlerFunc) *HTTPHandler {
 	return &HTTPHandler{path: path, method: method, handle: handle}
 }
 
+// NewHTTPHandlerWithAuth returns instance of HTTPHandler which can be used to handle http requests
+// that must be authorized according to the given requirement.
+func NewHTTPHandlerWithAuth(path, method string, handle http.HandlerFunc,
+	authRequirement auth.Requirement) *HTTPHandler {
+	return &HTTPHandler{path: path, method: method, handle: handle, authRequirement: authRequirement}
+}
+
 // HTTPHandler contains REST API handling details which can be used to build routers
 // for http requests for given path
 type HTTPHandler struct {
-	path   string
-	method string
-	handle http.HandlerFunc
+	path            string
+	method          string
+	handle          http.HandlerFunc
+	authRequirement auth.Requirement
 }
 
 // Path returns http request path
@@ -37,3 +47,8 @@ func (h *HTTPHandler) Method() string {
 func (h *HTTPHandler) Handle() http.HandlerFunc {
 	return h.handle
 }
+
+// AuthRequirement returns how http requests must be authorized
+func (h *HTTPHandler) AuthRequirement() auth.Requirement {
+	return h.authRequirement
+}
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
 )
 
 func TestNewHTTPHandler(t *testing.T) {
@@ -27,6 +29,7 @@ func TestNewHTTPHandler(t *testing.T) {
 	require.Equal(t, path, handler.Path())
 	require.Equal(t, method, handler.Method())
 	require.NotNil(t, handler.Handle())
+	require.Equal(t, auth.Admin, handler.AuthRequirement())
 
 	go handler.Handle()(nil, nil)
 
@@ -37,3 +40,12 @@ func TestNewHTTPHandler(t *testing.T) {
 		t.Fatal("handler function didn't get executed")
 	}
 }
+
+func TestNewHTTPHandlerWithAuth(t *testing.T) {
+	handler := NewHTTPHandlerWithAuth("/sample-path", http.MethodGet, func(w http.ResponseWriter, r *http.Request) {},
+		auth.Document)
+	require.Equal(t, "/sample-path", handler.Path())
+	require.Equal(t, http.MethodGet, handler.Method())
+	require.NotNil(t, handler.Handle())
+	require.Equal(t, auth.Document, handler.AuthRequirement())
+}
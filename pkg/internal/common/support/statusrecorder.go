@@ -0,0 +1,54 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package support
+
+import "net/http"
+
+// StatusRecorder is an http.ResponseWriter that records the status code of the response, for middlewares that
+// need it once the request has been handled. Responses that are written without calling WriteHeader have status
+// code 200. Flushes are passed on to the wrapped writer if it implements http.Flusher.
+type StatusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+// NewStatusRecorder returns a StatusRecorder that wraps w.
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+// StatusCode returns the status code of the response.
+func (r *StatusRecorder) StatusCode() int {
+	return r.statusCode
+}
+
+// WriteHeader records the status code, if the header hasn't been written yet, and writes it.
+func (r *StatusRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes b to the response.
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush sends any buffered data to the client, if the wrapped writer supports it.
+func (r *StatusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		r.wroteHeader = true
+
+		flusher.Flush()
+	}
+}
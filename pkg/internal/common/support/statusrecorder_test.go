@@ -0,0 +1,66 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package support
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	t.Run("status code is 200 if the header isn't written", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		recorder := NewStatusRecorder(rr)
+
+		_, err := recorder.Write([]byte("body"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, recorder.StatusCode())
+		require.Equal(t, "body", rr.Body.String())
+	})
+
+	t.Run("first status code written is recorded", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		recorder := NewStatusRecorder(rr)
+
+		recorder.WriteHeader(http.StatusNotFound)
+		recorder.WriteHeader(http.StatusInternalServerError)
+		require.Equal(t, http.StatusNotFound, recorder.StatusCode())
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("status code can't be written after the body", func(t *testing.T) {
+		recorder := NewStatusRecorder(httptest.NewRecorder())
+
+		_, err := recorder.Write([]byte("body"))
+		require.NoError(t, err)
+
+		recorder.WriteHeader(http.StatusNotFound)
+		require.Equal(t, http.StatusOK, recorder.StatusCode())
+	})
+
+	t.Run("flushes are passed on", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+
+		var w http.ResponseWriter = NewStatusRecorder(rr)
+
+		flusher, ok := w.(http.Flusher)
+		require.True(t, ok)
+
+		flusher.Flush()
+		require.True(t, rr.Flushed)
+	})
+
+	t.Run("flushes are ignored if the writer doesn't support them", func(t *testing.T) {
+		recorder := NewStatusRecorder(struct{ http.ResponseWriter }{httptest.NewRecorder()})
+
+		require.NotPanics(t, recorder.Flush)
+		require.Equal(t, http.StatusOK, recorder.StatusCode())
+	})
+}
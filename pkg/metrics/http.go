@@ -0,0 +1,43 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+// Middleware is a mux middleware that records the number and duration of requests by route, method and status
+// code. Routes are labelled by their path template (e.g. /encrypted-data-vaults/{vaultID}/documents), so that
+// vault and document IDs don't add time series. Add it to the router with Use before the auth middleware, so that
+// rejected requests are recorded too.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := support.NewStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		status := strconv.Itoa(recorder.StatusCode())
+
+		m.httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		m.httpRequestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
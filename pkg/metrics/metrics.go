@@ -0,0 +1,118 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package metrics collects Prometheus metrics of an EDV server: HTTP requests, storage provider calls, batch sizes
+// and zcap authorization outcomes.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "edv"
+
+// Option configures the metrics.
+type Option func(m *Metrics)
+
+// WithVaultLabel labels the storage metrics with the ID of the vault (i.e. the name of the store) that was accessed.
+// Every vault adds its own time series, so this should only be enabled on servers with few vaults.
+func WithVaultLabel() Option {
+	return func(m *Metrics) {
+		m.vaultLabel = true
+	}
+}
+
+// Metrics collects the metrics of an EDV server.
+type Metrics struct {
+	registry   *prometheus.Registry
+	vaultLabel bool
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	storeOperations     *prometheus.CounterVec
+	storeDuration       *prometheus.HistogramVec
+	storeDocuments      *prometheus.HistogramVec
+	batchSize           prometheus.Histogram
+	zcapAuthorizations  *prometheus.CounterVec
+}
+
+// New returns new metrics, registered in their own registry along with the Go runtime and process metrics.
+func New(opts ...Option) (*Metrics, error) {
+	// 1 to 16384 documents or vault operations.
+	countBuckets := prometheus.ExponentialBuckets(1, 4, 8) //nolint: gomnd
+
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "http", Name: "requests_total",
+			Help: "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests by route, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storeOperations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "store", Name: "operations_total",
+			Help: "Number of storage provider calls by provider, operation, vault and result " +
+				"(success, not_found or error).",
+		}, []string{"provider", "operation", "vault", "result"}),
+		storeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "store", Name: "operation_duration_seconds",
+			Help:    "Time taken by storage provider calls by provider, operation and vault.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider", "operation", "vault"}),
+		storeDocuments: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "store", Name: "documents_returned",
+			Help:    "Number of documents returned by storage provider reads and queries.",
+			Buckets: countBuckets,
+		}, []string{"provider", "operation", "vault"}),
+		batchSize: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "batch", Name: "size",
+			Help:    "Number of vault operations in batch requests.",
+			Buckets: countBuckets,
+		}),
+		zcapAuthorizations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "zcap", Name: "authorizations_total",
+			Help: "Number of zcap capability invocations by outcome.",
+		}, []string{"outcome"}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	for _, collector := range []prometheus.Collector{
+		m.httpRequests, m.httpRequestDuration, m.storeOperations, m.storeDuration, m.storeDocuments, m.batchSize,
+		m.zcapAuthorizations, prometheus.NewGoCollector(), prometheus.NewProcessCollector(
+			prometheus.ProcessCollectorOpts{}),
+	} {
+		if err := m.registry.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register metrics collector: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Handler returns the handler that serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveBatchSize records the number of vault operations in a batch request.
+func (m *Metrics) ObserveBatchSize(size int) {
+	m.batchSize.Observe(float64(size))
+}
+
+// ObserveZCAPAuthorization records the outcome of a zcap capability invocation.
+func (m *Metrics) ObserveZCAPAuthorization(outcome string) {
+	m.zcapAuthorizations.WithLabelValues(outcome).Inc()
+}
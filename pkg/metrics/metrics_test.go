@@ -0,0 +1,178 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testVaultID = "Sr7yHjomhn1aeaFnxREfRN"
+	testDocID   = "BJYHHJx4C8J9Fsgz7rZqSp"
+)
+
+func TestMetrics_Handler(t *testing.T) {
+	m, err := New()
+	require.NoError(t, err)
+
+	m.ObserveBatchSize(3)
+	m.ObserveZCAPAuthorization("authorized")
+
+	rr := httptest.NewRecorder()
+
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Contains(t, rr.Body.String(), "edv_batch_size_sum 3")
+	require.Contains(t, rr.Body.String(), `edv_zcap_authorizations_total{outcome="authorized"} 1`)
+	require.Contains(t, rr.Body.String(), "go_goroutines")
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	m, err := New()
+	require.NoError(t, err)
+
+	router := mux.NewRouter()
+	router.Use(m.Middleware)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/documents", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusNotFound)
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("documents")) //nolint: errcheck
+	}).Methods(http.MethodGet)
+
+	for _, target := range []string{
+		"/encrypted-data-vaults/v1/documents", "/encrypted-data-vaults/v2/documents",
+		"/encrypted-data-vaults/v1/documents?fail=true",
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	route := "/encrypted-data-vaults/{vaultID}/documents"
+
+	require.Equal(t, float64(2), testutil.ToFloat64(m.httpRequests.WithLabelValues(route, http.MethodGet, "200")))
+	require.Equal(t, float64(1), testutil.ToFloat64(m.httpRequests.WithLabelValues(route, http.MethodGet, "404")))
+	require.Equal(t, 2, testutil.CollectAndCount(m.httpRequestDuration))
+
+	t.Run("without route", func(t *testing.T) {
+		m.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		require.Equal(t, float64(1),
+			testutil.ToFloat64(m.httpRequests.WithLabelValues("unknown", http.MethodGet, "404")))
+	})
+}
+
+func TestMetrics_InstrumentProvider(t *testing.T) {
+	t.Run("without vault label", func(t *testing.T) {
+		m, err := New()
+		require.NoError(t, err)
+
+		store := createTestStore(t, m.InstrumentProvider(memedvprovider.NewProvider(), "mem"))
+
+		// Calls are still recorded when bound to a context.
+		store = edvprovider.StoreWithContext(context.Background(), store)
+		require.IsType(t, &instrumentedStore{}, store)
+
+		require.NoError(t, store.Put(models.EncryptedDocument{ID: testDocID, JWE: []byte("{}")}))
+
+		_, err = store.Get(testDocID)
+		require.NoError(t, err)
+
+		_, err = store.Get("missing")
+		require.Error(t, err)
+
+		documents, err := store.GetAll()
+		require.NoError(t, err)
+		require.Len(t, documents, 1)
+
+		require.Equal(t, float64(1), testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "Put", "", "success")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "Get", "", "success")))
+		require.Equal(t, float64(1),
+			testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "Get", "", "not_found")))
+		require.Equal(t, float64(1),
+			testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "CreateEDVIndex", "", "not_supported")))
+
+		// Documents are only recorded for successful reads.
+		require.Equal(t, 2, testutil.CollectAndCount(m.storeDocuments))
+	})
+
+	t.Run("with vault label", func(t *testing.T) {
+		m, err := New(WithVaultLabel())
+		require.NoError(t, err)
+
+		store := createTestStore(t, m.InstrumentProvider(memedvprovider.NewProvider(), "mem"))
+
+		documents := []models.EncryptedDocument{{ID: testDocID, JWE: []byte("{}")}}
+
+		require.NoError(t, store.UpsertBulk(documents))
+		require.NoError(t, store.Update(documents[0]))
+		require.NoError(t, store.Delete(testDocID))
+		require.NoError(t, store.StoreDataVaultConfiguration(&models.DataVaultConfiguration{}, testVaultID))
+
+		for _, operation := range []string{
+			"CreateStore", "OpenStore", "UpsertBulk", "Update", "Delete", "StoreDataVaultConfiguration",
+		} {
+			require.Equal(t, float64(1),
+				testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", operation, testVaultID, "success")),
+				operation)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		m, err := New()
+		require.NoError(t, err)
+
+		provider := m.InstrumentProvider(memedvprovider.NewProvider(), "mem")
+
+		_, err = provider.OpenStore("missing")
+		require.Error(t, err)
+
+		store := createTestStore(t, provider)
+
+		_, err = store.Query(&models.Query{Name: "name", Value: "value"})
+		require.Error(t, err)
+
+		require.Error(t, store.CreateReferenceIDIndex())
+		require.Error(t, store.CreateEncryptedDocIDIndex())
+
+		require.Equal(t, float64(1),
+			testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "OpenStore", "", "not_found")))
+		require.Equal(t, float64(1), testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "Query", "", "error")))
+		require.Equal(t, float64(1),
+			testutil.ToFloat64(m.storeOperations.WithLabelValues("mem", "CreateReferenceIDIndex", "", "not_supported")))
+	})
+}
+
+func createTestStore(t *testing.T, provider edvprovider.EDVProvider) edvprovider.EDVStore {
+	t.Helper()
+
+	require.NoError(t, provider.CreateStore(testVaultID))
+
+	store, err := provider.OpenStore(testVaultID)
+	require.NoError(t, err)
+
+	err = store.CreateEDVIndex()
+	require.True(t, errors.Is(err, edvprovider.ErrIndexingNotSupported))
+
+	return store
+}
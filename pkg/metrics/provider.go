@@ -0,0 +1,219 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/trustbloc/edge-core/pkg/storage"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+// Results of storage provider calls.
+const (
+	resultSuccess      = "success"
+	resultNotFound     = "not_found"
+	resultNotSupported = "not_supported"
+	resultError        = "error"
+)
+
+// InstrumentProvider returns an EDV provider that records the number, duration and result of the calls to the
+// given provider and its stores, and the number of documents they return. providerName (e.g. the database type)
+// labels the metrics.
+func (m *Metrics) InstrumentProvider(provider edvprovider.EDVProvider, providerName string) edvprovider.EDVProvider {
+	return &instrumentedProvider{provider: provider, name: providerName, metrics: m}
+}
+
+type instrumentedProvider struct {
+	provider edvprovider.EDVProvider
+	name     string
+	metrics  *Metrics
+}
+
+func (p *instrumentedProvider) CreateStore(name string) error {
+	return p.observe("CreateStore", name, func() error {
+		return p.provider.CreateStore(name)
+	})
+}
+
+func (p *instrumentedProvider) Close() error {
+	return p.provider.Close()
+}
+
+func (p *instrumentedProvider) OpenStore(name string) (edvprovider.EDVStore, error) {
+	var store edvprovider.EDVStore
+
+	err := p.observe("OpenStore", name, func() error {
+		var err error
+
+		store, err = p.provider.OpenStore(name)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedStore{store: store, name: name, provider: p}, nil
+}
+
+// observe calls f and records the call as the given operation on the given store.
+func (p *instrumentedProvider) observe(operation, storeName string, f func() error) error {
+	vault := p.vault(storeName)
+	start := time.Now()
+
+	err := f()
+
+	p.metrics.storeDuration.WithLabelValues(p.name, operation, vault).Observe(time.Since(start).Seconds())
+	p.metrics.storeOperations.WithLabelValues(p.name, operation, vault, result(err)).Inc()
+
+	return err
+}
+
+// observeDocuments calls f and records the call as the given operation on the given store, along with the number
+// of documents it returned.
+func (p *instrumentedProvider) observeDocuments(operation, storeName string, f func() (int, error)) error {
+	var documents int
+
+	err := p.observe(operation, storeName, func() error {
+		var err error
+
+		documents, err = f()
+
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	p.metrics.storeDocuments.WithLabelValues(p.name, operation, p.vault(storeName)).Observe(float64(documents))
+
+	return nil
+}
+
+// vault returns the vault label of calls on the given store, which is empty unless WithVaultLabel is set.
+func (p *instrumentedProvider) vault(storeName string) string {
+	if !p.metrics.vaultLabel {
+		return ""
+	}
+
+	return storeName
+}
+
+func result(err error) string {
+	switch {
+	case err == nil:
+		return resultSuccess
+	case errors.Is(err, storage.ErrValueNotFound), errors.Is(err, storage.ErrStoreNotFound),
+		errors.Is(err, messages.ErrDocumentNotFound):
+		return resultNotFound
+	case errors.Is(err, edvprovider.ErrIndexingNotSupported):
+		return resultNotSupported
+	default:
+		return resultError
+	}
+}
+
+type instrumentedStore struct {
+	store    edvprovider.EDVStore
+	name     string
+	provider *instrumentedProvider
+}
+
+// WithContext returns a copy of the store whose calls to the instrumented store use ctx.
+func (s *instrumentedStore) WithContext(ctx context.Context) edvprovider.EDVStore {
+	return &instrumentedStore{store: edvprovider.StoreWithContext(ctx, s.store), name: s.name, provider: s.provider}
+}
+
+func (s *instrumentedStore) Put(document models.EncryptedDocument) error {
+	return s.provider.observe("Put", s.name, func() error {
+		return s.store.Put(document)
+	})
+}
+
+func (s *instrumentedStore) UpsertBulk(documents []models.EncryptedDocument) error {
+	return s.provider.observe("UpsertBulk", s.name, func() error {
+		return s.store.UpsertBulk(documents)
+	})
+}
+
+func (s *instrumentedStore) GetAll() ([][]byte, error) {
+	var documents [][]byte
+
+	err := s.provider.observeDocuments("GetAll", s.name, func() (int, error) {
+		var err error
+
+		documents, err = s.store.GetAll()
+
+		return len(documents), err
+	})
+
+	return documents, err
+}
+
+func (s *instrumentedStore) Get(k string) ([]byte, error) {
+	var document []byte
+
+	err := s.provider.observeDocuments("Get", s.name, func() (int, error) {
+		var err error
+
+		document, err = s.store.Get(k)
+
+		return 1, err
+	})
+
+	return document, err
+}
+
+func (s *instrumentedStore) Update(document models.EncryptedDocument) error {
+	return s.provider.observe("Update", s.name, func() error {
+		return s.store.Update(document)
+	})
+}
+
+func (s *instrumentedStore) Delete(docID string) error {
+	return s.provider.observe("Delete", s.name, func() error {
+		return s.store.Delete(docID)
+	})
+}
+
+func (s *instrumentedStore) CreateEDVIndex() error {
+	return s.provider.observe("CreateEDVIndex", s.name, s.store.CreateEDVIndex)
+}
+
+func (s *instrumentedStore) CreateEncryptedDocIDIndex() error {
+	return s.provider.observe("CreateEncryptedDocIDIndex", s.name, s.store.CreateEncryptedDocIDIndex)
+}
+
+func (s *instrumentedStore) Query(query *models.Query) ([]models.EncryptedDocument, error) {
+	var documents []models.EncryptedDocument
+
+	err := s.provider.observeDocuments("Query", s.name, func() (int, error) {
+		var err error
+
+		documents, err = s.store.Query(query)
+
+		return len(documents), err
+	})
+
+	return documents, err
+}
+
+func (s *instrumentedStore) CreateReferenceIDIndex() error {
+	return s.provider.observe("CreateReferenceIDIndex", s.name, s.store.CreateReferenceIDIndex)
+}
+
+func (s *instrumentedStore) StoreDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
+	return s.provider.observe("StoreDataVaultConfiguration", s.name, func() error {
+		return s.store.StoreDataVaultConfiguration(config, vaultID)
+	})
+}
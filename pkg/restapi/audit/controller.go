@@ -0,0 +1,32 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"github.com/trustbloc/edv/pkg/restapi/audit/operation"
+)
+
+// New returns new controller instance.
+func New(auditLog operation.AuditLog) *Controller {
+	var allHandlers []operation.Handler
+
+	auditService := operation.New(auditLog)
+
+	allHandlers = append(allHandlers, auditService.GetRESTHandlers()...)
+
+	return &Controller{handlers: allHandlers}
+}
+
+// Controller contains handlers for controller.
+type Controller struct {
+	handlers []operation.Handler
+}
+
+// GetOperations returns all controller endpoints.
+func (c *Controller) GetOperations() []operation.Handler {
+	return c.handlers
+}
@@ -0,0 +1,19 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestController_New(t *testing.T) {
+	controller := New(nil)
+	require.NotNil(t, controller)
+	require.Len(t, controller.GetOperations(), 1)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	edvoperation "github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+// API endpoints.
+const (
+	logModuleName = "edv-audit-restapi"
+
+	auditLogEndpoint = "/encrypted-data-vaults/{" + edvoperation.VaultIDPathVariable + "}/audit"
+)
+
+var logger = log.New(logModuleName)
+
+// Handler http handler for each controller API endpoint.
+type Handler interface {
+	Path() string
+	Method() string
+	Handle() http.HandlerFunc
+}
+
+// AuditLog holds the audit logs of vaults. audit.Log implements this interface.
+type AuditLog interface {
+	Entries(vaultID string) ([]*audit.Entry, error)
+}
+
+// New returns a new audit log operation.
+func New(auditLog AuditLog) *Operation {
+	return &Operation{auditLog: auditLog}
+}
+
+// Operation defines handlers for audit log operations.
+type Operation struct {
+	auditLog AuditLog
+}
+
+// GetRESTHandlers get all controller API handler available for this service.
+// The audit log of a vault can only be read by the vault's controller, since it shows who else accessed the vault.
+func (o *Operation) GetRESTHandlers() []Handler {
+	return []Handler{
+		support.NewHTTPHandlerWithAuth(auditLogEndpoint, http.MethodGet, o.readAuditLogHandler, auth.Controller),
+	}
+}
+
+// Read the audit log of a vault, in order.
+func (o *Operation) readAuditLogHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, err := url.PathUnescape(mux.Vars(req)[edvoperation.VaultIDPathVariable])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("failed to unescape %s: %w",
+			edvoperation.VaultIDPathVariable, err))
+
+		return
+	}
+
+	entries, err := o.auditLog.Entries(vaultID)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, fmt.Errorf("failed to read audit log: %w", err))
+
+		return
+	}
+
+	if entries == nil {
+		entries = []*audit.Entry{}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	if errEncode := json.NewEncoder(rw).Encode(entries); errEncode != nil {
+		logger.Errorf("failed to write audit log response: %s", errEncode)
+	}
+}
+
+func writeError(rw http.ResponseWriter, statusCode int, err error) {
+	logger.Errorf("audit log request failed: %s", err)
+
+	if errWrite := support.WriteError(rw, statusCode, err, err.Error()); errWrite != nil {
+		logger.Errorf("failed to write audit log error response: %s", errWrite)
+	}
+}
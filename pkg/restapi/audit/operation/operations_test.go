@@ -0,0 +1,114 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/audit"
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const testVaultID = "Sr7yHjomhn1aeaFnxREfRN"
+
+func TestGetRESTHandlers(t *testing.T) {
+	handlers := New(nil).GetRESTHandlers()
+	require.Equal(t, 1, len(handlers))
+
+	// Only the controller of a vault can read its audit log.
+	requirer, ok := handlers[0].(interface{ AuthRequirement() auth.Requirement })
+	require.True(t, ok)
+	require.Equal(t, auth.Controller, requirer.AuthRequirement())
+}
+
+func TestReadAuditLog(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		auditLog := &mockAuditLog{entries: []*audit.Entry{
+			{Sequence: 1, VaultID: testVaultID, Outcome: audit.OutcomeSuccess},
+			{Sequence: 2, VaultID: testVaultID, Outcome: audit.OutcomeDenied},
+		}}
+
+		rw := serve(t, auditLog, "/encrypted-data-vaults/"+testVaultID+"/audit")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, testVaultID, auditLog.vaultID)
+
+		var entries []*audit.Entry
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &entries))
+		require.Equal(t, auditLog.entries, entries)
+	})
+
+	t.Run("no entries", func(t *testing.T) {
+		rw := serve(t, &mockAuditLog{}, "/encrypted-data-vaults/"+testVaultID+"/audit")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "[]\n", rw.Body.String())
+	})
+
+	t.Run("invalid vault ID", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"vaultID": "%"})
+
+		New(&mockAuditLog{}).readAuditLogHandler(rw, req)
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, errorMessage(t, rw), "failed to unescape vaultID")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		rw := serve(t, &mockAuditLog{err: errors.New("db unavailable")},
+			"/encrypted-data-vaults/"+testVaultID+"/audit")
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Equal(t, "failed to read audit log: db unavailable", errorMessage(t, rw))
+	})
+}
+
+func errorMessage(t *testing.T, rw *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var errResponse models.ErrorResponse
+
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &errResponse))
+
+	return errResponse.Message
+}
+
+func serve(t *testing.T, auditLog AuditLog, target string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range New(auditLog).GetRESTHandlers() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	rw := httptest.NewRecorder()
+
+	router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, target, nil))
+
+	return rw
+}
+
+type mockAuditLog struct {
+	entries []*audit.Entry
+	vaultID string
+	err     error
+}
+
+func (m *mockAuditLog) Entries(vaultID string) ([]*audit.Entry, error) {
+	m.vaultID = vaultID
+
+	return m.entries, m.err
+}
@@ -0,0 +1,203 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package restapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+var logger = log.New("edv-restapi")
+
+var (
+	// errAdminNotAllowed is returned for requests to admin endpoints when no AdminAuthorizer has been configured.
+	errAdminNotAllowed = errors.New("admin endpoints are disabled while authorization is enabled")
+	// errControllerNotSupported is returned for requests to controller endpoints when the auth service can't
+	// authorize them.
+	errControllerNotSupported = errors.New("controller endpoints aren't supported by the auth service")
+)
+
+// AuthService authorizes requests to vault and document endpoints.
+type AuthService interface {
+	Handler(vaultID string, req *http.Request, w http.ResponseWriter, next http.HandlerFunc) (http.HandlerFunc, error)
+	DocumentHandler(vaultID, docID string, req *http.Request, w http.ResponseWriter,
+		next http.HandlerFunc) (http.HandlerFunc, error)
+}
+
+// controllerAuthService is implemented by auth services that can authorize requests to controller endpoints.
+// Requests to controller endpoints are forbidden if the auth service doesn't implement it.
+type controllerAuthService interface {
+	ControllerHandler(vaultID string, req *http.Request, w http.ResponseWriter,
+		next http.HandlerFunc) (http.HandlerFunc, error)
+}
+
+// AdminAuthorizer authorizes requests to admin endpoints. A non-nil error rejects the request.
+type AdminAuthorizer func(req *http.Request) error
+
+// authRequirer is implemented by handlers that declare how requests to them must be authorized.
+type authRequirer interface {
+	AuthRequirement() auth.Requirement
+}
+
+// AuthMiddlewareOption configures the auth middleware.
+type AuthMiddlewareOption func(m *AuthMiddleware)
+
+// WithAdminAuthorizer sets the authorizer used for admin endpoints. Without one, admin endpoints are forbidden.
+func WithAdminAuthorizer(authorizer AdminAuthorizer) AuthMiddlewareOption {
+	return func(m *AuthMiddleware) {
+		m.adminAuthorizer = authorizer
+	}
+}
+
+// AuthMiddleware is a mux middleware that authorizes requests according to the auth requirement
+// of the handler registered for the matched route.
+type AuthMiddleware struct {
+	authService     AuthService
+	adminAuthorizer AdminAuthorizer
+
+	mutex        sync.RWMutex
+	requirements map[*mux.Route]auth.Requirement
+}
+
+// NewAuthMiddleware returns a new auth middleware that uses the given auth service for vault and document endpoints.
+func NewAuthMiddleware(authService AuthService, opts ...AuthMiddlewareOption) *AuthMiddleware {
+	m := &AuthMiddleware{authService: authService, requirements: make(map[*mux.Route]auth.Requirement)}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// HandleFunc registers the handler with the router and records its auth requirement.
+// Handlers that don't declare an auth requirement are treated as admin handlers.
+func (m *AuthMiddleware) HandleFunc(router *mux.Router, handler operation.Handler) *mux.Route {
+	route := router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+
+	requirement := auth.Admin
+
+	if requirer, ok := handler.(authRequirer); ok {
+		requirement = requirer.AuthRequirement()
+	}
+
+	m.mutex.Lock()
+	m.requirements[route] = requirement
+	m.mutex.Unlock()
+
+	return route
+}
+
+// Middleware authorizes the request before passing it on to next. It must be added to the router with Use.
+func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requirement := m.requirement(r); requirement {
+		case auth.Public:
+			next.ServeHTTP(w, r)
+		case auth.Vault, auth.Document, auth.Controller:
+			m.serveWithAuthService(w, r, requirement, next)
+		default:
+			m.serveAdmin(w, r, next)
+		}
+	})
+}
+
+func (m *AuthMiddleware) requirement(r *http.Request) auth.Requirement {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return auth.Admin
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	requirement, found := m.requirements[route]
+	if !found {
+		return auth.Admin
+	}
+
+	return requirement
+}
+
+func (m *AuthMiddleware) serveWithAuthService(w http.ResponseWriter, r *http.Request,
+	requirement auth.Requirement, next http.Handler) {
+	vars := mux.Vars(r)
+
+	vaultID, err := url.PathUnescape(vars[operation.VaultIDPathVariable])
+	if err != nil {
+		writeAuthError(w, http.StatusBadRequest, fmt.Errorf("invalid vault ID: %w", err))
+
+		return
+	}
+
+	var authHandler http.HandlerFunc
+
+	switch requirement {
+	case auth.Document:
+		docID, errUnescape := url.PathUnescape(vars[operation.DocIDPathVariable])
+		if errUnescape != nil {
+			writeAuthError(w, http.StatusBadRequest, fmt.Errorf("invalid document ID: %w", errUnescape))
+
+			return
+		}
+
+		authHandler, err = m.authService.DocumentHandler(vaultID, docID, r, w, next.ServeHTTP)
+	case auth.Controller:
+		controllerService, ok := m.authService.(controllerAuthService)
+		if !ok {
+			writeAuthError(w, http.StatusForbidden, errControllerNotSupported)
+
+			return
+		}
+
+		authHandler, err = controllerService.ControllerHandler(vaultID, r, w, next.ServeHTTP)
+	default:
+		authHandler, err = m.authService.Handler(vaultID, r, w, next.ServeHTTP)
+	}
+
+	if err != nil {
+		writeAuthError(w, http.StatusBadRequest, err)
+
+		return
+	}
+
+	authHandler(w, r)
+}
+
+func (m *AuthMiddleware) serveAdmin(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if m.adminAuthorizer == nil {
+		writeAuthError(w, http.StatusForbidden, errAdminNotAllowed)
+
+		return
+	}
+
+	if err := m.adminAuthorizer(r); err != nil {
+		writeAuthError(w, http.StatusForbidden, err)
+
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+func writeAuthError(w http.ResponseWriter, statusCode int, err error) {
+	logger.Infof("request not authorized: %s", err)
+
+	if errWrite := support.WriteError(w, statusCode, err, err.Error()); errWrite != nil {
+		logger.Errorf(errWrite.Error())
+	}
+}
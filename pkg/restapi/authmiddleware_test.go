@@ -0,0 +1,234 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package restapi
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+const (
+	testVaultPath    = "/encrypted-data-vaults/{vaultID}/documents"
+	testDocumentPath = "/encrypted-data-vaults/{vaultID}/documents/{docID}"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	t.Run("public route", func(t *testing.T) {
+		router := newTestRouter(t, &mockAuthService{}, auth.Public)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents?x=y")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("vault route", func(t *testing.T) {
+		authSvc := &mockAuthService{}
+		router := newTestRouter(t, authSvc, auth.Vault)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v%201/documents?x=y")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "v 1", authSvc.vaultID)
+		require.Empty(t, authSvc.docID)
+	})
+
+	t.Run("vault route behind a path prefix", func(t *testing.T) {
+		authSvc := &mockAuthService{}
+		router := newTestRouter(t, authSvc, auth.Vault)
+
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/v1/documents", nil)
+		req.RequestURI = "/edv/encrypted-data-vaults/v1/documents"
+
+		router.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "v1", authSvc.vaultID)
+	})
+
+	t.Run("document route", func(t *testing.T) {
+		authSvc := &mockAuthService{}
+		router := newTestRouter(t, authSvc, auth.Document)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents/d1")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "v1", authSvc.vaultID)
+		require.Equal(t, "d1", authSvc.docID)
+	})
+
+	t.Run("controller route", func(t *testing.T) {
+		authSvc := &mockControllerAuthService{}
+
+		router := mux.NewRouter()
+		m := NewAuthMiddleware(authSvc)
+		router.Use(m.Middleware)
+
+		m.HandleFunc(router, support.NewHTTPHandlerWithAuth(testVaultPath, http.MethodGet, okHandler, auth.Controller))
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "v1", authSvc.vaultID)
+		require.True(t, authSvc.controller)
+	})
+
+	t.Run("controller route with an auth service that doesn't support it", func(t *testing.T) {
+		router := newTestRouter(t, &mockAuthService{}, auth.Controller)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents")
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Contains(t, rw.Body.String(), errControllerNotSupported.Error())
+	})
+
+	t.Run("error from auth service", func(t *testing.T) {
+		router := newTestRouter(t, &mockAuthService{err: errors.New("failed to create auth handler")}, auth.Vault)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents")
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to create auth handler")
+	})
+
+	t.Run("request rejected by auth service", func(t *testing.T) {
+		router := newTestRouter(t, &mockAuthService{reject: true}, auth.Document)
+
+		rw := serve(router, http.MethodGet, "/encrypted-data-vaults/v1/documents/d1")
+		require.Equal(t, http.StatusUnauthorized, rw.Code)
+	})
+
+	t.Run("admin route without admin authorizer", func(t *testing.T) {
+		router := mux.NewRouter()
+		m := NewAuthMiddleware(&mockAuthService{})
+		router.Use(m.Middleware)
+
+		m.HandleFunc(router, support.NewHTTPHandler("/logspec", http.MethodGet, okHandler))
+
+		rw := serve(router, http.MethodGet, "/logspec")
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Contains(t, rw.Body.String(), errAdminNotAllowed.Error())
+	})
+
+	t.Run("admin route with admin authorizer", func(t *testing.T) {
+		router := mux.NewRouter()
+		m := NewAuthMiddleware(&mockAuthService{}, WithAdminAuthorizer(func(req *http.Request) error {
+			if req.Header.Get("X-Admin") == "" {
+				return errors.New("not an admin")
+			}
+
+			return nil
+		}))
+		router.Use(m.Middleware)
+
+		m.HandleFunc(router, support.NewHTTPHandler("/logspec", http.MethodGet, okHandler))
+
+		rw := serve(router, http.MethodGet, "/logspec")
+		require.Equal(t, http.StatusForbidden, rw.Code)
+		require.Contains(t, rw.Body.String(), "not an admin")
+
+		rw = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/logspec", nil)
+		req.Header.Set("X-Admin", "true")
+
+		router.ServeHTTP(rw, req)
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("route not registered through the middleware", func(t *testing.T) {
+		router := mux.NewRouter()
+		m := NewAuthMiddleware(&mockAuthService{})
+		router.Use(m.Middleware)
+
+		router.HandleFunc("/other", okHandler)
+
+		rw := serve(router, http.MethodGet, "/other")
+		require.Equal(t, http.StatusForbidden, rw.Code)
+	})
+}
+
+func newTestRouter(t *testing.T, authSvc *mockAuthService, requirement auth.Requirement) *mux.Router {
+	t.Helper()
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	m := NewAuthMiddleware(authSvc)
+	router.Use(m.Middleware)
+
+	path := testVaultPath
+	if requirement == auth.Document {
+		path = testDocumentPath
+	}
+
+	route := m.HandleFunc(router, support.NewHTTPHandlerWithAuth(path, http.MethodGet, okHandler, requirement))
+	require.NotNil(t, route)
+
+	return router
+}
+
+func serve(router http.Handler, method, target string) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+
+	router.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+
+	return rw
+}
+
+func okHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type mockAuthService struct {
+	vaultID string
+	docID   string
+	err     error
+	reject  bool
+}
+
+func (m *mockAuthService) Handler(vaultID string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	m.vaultID = vaultID
+
+	return m.handler(next)
+}
+
+func (m *mockAuthService) DocumentHandler(vaultID, docID string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	m.vaultID = vaultID
+	m.docID = docID
+
+	return m.handler(next)
+}
+
+func (m *mockAuthService) handler(next http.HandlerFunc) (http.HandlerFunc, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	if m.reject {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}, nil
+	}
+
+	return next, nil
+}
+
+type mockControllerAuthService struct {
+	mockAuthService
+	controller bool
+}
+
+func (m *mockControllerAuthService) ControllerHandler(vaultID string, _ *http.Request, _ http.ResponseWriter,
+	next http.HandlerFunc) (http.HandlerFunc, error) {
+	m.vaultID = vaultID
+	m.controller = true
+
+	return m.handler(next)
+}
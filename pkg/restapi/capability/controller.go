@@ -0,0 +1,32 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package capability
+
+import (
+	"github.com/trustbloc/edv/pkg/restapi/capability/operation"
+)
+
+// New returns new controller instance.
+func New(service operation.Service) *Controller {
+	var allHandlers []operation.Handler
+
+	capabilityService := operation.New(service)
+
+	allHandlers = append(allHandlers, capabilityService.GetRESTHandlers()...)
+
+	return &Controller{handlers: allHandlers}
+}
+
+// Controller contains handlers for controller.
+type Controller struct {
+	handlers []operation.Handler
+}
+
+// GetOperations returns all controller endpoints.
+func (c *Controller) GetOperations() []operation.Handler {
+	return c.handlers
+}
@@ -0,0 +1,251 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	edvoperation "github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+// API endpoints.
+const (
+	logModuleName = "edv-capability-restapi"
+
+	// CapabilityIDPathVariable is the name of the path variable holding the capability ID in capability endpoints.
+	CapabilityIDPathVariable = "capabilityID"
+
+	// Query parameters that filter listed capabilities.
+	vaultIDQueryParam = "vaultID"
+	invokerQueryParam = "invoker"
+	parentQueryParam  = "parent"
+
+	vaultCapabilitiesEndpoint = "/encrypted-data-vaults/{" + edvoperation.VaultIDPathVariable + "}/capabilities"
+	vaultCapabilityEndpoint   = vaultCapabilitiesEndpoint + "/{" + CapabilityIDPathVariable + "}"
+	capabilityChainEndpoint   = vaultCapabilityEndpoint + "/chain"
+	revokeCapabilityEndpoint  = vaultCapabilityEndpoint + "/revoke"
+	capabilitiesEndpoint      = "/capabilities"
+)
+
+var logger = log.New(logModuleName)
+
+// Handler http handler for each controller API endpoint.
+type Handler interface {
+	Path() string
+	Method() string
+	Handle() http.HandlerFunc
+}
+
+// Service manages the capabilities issued for vaults. zcapld.Service implements this interface.
+type Service interface {
+	Capabilities(query *zcapld.CapabilityQuery) ([]*zcapld.CapabilityInfo, error)
+	Capability(id string) (*zcapld.CapabilityInfo, error)
+	Chain(id string) ([]*zcapld.CapabilityInfo, error)
+	Revoke(vaultID, id string) (*zcapld.Revocation, error)
+}
+
+// New returns a new capability management operation.
+func New(service Service) *Operation {
+	return &Operation{service: service}
+}
+
+// Operation defines handlers for capability management operations.
+type Operation struct {
+	service Service
+}
+
+// GetRESTHandlers get all controller API handler available for this service.
+// The capabilities of a vault can be read by anyone who is authorized to access the vault, but only its controller
+// can revoke them. Listing the capabilities of all vaults is an admin operation.
+func (o *Operation) GetRESTHandlers() []Handler {
+	return []Handler{
+		support.NewHTTPHandlerWithAuth(vaultCapabilitiesEndpoint, http.MethodGet, o.listVaultCapabilitiesHandler,
+			auth.Vault),
+		support.NewHTTPHandlerWithAuth(vaultCapabilityEndpoint, http.MethodGet, o.readCapabilityHandler, auth.Vault),
+		support.NewHTTPHandlerWithAuth(capabilityChainEndpoint, http.MethodGet, o.readCapabilityChainHandler,
+			auth.Vault),
+		support.NewHTTPHandlerWithAuth(revokeCapabilityEndpoint, http.MethodPost, o.revokeCapabilityHandler,
+			auth.Controller),
+		support.NewHTTPHandlerWithAuth(capabilitiesEndpoint, http.MethodGet, o.listCapabilitiesHandler, auth.Admin),
+	}
+}
+
+// List the capabilities of a vault, optionally filtered by invoker and parent.
+func (o *Operation) listVaultCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, ok := unescapePathVar(rw, req, edvoperation.VaultIDPathVariable)
+	if !ok {
+		return
+	}
+
+	query := req.URL.Query()
+
+	o.listCapabilities(rw, &zcapld.CapabilityQuery{
+		VaultID: vaultID, Invoker: query.Get(invokerQueryParam), Parent: query.Get(parentQueryParam),
+	})
+}
+
+// List the capabilities of all vaults by vault ID, invoker or parent.
+func (o *Operation) listCapabilitiesHandler(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+
+	capabilityQuery := &zcapld.CapabilityQuery{
+		VaultID: query.Get(vaultIDQueryParam), Invoker: query.Get(invokerQueryParam),
+		Parent: query.Get(parentQueryParam),
+	}
+
+	if *capabilityQuery == (zcapld.CapabilityQuery{}) {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("one of the %s, %s or %s query parameters must be set",
+			vaultIDQueryParam, invokerQueryParam, parentQueryParam))
+
+		return
+	}
+
+	o.listCapabilities(rw, capabilityQuery)
+}
+
+func (o *Operation) listCapabilities(rw http.ResponseWriter, query *zcapld.CapabilityQuery) {
+	capabilities, err := o.service.Capabilities(query)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError, fmt.Errorf("failed to list capabilities: %w", err))
+
+		return
+	}
+
+	if capabilities == nil {
+		capabilities = []*zcapld.CapabilityInfo{}
+	}
+
+	writeJSON(rw, http.StatusOK, capabilities)
+}
+
+// Read a capability of a vault together with its revocation status.
+func (o *Operation) readCapabilityHandler(rw http.ResponseWriter, req *http.Request) {
+	info, ok := o.vaultCapability(rw, req)
+	if !ok {
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, info)
+}
+
+// Read a capability of a vault and all the capabilities it was delegated from, starting with the root capability.
+func (o *Operation) readCapabilityChainHandler(rw http.ResponseWriter, req *http.Request) {
+	info, ok := o.vaultCapability(rw, req)
+	if !ok {
+		return
+	}
+
+	chain, err := o.service.Chain(info.Capability.ID)
+	if err != nil {
+		writeError(rw, http.StatusInternalServerError,
+			fmt.Errorf("failed to read chain of capability %s: %w", info.Capability.ID, err))
+
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, chain)
+}
+
+// Revoke a capability of a vault by ID and return its revocation. Capabilities delegated by clients aren't known to
+// the server, so they can be revoked too.
+func (o *Operation) revokeCapabilityHandler(rw http.ResponseWriter, req *http.Request) {
+	vaultID, ok := unescapePathVar(rw, req, edvoperation.VaultIDPathVariable)
+	if !ok {
+		return
+	}
+
+	capabilityID, ok := unescapePathVar(rw, req, CapabilityIDPathVariable)
+	if !ok {
+		return
+	}
+
+	revocation, err := o.service.Revoke(vaultID, capabilityID)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, zcapld.ErrCapabilityNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		writeError(rw, statusCode, fmt.Errorf("failed to revoke capability %s: %w", capabilityID, err))
+
+		return
+	}
+
+	logger.Infof("capability %s of vault %s was revoked", revocation.CapabilityID, revocation.VaultID)
+
+	writeJSON(rw, http.StatusOK, revocation)
+}
+
+// vaultCapability returns the capability identified by the request's path variables. Capabilities of other vaults
+// are reported as not found.
+func (o *Operation) vaultCapability(rw http.ResponseWriter, req *http.Request) (*zcapld.CapabilityInfo, bool) {
+	vaultID, ok := unescapePathVar(rw, req, edvoperation.VaultIDPathVariable)
+	if !ok {
+		return nil, false
+	}
+
+	capabilityID, ok := unescapePathVar(rw, req, CapabilityIDPathVariable)
+	if !ok {
+		return nil, false
+	}
+
+	info, err := o.service.Capability(capabilityID)
+	if err == nil && info.VaultID != vaultID {
+		err = fmt.Errorf("%w: %s", zcapld.ErrCapabilityNotFound, capabilityID)
+	}
+
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, zcapld.ErrCapabilityNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		writeError(rw, statusCode, fmt.Errorf("failed to read capability: %w", err))
+
+		return nil, false
+	}
+
+	return info, true
+}
+
+func unescapePathVar(rw http.ResponseWriter, req *http.Request, pathVar string) (string, bool) {
+	value, err := url.PathUnescape(mux.Vars(req)[pathVar])
+	if err != nil {
+		writeError(rw, http.StatusBadRequest, fmt.Errorf("failed to unescape %s: %w", pathVar, err))
+
+		return "", false
+	}
+
+	return value, true
+}
+
+func writeJSON(rw http.ResponseWriter, statusCode int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logger.Errorf("failed to write capability response: %s", err)
+	}
+}
+
+func writeError(rw http.ResponseWriter, statusCode int, err error) {
+	logger.Errorf("capability request failed: %s", err)
+
+	if errWrite := support.WriteError(rw, statusCode, err, err.Error()); errWrite != nil {
+		logger.Errorf("failed to write capability error response: %s", errWrite)
+	}
+}
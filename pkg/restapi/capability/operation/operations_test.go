@@ -0,0 +1,300 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package operation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	edgezcapld "github.com/trustbloc/edge-core/pkg/zcapld"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/auth/zcapld"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	testVaultID      = "vault1"
+	testRootID       = "urn:uuid:root"
+	testCapabilityID = "urn:uuid:controller"
+)
+
+func TestGetRESTHandlers(t *testing.T) {
+	require.Equal(t, 5, len(New(nil).GetRESTHandlers()))
+}
+
+func TestListVaultCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newMockService()
+
+		rw := serve(t, svc, http.MethodGet,
+			"/encrypted-data-vaults/"+testVaultID+"/capabilities?invoker="+url.QueryEscape("did:example:alice"))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, &zcapld.CapabilityQuery{VaultID: testVaultID, Invoker: "did:example:alice"}, svc.query)
+
+		var capabilities []*zcapld.CapabilityInfo
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &capabilities))
+		require.Len(t, capabilities, 2)
+	})
+
+	t.Run("no capabilities", func(t *testing.T) {
+		rw := serve(t, &mockService{}, http.MethodGet, "/encrypted-data-vaults/"+testVaultID+"/capabilities")
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "[]\n", rw.Body.String())
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		svc := newMockService()
+		svc.err = errors.New("index error")
+
+		rw := serve(t, svc, http.MethodGet, "/encrypted-data-vaults/"+testVaultID+"/capabilities")
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Equal(t, "failed to list capabilities: index error", errorMessage(t, rw))
+	})
+}
+
+func TestListCapabilities(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		svc := newMockService()
+
+		rw := serve(t, svc, http.MethodGet, "/capabilities?parent="+url.QueryEscape(testRootID))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, &zcapld.CapabilityQuery{Parent: testRootID}, svc.query)
+	})
+
+	t.Run("no query parameters", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodGet, "/capabilities")
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Equal(t, "one of the vaultID, invoker or parent query parameters must be set", errorMessage(t, rw))
+	})
+}
+
+func TestReadCapability(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodGet, capabilityPath(testVaultID, testCapabilityID))
+		require.Equal(t, http.StatusOK, rw.Code)
+		require.Equal(t, "application/json", rw.Header().Get("Content-Type"))
+
+		var info zcapld.CapabilityInfo
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &info))
+		require.Equal(t, testCapabilityID, info.Capability.ID)
+		require.False(t, info.Revoked)
+	})
+
+	t.Run("capability of another vault", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodGet, capabilityPath("vault2", testCapabilityID))
+		require.Equal(t, http.StatusNotFound, rw.Code)
+		require.Contains(t, errorMessage(t, rw), "capability not found")
+		require.Contains(t, rw.Body.String(), `"code":"not_found"`)
+	})
+
+	t.Run("unknown capability", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodGet, capabilityPath(testVaultID, "unknown"))
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		svc := newMockService()
+		svc.err = errors.New("db error")
+
+		rw := serve(t, svc, http.MethodGet, capabilityPath(testVaultID, testCapabilityID))
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Equal(t, "failed to read capability: db error", errorMessage(t, rw))
+	})
+
+	t.Run("invalid capability ID escaping", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil),
+			map[string]string{"vaultID": testVaultID, CapabilityIDPathVariable: "%"})
+
+		New(newMockService()).readCapabilityHandler(rw, req)
+		require.Equal(t, http.StatusBadRequest, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to unescape capabilityID")
+	})
+}
+
+func TestReadCapabilityChain(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodGet, capabilityPath(testVaultID, testCapabilityID)+"/chain")
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		var chain []*zcapld.CapabilityInfo
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &chain))
+		require.Len(t, chain, 2)
+		require.Equal(t, testRootID, chain[0].Capability.ID)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		svc := newMockService()
+		svc.chainErr = errors.New("db error")
+
+		rw := serve(t, svc, http.MethodGet, capabilityPath(testVaultID, testCapabilityID)+"/chain")
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Contains(t, rw.Body.String(), "failed to read chain of capability")
+	})
+}
+
+func TestRevokeCapability(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodPost, capabilityPath(testVaultID, testCapabilityID)+"/revoke")
+		require.Equal(t, http.StatusOK, rw.Code)
+
+		var revocation zcapld.Revocation
+
+		require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &revocation))
+		require.Equal(t, testCapabilityID, revocation.CapabilityID)
+		require.Equal(t, testVaultID, revocation.VaultID)
+		require.False(t, revocation.RevokedAt.IsZero())
+	})
+
+	t.Run("capability delegated by a client", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodPost, capabilityPath(testVaultID, "urn:uuid:delegated")+"/revoke")
+		require.Equal(t, http.StatusOK, rw.Code)
+	})
+
+	t.Run("capability of another vault", func(t *testing.T) {
+		rw := serve(t, newMockService(), http.MethodPost, capabilityPath("vault2", testCapabilityID)+"/revoke")
+		require.Equal(t, http.StatusNotFound, rw.Code)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		svc := newMockService()
+		svc.revokeErr = errors.New("db error")
+
+		rw := serve(t, svc, http.MethodPost, capabilityPath(testVaultID, testCapabilityID)+"/revoke")
+		require.Equal(t, http.StatusInternalServerError, rw.Code)
+		require.Equal(t, "failed to revoke capability urn:uuid:controller: db error", errorMessage(t, rw))
+	})
+}
+
+func TestRevokeRequiresController(t *testing.T) {
+	requirements := make(map[string]auth.Requirement)
+
+	for _, handler := range New(nil).GetRESTHandlers() {
+		requirer, ok := handler.(interface{ AuthRequirement() auth.Requirement })
+		require.True(t, ok)
+
+		requirements[handler.Method()+" "+handler.Path()] = requirer.AuthRequirement()
+	}
+
+	require.Equal(t, auth.Controller, requirements[http.MethodPost+" "+revokeCapabilityEndpoint])
+	require.Equal(t, auth.Vault, requirements[http.MethodGet+" "+vaultCapabilityEndpoint])
+}
+
+// errorMessage returns the message of the error response recorded by rw.
+func errorMessage(t *testing.T, rw *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var errResponse models.ErrorResponse
+
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &errResponse))
+
+	return errResponse.Message
+}
+
+func serve(t *testing.T, svc Service, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := mux.NewRouter()
+	router.UseEncodedPath()
+
+	for _, handler := range New(svc).GetRESTHandlers() {
+		router.HandleFunc(handler.Path(), handler.Handle()).Methods(handler.Method())
+	}
+
+	rw := httptest.NewRecorder()
+
+	router.ServeHTTP(rw, httptest.NewRequest(method, target, nil))
+
+	return rw
+}
+
+func capabilityPath(vaultID, capabilityID string) string {
+	return fmt.Sprintf("/encrypted-data-vaults/%s/capabilities/%s", vaultID, url.PathEscape(capabilityID))
+}
+
+type mockService struct {
+	capabilities map[string]*zcapld.CapabilityInfo
+	query        *zcapld.CapabilityQuery
+	err          error
+	chainErr     error
+	revokeErr    error
+}
+
+func newMockService() *mockService {
+	root := &edgezcapld.Capability{ID: testRootID}
+
+	return &mockService{capabilities: map[string]*zcapld.CapabilityInfo{
+		testRootID: {Capability: root, VaultID: testVaultID},
+		testCapabilityID: {
+			Capability: &edgezcapld.Capability{ID: testCapabilityID, Parent: root.ID, Invoker: "did:example:alice"},
+			VaultID:    testVaultID,
+		},
+	}}
+}
+
+func (m *mockService) Capabilities(query *zcapld.CapabilityQuery) ([]*zcapld.CapabilityInfo, error) {
+	m.query = query
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	var capabilities []*zcapld.CapabilityInfo
+
+	for _, info := range m.capabilities {
+		capabilities = append(capabilities, info)
+	}
+
+	return capabilities, nil
+}
+
+func (m *mockService) Capability(id string) (*zcapld.CapabilityInfo, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	info, ok := m.capabilities[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", zcapld.ErrCapabilityNotFound, id)
+	}
+
+	return info, nil
+}
+
+func (m *mockService) Chain(id string) ([]*zcapld.CapabilityInfo, error) {
+	if m.chainErr != nil {
+		return nil, m.chainErr
+	}
+
+	return []*zcapld.CapabilityInfo{m.capabilities[testRootID], m.capabilities[id]}, nil
+}
+
+func (m *mockService) Revoke(vaultID, id string) (*zcapld.Revocation, error) {
+	if m.revokeErr != nil {
+		return nil, m.revokeErr
+	}
+
+	info, ok := m.capabilities[id]
+	if ok && info.VaultID != vaultID {
+		return nil, fmt.Errorf("%w: %s", zcapld.ErrCapabilityNotFound, id)
+	}
+
+	return &zcapld.Revocation{CapabilityID: id, VaultID: vaultID, RevokedAt: time.Now()}, nil
+}
@@ -18,15 +18,22 @@ func New(config *operation.Config) (*Controller, error) {
 
 	allHandlers = append(allHandlers, edvService.GetRESTHandlers()...)
 
-	return &Controller{handlers: allHandlers}, nil
+	return &Controller{handlers: allHandlers, edvService: edvService}, nil
 }
 
 // Controller contains handlers for controller
 type Controller struct {
-	handlers []operation.Handler
+	handlers   []operation.Handler
+	edvService *operation.Operation
 }
 
 // GetOperations returns all controller endpoints
 func (c *Controller) GetOperations() []operation.Handler {
 	return c.handlers
 }
+
+// AddEndpoints adds the endpoints of other services that are served along with the EDV endpoints to the endpoints
+// listed by the configuration endpoint.
+func (c *Controller) AddEndpoints(handlers ...operation.Handler) {
+	c.edvService.AddEndpoints(handlers...)
+}
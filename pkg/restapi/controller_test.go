@@ -30,7 +30,7 @@ func TestController_GetOperations(t *testing.T) {
 
 	ops := controller.GetOperations()
 
-	require.Equal(t, 7, len(ops))
+	require.Equal(t, 9, len(ops))
 
 	// Create vault
 	require.Equal(t, "/encrypted-data-vaults", ops[0].Path())
@@ -62,8 +62,18 @@ func TestController_GetOperations(t *testing.T) {
 	require.Equal(t, http.MethodDelete, ops[5].Method())
 	require.NotNil(t, ops[5].Handle())
 
-	// Read all documents
-	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents", ops[6].Path())
+	// Extensions
+	require.Equal(t, "/encrypted-data-vaults/extensions", ops[6].Path())
 	require.Equal(t, http.MethodGet, ops[6].Method())
 	require.NotNil(t, ops[6].Handle())
+
+	// Read all documents
+	require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents", ops[7].Path())
+	require.Equal(t, http.MethodGet, ops[7].Method())
+	require.NotNil(t, ops[7].Handle())
+
+	// Server configuration
+	require.Equal(t, "/.well-known/edv-configuration", ops[8].Path())
+	require.Equal(t, http.MethodGet, ops[8].Method())
+	require.NotNil(t, ops[8].Handle())
 }
@@ -0,0 +1,61 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package checks provides the checks of the dependencies that the EDV server needs to be ready.
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/trustbloc/edge-core/pkg/storage"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
+)
+
+// probeKey is the key that the checks read from stores. It isn't expected to exist: any response from the
+// database, including "not found", means that it's available.
+const probeKey = "healthcheck"
+
+// EDVProvider returns a check that reads from the given store of the EDV provider. The store must already exist.
+// Opening a store may not call the database (the CouchDB provider caches opened stores), so the check reads a
+// document from the store too.
+func EDVProvider(provider edvprovider.EDVProvider, storeName string) operation.Checker {
+	return func(ctx context.Context) error {
+		store, err := provider.OpenStore(storeName)
+		if err != nil {
+			return fmt.Errorf("failed to open store %s: %w", storeName, err)
+		}
+
+		_, err = edvprovider.StoreWithContext(ctx, store).Get(probeKey)
+		if err != nil && !errors.Is(err, storage.ErrValueNotFound) {
+			return fmt.Errorf("failed to read from store %s: %w", storeName, err)
+		}
+
+		return nil
+	}
+}
+
+// AriesStorage returns a check that reads from the given store of an Aries storage provider, such as the store
+// of zcaps or of the KMS secrets. Some providers create stores when they're opened, so storeName should be a
+// store that the server uses anyway.
+func AriesStorage(provider ariesstorage.Provider, storeName string) operation.Checker {
+	return func(ctx context.Context) error {
+		store, err := provider.OpenStore(storeName)
+		if err != nil {
+			return fmt.Errorf("failed to open store %s: %w", storeName, err)
+		}
+
+		_, err = store.Get(probeKey)
+		if err != nil && !errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return fmt.Errorf("failed to read from store %s: %w", storeName, err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package checks
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/edvprovider"
+	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+)
+
+const testStoreName = "data_vault_configurations"
+
+func TestEDVProvider(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		provider := memedvprovider.NewProvider()
+		require.NoError(t, provider.CreateStore(testStoreName))
+
+		require.NoError(t, EDVProvider(provider, testStoreName)(context.Background()))
+	})
+
+	t.Run("store doesn't exist", func(t *testing.T) {
+		err := EDVProvider(memedvprovider.NewProvider(), testStoreName)(context.Background())
+		require.EqualError(t, err, "failed to open store data_vault_configurations: store not found")
+	})
+
+	t.Run("read fails", func(t *testing.T) {
+		err := EDVProvider(&failingEDVProvider{}, testStoreName)(context.Background())
+		require.EqualError(t, err, "failed to read from store data_vault_configurations: connection refused")
+	})
+}
+
+func TestAriesStorage(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		require.NoError(t, AriesStorage(ariesmemstorage.NewProvider(), "masterkey")(context.Background()))
+	})
+
+	t.Run("open fails", func(t *testing.T) {
+		provider := &mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("connection refused")}
+
+		err := AriesStorage(provider, "masterkey")(context.Background())
+		require.EqualError(t, err, "failed to open store masterkey: connection refused")
+	})
+
+	t.Run("read fails", func(t *testing.T) {
+		provider := mockstorage.NewMockStoreProvider()
+		provider.Store.ErrGet = errors.New("connection refused")
+
+		err := AriesStorage(provider, "masterkey")(context.Background())
+		require.EqualError(t, err, "failed to read from store masterkey: connection refused")
+	})
+}
+
+func TestDiskSpace(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		require.NoError(t, DiskSpace(t.TempDir(), 1)(context.Background()))
+	})
+
+	t.Run("not enough space", func(t *testing.T) {
+		err := DiskSpace(t.TempDir(), math.MaxUint64)(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "less than the minimum")
+	})
+
+	t.Run("path doesn't exist", func(t *testing.T) {
+		err := DiskSpace("/path/that/does/not/exist", 1)(context.Background())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to get the free disk space of /path/that/does/not/exist")
+	})
+}
+
+type failingEDVProvider struct {
+	edvprovider.EDVProvider
+}
+
+func (p *failingEDVProvider) OpenStore(string) (edvprovider.EDVStore, error) {
+	return &failingEDVStore{}, nil
+}
+
+type failingEDVStore struct {
+	edvprovider.EDVStore
+}
+
+func (s *failingEDVStore) Get(string) ([]byte, error) {
+	return nil, errors.New("connection refused")
+}
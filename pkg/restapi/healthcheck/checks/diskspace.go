@@ -0,0 +1,38 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package checks
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+
+	"github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
+)
+
+// DiskSpace returns a check that fails if the file system that path is on has less than minFreeBytes of free space
+// available, e.g. for the files of an embedded store.
+func DiskSpace(path string, minFreeBytes uint64) operation.Checker {
+	return func(context.Context) error {
+		var stat syscall.Statfs_t
+
+		err := syscall.Statfs(path, &stat)
+		if err != nil {
+			return fmt.Errorf("failed to get the free disk space of %s: %w", path, err)
+		}
+
+		free := stat.Bavail * uint64(stat.Bsize)
+		if free < minFreeBytes {
+			return fmt.Errorf("%d bytes of disk space available for %s, less than the minimum of %d bytes",
+				free, path, minFreeBytes)
+		}
+
+		return nil
+	}
+}
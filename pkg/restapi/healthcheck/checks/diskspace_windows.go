@@ -0,0 +1,21 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package checks
+
+import (
+	"context"
+	"errors"
+
+	"github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
+)
+
+// DiskSpace returns a check that fails if the file system that path is on has less than minFreeBytes of free space
+// available. It isn't supported on Windows, where the check always fails.
+func DiskSpace(path string, minFreeBytes uint64) operation.Checker {
+	return func(context.Context) error {
+		return errors.New("disk space checks aren't supported on windows")
+	}
+}
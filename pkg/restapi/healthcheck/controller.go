@@ -9,11 +9,11 @@ import (
 	"github.com/trustbloc/edv/pkg/restapi/healthcheck/operation"
 )
 
-// New returns new controller instance.
-func New() *Controller {
+// New returns new controller instance. The options add the checks that the server needs to pass to be ready.
+func New(opts ...operation.Option) *Controller {
 	var allHandlers []operation.Handler
 
-	rpService := operation.New()
+	rpService := operation.New(opts...)
 
 	handlers := rpService.GetRESTHandlers()
 
@@ -6,12 +6,15 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/trustbloc/edge-core/pkg/log"
 
+	"github.com/trustbloc/edv/pkg/auth"
 	"github.com/trustbloc/edv/pkg/internal/common/support"
 )
 
@@ -19,13 +22,31 @@ import (
 const (
 	logModuleName       = "edv-healthcheck-restapi"
 	healthCheckEndpoint = "/healthcheck"
+	livenessEndpoint    = healthCheckEndpoint + "/live"
+	readinessEndpoint   = healthCheckEndpoint + "/ready"
+)
+
+const (
+	successStatus = "success"
+	failureStatus = "failure"
+
+	defaultCheckTimeout = 5 * time.Second
 )
 
 var logger = log.New(logModuleName)
 
 type healthCheckResp struct {
-	Status      string    `json:"status"`
-	CurrentTime time.Time `json:"currentTime"`
+	Status      string        `json:"status"`
+	CurrentTime time.Time     `json:"currentTime"`
+	Checks      []checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	// Error is logged, but not part of the response since the endpoint is public and errors can reveal internals.
+	Error string `json:"-"`
 }
 
 // Handler http handler for each controller API endpoint.
@@ -35,29 +56,144 @@ type Handler interface {
 	Handle() http.HandlerFunc
 }
 
+// Checker checks whether a dependency of the server is available, and returns an error if it isn't.
+// ctx is cancelled once the check timeout has passed.
+type Checker func(ctx context.Context) error
+
+type check struct {
+	name    string
+	checker Checker
+}
+
+// Option configures the health check operations.
+type Option func(opts *Operation)
+
+// WithCheck adds a check that the server needs to pass to be ready. Checks are reported by name in the order
+// they were added.
+func WithCheck(name string, checker Checker) Option {
+	return func(opts *Operation) {
+		opts.checks = append(opts.checks, check{name: name, checker: checker})
+	}
+}
+
+// WithCheckTimeout sets how long each check may take before it fails. Defaults to 5 seconds.
+func WithCheckTimeout(timeout time.Duration) Option {
+	return func(opts *Operation) {
+		opts.checkTimeout = timeout
+	}
+}
+
 // New returns CreateCredential instance.
-func New() *Operation {
-	return &Operation{}
+func New(opts ...Option) *Operation {
+	o := &Operation{checkTimeout: defaultCheckTimeout}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
 }
 
 // Operation defines handlers for rp operations.
 type Operation struct {
+	checks       []check
+	checkTimeout time.Duration
 }
 
 // GetRESTHandlers get all controller API handler available for this service.
 func (o *Operation) GetRESTHandlers() []Handler {
 	return []Handler{
-		support.NewHTTPHandler(healthCheckEndpoint, http.MethodGet, o.healthCheckHandler),
+		support.NewHTTPHandlerWithAuth(healthCheckEndpoint, http.MethodGet, o.healthCheckHandler, auth.Public),
+		support.NewHTTPHandlerWithAuth(livenessEndpoint, http.MethodGet, o.healthCheckHandler, auth.Public),
+		support.NewHTTPHandlerWithAuth(readinessEndpoint, http.MethodGet, o.readinessHandler, auth.Public),
 	}
 }
 
+// healthCheckHandler reports that the server is alive, without checking its dependencies.
 func (o *Operation) healthCheckHandler(rw http.ResponseWriter, r *http.Request) {
-	rw.WriteHeader(http.StatusOK)
-
-	err := json.NewEncoder(rw).Encode(&healthCheckResp{
-		Status:      "success",
+	writeResponse(rw, http.StatusOK, &healthCheckResp{
+		Status:      successStatus,
 		CurrentTime: time.Now(),
 	})
+}
+
+// readinessHandler runs the checks, and reports that the server is ready to handle requests if they all pass.
+func (o *Operation) readinessHandler(rw http.ResponseWriter, r *http.Request) {
+	resp := &healthCheckResp{
+		Status:      successStatus,
+		CurrentTime: time.Now(),
+		Checks:      o.runChecks(r.Context()),
+	}
+
+	statusCode := http.StatusOK
+
+	for _, result := range resp.Checks {
+		if result.Status != successStatus {
+			logger.Warnf("readiness check %s failed: %s", result.Name, result.Error)
+
+			resp.Status = failureStatus
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	writeResponse(rw, statusCode, resp)
+}
+
+// runChecks runs the checks concurrently, and returns their results in the order the checks were added.
+func (o *Operation) runChecks(ctx context.Context) []checkResult {
+	results := make([]checkResult, len(o.checks))
+	done := make(chan struct{})
+
+	for i := range o.checks {
+		go func(i int) {
+			results[i] = o.runCheck(ctx, o.checks[i])
+
+			done <- struct{}{}
+		}(i)
+	}
+
+	for range o.checks {
+		<-done
+	}
+
+	return results
+}
+
+func (o *Operation) runCheck(ctx context.Context, c check) checkResult {
+	ctx, cancel := context.WithTimeout(ctx, o.checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+
+	// The checker runs in its own goroutine, so that checkers that don't honour ctx can't block the response.
+	go func() {
+		errCh <- c.checker(ctx)
+	}()
+
+	var err error
+
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("check didn't complete within %s: %w", o.checkTimeout, ctx.Err())
+	}
+
+	result := checkResult{Name: c.name, Status: successStatus, Latency: time.Since(start).String()}
+
+	if err != nil {
+		result.Status = failureStatus
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func writeResponse(rw http.ResponseWriter, statusCode int, resp *healthCheckResp) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(statusCode)
+
+	err := json.NewEncoder(rw).Encode(resp)
 	if err != nil {
 		logger.Errorf("healthcheck response failure, %s", err)
 	}
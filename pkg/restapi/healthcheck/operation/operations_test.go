@@ -6,16 +6,20 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestGetRESTHandlers(t *testing.T) {
 	c := New()
-	require.Equal(t, 1, len(c.GetRESTHandlers()))
+	require.Equal(t, 3, len(c.GetRESTHandlers()))
 }
 
 func TestHealthCheck(t *testing.T) {
@@ -26,3 +30,97 @@ func TestHealthCheck(t *testing.T) {
 
 	require.Equal(t, http.StatusOK, b.Code)
 }
+
+func TestReadiness(t *testing.T) {
+	t.Run("ready", func(t *testing.T) {
+		c := New(WithCheck("db", func(context.Context) error { return nil }),
+			WithCheck("kms", func(context.Context) error { return nil }))
+
+		resp := checkReadiness(t, c, http.StatusOK)
+		require.Equal(t, successStatus, resp.Status)
+		require.Len(t, resp.Checks, 2)
+		require.Equal(t, "db", resp.Checks[0].Name)
+		require.Equal(t, "kms", resp.Checks[1].Name)
+
+		for _, result := range resp.Checks {
+			require.Equal(t, successStatus, result.Status)
+
+			_, err := time.ParseDuration(result.Latency)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("without checks", func(t *testing.T) {
+		resp := checkReadiness(t, New(), http.StatusOK)
+		require.Equal(t, successStatus, resp.Status)
+		require.Empty(t, resp.Checks)
+	})
+
+	t.Run("check fails", func(t *testing.T) {
+		c := New(WithCheck("db", func(context.Context) error { return nil }),
+			WithCheck("kms", func(context.Context) error { return errors.New("kms unavailable") }))
+
+		resp := checkReadiness(t, c, http.StatusServiceUnavailable)
+		require.Equal(t, failureStatus, resp.Status)
+		require.Equal(t, successStatus, resp.Checks[0].Status)
+		require.Equal(t, failureStatus, resp.Checks[1].Status)
+		require.Empty(t, resp.Checks[1].Error)
+
+		results := c.runChecks(context.Background())
+		require.Empty(t, results[0].Error)
+		require.Equal(t, "kms unavailable", results[1].Error)
+	})
+
+	t.Run("errors aren't in the response", func(t *testing.T) {
+		c := New(WithCheck("db", func(context.Context) error {
+			return errors.New("failed to connect to admin:password@couchdb:5984")
+		}))
+
+		rr := httptest.NewRecorder()
+		c.readinessHandler(rr, httptest.NewRequest(http.MethodGet, readinessEndpoint, nil))
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.NotContains(t, rr.Body.String(), "couchdb")
+
+		var resp struct {
+			Checks []map[string]interface{} `json:"checks"`
+		}
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.Len(t, resp.Checks, 1)
+		require.Len(t, resp.Checks[0], 3)
+		require.Equal(t, "db", resp.Checks[0]["name"])
+		require.Equal(t, failureStatus, resp.Checks[0]["status"])
+		require.Contains(t, resp.Checks[0], "latency")
+	})
+
+	t.Run("check times out", func(t *testing.T) {
+		block := make(chan struct{})
+		defer close(block)
+
+		c := New(WithCheckTimeout(10*time.Millisecond), WithCheck("db", func(context.Context) error {
+			<-block
+
+			return nil
+		}))
+
+		resp := checkReadiness(t, c, http.StatusServiceUnavailable)
+		require.Equal(t, failureStatus, resp.Checks[0].Status)
+
+		results := c.runChecks(context.Background())
+		require.Contains(t, results[0].Error, "check didn't complete within 10ms")
+	})
+}
+
+func checkReadiness(t *testing.T, c *Operation, expectedStatusCode int) *healthCheckResp {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	c.readinessHandler(rr, httptest.NewRequest(http.MethodGet, readinessEndpoint, nil))
+	require.Equal(t, expectedStatusCode, rr.Code)
+
+	var resp healthCheckResp
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+
+	return &resp
+}
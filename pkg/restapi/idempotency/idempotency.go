@@ -0,0 +1,408 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package idempotency makes requests idempotent by their Idempotency-Key header: the response to the first request
+// with a key is stored and returned to all later requests with the same key, which aren't processed again.
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+const (
+	// KeyHeader is the request header that carries idempotency keys.
+	KeyHeader = "Idempotency-Key"
+	// ReplayedHeader is set to true on responses that were stored for an earlier request with the same key.
+	ReplayedHeader = "Idempotent-Replayed"
+
+	storeName    = "idempotency_keys"
+	maxKeyLength = 255
+)
+
+// storeKeyPrefix is the prefix of all store keys, which start with the escaped path of the request.
+var storeKeyPrefix = url.QueryEscape("/") //nolint: gochecknoglobals
+
+var logger = log.New("edv-idempotency")
+
+// storedHeaders are the response headers that are stored along with the response.
+var storedHeaders = []string{"Content-Type", "Location"} //nolint: gochecknoglobals
+
+// response is a stored response to a request with an idempotency key.
+type response struct {
+	RequestHash string      `json:"requestHash"`
+	StatusCode  int         `json:"statusCode"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	Expires     time.Time   `json:"expires"`
+}
+
+// Keys stores the responses to requests with idempotency keys.
+type Keys struct {
+	store ariesstorage.Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mutex    sync.Mutex
+	inFlight map[string]struct{}
+
+	stopSweep chan struct{}
+	sweepDone chan struct{}
+}
+
+// New returns a new Keys that stores responses in storeProv for the given duration.
+func New(storeProv ariesstorage.Provider, ttl time.Duration) (*Keys, error) {
+	store, err := storeProv.OpenStore(storeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", storeName, err)
+	}
+
+	return &Keys{store: store, ttl: ttl, now: time.Now, inFlight: make(map[string]struct{})}, nil
+}
+
+// TTL returns how long responses are stored.
+func (k *Keys) TTL() time.Duration {
+	return k.ttl
+}
+
+// SweepEvery deletes the expired responses every interval, in the background, until Close is called.
+// Expired responses are also deleted when a request with their key is received.
+func (k *Keys) SweepEvery(interval time.Duration) {
+	k.stopSweep = make(chan struct{})
+	k.sweepDone = make(chan struct{})
+
+	go func() {
+		defer close(k.sweepDone)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := k.Sweep(); err != nil {
+					logger.Warnf("failed to delete expired idempotency keys: %s", err)
+				}
+			case <-k.stopSweep:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the background sweep started by SweepEvery, if any.
+func (k *Keys) Close() error {
+	if k.stopSweep != nil {
+		close(k.stopSweep)
+		<-k.sweepDone
+
+		k.stopSweep = nil
+	}
+
+	return nil
+}
+
+// Sweep deletes the expired responses and returns how many were deleted. Keys of requests that are being processed
+// are skipped.
+func (k *Keys) Sweep() (int, error) {
+	itr := k.store.Iterator(storeKeyPrefix, storeKeyPrefix+ariesstorage.EndKeySuffix)
+	defer itr.Release()
+
+	var expired []string
+
+	for itr.Next() {
+		var stored response
+
+		if err := json.Unmarshal(itr.Value(), &stored); err != nil {
+			logger.Warnf("failed to unmarshal stored response %s: %s", itr.Key(), err)
+
+			continue
+		}
+
+		if k.now().After(stored.Expires) {
+			expired = append(expired, string(itr.Key()))
+		}
+	}
+
+	if err := itr.Error(); err != nil {
+		return 0, fmt.Errorf("failed to iterate over idempotency keys: %w", err)
+	}
+
+	deleted := 0
+
+	for _, storeKey := range expired {
+		ok, err := k.deleteIfExpired(storeKey)
+		if err != nil {
+			return deleted, err
+		}
+
+		if ok {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// deleteIfExpired deletes the response for the key if it's still expired and the key isn't being processed,
+// so that responses stored since the key was found to be expired aren't deleted.
+func (k *Keys) deleteIfExpired(storeKey string) (bool, error) {
+	if !k.begin(storeKey) {
+		return false, nil
+	}
+
+	defer k.end(storeKey)
+
+	stored, err := k.get(storeKey)
+	if err != nil {
+		return false, err
+	}
+
+	// get deletes expired responses, so there is a response only if it was stored again.
+	return stored == nil, nil
+}
+
+// MaxKeyLength returns the maximum length of idempotency keys.
+func (k *Keys) MaxKeyLength() int {
+	return maxKeyLength
+}
+
+// Handler returns a handler that passes requests without an idempotency key on to next. For requests with a key,
+// it returns the stored response to the first request with the key, or passes the request on to next and stores
+// its response. Server errors (5xx) aren't stored, so that the request can be retried.
+// A key can't be used for different requests: requests with a key that was used for a request with a different
+// method, path or body are rejected with 422 Unprocessable Entity.
+func (k *Keys) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(KeyHeader)
+		if key == "" {
+			next(rw, req)
+
+			return
+		}
+
+		if len(key) > maxKeyLength {
+			writeError(rw, http.StatusBadRequest,
+				fmt.Sprintf("idempotency key must not be longer than %d characters", maxKeyLength))
+
+			return
+		}
+
+		requestHash, err := hashRequest(req)
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, fmt.Sprintf("failed to read request: %s", err))
+
+			return
+		}
+
+		storeKey := scopedKey(req.URL.EscapedPath(), key)
+
+		if !k.begin(storeKey) {
+			writeError(rw, http.StatusConflict, "a request with the same idempotency key is being processed")
+
+			return
+		}
+
+		defer k.end(storeKey)
+
+		stored, err := k.get(storeKey)
+		if err != nil {
+			writeError(rw, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		if stored != nil {
+			replay(rw, stored, requestHash, key)
+
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: rw, statusCode: http.StatusOK}
+
+		next(recorder, req)
+
+		if recorder.statusCode >= http.StatusInternalServerError {
+			return
+		}
+
+		k.put(storeKey, &response{
+			RequestHash: requestHash,
+			StatusCode:  recorder.statusCode,
+			Header:      recorder.storedHeader(),
+			Body:        recorder.body.Bytes(),
+			Expires:     k.now().Add(k.ttl),
+		})
+	}
+}
+
+// begin marks the key as being processed. It returns false if the key is already being processed.
+func (k *Keys) begin(storeKey string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if _, found := k.inFlight[storeKey]; found {
+		return false
+	}
+
+	k.inFlight[storeKey] = struct{}{}
+
+	return true
+}
+
+func (k *Keys) end(storeKey string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	delete(k.inFlight, storeKey)
+}
+
+// get returns the stored response for the key, or nil if there's none or it has expired. Expired responses are
+// deleted. The key must be marked as being processed with begin.
+func (k *Keys) get(storeKey string) (*response, error) {
+	responseBytes, err := k.store.Get(storeKey)
+	if err != nil {
+		if errors.Is(err, ariesstorage.ErrDataNotFound) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get idempotency key from db: %w", err)
+	}
+
+	var stored response
+
+	if err := json.Unmarshal(responseBytes, &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored response: %w", err)
+	}
+
+	if k.now().After(stored.Expires) {
+		if err := k.store.Delete(storeKey); err != nil {
+			return nil, fmt.Errorf("failed to delete expired idempotency key from db: %w", err)
+		}
+
+		return nil, nil
+	}
+
+	return &stored, nil
+}
+
+// put stores the response. Failures are only logged, since the request has been processed already.
+func (k *Keys) put(storeKey string, stored *response) {
+	responseBytes, err := json.Marshal(stored)
+	if err != nil {
+		logger.Errorf("failed to marshal response for idempotency key: %s", err)
+
+		return
+	}
+
+	if err := k.store.Put(storeKey, responseBytes); err != nil {
+		logger.Errorf("failed to store response for idempotency key: %s", err)
+	}
+}
+
+// scopedKey returns the store key of an idempotency key. Keys are scoped to the vault (or vault collection) the
+// request targets, so that clients of different vaults can't see each other's responses.
+func scopedKey(escapedPath, key string) string {
+	return url.QueryEscape(escapedPath) + " " + url.QueryEscape(key)
+}
+
+func replay(rw http.ResponseWriter, stored *response, requestHash, key string) {
+	if stored.RequestHash != requestHash {
+		writeError(rw, http.StatusUnprocessableEntity,
+			fmt.Sprintf("idempotency key %s was already used for a different request", key))
+
+		return
+	}
+
+	logger.Debugf("returning stored response for idempotency key %s", key)
+
+	for name, values := range stored.Header {
+		for _, value := range values {
+			rw.Header().Add(name, value)
+		}
+	}
+
+	rw.Header().Set(ReplayedHeader, "true")
+	rw.WriteHeader(stored.StatusCode)
+
+	if _, err := rw.Write(stored.Body); err != nil {
+		logger.Errorf("failed to write stored response: %s", err)
+	}
+}
+
+// hashRequest returns the hash of the request's method and body. The body is restored so that it can be read again.
+func hashRequest(req *http.Request) (string, error) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(req.Method + " ")) //nolint: errcheck // hash writes never fail
+	hash.Write(body)                     //nolint: errcheck // hash writes never fail
+
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil)), nil
+}
+
+func writeError(rw http.ResponseWriter, statusCode int, msg string) {
+	logger.Infof("request with idempotency key rejected: %s", msg)
+
+	if err := support.WriteError(rw, statusCode, nil, msg); err != nil {
+		logger.Errorf("failed to write response: %s", err)
+	}
+}
+
+// responseRecorder records the response written to the wrapped response writer.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader {
+		r.statusCode = statusCode
+		r.wroteHeader = true
+	}
+
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *responseRecorder) storedHeader() http.Header {
+	header := http.Header{}
+
+	for _, name := range storedHeaders {
+		if values := r.Header().Values(name); len(values) > 0 {
+			header[name] = values
+		}
+	}
+
+	return header
+}
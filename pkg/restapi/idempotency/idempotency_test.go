@@ -0,0 +1,371 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package idempotency
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	mockstorage "github.com/hyperledger/aries-framework-go/pkg/mock/storage"
+	ariesstorage "github.com/hyperledger/aries-framework-go/pkg/storage"
+	ariesmemstorage "github.com/hyperledger/aries-framework-go/pkg/storage/mem"
+	"github.com/stretchr/testify/require"
+)
+
+const testPath = "/encrypted-data-vaults/vault1/documents"
+
+func TestNew(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+		require.NotNil(t, keys)
+	})
+
+	t.Run("failed to open store", func(t *testing.T) {
+		keys, err := New(&mockstorage.MockStoreProvider{ErrOpenStoreHandle: errors.New("open error")}, time.Hour)
+		require.EqualError(t, err, "failed to open store idempotency_keys: open error")
+		require.Nil(t, keys)
+	})
+}
+
+func TestKeys_Handler(t *testing.T) {
+	t.Run("response is stored and replayed", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		rr := serve(handler, "key1", "doc1")
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, testPath+"/doc1", rr.Header().Get("Location"))
+		require.Empty(t, rr.Header().Get(ReplayedHeader))
+
+		rr = serve(handler, "key1", "doc1")
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, testPath+"/doc1", rr.Header().Get("Location"))
+		require.Equal(t, "created doc1", rr.Body.String())
+		require.Equal(t, "true", rr.Header().Get(ReplayedHeader))
+		require.Empty(t, rr.Header().Get("X-Not-Stored"))
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("requests without a key aren't stored", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		serve(handler, "", "doc1")
+		rr := serve(handler, "", "doc1")
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("different keys are processed separately", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		serve(handler, "key1", "doc1")
+		serve(handler, "key2", "doc2")
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("client errors are stored", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusConflict)
+
+		serve(handler, "key1", "doc1")
+		rr := serve(handler, "key1", "doc1")
+		require.Equal(t, http.StatusConflict, rr.Code)
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("server errors aren't stored", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusInternalServerError)
+
+		serve(handler, "key1", "doc1")
+		rr := serve(handler, "key1", "doc1")
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("key reused for a different request", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		serve(handler, "key1", "doc1")
+		rr := serve(handler, "key1", "doc2")
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		require.Contains(t, rr.Body.String(), "idempotency key key1 was already used for a different request")
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("key is scoped to the request path", func(t *testing.T) {
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		calls := 0
+
+		handler := keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+			calls++
+
+			rw.WriteHeader(http.StatusCreated)
+		})
+
+		for _, path := range []string{testPath, "/encrypted-data-vaults/vault2/documents"} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("doc1"))
+			req.Header.Set(KeyHeader, "key1")
+
+			handler(httptest.NewRecorder(), req)
+		}
+
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("expired keys are processed again", func(t *testing.T) {
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		calls := 0
+
+		handler := keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+			calls++
+
+			rw.WriteHeader(http.StatusCreated)
+		})
+
+		serve(handler, "key1", "doc1")
+
+		now = now.Add(2 * time.Hour)
+
+		rr := serve(handler, "key1", "doc1")
+		require.Empty(t, rr.Header().Get(ReplayedHeader))
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("expired keys are deleted", func(t *testing.T) {
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		statusCode := http.StatusCreated
+
+		handler := keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(statusCode)
+		})
+
+		serve(handler, "key1", "doc1")
+
+		now = now.Add(2 * time.Hour)
+		statusCode = http.StatusInternalServerError
+
+		serve(handler, "key1", "doc1")
+
+		_, err = keys.store.Get(scopedKey(testPath, "key1"))
+		require.True(t, errors.Is(err, ariesstorage.ErrDataNotFound))
+	})
+
+	t.Run("concurrent request with the same key", func(t *testing.T) {
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		var concurrent *httptest.ResponseRecorder
+
+		var handler http.HandlerFunc
+
+		handler = keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+			concurrent = serve(handler, "key1", "doc1")
+
+			rw.WriteHeader(http.StatusCreated)
+		})
+
+		rr := serve(handler, "key1", "doc1")
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, http.StatusConflict, concurrent.Code)
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		rr := serve(handler, strings.Repeat("k", maxKeyLength+1), "doc1")
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, 0, *calls)
+	})
+
+	t.Run("failed to read request body", func(t *testing.T) {
+		handler, calls := newTestHandler(t, http.StatusCreated)
+
+		req := httptest.NewRequest(http.MethodPost, testPath, &failingReader{})
+		req.Header.Set(KeyHeader, "key1")
+
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, 0, *calls)
+	})
+
+	t.Run("failed to get key from db", func(t *testing.T) {
+		keys, err := New(&mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store: make(map[string][]byte), ErrGet: errors.New("get error"),
+		}}, time.Hour)
+		require.NoError(t, err)
+
+		rr := serve(keys.Handler(func(http.ResponseWriter, *http.Request) {}), "key1", "doc1")
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "failed to get idempotency key from db: get error")
+	})
+
+	t.Run("failed to store response", func(t *testing.T) {
+		keys, err := New(&mockstorage.MockStoreProvider{Store: &mockstorage.MockStore{
+			Store: make(map[string][]byte), ErrPut: errors.New("put error"),
+		}}, time.Hour)
+		require.NoError(t, err)
+
+		rr := serve(keys.Handler(func(rw http.ResponseWriter, _ *http.Request) {
+			rw.WriteHeader(http.StatusCreated)
+		}), "key1", "doc1")
+		require.Equal(t, http.StatusCreated, rr.Code)
+	})
+}
+
+func TestKeys_Sweep(t *testing.T) {
+	newKeys := func(t *testing.T) (*Keys, *time.Time, http.HandlerFunc) {
+		t.Helper()
+
+		keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+		require.NoError(t, err)
+
+		now := time.Now()
+		keys.now = func() time.Time { return now }
+
+		return keys, &now, keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+			rw.WriteHeader(http.StatusCreated)
+		})
+	}
+
+	t.Run("expired keys are deleted", func(t *testing.T) {
+		keys, now, handler := newKeys(t)
+
+		serve(handler, "key1", "doc1")
+
+		*now = now.Add(30 * time.Minute)
+
+		serve(handler, "key2", "doc2")
+
+		*now = now.Add(45 * time.Minute)
+
+		deleted, err := keys.Sweep()
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+
+		_, err = keys.store.Get(scopedKey(testPath, "key1"))
+		require.True(t, errors.Is(err, ariesstorage.ErrDataNotFound))
+
+		_, err = keys.store.Get(scopedKey(testPath, "key2"))
+		require.NoError(t, err)
+
+		rr := serve(handler, "key2", "doc2")
+		require.Equal(t, "true", rr.Header().Get(ReplayedHeader))
+	})
+
+	t.Run("keys being processed are skipped", func(t *testing.T) {
+		keys, now, handler := newKeys(t)
+
+		serve(handler, "key1", "doc1")
+
+		*now = now.Add(2 * time.Hour)
+
+		require.True(t, keys.begin(scopedKey(testPath, "key1")))
+
+		deleted, err := keys.Sweep()
+		require.NoError(t, err)
+		require.Zero(t, deleted)
+
+		keys.end(scopedKey(testPath, "key1"))
+
+		deleted, err = keys.Sweep()
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+	})
+
+	t.Run("failed to delete key", func(t *testing.T) {
+		store := &mockstorage.MockStore{Store: make(map[string][]byte), ErrDelete: errors.New("delete error")}
+
+		keys, err := New(&mockstorage.MockStoreProvider{Store: store}, time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, store.Put(scopedKey(testPath, "key1"), []byte(`{"expires":"2000-01-01T00:00:00Z"}`)))
+
+		rr := serve(keys.Handler(func(http.ResponseWriter, *http.Request) {}), "key1", "doc1")
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Contains(t, rr.Body.String(), "failed to delete expired idempotency key from db: delete error")
+	})
+
+	t.Run("sweep in the background", func(t *testing.T) {
+		keys, now, handler := newKeys(t)
+
+		serve(handler, "key1", "doc1")
+
+		*now = now.Add(2 * time.Hour)
+
+		keys.SweepEvery(time.Millisecond)
+
+		require.Eventually(t, func() bool {
+			_, err := keys.store.Get(scopedKey(testPath, "key1"))
+
+			return errors.Is(err, ariesstorage.ErrDataNotFound)
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, keys.Close())
+		require.NoError(t, keys.Close())
+	})
+}
+
+// newTestHandler returns a handler that writes a response with the given status code for the document in the
+// request body, and a pointer to the number of times it was called.
+func newTestHandler(t *testing.T, statusCode int) (http.HandlerFunc, *int) {
+	t.Helper()
+
+	keys, err := New(ariesmemstorage.NewProvider(), time.Hour)
+	require.NoError(t, err)
+
+	calls := 0
+
+	return keys.Handler(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+
+		rw.Header().Set("Location", testPath+"/"+string(body))
+		rw.Header().Set("X-Not-Stored", "value")
+		rw.WriteHeader(statusCode)
+
+		_, err = rw.Write([]byte("created " + string(body)))
+		require.NoError(t, err)
+	}), &calls
+}
+
+func serve(handler http.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, testPath, strings.NewReader(body))
+
+	if key != "" {
+		req.Header.Set(KeyHeader, key)
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+
+	return rr
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read error")
+}
@@ -0,0 +1,77 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package messages
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error codes are returned in the code field of error responses. Unlike the messages, they're stable,
+// so clients can rely on them to tell errors apart.
+const (
+	// CodeVaultNotFound is the code of ErrVaultNotFound.
+	CodeVaultNotFound = "vault_not_found"
+	// CodeDocumentNotFound is the code of ErrDocumentNotFound.
+	CodeDocumentNotFound = "document_not_found"
+	// CodeDuplicateVault is the code of ErrDuplicateVault.
+	CodeDuplicateVault = "duplicate_vault"
+	// CodeDuplicateDocument is the code of ErrDuplicateDocument.
+	CodeDuplicateDocument = "duplicate_document"
+	// CodeInvalidDocumentID is the code of ErrNotBase58Encoded and ErrNot128BitValue.
+	CodeInvalidDocumentID = "invalid_document_id"
+	// CodeInvalidRequest is used for other 4xx errors.
+	CodeInvalidRequest = "invalid_request"
+	// CodeUnauthorized is used for 401 Unauthorized errors.
+	CodeUnauthorized = "unauthorized"
+	// CodeForbidden is used for 403 Forbidden errors.
+	CodeForbidden = "forbidden"
+	// CodeNotFound is used for 404 Not Found errors that aren't about a vault or document.
+	CodeNotFound = "not_found"
+	// CodeConflict is used for 409 Conflict errors that aren't about a duplicate vault or document.
+	CodeConflict = "conflict"
+	// CodeTooManyRequests is used for 429 Too Many Requests errors.
+	CodeTooManyRequests = "too_many_requests"
+	// CodeInternal is used for 5xx errors.
+	CodeInternal = "internal_error"
+)
+
+// ErrorCode returns the code of the EDV error that err wraps or, if it doesn't wrap one, the code for the status
+// code of the response.
+func ErrorCode(err error, statusCode int) string {
+	switch {
+	case errors.Is(err, ErrVaultNotFound):
+		return CodeVaultNotFound
+	case errors.Is(err, ErrDocumentNotFound):
+		return CodeDocumentNotFound
+	case errors.Is(err, ErrDuplicateVault):
+		return CodeDuplicateVault
+	case errors.Is(err, ErrDuplicateDocument):
+		return CodeDuplicateDocument
+	case errors.Is(err, ErrNotBase58Encoded), errors.Is(err, ErrNot128BitValue):
+		return CodeInvalidDocumentID
+	}
+
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	}
+
+	if statusCode >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+
+	return CodeInvalidRequest
+}
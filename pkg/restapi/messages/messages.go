@@ -79,6 +79,8 @@ Received data: %s`
 	InvalidKEKIDString = "invalid key agreement key ID: %w"
 	// VaultCreationFailure is used when an error prevents a new data vault from being created.
 	VaultCreationFailure = "Failed to create a new data vault: %s."
+	// ControllerProofFailure is used when a data vault creation request isn't signed by the vault's controller.
+	ControllerProofFailure = "Failed to verify that the request was signed by the vault's controller: %s."
 	// MarshalVaultConfigForLogFailure is used when the log level is set to debug and a data vault configuration
 	// fails to marshal back into bytes for logging purposes.
 	MarshalVaultConfigForLogFailure = "Failed to marshal vault config back into bytes for logging purposes: %s."
@@ -196,6 +198,11 @@ Received data: %s`
 	// BatchResponseFailure is used when one or more operations within a batch request fail.
 	BatchResponseFailure = `Failure during batch operation. Vault ID: %s, Request: %s, Response: %s`
 
+	// ExtensionsFailure is used when the list of enabled extensions can't be written.
+	ExtensionsFailure = "Failed to write the enabled extensions: %s."
+	// ConfigurationFailure is used when the server configuration can't be written.
+	ConfigurationFailure = "Failed to write the server configuration: %s."
+
 	// PutLogSpecFailReadRequestBody is used when the incoming request body can't be read.
 	// This should not happen during normal operation.
 	PutLogSpecFailReadRequestBody = "Received request to change the log spec, " +
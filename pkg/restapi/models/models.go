@@ -87,6 +87,25 @@ type VaultOperation struct {
 	EncryptedDocument EncryptedDocument `json:"document,omitempty"` // Only used if Operation=createOrUpdate
 }
 
+// Names of the EDV server extensions, as listed by the extensions endpoint.
+const (
+	ReturnFullDocumentsOnQueryExtension = "ReturnFullDocumentsOnQuery"
+	ReadAllDocumentsExtension           = "ReadAllDocuments"
+	BatchExtension                      = "Batch"
+)
+
+// Extensions lists the extensions that are enabled on an EDV server.
+type Extensions struct {
+	Extensions []string `json:"extensions"`
+}
+
+// ErrorResponse represents the body of an error response.
+// Code is one of the stable error codes defined in the messages package.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 // JSONWebEncryption represents a JWE
 type JSONWebEncryption struct {
 	B64ProtectedHeaders      string                 `json:"protected,omitempty"`
@@ -116,3 +135,56 @@ type RecipientHeaders struct {
 	EPK json.RawMessage `json:"epk,omitempty"`
 	SPK json.RawMessage `json:"spk,omitempty"`
 }
+
+// Names of the optional EDV server features, as listed by the configuration endpoint.
+const (
+	// IdempotencyKeysFeature means that requests that create data vaults and documents are idempotent by their
+	// Idempotency-Key header.
+	IdempotencyKeysFeature = "IdempotencyKeys"
+	// ControllerProofFeature means that data vault creation requests must be signed by the controller of the vault.
+	ControllerProofFeature = "ControllerProof"
+)
+
+// ServerConfiguration describes what an EDV server supports, so that clients can check that it matches their
+// configuration before using it.
+type ServerConfiguration struct {
+	// SpecVersion is the version of the Confidential Storage specification that the server implements.
+	SpecVersion string `json:"specVersion"`
+	// Extensions lists the enabled extensions.
+	Extensions []string `json:"extensions"`
+	// Features lists the enabled optional features.
+	Features []string `json:"features"`
+	// AuthMethods lists the methods requests can be authorized with. It's empty if authorization is disabled.
+	AuthMethods []string         `json:"authMethods"`
+	JWE         JWEConfiguration `json:"jwe"`
+	Limits      Limits           `json:"limits"`
+	// Endpoints lists the endpoints of the server: the EDV REST API, and the endpoints of other services served along
+	// with it (e.g. capabilities, audit logs and health checks).
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// JWEConfiguration describes the JWEs that an EDV server accepts as encrypted documents. Documents are encrypted
+// and decrypted by clients, so any key management algorithm other than the rejected ones is accepted.
+type JWEConfiguration struct {
+	RejectedAlgorithms []string `json:"rejectedAlgorithms"`
+}
+
+// Limits describes the limits that an EDV server enforces on requests.
+type Limits struct {
+	// IDBytes is the number of bytes that base58-encoded document IDs must decode to.
+	IDBytes int `json:"idBytes"`
+	// MaxIdempotencyKeyLength is the maximum length of Idempotency-Key headers, if idempotency keys are enabled.
+	MaxIdempotencyKeyLength int `json:"maxIdempotencyKeyLength,omitempty"`
+	// IdempotencyKeyTTL is how long, in seconds, the responses of idempotent requests are kept, if idempotency keys
+	// are enabled.
+	IdempotencyKeyTTL int64 `json:"idempotencyKeyTTL,omitempty"`
+}
+
+// Endpoint describes an endpoint of an EDV server.
+type Endpoint struct {
+	// Path is the path template of the endpoint, with path variables in braces (e.g. {vaultID}).
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	// Auth is how requests to the endpoint must be authorized (public, vault, document or admin).
+	Auth string `json:"auth"`
+}
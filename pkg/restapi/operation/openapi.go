@@ -16,7 +16,7 @@ import "github.com/trustbloc/edv/pkg/restapi/models"
 // swagger:response genericError
 type genericError struct { // nolint: unused,deadcode
 	// in: body
-	ErrMsg string
+	Body models.ErrorResponse
 }
 
 // createVaultReq model
@@ -73,6 +73,22 @@ type createDocumentRes struct { // nolint: unused,deadcode
 	Location string
 }
 
+// extensionsRes model
+//
+// swagger:response extensionsRes
+type extensionsRes struct { // nolint: unused,deadcode
+	// in: body
+	Body models.Extensions
+}
+
+// configurationRes model
+//
+// swagger:response configurationRes
+type configurationRes struct { // nolint: unused,deadcode
+	// in: body
+	Body models.ServerConfiguration
+}
+
 // readAllDocumentsReq model
 //
 // swagger:parameters readAllDocumentsReq
@@ -7,64 +7,98 @@ SPDX-License-Identifier: Apache-2.0
 package operation
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/storage"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/trustbloc/edv/pkg/auth"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvutils"
 	"github.com/trustbloc/edv/pkg/internal/common/support"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/tracing"
 )
 
 const (
-	logModuleName                   = "restapi"
-	dataVaultConfigurationStoreName = "data_vault_configurations"
+	logModuleName = "restapi"
+	// DataVaultConfigurationStoreName is the name of the store that holds the configurations of the data vaults.
+	// It must exist before the EDV service is used (see CreateConfigStore).
+	DataVaultConfigurationStoreName = "data_vault_configurations"
 
 	edvCommonEndpointPathRoot = "/encrypted-data-vaults"
-	vaultIDPathVariable       = "vaultID"
-	docIDPathVariable         = "docID"
+	// VaultIDPathVariable is the name of the path variable holding the vault ID in vault and document endpoints.
+	VaultIDPathVariable = "vaultID"
+	// DocIDPathVariable is the name of the path variable holding the document ID in document endpoints.
+	DocIDPathVariable = "docID"
+
+	// specVersion is the version of the Confidential Storage specification that this EDV server implements.
+	specVersion = "0.1"
 
 	createVaultEndpoint = edvCommonEndpointPathRoot
 	// TODO (#126): As of writing, the spec shows multiple, conflicting query endpoints.
 	// See: https://github.com/decentralized-identity/secure-data-store/issues/110.
 	// The endpoint listed below is the correct one (per the comment made by one of the spec contributors).
 	// This also matches the one used by Transmute's EDV implementation.
-	queryVaultEndpoint       = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/query"
-	createDocumentEndpoint   = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents"
-	batchEndpoint            = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/batch"
+	queryVaultEndpoint       = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/query"
+	createDocumentEndpoint   = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/documents"
+	batchEndpoint            = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/batch"
+	extensionsEndpoint       = edvCommonEndpointPathRoot + "/extensions"
+	configurationEndpoint    = "/.well-known/edv-configuration"
 	readAllDocumentsEndpoint = createDocumentEndpoint
-	readDocumentEndpoint     = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
-		docIDPathVariable + "}"
-	updateDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
-		docIDPathVariable + "}"
-	deleteDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + vaultIDPathVariable + "}/documents/{" +
-		docIDPathVariable + "}"
+	readDocumentEndpoint     = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/documents/{" +
+		DocIDPathVariable + "}"
+	updateDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/documents/{" +
+		DocIDPathVariable + "}"
+	deleteDocumentEndpoint = edvCommonEndpointPathRoot + "/{" + VaultIDPathVariable + "}/documents/{" +
+		DocIDPathVariable + "}"
 )
 
 var logger = log.New(logModuleName)
 
 // Operation defines handler logic for the EDV service.
 type Operation struct {
-	handlers          []Handler
-	vaultCollection   VaultCollection
-	authEnable        bool
-	authService       authService
-	enabledExtensions *EnabledExtensions
+	handlers           []Handler
+	otherEndpoints     []Handler
+	vaultCollection    VaultCollection
+	authEnable         bool
+	authService        authService
+	controllerVerifier controllerVerifier
+	enabledExtensions  *EnabledExtensions
+	idempotencyKeys    idempotencyKeys
+	authMethods        []string
+	metrics            metrics
 }
 
 type authService interface {
 	Create(resourceID, verificationMethod string) ([]byte, error)
 }
 
+type controllerVerifier interface {
+	VerifyController(req *http.Request, controller string) error
+}
+
+type idempotencyKeys interface {
+	Handler(next http.HandlerFunc) http.HandlerFunc
+	MaxKeyLength() int
+	TTL() time.Duration
+}
+
+type metrics interface {
+	ObserveBatchSize(size int)
+}
+
 // VaultCollection represents EDV storage.
 type VaultCollection struct {
 	provider edvprovider.EDVProvider
@@ -86,10 +120,21 @@ type EnabledExtensions struct {
 
 // Config defines configuration for vcs operations
 type Config struct {
-	Provider          edvprovider.EDVProvider
-	AuthService       authService
-	AuthEnable        bool
-	EnabledExtensions *EnabledExtensions
+	Provider    edvprovider.EDVProvider
+	AuthService authService
+	AuthEnable  bool
+	// ControllerVerifier, if set, is used to check that data vault creation requests are signed
+	// by a key belonging to the controller of the new vault.
+	ControllerVerifier controllerVerifier
+	EnabledExtensions  *EnabledExtensions
+	// IdempotencyKeys, if set, makes the requests that create data vaults and documents (including batches)
+	// idempotent by their Idempotency-Key header.
+	IdempotencyKeys idempotencyKeys
+	// AuthMethods are the names of the methods requests can be authorized with (e.g. zcap, oauth2 or mtls),
+	// as listed by the configuration endpoint.
+	AuthMethods []string
+	// Metrics, if set, records the sizes of batch requests.
+	Metrics metrics
 }
 
 // New returns a new EDV operations instance.
@@ -97,7 +142,9 @@ func New(config *Config) *Operation {
 	svc := &Operation{
 		vaultCollection: VaultCollection{
 			provider: config.Provider,
-		}, authEnable: config.AuthEnable, authService: config.AuthService, enabledExtensions: config.EnabledExtensions,
+		}, authEnable: config.AuthEnable, authService: config.AuthService,
+		controllerVerifier: config.ControllerVerifier, enabledExtensions: config.EnabledExtensions,
+		idempotencyKeys: config.IdempotencyKeys, authMethods: config.AuthMethods, metrics: config.Metrics,
 	}
 
 	svc.registerHandler()
@@ -105,28 +152,94 @@ func New(config *Config) *Operation {
 	return svc
 }
 
+// CreateConfigStore creates the data vault configuration store, if it doesn't exist yet, and its reference ID
+// index, if the provider supports indices.
+func CreateConfigStore(provider edvprovider.EDVProvider) error {
+	err := provider.CreateStore(DataVaultConfigurationStoreName)
+	if err != nil {
+		if errors.Is(err, storage.ErrDuplicateStore) {
+			return nil
+		}
+
+		return err
+	}
+
+	store, err := provider.OpenStore(DataVaultConfigurationStoreName)
+	if err != nil {
+		return err
+	}
+
+	err = store.CreateReferenceIDIndex()
+	if err != nil && !errors.Is(err, edvprovider.ErrIndexingNotSupported) { // The EDV still operates without indices
+		return err
+	}
+
+	return nil
+}
+
 // registerHandler register handlers to be exposed from this service as REST API endpoints.
 func (c *Operation) registerHandler() {
 	// Add more protocol endpoints here to expose them as controller API endpoints
 	c.handlers = []Handler{
-		support.NewHTTPHandler(createVaultEndpoint, http.MethodPost, c.createDataVaultHandler),
-		support.NewHTTPHandler(queryVaultEndpoint, http.MethodPost, c.queryVaultHandler),
-		support.NewHTTPHandler(createDocumentEndpoint, http.MethodPost, c.createDocumentHandler),
-		support.NewHTTPHandler(readDocumentEndpoint, http.MethodGet, c.readDocumentHandler),
-		support.NewHTTPHandler(updateDocumentEndpoint, http.MethodPost, c.updateDocumentHandler),
-		support.NewHTTPHandler(deleteDocumentEndpoint, http.MethodDelete, c.deleteDocumentHandler),
+		support.NewHTTPHandlerWithAuth(createVaultEndpoint, http.MethodPost, c.idempotent(c.createDataVaultHandler),
+			auth.Public),
+		support.NewHTTPHandlerWithAuth(queryVaultEndpoint, http.MethodPost, c.queryVaultHandler, auth.Vault),
+		support.NewHTTPHandlerWithAuth(createDocumentEndpoint, http.MethodPost, c.idempotent(c.createDocumentHandler),
+			auth.Vault),
+		support.NewHTTPHandlerWithAuth(readDocumentEndpoint, http.MethodGet, c.readDocumentHandler, auth.Document),
+		support.NewHTTPHandlerWithAuth(updateDocumentEndpoint, http.MethodPost, c.updateDocumentHandler,
+			auth.Document),
+		support.NewHTTPHandlerWithAuth(deleteDocumentEndpoint, http.MethodDelete, c.deleteDocumentHandler,
+			auth.Document),
+		support.NewHTTPHandlerWithAuth(extensionsEndpoint, http.MethodGet, c.extensionsHandler, auth.Public),
 	}
 	if c.enabledExtensions != nil {
 		if c.enabledExtensions.ReadAllDocumentsEndpoint {
 			c.handlers = append(c.handlers,
-				support.NewHTTPHandler(readAllDocumentsEndpoint, http.MethodGet, c.readAllDocumentsHandler))
+				support.NewHTTPHandlerWithAuth(readAllDocumentsEndpoint, http.MethodGet, c.readAllDocumentsHandler,
+					auth.Vault))
 		}
 
 		if c.enabledExtensions.Batch {
 			c.handlers = append(c.handlers,
-				support.NewHTTPHandler(batchEndpoint, http.MethodPost, c.batchHandler))
+				support.NewHTTPHandlerWithAuth(batchEndpoint, http.MethodPost, c.idempotent(c.batchHandler), auth.Vault))
 		}
 	}
+
+	c.handlers = append(c.handlers,
+		support.NewHTTPHandlerWithAuth(configurationEndpoint, http.MethodGet, c.configurationHandler, auth.Public))
+}
+
+// idempotent makes the handler idempotent by the Idempotency-Key header of requests, if idempotency keys are enabled.
+func (c *Operation) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	if c.idempotencyKeys == nil {
+		return handler
+	}
+
+	return c.idempotencyKeys.Handler(handler)
+}
+
+// extensions returns the names of the enabled extensions.
+func (c *Operation) extensions() []string {
+	extensions := []string{}
+
+	if c.enabledExtensions == nil {
+		return extensions
+	}
+
+	if c.enabledExtensions.ReturnFullDocumentsOnQuery {
+		extensions = append(extensions, models.ReturnFullDocumentsOnQueryExtension)
+	}
+
+	if c.enabledExtensions.ReadAllDocumentsEndpoint {
+		extensions = append(extensions, models.ReadAllDocumentsExtension)
+	}
+
+	if c.enabledExtensions.Batch {
+		extensions = append(extensions, models.BatchExtension)
+	}
+
+	return extensions
 }
 
 // GetRESTHandlers gets all controller API handler available for this service.
@@ -134,6 +247,22 @@ func (c *Operation) GetRESTHandlers() []Handler {
 	return c.handlers
 }
 
+// AddEndpoints adds the endpoints of other services that are served along with this one (e.g. the capability,
+// audit log and health check endpoints) to the endpoints listed by the configuration endpoint.
+func (c *Operation) AddEndpoints(handlers ...Handler) {
+	c.otherEndpoints = append(c.otherEndpoints, handlers...)
+}
+
+// ExpensiveRoutes returns the routes that scan the documents of a vault (queries, batches and reading all documents)
+// as their method and path template, e.g. "POST /encrypted-data-vaults/{vaultID}/query".
+func ExpensiveRoutes() []string {
+	return []string{
+		http.MethodPost + " " + queryVaultEndpoint,
+		http.MethodPost + " " + batchEndpoint,
+		http.MethodGet + " " + readAllDocumentsEndpoint,
+	}
+}
+
 // Create Data Vault swagger:route POST /encrypted-data-vaults createVaultReq
 //
 // Creates a new data vault.
@@ -165,6 +294,17 @@ func (c *Operation) createDataVaultHandler(rw http.ResponseWriter, req *http.Req
 		return
 	}
 
+	if c.controllerVerifier != nil {
+		// The body has already been read, but the verifier needs it to check the digest of the signed request.
+		req.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+
+		err = c.controllerVerifier.VerifyController(req, config.Controller)
+		if err != nil {
+			writeCreateDataVaultControllerProofFailure(rw, err, requestBody)
+			return
+		}
+	}
+
 	var configBytesForLog []byte
 
 	if debugLogLevelEnabled() {
@@ -178,24 +318,24 @@ func (c *Operation) createDataVaultHandler(rw http.ResponseWriter, req *http.Req
 		}
 	}
 
-	c.createDataVault(rw, &config, req.Host, configBytesForLog)
+	c.createDataVault(req.Context(), rw, &config, req.Host, configBytesForLog)
 }
 
-func (c *Operation) createDataVault(rw http.ResponseWriter, config *models.DataVaultConfiguration, hostURL string,
-	configBytesForLog []byte) {
+func (c *Operation) createDataVault(ctx context.Context, rw http.ResponseWriter, config *models.DataVaultConfiguration,
+	hostURL string, configBytesForLog []byte) {
 	vaultID, err := edvutils.GenerateEDVCompatibleID()
 	if err != nil {
 		writeCreateDataVaultFailure(rw, err, configBytesForLog)
 		return
 	}
 
-	err = c.vaultCollection.storeDataVaultConfiguration(config, vaultID)
+	err = c.vaultCollection.storeDataVaultConfiguration(ctx, config, vaultID)
 	if err != nil {
 		writeCreateDataVaultFailure(rw, fmt.Errorf(messages.StoreVaultConfigFailure, err), configBytesForLog)
 		return
 	}
 
-	err = c.vaultCollection.createDataVault(vaultID)
+	err = c.vaultCollection.createDataVault(ctx, vaultID)
 	if err != nil {
 		writeCreateDataVaultFailure(rw, err, configBytesForLog)
 		return
@@ -223,7 +363,7 @@ func (c *Operation) createDataVault(rw http.ResponseWriter, config *models.DataV
 //    default: genericError
 //        200: queryVaultRes
 func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
@@ -259,7 +399,7 @@ func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request)
 		}
 	}
 
-	matchingDocuments, err := c.vaultCollection.queryVault(vaultID, &incomingQuery)
+	matchingDocuments, err := c.vaultCollection.queryVault(req.Context(), vaultID, &incomingQuery)
 	if err != nil {
 		writeErrorWithVaultIDAndReceivedData(rw, http.StatusBadRequest, messages.QueryFailure, err, vaultID, queryBytesForLog)
 		return
@@ -280,7 +420,7 @@ func (c *Operation) queryVaultHandler(rw http.ResponseWriter, req *http.Request)
 //    default: genericError
 //        201: createDocumentRes
 func (c *Operation) createDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
@@ -296,7 +436,82 @@ func (c *Operation) createDocumentHandler(rw http.ResponseWriter, req *http.Requ
 		fmt.Sprintf(messages.CreateDocumentReceiveRequest, vaultID),
 		requestBody)
 
-	c.createDocument(rw, requestBody, req.Host, vaultID)
+	c.createDocument(req.Context(), rw, requestBody, req.Host, vaultID)
+}
+
+// Extensions swagger:route GET /encrypted-data-vaults/extensions extensionsReq
+//
+// Lists the extensions that are enabled on this EDV server, so that clients can tell which features they can use.
+// The same list is part of the server configuration.
+//
+// Responses:
+//    default: genericError
+//        200: extensionsRes
+func (c *Operation) extensionsHandler(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(rw).Encode(models.Extensions{Extensions: c.extensions()})
+	if err != nil {
+		logger.Errorf(messages.ExtensionsFailure, err)
+	}
+}
+
+// Server Configuration swagger:route GET /.well-known/edv-configuration configurationReq
+//
+// Describes what this EDV server supports: the specification version, enabled extensions and features,
+// authorization methods, accepted JWEs, limits and endpoints.
+//
+// Responses:
+//    default: genericError
+//        200: configurationRes
+func (c *Operation) configurationHandler(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(rw).Encode(c.configuration())
+	if err != nil {
+		logger.Errorf(messages.ConfigurationFailure, err)
+	}
+}
+
+// configuration returns the description of this EDV server that is served by the configuration endpoint.
+func (c *Operation) configuration() *models.ServerConfiguration {
+	config := &models.ServerConfiguration{
+		SpecVersion: specVersion,
+		Extensions:  c.extensions(),
+		Features:    []string{},
+		AuthMethods: []string{},
+		JWE:         models.JWEConfiguration{RejectedAlgorithms: edvutils.RejectedJWEAlgorithms()},
+		Limits:      models.Limits{IDBytes: edvutils.IDBytes},
+		Endpoints:   []models.Endpoint{},
+	}
+
+	if c.authEnable {
+		config.AuthMethods = append(config.AuthMethods, c.authMethods...)
+	}
+
+	if c.idempotencyKeys != nil {
+		config.Features = append(config.Features, models.IdempotencyKeysFeature)
+		config.Limits.MaxIdempotencyKeyLength = c.idempotencyKeys.MaxKeyLength()
+		config.Limits.IdempotencyKeyTTL = int64(c.idempotencyKeys.TTL() / time.Second)
+	}
+
+	if c.controllerVerifier != nil {
+		config.Features = append(config.Features, models.ControllerProofFeature)
+	}
+
+	for _, handlers := range [][]Handler{c.handlers, c.otherEndpoints} {
+		for _, handler := range handlers {
+			endpoint := models.Endpoint{Path: handler.Path(), Method: handler.Method(), Auth: auth.Admin.String()}
+
+			if requirer, ok := handler.(interface{ AuthRequirement() auth.Requirement }); ok {
+				endpoint.Auth = requirer.AuthRequirement().String()
+			}
+
+			config.Endpoints = append(config.Endpoints, endpoint)
+		}
+	}
+
+	return config
 }
 
 // Read All Documents swagger:route GET /encrypted-data-vaults/{vaultID}/documents readAllDocumentsReq
@@ -307,14 +522,14 @@ func (c *Operation) createDocumentHandler(rw http.ResponseWriter, req *http.Requ
 //    default: genericError
 //        201: readAllDocumentsRes
 func (c *Operation) readAllDocumentsHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadAllDocumentsReceiveRequest, vaultID))
 
-	allDocuments, err := c.vaultCollection.readAllDocuments(vaultID)
+	allDocuments, err := c.vaultCollection.readAllDocuments(req.Context(), vaultID)
 	if err != nil {
 		writeReadAllDocumentsFailure(rw, err, vaultID)
 		return
@@ -337,19 +552,19 @@ func (c *Operation) readAllDocumentsHandler(rw http.ResponseWriter, req *http.Re
 //    default: genericError
 //        201: readDocumentRes
 func (c *Operation) readDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
+	docID, success := unescapePathVar(DocIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.ReadDocumentReceiveRequest, docID, vaultID))
 
-	documentBytes, err := c.vaultCollection.readDocument(vaultID, docID)
+	documentBytes, err := c.vaultCollection.readDocument(req.Context(), vaultID, docID)
 	if err != nil {
 		writeReadDocumentFailure(rw, err, docID, vaultID)
 		return
@@ -366,12 +581,12 @@ func (c *Operation) readDocumentHandler(rw http.ResponseWriter, req *http.Reques
 //		default: genericError
 // 			200: emptyRes
 func (c *Operation) updateDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
+	docID, success := unescapePathVar(DocIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
@@ -385,7 +600,7 @@ func (c *Operation) updateDocumentHandler(rw http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	c.updateDocument(rw, requestBody, docID, vaultID)
+	c.updateDocument(req.Context(), rw, requestBody, docID, vaultID)
 }
 
 // Delete Document swagger:route DELETE /encrypted-data-vaults/{vaultID}/documents/{docID} deleteDocumentReq
@@ -398,19 +613,19 @@ func (c *Operation) updateDocumentHandler(rw http.ResponseWriter, req *http.Requ
 //			400: emptyRes
 // 			404: emptyRes
 func (c *Operation) deleteDocumentHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
-	docID, success := unescapePathVar(docIDPathVariable, mux.Vars(req), rw)
+	docID, success := unescapePathVar(DocIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
 
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.DeleteDocumentReceiveRequest, docID, vaultID))
 
-	err := c.vaultCollection.deleteDocument(docID, vaultID)
+	err := c.vaultCollection.deleteDocument(req.Context(), docID, vaultID)
 	if err != nil {
 		writeDeleteDocumentFailure(rw, err, docID, vaultID)
 	}
@@ -426,7 +641,7 @@ func (c *Operation) deleteDocumentHandler(rw http.ResponseWriter, req *http.Requ
 //  3. Delete operations are slow because they don't batch with other operations. They force any queued operations
 //     to execute early. Delete operations don't batch with other operations (including other deletes).
 func (c *Operation) batchHandler(rw http.ResponseWriter, req *http.Request) {
-	vaultID, success := unescapePathVar(vaultIDPathVariable, mux.Vars(req), rw)
+	vaultID, success := unescapePathVar(VaultIDPathVariable, mux.Vars(req), rw)
 	if !success {
 		return
 	}
@@ -449,6 +664,10 @@ func (c *Operation) batchHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if c.metrics != nil {
+		c.metrics.ObserveBatchSize(len(incomingBatch))
+	}
+
 	responses := createInitialResponses(len(incomingBatch))
 
 	// Validate everything at the start so we can fail fast if need be
@@ -458,10 +677,10 @@ func (c *Operation) batchHandler(rw http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	c.executeBatchedOperations(rw, req.Host, vaultID, incomingBatch, responses, requestBody)
+	c.executeBatchedOperations(req.Context(), rw, req.Host, vaultID, incomingBatch, responses, requestBody)
 }
 
-func (c *Operation) executeBatchedOperations(rw http.ResponseWriter, host, vaultID string,
+func (c *Operation) executeBatchedOperations(ctx context.Context, rw http.ResponseWriter, host, vaultID string,
 	vaultOperations models.Batch, responses []string, requestBody []byte) {
 	// To improve performance, we gather as many document upsert operations as we can before we hit a
 	// delete operation so that we can insert them into the underlying database in one big bulk operation.
@@ -475,7 +694,7 @@ func (c *Operation) executeBatchedOperations(rw http.ResponseWriter, host, vault
 			currentUpsertDocumentsBatch = append(currentUpsertDocumentsBatch, vaultOperation.EncryptedDocument)
 		case strings.EqualFold(vaultOperation.Operation, models.DeleteDocumentVaultOperation):
 			if len(currentUpsertDocumentsBatch) > 0 {
-				err := c.vaultCollection.upsertDocuments(vaultID, currentUpsertDocumentsBatch)
+				err := c.vaultCollection.upsertDocuments(ctx, vaultID, currentUpsertDocumentsBatch)
 				if err != nil {
 					for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
 						responses[i+numOperationsCompleted] = err.Error()
@@ -496,7 +715,7 @@ func (c *Operation) executeBatchedOperations(rw http.ResponseWriter, host, vault
 				currentUpsertDocumentsBatch = nil // Finished with these documents, start a new batch
 			}
 
-			err := c.vaultCollection.deleteDocument(vaultOperation.DocumentID, vaultID)
+			err := c.vaultCollection.deleteDocument(ctx, vaultOperation.DocumentID, vaultID)
 			if err != nil {
 				responses[vaultOperationIndex] = err.Error()
 				writeBatchResponse(rw, messages.BatchResponseFailure, vaultID, requestBody, responses)
@@ -515,15 +734,15 @@ func (c *Operation) executeBatchedOperations(rw http.ResponseWriter, host, vault
 		}
 	}
 
-	c.upsertRemainingDocuments(rw, host, vaultID, currentUpsertDocumentsBatch, responses, numOperationsCompleted,
+	c.upsertRemainingDocuments(ctx, rw, host, vaultID, currentUpsertDocumentsBatch, responses, numOperationsCompleted,
 		requestBody)
 }
 
-func (c *Operation) upsertRemainingDocuments(rw http.ResponseWriter, host, vaultID string,
+func (c *Operation) upsertRemainingDocuments(ctx context.Context, rw http.ResponseWriter, host, vaultID string,
 	currentUpsertDocumentsBatch []models.EncryptedDocument, responses []string, numOperationsCompleted int,
 	requestBody []byte) {
 	if len(currentUpsertDocumentsBatch) > 0 {
-		err := c.vaultCollection.upsertDocuments(vaultID, currentUpsertDocumentsBatch)
+		err := c.vaultCollection.upsertDocuments(ctx, vaultID, currentUpsertDocumentsBatch)
 		if err != nil {
 			for i := 0; i < len(currentUpsertDocumentsBatch); i++ {
 				responses[i+numOperationsCompleted] = err.Error()
@@ -581,8 +800,26 @@ func validateBatch(incomingBatch models.Batch, responses []string) error {
 	return nil
 }
 
-func (vc *VaultCollection) createDataVault(vaultID string) error {
-	err := vc.provider.CreateStore(vaultID)
+// startSpan starts the span of a VaultCollection method on the given vault.
+func startSpan(ctx context.Context, method, vaultID string) (context.Context, trace.Span) {
+	return tracing.StartSpan(ctx, "VaultCollection."+method, tracing.VaultIDKey.String(vaultID))
+}
+
+// openStore opens the store with the given name, whose calls are then made as part of ctx.
+func (vc *VaultCollection) openStore(ctx context.Context, name string) (edvprovider.EDVStore, error) {
+	store, err := vc.provider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return edvprovider.StoreWithContext(ctx, store), nil
+}
+
+func (vc *VaultCollection) createDataVault(ctx context.Context, vaultID string) (err error) {
+	ctx, span := startSpan(ctx, "createDataVault", vaultID)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	err = vc.provider.CreateStore(vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrDuplicateStore) {
 			return messages.ErrDuplicateVault
@@ -591,7 +828,7 @@ func (vc *VaultCollection) createDataVault(vaultID string) error {
 		return err
 	}
 
-	store, err := vc.provider.OpenStore(vaultID)
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		return err
 	}
@@ -627,8 +864,12 @@ func (vc *VaultCollection) createIndices(store edvprovider.EDVStore) error {
 }
 
 // storeDataVaultConfiguration stores a given DataVaultConfiguration and vaultID
-func (vc *VaultCollection) storeDataVaultConfiguration(config *models.DataVaultConfiguration, vaultID string) error {
-	store, err := vc.provider.OpenStore(dataVaultConfigurationStoreName)
+func (vc *VaultCollection) storeDataVaultConfiguration(ctx context.Context, config *models.DataVaultConfiguration,
+	vaultID string) (err error) {
+	ctx, span := startSpan(ctx, "storeDataVaultConfiguration", vaultID)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, DataVaultConfigurationStoreName)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return errors.New(messages.ConfigStoreNotFound)
@@ -645,7 +886,8 @@ func (vc *VaultCollection) storeDataVaultConfiguration(config *models.DataVaultC
 	return nil
 }
 
-func (c *Operation) createDocument(rw http.ResponseWriter, requestBody []byte, hostURL, vaultID string) {
+func (c *Operation) createDocument(ctx context.Context, rw http.ResponseWriter, requestBody []byte,
+	hostURL, vaultID string) {
 	var incomingDocument models.EncryptedDocument
 
 	err := json.Unmarshal(requestBody, &incomingDocument)
@@ -674,7 +916,7 @@ func (c *Operation) createDocument(rw http.ResponseWriter, requestBody []byte, h
 		return
 	}
 
-	err = c.vaultCollection.createDocument(vaultID, incomingDocument)
+	err = c.vaultCollection.createDocument(ctx, vaultID, incomingDocument)
 	if err != nil {
 		writeCreateDocumentFailure(rw, err, vaultID, docBytesForLog)
 		return
@@ -683,8 +925,14 @@ func (c *Operation) createDocument(rw http.ResponseWriter, requestBody []byte, h
 	writeCreateDocumentSuccess(rw, hostURL, vaultID, incomingDocument.ID, docBytesForLog)
 }
 
-func (vc *VaultCollection) createDocument(vaultID string, document models.EncryptedDocument) error {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) createDocument(ctx context.Context, vaultID string,
+	document models.EncryptedDocument) (err error) {
+	ctx, span := startSpan(ctx, "createDocument", vaultID)
+	span.SetAttributes(tracing.DocumentIDKey.String(document.ID))
+
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return messages.ErrVaultNotFound
@@ -708,8 +956,14 @@ func (vc *VaultCollection) createDocument(vaultID string, document models.Encryp
 	return store.Put(document)
 }
 
-func (vc *VaultCollection) upsertDocuments(vaultID string, documents []models.EncryptedDocument) error {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) upsertDocuments(ctx context.Context, vaultID string,
+	documents []models.EncryptedDocument) (err error) {
+	ctx, span := startSpan(ctx, "upsertDocuments", vaultID)
+	span.SetAttributes(tracing.DocumentsKey.Int(len(documents)))
+
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return messages.ErrVaultNotFound
@@ -721,8 +975,14 @@ func (vc *VaultCollection) upsertDocuments(vaultID string, documents []models.En
 	return store.UpsertBulk(documents)
 }
 
-func (vc *VaultCollection) readAllDocuments(vaultName string) ([][]byte, error) {
-	store, err := vc.provider.OpenStore(vaultName)
+func (vc *VaultCollection) readAllDocuments(ctx context.Context, vaultName string) (documents [][]byte, err error) {
+	ctx, span := startSpan(ctx, "readAllDocuments", vaultName)
+	defer func() {
+		span.SetAttributes(tracing.DocumentsKey.Int(len(documents)))
+		tracing.EndSpan(span, err)
+	}()
+
+	store, err := vc.openStore(ctx, vaultName)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return nil, messages.ErrVaultNotFound
@@ -739,8 +999,13 @@ func (vc *VaultCollection) readAllDocuments(vaultName string) ([][]byte, error)
 	return documentBytes, err
 }
 
-func (vc *VaultCollection) readDocument(vaultID, docID string) ([]byte, error) {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) readDocument(ctx context.Context, vaultID, docID string) (document []byte, err error) {
+	ctx, span := startSpan(ctx, "readDocument", vaultID)
+	span.SetAttributes(tracing.DocumentIDKey.String(docID))
+
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return nil, messages.ErrVaultNotFound
@@ -761,8 +1026,15 @@ func (vc *VaultCollection) readDocument(vaultID, docID string) ([]byte, error) {
 	return documentBytes, err
 }
 
-func (vc *VaultCollection) queryVault(vaultID string, query *models.Query) ([]models.EncryptedDocument, error) {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) queryVault(ctx context.Context, vaultID string,
+	query *models.Query) (documents []models.EncryptedDocument, err error) {
+	ctx, span := startSpan(ctx, "queryVault", vaultID)
+	defer func() {
+		span.SetAttributes(tracing.DocumentsKey.Int(len(documents)))
+		tracing.EndSpan(span, err)
+	}()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return nil, messages.ErrVaultNotFound
@@ -774,7 +1046,8 @@ func (vc *VaultCollection) queryVault(vaultID string, query *models.Query) ([]mo
 	return store.Query(query)
 }
 
-func (c *Operation) updateDocument(rw http.ResponseWriter, requestBody []byte, docID, vaultID string) {
+func (c *Operation) updateDocument(ctx context.Context, rw http.ResponseWriter, requestBody []byte,
+	docID, vaultID string) {
 	var incomingDocument models.EncryptedDocument
 
 	err := json.Unmarshal(requestBody, &incomingDocument)
@@ -794,7 +1067,7 @@ func (c *Operation) updateDocument(rw http.ResponseWriter, requestBody []byte, d
 		return
 	}
 
-	err = c.vaultCollection.updateDocument(docID, vaultID, incomingDocument)
+	err = c.vaultCollection.updateDocument(ctx, docID, vaultID, incomingDocument)
 	if err != nil {
 		writeUpdateDocumentFailure(rw, err, docID, vaultID)
 		return
@@ -803,8 +1076,14 @@ func (c *Operation) updateDocument(rw http.ResponseWriter, requestBody []byte, d
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(messages.UpdateDocumentSuccess, docID, vaultID))
 }
 
-func (vc *VaultCollection) updateDocument(docID, vaultID string, document models.EncryptedDocument) error {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) updateDocument(ctx context.Context, docID, vaultID string,
+	document models.EncryptedDocument) (err error) {
+	ctx, span := startSpan(ctx, "updateDocument", vaultID)
+	span.SetAttributes(tracing.DocumentIDKey.String(docID))
+
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return messages.ErrVaultNotFound
@@ -825,8 +1104,13 @@ func (vc *VaultCollection) updateDocument(docID, vaultID string, document models
 	return store.Update(document)
 }
 
-func (vc *VaultCollection) deleteDocument(docID, vaultID string) error {
-	store, err := vc.provider.OpenStore(vaultID)
+func (vc *VaultCollection) deleteDocument(ctx context.Context, docID, vaultID string) (err error) {
+	ctx, span := startSpan(ctx, "deleteDocument", vaultID)
+	span.SetAttributes(tracing.DocumentIDKey.String(docID))
+
+	defer func() { tracing.EndSpan(span, err) }()
+
+	store, err := vc.openStore(ctx, vaultID)
 	if err != nil {
 		if errors.Is(err, storage.ErrStoreNotFound) {
 			return messages.ErrVaultNotFound
@@ -8,9 +8,11 @@ package operation
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -23,11 +25,19 @@ import (
 	"github.com/trustbloc/edge-core/pkg/log"
 	"github.com/trustbloc/edge-core/pkg/log/mocklogger"
 	"github.com/trustbloc/edge-core/pkg/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/trustbloc/edv/pkg/auth"
 	"github.com/trustbloc/edv/pkg/edvprovider"
 	"github.com/trustbloc/edv/pkg/edvprovider/memedvprovider"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
+	"github.com/trustbloc/edv/pkg/tracing"
 )
 
 const (
@@ -114,7 +124,7 @@ type failingResponseWriter struct {
 }
 
 func (f failingResponseWriter) Header() http.Header {
-	return nil
+	return http.Header{}
 }
 
 func (f failingResponseWriter) Write([]byte) (int, error) {
@@ -172,6 +182,32 @@ type mockEDVProvider struct {
 	numTimesCreateStoreCalledBeforeErr int
 }
 
+// contextRecordingProvider records the contexts its stores are called with.
+type contextRecordingProvider struct {
+	edvprovider.EDVProvider
+	contexts []context.Context
+}
+
+func (p *contextRecordingProvider) OpenStore(name string) (edvprovider.EDVStore, error) {
+	store, err := p.EDVProvider.OpenStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextRecordingStore{EDVStore: store, provider: p}, nil
+}
+
+type contextRecordingStore struct {
+	edvprovider.EDVStore
+	provider *contextRecordingProvider
+}
+
+func (s *contextRecordingStore) WithContext(ctx context.Context) edvprovider.EDVStore {
+	s.provider.contexts = append(s.provider.contexts, ctx)
+
+	return s
+}
+
 func (m *mockEDVProvider) CreateStore(string) error {
 	if m.numTimesCreateStoreCalled == m.numTimesCreateStoreCalledBeforeErr {
 		return m.errCreateStore
@@ -182,6 +218,10 @@ func (m *mockEDVProvider) CreateStore(string) error {
 	return nil
 }
 
+func (m *mockEDVProvider) Close() error {
+	return nil
+}
+
 func (m *mockEDVProvider) OpenStore(string) (edvprovider.EDVStore, error) {
 	if m.numTimesOpenStoreCalled == m.numTimesOpenStoreCalledBeforeErr {
 		return nil, m.errOpenStore
@@ -276,6 +316,27 @@ func TestNew(t *testing.T) {
 	})
 }
 
+func TestExpensiveRoutes(t *testing.T) {
+	require.Equal(t, []string{
+		"POST /encrypted-data-vaults/{vaultID}/query",
+		"POST /encrypted-data-vaults/{vaultID}/batch",
+		"GET /encrypted-data-vaults/{vaultID}/documents",
+	}, ExpensiveRoutes())
+}
+
+func TestNew_IdempotencyKeys(t *testing.T) {
+	idempotencyKeys := &mockIdempotencyKeys{}
+
+	o := New(&Config{
+		Provider: memedvprovider.NewProvider(), IdempotencyKeys: idempotencyKeys,
+		EnabledExtensions: &EnabledExtensions{Batch: true},
+	})
+	require.NotNil(t, o)
+
+	// Vault creation, document creation and batches are idempotent.
+	require.Equal(t, 3, idempotencyKeys.wrapped)
+}
+
 func TestCreateDataVault(t *testing.T) {
 	testValidateIncomingDataVaultConfiguration(t)
 
@@ -312,6 +373,39 @@ func TestCreateDataVault(t *testing.T) {
 		require.Contains(t, rr.Body.String(), "failed to create auth")
 	})
 
+	t.Run("Success: signed by the controller", func(t *testing.T) {
+		verifier := &mockControllerVerifier{}
+		op := New(&Config{Provider: memedvprovider.NewProvider(), ControllerVerifier: verifier})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		createDataVaultExpectSuccess(t, op)
+
+		require.Equal(t, testValidURI, verifier.controller)
+		require.Equal(t, testDataVaultConfiguration, string(verifier.body))
+	})
+
+	t.Run("Not signed by the controller", func(t *testing.T) {
+		op := New(&Config{
+			Provider:           memedvprovider.NewProvider(),
+			ControllerVerifier: &mockControllerVerifier{err: errors.New("key doesn't belong to controller")},
+		})
+
+		createConfigStoreExpectSuccess(t, op)
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(testDataVaultConfiguration)))
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		createVaultEndpointHandler := getHandler(t, op, createVaultEndpoint, http.MethodPost)
+		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Equal(t, fmt.Sprintf(messages.ControllerProofFailure, "key doesn't belong to controller"),
+			errorMessage(t, rr))
+	})
+
 	t.Run("Invalid Data Vault Configuration JSON", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
 
@@ -326,7 +420,7 @@ func TestCreateDataVault(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.InvalidVaultConfig, "unexpected end of JSON input"),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Config store does not exist", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -340,7 +434,7 @@ func TestCreateDataVault(t *testing.T) {
 		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure,
-			fmt.Sprintf(messages.StoreVaultConfigFailure, messages.ConfigStoreNotFound)), rr.Body.String())
+			fmt.Sprintf(messages.StoreVaultConfigFailure, messages.ConfigStoreNotFound)), errorMessage(t, rr))
 		require.Equal(t, http.StatusInternalServerError, rr.Code)
 	})
 	t.Run("Response writer fails while writing request read error", func(t *testing.T) {
@@ -360,11 +454,12 @@ func TestCreateDataVault(t *testing.T) {
 		createDataVaultExpectSuccess(t, op)
 
 		rr := httptest.NewRecorder()
-		op.createDataVault(rr, &models.DataVaultConfiguration{ReferenceID: testReferenceID}, "",
+		op.createDataVault(context.Background(), rr, &models.DataVaultConfiguration{ReferenceID: testReferenceID}, "",
 			nil)
 		require.Equal(t, http.StatusConflict, rr.Code)
 		require.Equal(t, "Failed to create a new data vault: failed to store data vault configuration: "+
-			"an error occurred while querying reference IDs: vault already exists.", rr.Body.String())
+			"an error occurred while querying reference IDs: vault already exists.", errorMessage(t, rr))
+		require.Equal(t, messages.CodeDuplicateVault, errorResponse(t, rr).Code)
 	})
 	t.Run("Other error when creating new store", func(t *testing.T) {
 		errTest := errors.New("some other create store error")
@@ -382,7 +477,7 @@ func TestCreateDataVault(t *testing.T) {
 		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
-		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure, errTest), rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure, errTest), errorMessage(t, rr))
 	})
 	t.Run("Response writer fails while writing duplicate data vault error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -391,7 +486,7 @@ func TestCreateDataVault(t *testing.T) {
 
 		createDataVaultExpectSuccess(t, op)
 
-		op.createDataVault(&failingResponseWriter{},
+		op.createDataVault(context.Background(), &failingResponseWriter{},
 			&models.DataVaultConfiguration{ReferenceID: testReferenceID}, "", nil)
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
@@ -416,7 +511,7 @@ func TestCreateDataVault(t *testing.T) {
 		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure,
-			fmt.Sprintf(messages.StoreVaultConfigFailure, errTest)), rr.Body.String())
+			fmt.Sprintf(messages.StoreVaultConfigFailure, errTest)), errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Fail to store data vault configuration - config vault not found", func(t *testing.T) {
@@ -434,7 +529,7 @@ func TestCreateDataVault(t *testing.T) {
 		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure,
-			fmt.Sprintf(messages.StoreVaultConfigFailure, messages.ConfigStoreNotFound)), rr.Body.String())
+			fmt.Sprintf(messages.StoreVaultConfigFailure, messages.ConfigStoreNotFound)), errorMessage(t, rr))
 		require.Equal(t, http.StatusInternalServerError, rr.Code)
 	})
 	t.Run("Fail to create EDV index", func(t *testing.T) {
@@ -452,7 +547,7 @@ func TestCreateDataVault(t *testing.T) {
 		createVaultEndpointHandler := getHandler(t, op, createVaultEndpoint, http.MethodPost)
 		createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
-		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure, errTest), rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.VaultCreationFailure, errTest), errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 }
@@ -523,7 +618,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -549,7 +644,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -580,7 +675,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -590,7 +685,7 @@ func TestQueryVault(t *testing.T) {
 		queryVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, fmt.Sprintf(messages.QueryFailure, vaultID, memedvprovider.ErrQueryingNotSupported),
-			rr.Body.String())
+			errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Error: vault not found", func(t *testing.T) {
@@ -604,7 +699,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -613,7 +708,7 @@ func TestQueryVault(t *testing.T) {
 		queryVaultEndpointHandler := getHandler(t, op, queryVaultEndpoint, http.MethodPost)
 		queryVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
-		require.Equal(t, fmt.Sprintf(messages.QueryFailure, vaultID, messages.ErrVaultNotFound), rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.QueryFailure, vaultID, messages.ErrVaultNotFound), errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Error: fail to open store", func(t *testing.T) {
@@ -626,7 +721,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -635,7 +730,7 @@ func TestQueryVault(t *testing.T) {
 		queryVaultEndpointHandler := getHandler(t, op, queryVaultEndpoint, http.MethodPost)
 		queryVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
-		require.Equal(t, fmt.Sprintf(messages.QueryFailure, vaultID, testErr), rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.QueryFailure, vaultID, testErr), errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Error when writing response after an error happens while querying vault", func(t *testing.T) {
@@ -649,7 +744,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -670,7 +765,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -680,7 +775,7 @@ func TestQueryVault(t *testing.T) {
 		queryVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t, fmt.Sprintf(messages.InvalidQuery, testVaultID, "unexpected end of JSON input"),
-			rr.Body.String())
+			errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Fail to write response when unable to unmarshal query JSON", func(t *testing.T) {
@@ -690,7 +785,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -707,7 +802,7 @@ func TestQueryVault(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
+		urlVars[VaultIDPathVariable] = "%"
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -717,8 +812,8 @@ func TestQueryVault(t *testing.T) {
 		queryVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t,
-			fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+			fmt.Sprintf(messages.UnescapeFailure, VaultIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Fail to write response when matching documents are found (only IDs returned)", func(t *testing.T) {
@@ -766,7 +861,7 @@ func TestCreateDocument(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -776,7 +871,7 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, testVaultID, "unexpected end of JSON input"),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Document ID is not base58 encoded", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -791,7 +886,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -801,7 +896,7 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, vaultID, messages.ErrNotBase58Encoded),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Document ID was not 128 bits long before being base58 encoded", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -817,7 +912,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -827,7 +922,7 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, vaultID, messages.ErrNot128BitValue),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Empty JWE", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -843,7 +938,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -853,7 +948,7 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.InvalidDocumentForDocCreation, vaultID,
-			fmt.Sprintf(messages.InvalidRawJWE, messages.BlankJWE)), rr.Body.String())
+			fmt.Sprintf(messages.InvalidRawJWE, messages.BlankJWE)), errorMessage(t, rr))
 	})
 	t.Run("Duplicate document", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -870,7 +965,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -879,7 +974,9 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusConflict, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.CreateDocumentFailure, vaultID, messages.ErrDuplicateDocument),
-			rr.Body.String())
+			errorMessage(t, rr))
+		require.Equal(t, messages.CodeDuplicateDocument, errorResponse(t, rr).Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
 	})
 	t.Run("Response writer fails while writing duplicate document error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -890,7 +987,7 @@ func TestCreateDocument(t *testing.T) {
 
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
-		op.createDocument(&failingResponseWriter{}, []byte(testEncryptedDocument), "", vaultID)
+		op.createDocument(context.Background(), &failingResponseWriter{}, []byte(testEncryptedDocument), "", vaultID)
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.CreateDocumentFailure+messages.FailWriteResponse,
@@ -910,7 +1007,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -918,7 +1015,7 @@ func TestCreateDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.CreateDocumentFailure, testVaultID, messages.ErrVaultNotFound),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Unable to escape vault ID path variable", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -929,7 +1026,7 @@ func TestCreateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
+		urlVars[VaultIDPathVariable] = "%"
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -940,8 +1037,8 @@ func TestCreateDocument(t *testing.T) {
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 		require.Equal(t, "", rr.Header().Get("Location"))
 		require.Equal(t,
-			fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+			fmt.Sprintf(messages.UnescapeFailure, VaultIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 	})
 	t.Run("Response writer fails while writing unescape Vault ID error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -956,7 +1053,7 @@ func TestCreateDocument(t *testing.T) {
 			request.WithContext(mockContext{valueToReturnWhenValueMethodCalled: getMapWithVaultIDThatCannotBeEscaped()}))
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
-			fmt.Sprintf(messages.UnescapeFailure+messages.FailWriteResponse, vaultIDPathVariable,
+			fmt.Sprintf(messages.UnescapeFailure+messages.FailWriteResponse, VaultIDPathVariable,
 				errFailingResponseWriter, errFailingResponseWriter))
 	})
 	t.Run("Response writer fails while writing request read error", func(t *testing.T) {
@@ -969,7 +1066,7 @@ func TestCreateDocument(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1003,7 +1100,7 @@ func TestReadAllDocuments(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
+		urlVars[VaultIDPathVariable] = vaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1059,7 +1156,7 @@ Actual document 2: %s`, testEncryptedDocument, testEncryptedDocument2,
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1067,7 +1164,7 @@ Actual document 2: %s`, testEncryptedDocument, testEncryptedDocument2,
 		require.Equal(t, http.StatusNotFound, rr.Code)
 
 		require.Equal(t, fmt.Sprintf(messages.ReadAllDocumentsFailure, testVaultID, messages.ErrVaultNotFound),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Error while getting all docs from store", func(t *testing.T) {
 		errGetAll := errors.New("some get all error")
@@ -1087,7 +1184,7 @@ Actual document 2: %s`, testEncryptedDocument, testEncryptedDocument2,
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1096,7 +1193,7 @@ Actual document 2: %s`, testEncryptedDocument, testEncryptedDocument2,
 
 		require.Equal(t, fmt.Sprintf(messages.ReadAllDocumentsFailure,
 			testVaultID, fmt.Errorf(messages.FailWhileGetAllDocsFromStoreErrMsg, errGetAll).Error()),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Unable to escape vault ID path variable", func(t *testing.T) {
 		op := New(&Config{
@@ -1112,15 +1209,15 @@ Actual document 2: %s`, testEncryptedDocument, testEncryptedDocument2,
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
+		urlVars[VaultIDPathVariable] = "%"
 
 		req = mux.SetURLVars(req, urlVars)
 
 		readAllDocumentsEndpointHandler.Handle().ServeHTTP(rr, req)
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 
-		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, VaultIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 	})
 }
 
@@ -1146,8 +1243,8 @@ func TestReadDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = testVaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1155,7 +1252,8 @@ func TestReadDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusNotFound, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure, testDocID, testVaultID, messages.ErrVaultNotFound),
-			rr.Body.String())
+			errorMessage(t, rr))
+		require.Equal(t, messages.CodeVaultNotFound, errorResponse(t, rr).Code)
 	})
 	t.Run("Document does not exist", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1172,8 +1270,8 @@ func TestReadDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = vaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1181,7 +1279,8 @@ func TestReadDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusNotFound, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure,
-			testDocID, vaultID, messages.ErrDocumentNotFound), rr.Body.String())
+			testDocID, vaultID, messages.ErrDocumentNotFound), errorMessage(t, rr))
+		require.Equal(t, messages.CodeDocumentNotFound, errorResponse(t, rr).Code)
 	})
 	t.Run("Unable to escape vault ID path variable", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1200,8 +1299,8 @@ func TestReadDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = "%"
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1209,8 +1308,8 @@ func TestReadDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 
-		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, VaultIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 	})
 	t.Run("Unable to escape document ID path variable", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1229,8 +1328,8 @@ func TestReadDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = "%"
+		urlVars[VaultIDPathVariable] = vaultID
+		urlVars[DocIDPathVariable] = "%"
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1238,8 +1337,8 @@ func TestReadDocument(t *testing.T) {
 
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 
-		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, docIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+		require.Equal(t, fmt.Sprintf(messages.UnescapeFailure, DocIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 	})
 	t.Run("Response writer fails while writing unescape vault ID error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1257,7 +1356,7 @@ func TestReadDocument(t *testing.T) {
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.UnescapeFailure+messages.FailWriteResponse,
-				vaultIDPathVariable, errFailingResponseWriter, errFailingResponseWriter))
+				VaultIDPathVariable, errFailingResponseWriter, errFailingResponseWriter))
 	})
 	t.Run("Response writer fails while writing unescape document ID error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1275,7 +1374,7 @@ func TestReadDocument(t *testing.T) {
 
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents,
 			fmt.Sprintf(messages.UnescapeFailure+messages.FailWriteResponse,
-				docIDPathVariable, errFailingResponseWriter, errFailingResponseWriter))
+				DocIDPathVariable, errFailingResponseWriter, errFailingResponseWriter))
 	})
 	t.Run("Response writer fails while writing read document error", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1284,8 +1383,8 @@ func TestReadDocument(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = testVaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1323,7 +1422,7 @@ func Test_writeReadAllDocumentsSuccess(t *testing.T) {
 		require.Equal(t, http.StatusInternalServerError, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.FailToMarshalAllDocuments, testVaultID, "json: error calling "+
 			"MarshalJSON for type json.RawMessage: invalid character 'N' looking for beginning of value"),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 }
 
@@ -1345,8 +1444,8 @@ func TestUpdateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = vaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1371,8 +1470,8 @@ func TestUpdateDocument(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = vaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req = mux.SetURLVars(req, urlVars)
 		createDocumentEndpointHandler := getHandler(t, op, updateDocumentEndpoint, http.MethodPost)
@@ -1451,7 +1550,8 @@ func TestUpdateDocument(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
 		createConfigStoreExpectSuccess(t, op)
 
-		op.updateDocument(&failingResponseWriter{}, []byte(testEncryptedDocument), testDocID, testVaultID)
+		op.updateDocument(context.Background(), &failingResponseWriter{}, []byte(testEncryptedDocument), testDocID,
+			testVaultID)
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents, "Failed to update document "+
 			testDocID+" in vault "+testVaultID+": specified vault does not exist.")
 		require.Contains(t, mockLoggerProvider.MockLogger.AllLogContents, errFailingResponseWriter.Error())
@@ -1467,8 +1567,8 @@ func TestDeleteDocument(t *testing.T) {
 		storeEncryptedDocumentExpectSuccess(t, op, testDocID, testEncryptedDocument, vaultID)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = vaultID
-		urlVars[docIDPathVariable] = testDocID
+		urlVars[VaultIDPathVariable] = vaultID
+		urlVars[DocIDPathVariable] = testDocID
 
 		req, err := http.NewRequest("DELETE", "", nil)
 		require.NoError(t, err)
@@ -1490,17 +1590,17 @@ func TestDeleteDocument(t *testing.T) {
 		getDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 		require.Equal(t, http.StatusNotFound, rr.Code)
 		require.Equal(t, fmt.Sprintf(messages.ReadDocumentFailure, testDocID, vaultID, messages.ErrDocumentNotFound),
-			rr.Body.String())
+			errorMessage(t, rr))
 	})
 	t.Run("Failure - unable to escape vault ID path variable", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
 		deleteDocumentExpectError(t, op, "%", testDocID, fmt.Sprintf(messages.UnescapeFailure,
-			vaultIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
+			VaultIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
 	})
 	t.Run("Failure - unable to escape doc ID path variable", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
 		deleteDocumentExpectError(t, op, testVaultID, "%", fmt.Sprintf(messages.UnescapeFailure,
-			docIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
+			DocIDPathVariable, `invalid URL escape "%"`), http.StatusBadRequest)
 	})
 	t.Run("Failure - vault does not exist", func(t *testing.T) {
 		op := New(&Config{Provider: memedvprovider.NewProvider()})
@@ -1538,6 +1638,184 @@ func TestDeleteDocument(t *testing.T) {
 	})
 }
 
+func TestExtensions(t *testing.T) {
+	for name, tc := range map[string]struct {
+		enabledExtensions *EnabledExtensions
+		expected          []string
+	}{
+		"none":         {expected: []string{}},
+		"none enabled": {enabledExtensions: &EnabledExtensions{}, expected: []string{}},
+		"batch":        {enabledExtensions: &EnabledExtensions{Batch: true}, expected: []string{"Batch"}},
+		"all": {
+			enabledExtensions: &EnabledExtensions{
+				ReturnFullDocumentsOnQuery: true, ReadAllDocumentsEndpoint: true, Batch: true,
+			},
+			expected: []string{"ReturnFullDocumentsOnQuery", "ReadAllDocuments", "Batch"},
+		},
+	} {
+		tc := tc
+
+		t.Run(name, func(t *testing.T) {
+			op := New(&Config{Provider: memedvprovider.NewProvider(), EnabledExtensions: tc.enabledExtensions})
+
+			req, err := http.NewRequest(http.MethodGet, "", nil)
+			require.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+
+			getHandler(t, op, extensionsEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+			var extensions models.Extensions
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &extensions))
+			require.Equal(t, tc.expected, extensions.Extensions)
+
+			// The configuration lists the same extensions.
+			rr = httptest.NewRecorder()
+
+			getHandler(t, op, configurationEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var config models.ServerConfiguration
+
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+			require.Equal(t, tc.expected, config.Extensions)
+		})
+	}
+}
+
+func TestConfiguration(t *testing.T) {
+	getConfiguration := func(t *testing.T, op *Operation) *models.ServerConfiguration {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		require.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+
+		getHandler(t, op, configurationEndpoint, http.MethodGet).Handle().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var config models.ServerConfiguration
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &config))
+
+		return &config
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		config := getConfiguration(t, New(&Config{Provider: memedvprovider.NewProvider()}))
+
+		require.Equal(t, "0.1", config.SpecVersion)
+		require.Empty(t, config.Extensions)
+		require.Empty(t, config.Features)
+		require.Empty(t, config.AuthMethods)
+		require.Equal(t, []string{"none"}, config.JWE.RejectedAlgorithms)
+		require.Equal(t, models.Limits{IDBytes: 16}, config.Limits)
+		require.Len(t, config.Endpoints, 8)
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/encrypted-data-vaults", Method: http.MethodPost, Auth: "public",
+		})
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/encrypted-data-vaults/{vaultID}/documents/{docID}", Method: http.MethodGet, Auth: "document",
+		})
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/.well-known/edv-configuration", Method: http.MethodGet, Auth: "public",
+		})
+	})
+
+	t.Run("all enabled", func(t *testing.T) {
+		config := getConfiguration(t, New(&Config{
+			Provider: memedvprovider.NewProvider(), AuthEnable: true, AuthMethods: []string{"zcap", "mtls"},
+			ControllerVerifier: &mockControllerVerifier{}, IdempotencyKeys: &mockIdempotencyKeys{},
+			EnabledExtensions: &EnabledExtensions{
+				ReturnFullDocumentsOnQuery: true, ReadAllDocumentsEndpoint: true, Batch: true,
+			},
+		}))
+
+		require.Equal(t, []string{"ReturnFullDocumentsOnQuery", "ReadAllDocuments", "Batch"}, config.Extensions)
+		require.Equal(t, []string{"IdempotencyKeys", "ControllerProof"}, config.Features)
+		require.Equal(t, []string{"zcap", "mtls"}, config.AuthMethods)
+		require.Equal(t, models.Limits{IDBytes: 16, MaxIdempotencyKeyLength: 255, IdempotencyKeyTTL: 3600},
+			config.Limits)
+		require.Len(t, config.Endpoints, 10)
+		require.Contains(t, config.Endpoints, models.Endpoint{
+			Path: "/encrypted-data-vaults/{vaultID}/batch", Method: http.MethodPost, Auth: "vault",
+		})
+	})
+
+	t.Run("other endpoints", func(t *testing.T) {
+		op := New(&Config{Provider: memedvprovider.NewProvider()})
+
+		op.AddEndpoints(
+			support.NewHTTPHandlerWithAuth("/encrypted-data-vaults/{vaultID}/audit", http.MethodGet, nil,
+				auth.Controller),
+			support.NewHTTPHandlerWithAuth("/healthcheck", http.MethodGet, nil, auth.Public),
+		)
+
+		config := getConfiguration(t, op)
+
+		require.Len(t, config.Endpoints, 10)
+		require.Equal(t, models.Endpoint{
+			Path: "/encrypted-data-vaults/{vaultID}/audit", Method: http.MethodGet, Auth: "controller",
+		}, config.Endpoints[8])
+		require.Equal(t, models.Endpoint{Path: "/healthcheck", Method: http.MethodGet, Auth: "public"},
+			config.Endpoints[9])
+	})
+
+	t.Run("auth methods are ignored while auth is disabled", func(t *testing.T) {
+		config := getConfiguration(t, New(&Config{
+			Provider: memedvprovider.NewProvider(), AuthMethods: []string{"zcap"},
+		}))
+
+		require.Empty(t, config.AuthMethods)
+	})
+}
+
+func TestVaultCollection_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := otel.GetTracerProvider()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(tracerProvider) })
+
+	provider := &contextRecordingProvider{EDVProvider: memedvprovider.NewProvider()}
+	op := New(&Config{Provider: provider})
+
+	createConfigStoreExpectSuccess(t, op)
+
+	vaultID, _ := createDataVaultExpectSuccess(t, op)
+
+	ctx, requestSpan := otel.Tracer("test").Start(context.Background(), "request")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	getHandler(t, op, readDocumentEndpoint, http.MethodGet).Handle().ServeHTTP(rr,
+		mux.SetURLVars(req, map[string]string{VaultIDPathVariable: vaultID, DocIDPathVariable: testDocID}))
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	requestSpan.End()
+
+	spans := recorder.Ended()
+	readDocumentSpan := spans[len(spans)-2]
+
+	require.Equal(t, "VaultCollection.readDocument", readDocumentSpan.Name())
+	require.Equal(t, requestSpan.SpanContext().SpanID(), readDocumentSpan.Parent().SpanID())
+	require.Equal(t, codes.Error, readDocumentSpan.Status().Code)
+	require.Contains(t, readDocumentSpan.Attributes(), tracing.VaultIDKey.String(vaultID))
+	require.Contains(t, readDocumentSpan.Attributes(), tracing.DocumentIDKey.String(testDocID))
+
+	// The store is called as part of the span.
+	storeCtx := provider.contexts[len(provider.contexts)-1]
+	require.Equal(t, readDocumentSpan.SpanContext(), trace.SpanFromContext(storeCtx).SpanContext())
+}
+
 func TestBatch(t *testing.T) {
 	upsertNewDoc1 := models.VaultOperation{
 		Operation:         models.UpsertDocumentVaultOperation,
@@ -1607,6 +1885,27 @@ func TestBatch(t *testing.T) {
 			rr.Body.String())
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
+	t.Run("Success: batch size is recorded", func(t *testing.T) {
+		metrics := &mockMetrics{}
+
+		op := New(&Config{
+			Provider:          memedvprovider.NewProvider(),
+			EnabledExtensions: &EnabledExtensions{Batch: true},
+			Metrics:           metrics,
+		})
+
+		batchBytes, err := json.Marshal(models.Batch{upsertNewDoc1, upsertNewDoc2})
+		require.NoError(t, err)
+
+		req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer(batchBytes))
+		require.NoError(t, err)
+
+		req = mux.SetURLVars(req, map[string]string{VaultIDPathVariable: testVaultID})
+
+		getHandler(t, op, batchEndpoint, http.MethodPost).Handle().ServeHTTP(httptest.NewRecorder(), req)
+
+		require.Equal(t, []int{2}, metrics.batchSizes)
+	})
 	t.Run("Failure: unable to escape vault ID", func(t *testing.T) {
 		op := New(&Config{
 			Provider:          memedvprovider.NewProvider(),
@@ -1617,7 +1916,7 @@ func TestBatch(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = "%"
+		urlVars[VaultIDPathVariable] = "%"
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1627,8 +1926,8 @@ func TestBatch(t *testing.T) {
 		batchEndpointHandler.Handle().ServeHTTP(rr, req)
 
 		require.Equal(t,
-			fmt.Sprintf(messages.UnescapeFailure, vaultIDPathVariable, `invalid URL escape "%"`),
-			rr.Body.String())
+			fmt.Sprintf(messages.UnescapeFailure, VaultIDPathVariable, `invalid URL escape "%"`),
+			errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Failure: unable to marshal request", func(t *testing.T) {
@@ -1641,7 +1940,7 @@ func TestBatch(t *testing.T) {
 		require.NoError(t, err)
 
 		urlVars := make(map[string]string)
-		urlVars[vaultIDPathVariable] = testVaultID
+		urlVars[VaultIDPathVariable] = testVaultID
 
 		req = mux.SetURLVars(req, urlVars)
 
@@ -1653,7 +1952,7 @@ func TestBatch(t *testing.T) {
 		require.Equal(t,
 			fmt.Sprintf(messages.InvalidBatch, testVaultID,
 				"invalid character 'I' looking for beginning of value"),
-			rr.Body.String())
+			errorMessage(t, rr))
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 	t.Run("Failure: delete with a missing document ID", func(t *testing.T) {
@@ -1717,7 +2016,7 @@ func doBatchCall(t *testing.T, batch *models.Batch,
 	require.NoError(t, err)
 
 	urlVars := make(map[string]string)
-	urlVars[vaultIDPathVariable] = vaultID
+	urlVars[VaultIDPathVariable] = vaultID
 
 	req = mux.SetURLVars(req, urlVars)
 
@@ -1737,22 +2036,22 @@ func updateDocumentExpectError(t *testing.T, op *Operation, requestBody []byte,
 	rr := httptest.NewRecorder()
 
 	urlVars := make(map[string]string)
-	urlVars[vaultIDPathVariable] = pathVarVaultID
-	urlVars[docIDPathVariable] = pathVarDocID
+	urlVars[VaultIDPathVariable] = pathVarVaultID
+	urlVars[DocIDPathVariable] = pathVarDocID
 
 	req = mux.SetURLVars(req, urlVars)
 
 	createDocumentEndpointHandler := getHandler(t, op, updateDocumentEndpoint, http.MethodPost)
 	createDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 	require.Equal(t, expectedErrorCode, rr.Code)
-	require.Equal(t, expectedErrorString, rr.Body.String())
+	require.Equal(t, expectedErrorString, errorMessage(t, rr))
 }
 
 func deleteDocumentExpectError(t *testing.T, op *Operation, pathVarVaultID, pathVarDocID, expectedErrorString string,
 	expectedErrorCode int) {
 	urlVars := make(map[string]string)
-	urlVars[vaultIDPathVariable] = pathVarVaultID
-	urlVars[docIDPathVariable] = pathVarDocID
+	urlVars[VaultIDPathVariable] = pathVarVaultID
+	urlVars[DocIDPathVariable] = pathVarDocID
 
 	req, err := http.NewRequest("DELETE", "", nil)
 	require.NoError(t, err)
@@ -1763,16 +2062,16 @@ func deleteDocumentExpectError(t *testing.T, op *Operation, pathVarVaultID, path
 	deleteDocumentEndpointHandler := getHandler(t, op, deleteDocumentEndpoint, http.MethodDelete)
 	deleteDocumentEndpointHandler.Handle().ServeHTTP(rr, req)
 	require.Equal(t, expectedErrorCode, rr.Code)
-	require.Equal(t, expectedErrorString, rr.Body.String())
+	require.Equal(t, expectedErrorString, errorMessage(t, rr))
 }
 
 func createConfigStoreExpectSuccess(t *testing.T, op *Operation) {
-	err := op.vaultCollection.provider.CreateStore(dataVaultConfigurationStoreName)
+	err := op.vaultCollection.provider.CreateStore(DataVaultConfigurationStoreName)
 	require.NoError(t, err)
 }
 
 func storeSampleConfigExpectSuccess(t *testing.T, op *Operation) {
-	store, err := op.vaultCollection.provider.OpenStore(dataVaultConfigurationStoreName)
+	store, err := op.vaultCollection.provider.OpenStore(DataVaultConfigurationStoreName)
 	require.NoError(t, err)
 
 	err = store.StoreDataVaultConfiguration(&models.DataVaultConfiguration{ReferenceID: testReferenceID},
@@ -1780,6 +2079,18 @@ func storeSampleConfigExpectSuccess(t *testing.T, op *Operation) {
 	require.NoError(t, err)
 }
 
+func TestCreateConfigStore(t *testing.T) {
+	provider := memedvprovider.NewProvider()
+
+	require.NoError(t, CreateConfigStore(provider))
+
+	_, err := provider.OpenStore(DataVaultConfigurationStoreName)
+	require.NoError(t, err)
+
+	// The store may already exist.
+	require.NoError(t, CreateConfigStore(provider))
+}
+
 // returns created test vault ID
 func createDataVaultExpectSuccess(t *testing.T, op *Operation) (string, []byte) {
 	req, err := http.NewRequest(http.MethodPost, "", bytes.NewBuffer([]byte(testDataVaultConfiguration)))
@@ -1812,7 +2123,7 @@ func createDataVaultExpectError(t *testing.T, request *models.DataVaultConfigura
 	createVaultEndpointHandler := getHandler(t, op, createVaultEndpoint, http.MethodPost)
 	createVaultEndpointHandler.Handle().ServeHTTP(rr, req)
 
-	require.Equal(t, expectedError, rr.Body.String())
+	require.Equal(t, expectedError, errorMessage(t, rr))
 	require.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
@@ -1824,7 +2135,7 @@ func storeEncryptedDocumentExpectSuccess(t *testing.T, op *Operation, testDocID,
 	rr := httptest.NewRecorder()
 
 	urlVars := make(map[string]string)
-	urlVars[vaultIDPathVariable] = vaultID
+	urlVars[VaultIDPathVariable] = vaultID
 
 	req = mux.SetURLVars(req, urlVars)
 
@@ -1850,8 +2161,8 @@ func readDocumentExpectSuccess(t *testing.T, op *Operation) {
 	rr := httptest.NewRecorder()
 
 	urlVars := make(map[string]string)
-	urlVars[vaultIDPathVariable] = vaultID
-	urlVars[docIDPathVariable] = testDocID
+	urlVars[VaultIDPathVariable] = vaultID
+	urlVars[DocIDPathVariable] = testDocID
 
 	req = mux.SetURLVars(req, urlVars)
 
@@ -1940,3 +2251,66 @@ type mockAuthService struct {
 func (m *mockAuthService) Create(resourceID, verificationMethod string) ([]byte, error) {
 	return m.createValue, m.createErr
 }
+
+type mockIdempotencyKeys struct {
+	wrapped int
+}
+
+func (m *mockIdempotencyKeys) Handler(next http.HandlerFunc) http.HandlerFunc {
+	m.wrapped++
+
+	return next
+}
+
+func (m *mockIdempotencyKeys) MaxKeyLength() int {
+	return 255
+}
+
+func (m *mockIdempotencyKeys) TTL() time.Duration {
+	return time.Hour
+}
+
+type mockMetrics struct {
+	batchSizes []int
+}
+
+func (m *mockMetrics) ObserveBatchSize(size int) {
+	m.batchSizes = append(m.batchSizes, size)
+}
+
+type mockControllerVerifier struct {
+	controller string
+	body       []byte
+	err        error
+}
+
+func (m *mockControllerVerifier) VerifyController(req *http.Request, controller string) error {
+	m.controller = controller
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+
+	m.body = body
+
+	return m.err
+}
+
+// errorMessage returns the message of the error response recorded by rr.
+func errorMessage(t *testing.T, rr *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	return errorResponse(t, rr).Message
+}
+
+func errorResponse(t *testing.T, rr *httptest.ResponseRecorder) models.ErrorResponse {
+	t.Helper()
+
+	var errResponse models.ErrorResponse
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResponse))
+	require.NotEmpty(t, errResponse.Code)
+
+	return errResponse
+}
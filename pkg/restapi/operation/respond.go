@@ -14,6 +14,7 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/trustbloc/edv/pkg/internal/common/support"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 	"github.com/trustbloc/edv/pkg/restapi/models"
 )
@@ -21,9 +22,8 @@ import (
 func writeCreateDataVaultRequestReadFailure(rw http.ResponseWriter, errBodyRead error) {
 	logger.Errorf(messages.CreateVaultFailReadRequestBody, errBodyRead)
 
-	rw.WriteHeader(http.StatusInternalServerError)
-
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.CreateVaultFailReadRequestBody, errBodyRead)))
+	errWrite := support.WriteError(rw, http.StatusInternalServerError, errBodyRead,
+		fmt.Sprintf(messages.CreateVaultFailReadRequestBody, errBodyRead))
 	if errWrite != nil {
 		logger.Errorf(messages.CreateVaultFailReadRequestBody+messages.FailWriteResponse, errBodyRead, errWrite)
 	}
@@ -35,9 +35,8 @@ func writeCreateDataVaultInvalidRequest(rw http.ResponseWriter, errInvalid error
 		fmt.Sprintf(messages.InvalidVaultConfig, errInvalid),
 		receivedConfig)
 
-	rw.WriteHeader(http.StatusBadRequest)
-
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.InvalidVaultConfig, errInvalid)))
+	errWrite := support.WriteError(rw, http.StatusBadRequest, errInvalid,
+		fmt.Sprintf(messages.InvalidVaultConfig, errInvalid))
 	if errWrite != nil {
 		logger.Errorf(messages.InvalidVaultConfig+messages.FailWriteResponse, errInvalid, errWrite)
 		logger.Debugf(messages.DebugLogEventWithReceivedData,
@@ -46,21 +45,38 @@ func writeCreateDataVaultInvalidRequest(rw http.ResponseWriter, errInvalid error
 	}
 }
 
+func writeCreateDataVaultControllerProofFailure(rw http.ResponseWriter, errProof error, receivedConfig []byte) {
+	logger.Errorf(messages.ControllerProofFailure, errProof)
+	logger.Debugf(messages.DebugLogEventWithReceivedData,
+		fmt.Sprintf(messages.ControllerProofFailure, errProof),
+		receivedConfig)
+
+	errWrite := support.WriteError(rw, http.StatusUnauthorized, errProof,
+		fmt.Sprintf(messages.ControllerProofFailure, errProof))
+	if errWrite != nil {
+		logger.Errorf(messages.ControllerProofFailure+messages.FailWriteResponse, errProof, errWrite)
+	}
+}
+
 func writeCreateDataVaultFailure(rw http.ResponseWriter, errVaultCreation error, configBytesForLog []byte) {
 	logger.Errorf(messages.VaultCreationFailure, errVaultCreation)
 	logger.Debugf(messages.DebugLogEventWithReceivedData,
 		fmt.Sprintf(messages.VaultCreationFailure, errVaultCreation), configBytesForLog)
 
+	statusCode := http.StatusBadRequest
+	errCode := errVaultCreation
+
 	switch {
 	case strings.Contains(errVaultCreation.Error(), string(messages.ErrDuplicateVault)):
-		rw.WriteHeader(http.StatusConflict)
+		statusCode = http.StatusConflict
+		// The error may not wrap ErrDuplicateVault, e.g. when the reference ID is a duplicate.
+		errCode = messages.ErrDuplicateVault
 	case strings.Contains(errVaultCreation.Error(), messages.ConfigStoreNotFound):
-		rw.WriteHeader(http.StatusInternalServerError)
-	default:
-		rw.WriteHeader(http.StatusBadRequest)
+		statusCode = http.StatusInternalServerError
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.VaultCreationFailure, errVaultCreation)))
+	errWrite := support.WriteError(rw, statusCode, errCode,
+		fmt.Sprintf(messages.VaultCreationFailure, errVaultCreation))
 	if errWrite != nil {
 		logger.Errorf(messages.VaultCreationFailure+messages.FailWriteResponse, errVaultCreation, errWrite)
 		logger.Debugf(messages.DebugLogEventWithReceivedData,
@@ -154,13 +170,13 @@ func writeCreateDocumentFailure(rw http.ResponseWriter, errCreateDoc error, vaul
 		fmt.Sprintf(messages.CreateDocumentFailure, vaultID, errCreateDoc),
 		docBytesForLog)
 
+	statusCode := http.StatusBadRequest
 	if errCreateDoc == messages.ErrDuplicateDocument {
-		rw.WriteHeader(http.StatusConflict)
-	} else {
-		rw.WriteHeader(http.StatusBadRequest)
+		statusCode = http.StatusConflict
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.CreateDocumentFailure, vaultID, errCreateDoc)))
+	errWrite := support.WriteError(rw, statusCode, errCreateDoc,
+		fmt.Sprintf(messages.CreateDocumentFailure, vaultID, errCreateDoc))
 	if errWrite != nil {
 		logger.Errorf(messages.CreateDocumentFailure+messages.FailWriteResponse, vaultID, errCreateDoc, errWrite)
 		logger.Debugf(messages.DebugLogEventWithReceivedData,
@@ -185,9 +201,7 @@ func writeErrorWithVaultID(rw http.ResponseWriter, statusCode int, message strin
 	logger.Errorf(message, vaultID, err)
 	logger.Debugf(messages.DebugLogEvent, fmt.Sprintf(message, vaultID, err))
 
-	rw.WriteHeader(statusCode)
-
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(message, vaultID, err)))
+	errWrite := support.WriteError(rw, statusCode, err, fmt.Sprintf(message, vaultID, err))
 	if errWrite != nil {
 		logger.Errorf(message+messages.FailWriteResponse, vaultID, err, errWrite)
 		logger.Debugf(messages.DebugLogEvent,
@@ -201,9 +215,7 @@ func writeErrorWithVaultIDAndReceivedData(rw http.ResponseWriter, statusCode int
 	logger.Errorf(message, vaultID, err)
 	logger.Debugf(messages.DebugLogEventWithReceivedData, fmt.Sprintf(message, vaultID, err), receivedData)
 
-	rw.WriteHeader(statusCode)
-
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(message, vaultID, err)))
+	errWrite := support.WriteError(rw, statusCode, err, fmt.Sprintf(message, vaultID, err))
 	if errWrite != nil {
 		logger.Errorf(message+messages.FailWriteResponse, vaultID, err, errWrite)
 		logger.Debugf(messages.DebugLogEventWithReceivedData,
@@ -216,9 +228,7 @@ func writeErrorWithVaultIDAndDocID(rw http.ResponseWriter, statusCode int, messa
 	docID, vaultID string) {
 	logger.Errorf(message, docID, vaultID, err)
 
-	rw.WriteHeader(statusCode)
-
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(message, docID, vaultID, err)))
+	errWrite := support.WriteError(rw, statusCode, err, fmt.Sprintf(message, docID, vaultID, err))
 	if errWrite != nil {
 		logger.Errorf(message+messages.FailWriteResponse, docID, vaultID, err, errWrite)
 	}
@@ -227,13 +237,13 @@ func writeErrorWithVaultIDAndDocID(rw http.ResponseWriter, statusCode int, messa
 func writeReadAllDocumentsFailure(rw http.ResponseWriter, errReadDoc error, vaultID string) {
 	logger.Infof(messages.ReadAllDocumentsFailure, vaultID, errReadDoc)
 
+	statusCode := http.StatusInternalServerError
 	if errors.Is(errReadDoc, messages.ErrVaultNotFound) {
-		rw.WriteHeader(http.StatusNotFound)
-	} else {
-		rw.WriteHeader(http.StatusInternalServerError)
+		statusCode = http.StatusNotFound
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.ReadAllDocumentsFailure, vaultID, errReadDoc)))
+	errWrite := support.WriteError(rw, statusCode, errReadDoc,
+		fmt.Sprintf(messages.ReadAllDocumentsFailure, vaultID, errReadDoc))
 	if errWrite != nil {
 		logger.Errorf(messages.ReadAllDocumentsFailure+messages.FailWriteResponse, vaultID, errReadDoc, errWrite)
 	}
@@ -262,13 +272,13 @@ func writeReadAllDocumentsSuccess(rw http.ResponseWriter, allDocuments []json.Ra
 func writeReadDocumentFailure(rw http.ResponseWriter, errReadDoc error, docID, vaultID string) {
 	logger.Infof(messages.ReadDocumentFailure, docID, vaultID, errReadDoc)
 
+	statusCode := http.StatusBadRequest
 	if errReadDoc == messages.ErrDocumentNotFound || errReadDoc == messages.ErrVaultNotFound {
-		rw.WriteHeader(http.StatusNotFound)
-	} else {
-		rw.WriteHeader(http.StatusBadRequest)
+		statusCode = http.StatusNotFound
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.ReadDocumentFailure, docID, vaultID, errReadDoc)))
+	errWrite := support.WriteError(rw, statusCode, errReadDoc,
+		fmt.Sprintf(messages.ReadDocumentFailure, docID, vaultID, errReadDoc))
 	if errWrite != nil {
 		logger.Errorf(messages.ReadDocumentFailure+messages.FailWriteResponse, docID, vaultID, errReadDoc, errWrite)
 	}
@@ -291,13 +301,13 @@ func writeReadDocumentSuccess(rw http.ResponseWriter, documentBytes []byte, docI
 func writeUpdateDocumentFailure(rw http.ResponseWriter, errUpdateDoc error, docID, vaultID string) {
 	logger.Infof(messages.UpdateDocumentFailure, docID, vaultID, errUpdateDoc)
 
+	statusCode := http.StatusBadRequest
 	if errUpdateDoc == messages.ErrDocumentNotFound || errUpdateDoc == messages.ErrVaultNotFound {
-		rw.WriteHeader(http.StatusNotFound)
-	} else {
-		rw.WriteHeader(http.StatusBadRequest)
+		statusCode = http.StatusNotFound
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.UpdateDocumentFailure, docID, vaultID, errUpdateDoc)))
+	errWrite := support.WriteError(rw, statusCode, errUpdateDoc,
+		fmt.Sprintf(messages.UpdateDocumentFailure, docID, vaultID, errUpdateDoc))
 	if errWrite != nil {
 		logger.Errorf(messages.UpdateDocumentFailure+messages.FailWriteResponse, docID, vaultID, errUpdateDoc, errWrite)
 	}
@@ -306,13 +316,13 @@ func writeUpdateDocumentFailure(rw http.ResponseWriter, errUpdateDoc error, docI
 func writeDeleteDocumentFailure(rw http.ResponseWriter, errDeleteDoc error, docID, vaultID string) {
 	logger.Infof(messages.DeleteDocumentFailure, docID, vaultID, errDeleteDoc)
 
+	statusCode := http.StatusBadRequest
 	if errDeleteDoc == messages.ErrDocumentNotFound || errDeleteDoc == messages.ErrVaultNotFound {
-		rw.WriteHeader(http.StatusNotFound)
-	} else {
-		rw.WriteHeader(http.StatusBadRequest)
+		statusCode = http.StatusNotFound
 	}
 
-	_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.DeleteDocumentFailure, docID, vaultID, errDeleteDoc)))
+	errWrite := support.WriteError(rw, statusCode, errDeleteDoc,
+		fmt.Sprintf(messages.DeleteDocumentFailure, docID, vaultID, errDeleteDoc))
 	if errWrite != nil {
 		logger.Errorf(messages.DeleteDocumentFailure+messages.FailWriteResponse, docID, vaultID, errDeleteDoc, errWrite)
 	}
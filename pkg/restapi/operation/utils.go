@@ -13,6 +13,7 @@ import (
 
 	"github.com/trustbloc/edge-core/pkg/log"
 
+	"github.com/trustbloc/edv/pkg/internal/common/support"
 	"github.com/trustbloc/edv/pkg/restapi/messages"
 )
 
@@ -23,9 +24,8 @@ func unescapePathVar(pathVar string, vars map[string]string, rw http.ResponseWri
 	if errUnescape != nil {
 		logger.Errorf(messages.UnescapeFailure, pathVar, errUnescape)
 
-		rw.WriteHeader(http.StatusBadRequest)
-
-		_, errWrite := rw.Write([]byte(fmt.Sprintf(messages.UnescapeFailure, pathVar, errUnescape)))
+		errWrite := support.WriteError(rw, http.StatusBadRequest, errUnescape,
+			fmt.Sprintf(messages.UnescapeFailure, pathVar, errUnescape))
 		if errWrite != nil {
 			logger.Errorf(messages.UnescapeFailure+messages.FailWriteResponse, pathVar, errWrite, errWrite)
 		}
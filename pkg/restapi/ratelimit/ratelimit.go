@@ -0,0 +1,385 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package ratelimit limits the rate of requests per client IP, authenticated invoker and vault with token buckets.
+// Every client IP, invoker and vault has its own bucket, which holds up to the burst of its budget and refills at its
+// rate. A request takes a token from each of its buckets, and is rejected with 429 Too Many Requests and a
+// Retry-After header if one of them is empty. Expensive routes, such as queries, take tokens from separate buckets
+// with their own budget, so that they can be limited more strictly without limiting the other routes.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/trustbloc/edge-core/pkg/log"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+	"github.com/trustbloc/edv/pkg/restapi/operation"
+)
+
+// Keys that requests can be limited by.
+const (
+	// ClientIPKey limits the requests of each client IP address. The client IP is the address that the request came
+	// from, unless it came from a trusted proxy (see WithTrustedProxies). Behind proxies that aren't trusted, all the
+	// requests that a proxy forwards share the budget of its address.
+	ClientIPKey = "ip"
+	// InvokerKey limits the requests of each authenticated invoker, such as the key ID of the HTTP signature of a zcap
+	// invocation. Requests that aren't authenticated aren't limited by it.
+	InvokerKey = "invoker"
+	// VaultKey limits the requests to each vault.
+	VaultKey = "vault"
+)
+
+const (
+	regularClass   = "regular"
+	expensiveClass = "expensive"
+
+	// sweepInterval is how often buckets that have refilled are removed, so that the buckets of past clients don't
+	// accumulate.
+	sweepInterval = time.Minute
+)
+
+var logger = log.New("edv-ratelimit")
+
+// Budget is the rate at which the requests of a client IP, invoker or vault are allowed, and how many requests it can
+// make at once after being idle.
+type Budget struct {
+	// RequestsPerSecond is the rate at which buckets refill.
+	RequestsPerSecond float64
+	// Burst is the size of buckets.
+	Burst int
+}
+
+// Limiter limits the rate of requests.
+type Limiter struct {
+	budgets         map[string]Budget
+	expensiveRoutes map[string]struct{}
+	keys            map[string]bool
+	trustedProxies  []*net.IPNet
+	now             func() time.Time
+
+	mutex     sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+// Option configures the limiter.
+type Option func(l *Limiter)
+
+// WithExpensiveRoutes gives the routes, as their method and path template (e.g.
+// "POST /encrypted-data-vaults/{vaultID}/query"), their own budget. Without it, all routes share one budget.
+func WithExpensiveRoutes(budget Budget, routes ...string) Option {
+	return func(l *Limiter) {
+		l.budgets[expensiveClass] = budget
+
+		for _, route := range routes {
+			l.expensiveRoutes[route] = struct{}{}
+		}
+	}
+}
+
+// WithKeys sets the keys that requests are limited by: ClientIPKey, InvokerKey and VaultKey. Defaults to all of them.
+func WithKeys(keys ...string) Option {
+	return func(l *Limiter) {
+		l.keys = make(map[string]bool)
+
+		for _, key := range keys {
+			l.keys[key] = true
+		}
+	}
+}
+
+// WithTrustedProxies sets the networks of the reverse proxies (e.g. load balancers) in front of the server. The
+// client IP of requests from these networks is read from their X-Forwarded-For header, or their Forwarded header
+// (RFC 7239) if they don't have one: it's the last address that isn't a trusted proxy. Without trusted proxies, the
+// forwarding headers are ignored, since clients can set them to anything.
+func WithTrustedProxies(networks ...*net.IPNet) Option {
+	return func(l *Limiter) {
+		l.trustedProxies = networks
+	}
+}
+
+// New returns a new Limiter that limits requests to the given budget per key.
+func New(budget Budget, opts ...Option) *Limiter {
+	l := &Limiter{
+		budgets:         map[string]Budget{regularClass: budget},
+		expensiveRoutes: make(map[string]struct{}),
+		keys:            map[string]bool{ClientIPKey: true, InvokerKey: true, VaultKey: true},
+		now:             time.Now,
+		buckets:         make(map[bucketKey]*bucket),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.lastSweep = l.now()
+
+	return l
+}
+
+// ClientMiddleware is a mux middleware that limits requests by client IP. Add it to the router with Use before the
+// auth middleware, so that clients that flood the server are rejected before their requests are authenticated.
+func (l *Limiter) ClientMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The invoker is only known once the auth middleware has handled the request, so it's recorded for
+		// Middleware.
+		r = r.WithContext(auth.WithInvokerRecorder(r.Context()))
+
+		if l.keys[ClientIPKey] && !l.allow(w, r, bucketKey{kind: ClientIPKey, value: l.clientIP(r)}) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware is a mux middleware that limits requests by authenticated invoker and by vault. Add it to the router with
+// Use after ClientMiddleware and the auth middleware, so that requests that aren't authorized don't use up the budget
+// of the invoker or vault they claim.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var keys []bucketKey
+
+		if invoker := auth.Invoker(r.Context()); l.keys[InvokerKey] && invoker != "" {
+			keys = append(keys, bucketKey{kind: InvokerKey, value: invoker})
+		}
+
+		if vaultID := vaultID(r); l.keys[VaultKey] && vaultID != "" {
+			keys = append(keys, bucketKey{kind: VaultKey, value: vaultID})
+		}
+
+		if len(keys) > 0 && !l.allow(w, r, keys...) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the buckets of the keys for the class of the request's route. If one of them is empty, no
+// tokens are taken, and the request is rejected.
+func (l *Limiter) allow(w http.ResponseWriter, r *http.Request, keys ...bucketKey) bool {
+	class := regularClass
+	if _, expensive := l.expensiveRoutes[r.Method+" "+routeTemplate(r)]; expensive {
+		class = expensiveClass
+	}
+
+	budget := l.budgets[class]
+
+	retryAfter, limitedKey := l.take(class, budget, keys)
+	if retryAfter == 0 {
+		return true
+	}
+
+	logger.Debugf("rate limited %s %s of %s %q", r.Method, r.URL.Path, limitedKey.kind, limitedKey.value)
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	err := support.WriteError(w, http.StatusTooManyRequests, nil,
+		fmt.Sprintf("too many requests for %s, retry after %s", limitedKey.kind, retryAfter.Round(time.Second)))
+	if err != nil {
+		logger.Errorf("failed to write response: %s", err)
+	}
+
+	return false
+}
+
+// take takes a token from each bucket, or returns how long it takes until the first empty bucket has a token.
+func (l *Limiter) take(class string, budget Budget, keys []bucketKey) (time.Duration, bucketKey) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	buckets := make([]*bucket, len(keys))
+
+	for i, key := range keys {
+		key.class = class
+
+		b, found := l.buckets[key]
+		if !found {
+			b = &bucket{tokens: float64(budget.Burst), updated: now}
+			l.buckets[key] = b
+		}
+
+		b.refill(now, budget)
+
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / budget.RequestsPerSecond * float64(time.Second))
+
+			// Retry-After is in whole seconds, so clients are told to wait at least a second.
+			if wait < time.Second {
+				wait = time.Second
+			}
+
+			return wait, key
+		}
+
+		buckets[i] = b
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+
+	return 0, bucketKey{}
+}
+
+// sweep removes the buckets that are full, since they're the same as new buckets.
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		budget := l.budgets[key.class]
+
+		b.refill(now, budget)
+
+		if b.tokens >= float64(budget.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+
+	l.lastSweep = now
+}
+
+type bucketKey struct {
+	class string
+	kind  string
+	value string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (b *bucket) refill(now time.Time, budget Budget) {
+	if !now.After(b.updated) {
+		return
+	}
+
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+now.Sub(b.updated).Seconds()*budget.RequestsPerSecond)
+	b.updated = now
+}
+
+// clientIP returns the IP address of the client, without the port. If the request came from a trusted proxy, it's
+// the last forwarded address that isn't a trusted proxy.
+func (l *Limiter) clientIP(r *http.Request) string {
+	ip := hostIP(r.RemoteAddr)
+	if !l.isTrustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := forwardedFor(r)
+
+	// Proxies append the address they received the request from, so the first ones may have been set by the client.
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip = hostIP(forwarded[i])
+		if !l.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+func (l *Limiter) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range l.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardedFor returns the addresses that the request was forwarded for, from its X-Forwarded-For header or, if it
+// doesn't have one, the for parameters of its Forwarded header.
+func forwardedFor(r *http.Request) []string {
+	var addresses []string
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		for _, value := range values {
+			for _, address := range strings.Split(value, ",") {
+				addresses = append(addresses, strings.TrimSpace(address))
+			}
+		}
+
+		return addresses
+	}
+
+	for _, value := range r.Header.Values("Forwarded") {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, address := splitPair(pair)
+				if strings.EqualFold(name, "for") {
+					addresses = append(addresses, strings.Trim(address, `"`))
+				}
+			}
+		}
+	}
+
+	return addresses
+}
+
+func splitPair(pair string) (string, string) {
+	i := strings.Index(pair, "=")
+	if i < 0 {
+		return strings.TrimSpace(pair), ""
+	}
+
+	return strings.TrimSpace(pair[:i]), strings.TrimSpace(pair[i+1:])
+}
+
+// hostIP returns the IP address of an address that may have a port, e.g. 192.0.2.1:8080 or [2001:db8::1]:8080.
+func hostIP(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	}
+
+	return host
+}
+
+// vaultID returns the unescaped ID of the vault of the request's route, so that the same vault can't be requested
+// with differently escaped IDs to get around its budget.
+func vaultID(r *http.Request) string {
+	vaultID := mux.Vars(r)[operation.VaultIDPathVariable]
+
+	if unescaped, err := url.PathUnescape(vaultID); err == nil {
+		return unescaped
+	}
+
+	return vaultID
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return r.URL.Path
+}
@@ -0,0 +1,237 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package ratelimit
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/trustbloc/edv/pkg/auth"
+	"github.com/trustbloc/edv/pkg/restapi/messages"
+	"github.com/trustbloc/edv/pkg/restapi/models"
+)
+
+const (
+	queryRoute = "/encrypted-data-vaults/{vaultID}/query"
+	docRoute   = "/encrypted-data-vaults/{vaultID}/documents/{docID}"
+)
+
+type testServer struct {
+	handler http.Handler
+	now     time.Time
+}
+
+// newTestServer returns a router that limits requests with the limiter. Requests are authenticated as the invoker in
+// their X-Invoker header.
+func newTestServer(budget Budget, opts ...Option) (*testServer, *Limiter) {
+	limiter := New(budget, opts...)
+	s := &testServer{now: time.Now()}
+	limiter.now = func() time.Time { return s.now }
+
+	router := mux.NewRouter()
+	router.Use(limiter.ClientMiddleware)
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			auth.SetInvoker(r.Context(), r.Header.Get("X-Invoker"))
+			next.ServeHTTP(w, r)
+		})
+	})
+	router.Use(limiter.Middleware)
+
+	ok := func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }
+	router.HandleFunc(queryRoute, ok).Methods(http.MethodPost)
+	router.HandleFunc(docRoute, ok).Methods(http.MethodGet)
+
+	s.handler = router
+
+	return s, limiter
+}
+
+func (s *testServer) request(method, path, ip, invoker string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":12345"
+	req.Header.Set("X-Invoker", invoker)
+
+	rr := httptest.NewRecorder()
+	s.handler.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func (s *testServer) getDoc(vaultID, ip, invoker string) int {
+	return s.request(http.MethodGet, "/encrypted-data-vaults/"+vaultID+"/documents/doc1", ip, invoker).Code
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("limits requests by client IP", func(t *testing.T) {
+		s, _ := newTestServer(Budget{RequestsPerSecond: 1, Burst: 2}, WithKeys(ClientIPKey))
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+		require.Equal(t, http.StatusOK, s.getDoc("vault2", "192.0.2.1", ""))
+
+		rr := s.request(http.MethodGet, "/encrypted-data-vaults/vault3/documents/doc1", "192.0.2.1", "")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+		var errResp models.ErrorResponse
+
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &errResp))
+		require.Equal(t, messages.CodeTooManyRequests, errResp.Code)
+		require.Equal(t, "too many requests for ip, retry after 1s", errResp.Message)
+
+		// Other clients have their own budget.
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.2", ""))
+
+		s.now = s.now.Add(time.Second)
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+		require.Equal(t, http.StatusTooManyRequests, s.getDoc("vault1", "192.0.2.1", ""))
+	})
+
+	t.Run("limits requests by invoker", func(t *testing.T) {
+		s, _ := newTestServer(Budget{RequestsPerSecond: 1, Burst: 1}, WithKeys(InvokerKey))
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", "did:example:alice#key1"))
+		require.Equal(t, http.StatusTooManyRequests, s.getDoc("vault2", "192.0.2.2", "did:example:alice#key1"))
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", "did:example:bob#key1"))
+
+		// Requests that aren't authenticated aren't limited by invoker.
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+	})
+
+	t.Run("limits requests by vault", func(t *testing.T) {
+		s, _ := newTestServer(Budget{RequestsPerSecond: 0.1, Burst: 1}, WithKeys(VaultKey))
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", "did:example:alice#key1"))
+
+		rr := s.request(http.MethodGet, "/encrypted-data-vaults/vault1/documents/doc1", "192.0.2.2",
+			"did:example:bob#key1")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "10", rr.Header().Get("Retry-After"))
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault2", "192.0.2.1", "did:example:alice#key1"))
+
+		// Escaping the vault ID doesn't get around the vault's budget.
+		require.Equal(t, http.StatusTooManyRequests, s.getDoc("v%61ult1", "192.0.2.1", "did:example:alice#key1"))
+	})
+
+	t.Run("rejected requests don't take tokens", func(t *testing.T) {
+		s, _ := newTestServer(Budget{RequestsPerSecond: 1, Burst: 1}, WithKeys(InvokerKey, VaultKey))
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", "did:example:alice#key1"))
+		require.Equal(t, http.StatusTooManyRequests, s.getDoc("vault1", "192.0.2.1", "did:example:bob#key1"))
+
+		// Bob's request was rejected because of the vault's budget, so Bob's budget is untouched.
+		require.Equal(t, http.StatusOK, s.getDoc("vault2", "192.0.2.1", "did:example:bob#key1"))
+	})
+
+	t.Run("expensive routes have their own budget", func(t *testing.T) {
+		s, _ := newTestServer(Budget{RequestsPerSecond: 1, Burst: 2},
+			WithExpensiveRoutes(Budget{RequestsPerSecond: 1, Burst: 1}, "POST "+queryRoute))
+
+		query := func() int {
+			return s.request(http.MethodPost, "/encrypted-data-vaults/vault1/query", "192.0.2.1", "").Code
+		}
+
+		require.Equal(t, http.StatusOK, query())
+		require.Equal(t, http.StatusTooManyRequests, query())
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", ""))
+		require.Equal(t, http.StatusTooManyRequests, s.getDoc("vault1", "192.0.2.1", ""))
+	})
+
+	t.Run("removes refilled buckets", func(t *testing.T) {
+		s, limiter := newTestServer(Budget{RequestsPerSecond: 1, Burst: 10})
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault1", "192.0.2.1", "did:example:alice#key1"))
+		require.Len(t, limiter.buckets, 3)
+
+		s.now = s.now.Add(sweepInterval)
+
+		require.Equal(t, http.StatusOK, s.getDoc("vault2", "192.0.2.2", ""))
+		require.Len(t, limiter.buckets, 2)
+	})
+}
+
+func TestClientIP(t *testing.T) {
+	limiter := New(Budget{RequestsPerSecond: 1, Burst: 1})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	req.RemoteAddr = "[2001:db8::1]:12345"
+	require.Equal(t, "2001:db8::1", limiter.clientIP(req))
+
+	req.RemoteAddr = "192.0.2.1"
+	require.Equal(t, "192.0.2.1", limiter.clientIP(req))
+
+	t.Run("forwarding headers are ignored without trusted proxies", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", "192.0.2.1")
+
+		require.Equal(t, "10.0.0.1", limiter.clientIP(req))
+	})
+
+	t.Run("trusted proxies", func(t *testing.T) {
+		_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+		require.NoError(t, err)
+
+		limiter := New(Budget{RequestsPerSecond: 1, Burst: 1}, WithTrustedProxies(proxies))
+
+		for _, tc := range []struct {
+			name       string
+			remoteAddr string
+			headers    map[string][]string
+			expected   string
+		}{
+			{name: "X-Forwarded-For", remoteAddr: "10.0.0.1:12345",
+				headers:  map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+				expected: "192.0.2.1"},
+			{name: "X-Forwarded-For with addresses set by the client", remoteAddr: "10.0.0.1:12345",
+				headers:  map[string][]string{"X-Forwarded-For": {"198.51.100.1, 192.0.2.1, 10.0.0.2"}},
+				expected: "192.0.2.1"},
+			{name: "X-Forwarded-For in multiple headers", remoteAddr: "10.0.0.1:12345",
+				headers:  map[string][]string{"X-Forwarded-For": {"198.51.100.1", "192.0.2.1"}},
+				expected: "192.0.2.1"},
+			{name: "Forwarded", remoteAddr: "10.0.0.1:12345",
+				headers:  map[string][]string{"Forwarded": {`for=198.51.100.1, for="[2001:db8::1]:4711";proto=https`}},
+				expected: "2001:db8::1"},
+			{name: "X-Forwarded-For takes precedence over Forwarded", remoteAddr: "10.0.0.1:12345",
+				headers: map[string][]string{
+					"X-Forwarded-For": {"192.0.2.1"}, "Forwarded": {"for=198.51.100.1"},
+				},
+				expected: "192.0.2.1"},
+			{name: "only trusted proxies", remoteAddr: "10.0.0.1:12345",
+				headers:  map[string][]string{"X-Forwarded-For": {"10.0.0.2"}},
+				expected: "10.0.0.2"},
+			{name: "without forwarding headers", remoteAddr: "10.0.0.1:12345", expected: "10.0.0.1"},
+			{name: "request not from a trusted proxy", remoteAddr: "198.51.100.1:12345",
+				headers:  map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+				expected: "198.51.100.1"},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+
+			for name, values := range tc.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+
+			require.Equal(t, tc.expected, limiter.clientIP(req), tc.name)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trustbloc/edv/pkg/internal/common/support"
+)
+
+const serverName = "edv"
+
+// Middleware is a mux middleware that handles each request in a server span, which continues the trace of the
+// client if the request has trace context headers (e.g. W3C traceparent). Spans are named by the path template of
+// the route (e.g. /encrypted-data-vaults/{vaultID}/documents). Add it to the router with Use before the auth
+// middleware, so that zcap verification is traced as part of the request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		ctx, span := otel.Tracer(instrumentationName).Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(serverName, route, r)...))
+		defer span.End()
+
+		recorder := support.NewStatusRecorder(w)
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.StatusCode())...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(recorder.StatusCode()))
+	})
+}
@@ -0,0 +1,52 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package tracing traces EDV server requests with OpenTelemetry. Spans are created with the global tracer provider
+// and propagated with the global propagator, which are both no-ops unless set with otel.SetTracerProvider and
+// otel.SetTextMapPropagator.
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/trustbloc/edv"
+
+// Span attributes.
+const (
+	VaultIDKey    = attribute.Key("edv.vault_id")
+	DocumentIDKey = attribute.Key("edv.document_id")
+	DocumentsKey  = attribute.Key("edv.documents")
+)
+
+// StartSpan starts a span with the given name and attributes, as a child of the span in ctx (if any).
+// The returned context holds the new span, which must be ended with EndSpan.
+func StartSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	// The tracer is looked up on every call, so that spans go to the current global tracer provider.
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartClientSpan starts a span like StartSpan, for a call to a remote service such as a database.
+func StartClientSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context,
+	trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...))
+}
+
+// EndSpan ends the given span, recording err (if not nil) as its error.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,132 @@
+/*
+Copyright SecureKey Technologies Inc. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestStartSpan(t *testing.T) {
+	recorder := recordSpans(t)
+
+	ctx, parent := StartSpan(context.Background(), "parent", VaultIDKey.String("vault"))
+	_, child := StartClientSpan(ctx, "child")
+
+	EndSpan(child, errors.New("child failed"))
+	EndSpan(parent, nil)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+
+	require.Equal(t, "child", spans[0].Name())
+	require.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Equal(t, "child failed", spans[0].Status().Description)
+	require.Len(t, spans[0].Events(), 1)
+	require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+	require.Equal(t, "parent", spans[1].Name())
+	require.Equal(t, codes.Unset, spans[1].Status().Code)
+	require.Contains(t, spans[1].Attributes(), VaultIDKey.String("vault"))
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/encrypted-data-vaults/{vaultID}/documents", func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartSpan(r.Context(), "handler")
+		span.End()
+
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("documents")) //nolint: errcheck
+	}).Methods(http.MethodGet)
+
+	t.Run("continues the trace of the client", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/v1/documents", nil)
+		req.Header.Set("traceparent", testTraceParent)
+
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+
+		handlerSpan, serverSpan := spans[0], spans[1]
+
+		require.Equal(t, "/encrypted-data-vaults/{vaultID}/documents", serverSpan.Name())
+		require.Equal(t, trace.SpanKindServer, serverSpan.SpanKind())
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext().TraceID().String())
+		require.Equal(t, "00f067aa0ba902b7", serverSpan.Parent().SpanID().String())
+		require.True(t, serverSpan.Parent().IsRemote())
+		require.Contains(t, serverSpan.Attributes(), attribute.Int("http.status_code", http.StatusOK))
+		require.Equal(t, codes.Unset, serverSpan.Status().Code)
+
+		require.Equal(t, serverSpan.SpanContext().SpanID(), handlerSpan.Parent().SpanID())
+	})
+
+	t.Run("server error", func(t *testing.T) {
+		router.ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/encrypted-data-vaults/v1/documents?fail=true", nil))
+
+		spans := recorder.Ended()
+		serverSpan := spans[len(spans)-1]
+
+		require.False(t, serverSpan.Parent().IsValid())
+		require.Contains(t, serverSpan.Attributes(), attribute.Int("http.status_code", http.StatusInternalServerError))
+		require.Equal(t, codes.Error, serverSpan.Status().Code)
+	})
+
+	t.Run("without route", func(t *testing.T) {
+		Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		spans := recorder.Ended()
+		require.Equal(t, "unknown", spans[len(spans)-1].Name())
+	})
+}
+
+// recordSpans sets a global tracer provider and propagator for the duration of the test, and returns the recorder
+// of the spans.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	propagator := otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	return recorder
+}
@@ -32,3 +32,11 @@ PKGS=`go list github.com/trustbloc/edv/cmd/edv-rest/... 2> /dev/null | \
 go test $PKGS -count=1 -race -coverprofile=profile.out -covermode=atomic -timeout=10m
 amend_coverage_file
 cd "$pwd"
+
+# Running edv-cli unit tests
+cd cmd/edv-cli
+PKGS=`go list github.com/trustbloc/edv/cmd/edv-cli/... 2> /dev/null | \
+                                                 grep -v /mocks`
+go test $PKGS -count=1 -race -coverprofile=profile.out -covermode=atomic -timeout=10m
+amend_coverage_file
+cd "$pwd"
@@ -14,3 +14,5 @@ Feature: health check
     Examples:
       | url                                            | respKey       | respKeyVal                                      |
       | https://localhost:8080/healthcheck              | status        | success                                         |
+      | https://localhost:8080/healthcheck/live         | status        | success                                         |
+      | https://localhost:8080/healthcheck/ready        | status        | success                                         |